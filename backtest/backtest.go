@@ -0,0 +1,122 @@
+// Package backtest runs a strategy over stored or recorded market data.
+// The events of a Source drive a strategy.Runner that trades on a paper.Exchange,
+// both use a simulated clock that follows the time of the events.
+package backtest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/resc/rescbits/paper"
+	"github.com/resc/rescbits/strategy"
+)
+
+// DefaultInterval is the default simulated time between timer ticks
+const DefaultInterval = time.Minute
+
+type (
+	// Config configures a backtest
+	Config struct {
+		// Paper configures the simulated exchange, its market is the market of the backtest and its clock is ignored
+		Paper paper.Config
+		// Limits are the risk limits of the runner
+		Limits strategy.Limits
+		// Interval is the simulated time between timer ticks, the equity curve has a point for every tick
+		Interval time.Duration
+	}
+)
+
+// Run feeds the events of the source to the strategy until the source is exhausted or ctx is done, and reports the results.
+// The open orders are cancelled at the end, the position is kept and valued at the last price.
+func Run(ctx context.Context, s strategy.Strategy, src Source, c Config) (*Report, error) {
+	if s == nil || src == nil {
+		return nil, errors.New("a backtest needs a strategy and a source")
+	}
+	if c.Interval == 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.Interval < 0 {
+		return nil, errors.New("the interval should be positive")
+	}
+
+	var now time.Time
+	clock := func() time.Time { return now }
+	c.Paper.Clock = clock
+	exchange, err := paper.NewExchange(c.Paper)
+	if err != nil {
+		return nil, err
+	}
+	runner, err := strategy.NewRunner(s, exchange, exchange.Market(), c.Limits)
+	if err != nil {
+		return nil, err
+	}
+	runner.SetClock(clock)
+
+	report := &Report{
+		Strategy: s.Name(),
+		Market:   exchange.Market(),
+		Interval: c.Interval,
+	}
+	var next time.Time
+	tick := func() {
+		runner.HandleTimer(ctx)
+		report.EquityCurve = append(report.EquityCurve, EquityPoint{Time: now, Equity: exchange.Equity()})
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		e, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if report.Events == 0 {
+			report.Start = e.Time
+			next = e.Time.Truncate(c.Interval).Add(c.Interval)
+		}
+		report.Events++
+
+		for !next.After(e.Time) {
+			now = next
+			tick()
+			next = next.Add(c.Interval)
+		}
+		if e.Time.After(now) {
+			now = e.Time
+		}
+		// the exchange sees the event first, so an order placed in reaction to a trade does not fill against that trade
+		if e.Trade != nil {
+			exchange.OnTrade(e.Trade)
+		}
+		if e.Book != nil {
+			exchange.OnOrderBookChanged(e.Book)
+		}
+		if report.Events == 1 {
+			report.StartEquity = exchange.Equity()
+			report.EquityCurve = append(report.EquityCurve, EquityPoint{Time: now, Equity: report.StartEquity})
+		}
+		if e.Trade != nil {
+			runner.HandleTrade(ctx, e.Trade)
+		}
+		if e.Book != nil {
+			runner.HandleOrderBook(ctx, e.Book)
+		}
+	}
+	if report.Events == 0 {
+		return nil, errors.New("the source has no events")
+	}
+
+	report.End = now
+	if err := runner.CancelAll(ctx); err != nil {
+		return nil, err
+	}
+	tick()
+	report.complete(exchange)
+	return report, nil
+}
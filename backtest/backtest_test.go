@@ -0,0 +1,276 @@
+package backtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bitbot/datastore"
+	"github.com/resc/rescbits/bl3papi"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+	"github.com/resc/rescbits/paper"
+	"github.com/resc/rescbits/strategy"
+)
+
+type (
+	// roundTrip buys at the first trade and sells when the price reaches the target
+	roundTrip struct {
+		amount money.Amount
+		target money.Price
+		bought bool
+		sold   bool
+	}
+)
+
+func (s *roundTrip) Name() string { return "round-trip" }
+
+func (s *roundTrip) OnTrade(a *strategy.Account, t *bl3pfeed.Trade) []strategy.Intent {
+	if !s.bought {
+		s.bought = true
+		return []strategy.Intent{strategy.Buy(s.amount, 0, "first trade")}
+	}
+	if !s.sold && t.Price >= s.target {
+		s.sold = true
+		return []strategy.Intent{strategy.Sell(s.amount, 0, "target reached")}
+	}
+	return nil
+}
+
+func (s *roundTrip) OnOrderBook(a *strategy.Account, b *bl3pfeed.Book) []strategy.Intent { return nil }
+func (s *roundTrip) OnTimer(a *strategy.Account) []strategy.Intent                       { return nil }
+
+var start = time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func trades(prices ...money.Price) []datastore.Trade {
+	trades := make([]datastore.Trade, 0, len(prices))
+	for i, p := range prices {
+		trades = append(trades, datastore.Trade{
+			Market:    "BTCEUR",
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+			Type:      bl3papi.TypeBid,
+			Price:     p,
+			Amount:    money.Bitcoin,
+		})
+	}
+	return trades
+}
+
+func TestRun(t *testing.T) {
+	s := &roundTrip{amount: 5 * money.Bitcoin, target: 120 * money.Euro}
+	src := Trades(trades(100*money.Euro, 110*money.Euro, 90*money.Euro, 120*money.Euro, 115*money.Euro))
+	r, err := Run(context.Background(), s, src, Config{Paper: paper.Config{Eur: 1000 * money.Euro}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Strategy != "round-trip" || r.Market != "BTCEUR" || r.Interval != DefaultInterval {
+		t.Errorf("unexpected report header: %s %s %s", r.Strategy, r.Market, r.Interval)
+	}
+	if r.Events != 10 {
+		t.Errorf("expected 10 events, got %d", r.Events)
+	}
+	if !r.Start.Equal(start) || !r.End.Equal(start.Add(4*time.Minute)) {
+		t.Errorf("unexpected period %s - %s", r.Start, r.End)
+	}
+	expected := []money.Price{1000, 1000, 1050, 950, 1100, 1100}
+	if len(r.EquityCurve) != len(expected) {
+		t.Fatalf("expected %d points, got %v", len(expected), r.EquityCurve)
+	}
+	for i, p := range r.EquityCurve {
+		if p.Equity != expected[i]*money.Euro {
+			t.Errorf("point %d: expected equity %d EUR, got %s", i, expected[i], p.Equity)
+		}
+	}
+	if r.StartEquity != 1000*money.Euro || r.EndEquity != 1100*money.Euro || r.Return != 10 {
+		t.Errorf("unexpected equity %s -> %s (%f%%)", r.StartEquity, r.EndEquity, r.Return)
+	}
+	if r.MaxDrawdown != 100*money.Euro || r.MaxDrawdownPercent < 9.52 || r.MaxDrawdownPercent > 9.53 {
+		t.Errorf("unexpected max drawdown %s (%f%%)", r.MaxDrawdown, r.MaxDrawdownPercent)
+	}
+	if r.Trades != 2 || r.Wins != 1 || r.Losses != 0 || r.WinRate != 100 {
+		t.Errorf("unexpected trades %d, wins %d, losses %d, win rate %f", r.Trades, r.Wins, r.Losses, r.WinRate)
+	}
+	if r.Realised != 100*money.Euro || r.Unrealised != 0 || r.Position != 0 {
+		t.Errorf("unexpected position %s, realised %s, unrealised %s", r.Position, r.Realised, r.Unrealised)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	ctx := context.Background()
+	s := &roundTrip{amount: money.Bitcoin}
+	if _, err := Run(ctx, s, Events(), Config{}); err == nil {
+		t.Error("expected an error for a source without events")
+	}
+	if _, err := Run(ctx, nil, Events(), Config{}); err == nil {
+		t.Error("expected an error without a strategy")
+	}
+	if _, err := Run(ctx, s, Trades(trades(100*money.Euro)), Config{Interval: -time.Second}); err == nil {
+		t.Error("expected an error for a negative interval")
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := Run(cancelled, s, Trades(trades(100*money.Euro)), Config{}); err != context.Canceled {
+		t.Errorf("expected the context error, got %v", err)
+	}
+}
+
+func TestReport(t *testing.T) {
+	r := &Report{Strategy: "round-trip", Market: "BTCEUR", Start: start, End: start.Add(time.Hour), Interval: time.Minute,
+		StartEquity: 1000 * money.Euro, EndEquity: 1100 * money.Euro, Return: 10, Trades: 2, Wins: 1, WinRate: 100,
+		EquityCurve: []EquityPoint{{Time: start, Equity: 1000 * money.Euro}}}
+
+	b := &bytes.Buffer{}
+	if err := r.WriteJSON(b); err != nil {
+		t.Fatal(err)
+	}
+	decoded := &Report{}
+	if err := json.Unmarshal(b.Bytes(), decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.EndEquity != r.EndEquity || decoded.Interval != r.Interval || len(decoded.EquityCurve) != 1 {
+		t.Errorf("the report did not survive json: %s", b)
+	}
+	if !strings.Contains(b.String(), `"return_pct": 10`) {
+		t.Errorf("expected snake case fields, got %s", b)
+	}
+
+	text := r.String()
+	for _, line := range []string{
+		"Backtest of round-trip on BTCEUR",
+		"Period:       2018-03-01 12:00 - 2018-03-01 13:00",
+		"Equity:       1000.00 EUR -> 1100.00 EUR (+10.00%)",
+		"win rate 100.0% (1 wins, 0 losses)",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("expected %q in\n%s", line, text)
+		}
+	}
+}
+
+func TestMaxDrawdown(t *testing.T) {
+	curve := []EquityPoint{{Equity: 100}, {Equity: 80}, {Equity: 120}, {Equity: 90}, {Equity: 130}}
+	if d, pct := maxDrawdown(curve); d != 30 || pct != 25 {
+		t.Errorf("expected a drawdown of 30 (25%%), got %d (%f%%)", d, pct)
+	}
+}
+
+func TestSharpe(t *testing.T) {
+	flat := []EquityPoint{{Equity: 100}, {Equity: 100}, {Equity: 100}}
+	if s := sharpe(flat, time.Hour); s != 0 {
+		t.Errorf("expected 0 for a flat curve, got %f", s)
+	}
+	rising := []EquityPoint{{Equity: 100}, {Equity: 101}, {Equity: 103}, {Equity: 104}}
+	if s := sharpe(rising, time.Hour); s <= 0 {
+		t.Errorf("expected a positive ratio for a rising curve, got %f", s)
+	}
+	falling := []EquityPoint{{Equity: 104}, {Equity: 103}, {Equity: 101}, {Equity: 100}}
+	if s := sharpe(falling, time.Hour); s >= 0 {
+		t.Errorf("expected a negative ratio for a falling curve, got %f", s)
+	}
+}
+
+func TestSamples(t *testing.T) {
+	src := Samples([]datastore.PriceSample{
+		{Timestamp: start, Type: "B", Price: 8010 * money.Euro},
+		{Timestamp: start, Type: "S", Price: 7990 * money.Euro},
+		// incomplete samples are skipped
+		{Timestamp: start.Add(time.Minute), Type: "B", Price: 8020 * money.Euro},
+	})
+	book, err := src.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.Book == nil || book.Book.Asks[0].Price != 8010*money.Euro || book.Book.Bids[0].Price != 7990*money.Euro {
+		t.Errorf("expected a book with the sample prices, got %+v", book)
+	}
+	trade, err := src.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trade.Trade == nil || trade.Trade.Price != 8000*money.Euro || trade.Trade.Amount != 0 || !trade.Time.Equal(start) {
+		t.Errorf("expected a trade at the mid price, got %+v", trade)
+	}
+	if _, err := src.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestWindowSource(t *testing.T) {
+	var windows [][2]time.Time
+	src := &windowSource{from: start, to: start.Add(13 * time.Hour), load: func(from, to time.Time) ([]Event, error) {
+		windows = append(windows, [2]time.Time{from, to})
+		if len(windows) == 2 {
+			// an empty window is skipped
+			return nil, nil
+		}
+		return []Event{{Time: from}}, nil
+	}}
+	n := 0
+	for {
+		if _, err := src.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 2 || len(windows) != 3 {
+		t.Fatalf("expected 2 events from 3 windows, got %d from %v", n, windows)
+	}
+	for i, w := range [][2]time.Duration{{0, 6 * time.Hour}, {6 * time.Hour, 12 * time.Hour}, {12 * time.Hour, 13 * time.Hour}} {
+		if !windows[i][0].Equal(start.Add(w[0])) || !windows[i][1].Equal(start.Add(w[1]-time.Microsecond)) {
+			t.Errorf("window %d: unexpected %s - %s", i, windows[i][0], windows[i][1])
+		}
+	}
+}
+
+func TestRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "session.jsonl.gz")
+	rec, err := bl3pfeed.CreateRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := []bl3pfeed.Frame{
+		{Time: start, Market: "BTCEUR", Channel: bl3pfeed.ChannelTrades,
+			Data: []byte(`{"date":1519905600,"marketplace":"BTCEUR","price_int":800000000,"type":"buy","amount_int":100000000}`)},
+		{Time: start.Add(time.Second), Market: "LTCEUR", Channel: bl3pfeed.ChannelTrades,
+			Data: []byte(`{"date":1519905601,"marketplace":"LTCEUR","price_int":20000000,"type":"buy","amount_int":100000000}`)},
+	}
+	for _, f := range frames {
+		if err := rec.Record(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := Recording(path, "BTCEUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	e, err := src.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Trade == nil || e.Trade.Price != 8000*money.Euro || !e.Time.Equal(start) {
+		t.Errorf("expected the recorded BTCEUR trade, got %+v", e)
+	}
+	if _, err := src.Next(); err != io.EOF {
+		t.Errorf("expected only the BTCEUR trade, got %v", err)
+	}
+}
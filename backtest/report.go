@@ -0,0 +1,163 @@
+package backtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/resc/rescbits/money"
+	"github.com/resc/rescbits/paper"
+)
+
+type (
+	// EquityPoint is the value of the account at a point in time
+	EquityPoint struct {
+		Time   time.Time   `json:"time"`
+		Equity money.Price `json:"equity"`
+	}
+
+	// Report is the result of a backtest, the equity is the EUR balance plus the BTC balance valued at the last price
+	Report struct {
+		Strategy string        `json:"strategy"`
+		Market   string        `json:"market"`
+		Start    time.Time     `json:"start"`
+		End      time.Time     `json:"end"`
+		Interval time.Duration `json:"interval_ns"`
+		Events   int           `json:"events"`
+
+		StartEquity money.Price `json:"start_equity"`
+		EndEquity   money.Price `json:"end_equity"`
+		// Return is the change of the equity in percent
+		Return float64 `json:"return_pct"`
+		// MaxDrawdown is the largest drop of the equity from a previous high
+		MaxDrawdown        money.Price `json:"max_drawdown"`
+		MaxDrawdownPercent float64     `json:"max_drawdown_pct"`
+		// Sharpe is the annualised Sharpe ratio of the equity returns per interval, without a risk free rate
+		Sharpe float64 `json:"sharpe"`
+
+		// Trades is the number of fills
+		Trades int `json:"trades"`
+		// Wins and Losses are the number of fills that closed a part of the position with a profit or a loss
+		Wins   int `json:"wins"`
+		Losses int `json:"losses"`
+		// WinRate is the percentage of the closing fills with a profit
+		WinRate    float64      `json:"win_rate_pct"`
+		Fees       money.Price  `json:"fees"`
+		Realised   money.Price  `json:"realised"`
+		Unrealised money.Price  `json:"unrealised"`
+		Position   money.Amount `json:"position"`
+
+		EquityCurve []EquityPoint `json:"equity_curve"`
+	}
+)
+
+// WriteJSON writes the report as indented json
+func (r *Report) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(r)
+}
+
+// WriteText writes a plain text summary of the report, without the equity curve
+func (r *Report) WriteText(w io.Writer) error {
+	const layout = "2006-01-02 15:04"
+	_, err := fmt.Fprintf(w, `Backtest of %s on %s
+Period:       %s - %s (%d events)
+Equity:       %s EUR -> %s EUR (%+.2f%%)
+Max drawdown: %s EUR (%.2f%%)
+Sharpe ratio: %.2f
+Trades:       %d fills, win rate %.1f%% (%d wins, %d losses)
+Fees:         %s EUR
+Position:     %s BTC, realised %s EUR, unrealised %s EUR
+`,
+		r.Strategy, r.Market,
+		r.Start.UTC().Format(layout), r.End.UTC().Format(layout), r.Events,
+		r.StartEquity.StringFixed(2), r.EndEquity.StringFixed(2), r.Return,
+		r.MaxDrawdown.StringFixed(2), r.MaxDrawdownPercent,
+		r.Sharpe,
+		r.Trades, r.WinRate, r.Wins, r.Losses,
+		r.Fees.StringFixed(2),
+		r.Position, r.Realised.StringFixed(2), r.Unrealised.StringFixed(2))
+	return err
+}
+
+func (r *Report) String() string {
+	b := &bytes.Buffer{}
+	r.WriteText(b)
+	return b.String()
+}
+
+// complete computes the statistics from the equity curve and the exchange
+func (r *Report) complete(exchange *paper.Exchange) {
+	r.EndEquity = r.EquityCurve[len(r.EquityCurve)-1].Equity
+	if r.StartEquity > 0 {
+		r.Return = 100 * (r.EndEquity - r.StartEquity).Float64() / r.StartEquity.Float64()
+	}
+	r.MaxDrawdown, r.MaxDrawdownPercent = maxDrawdown(r.EquityCurve)
+	r.Sharpe = sharpe(r.EquityCurve, r.Interval)
+
+	for _, x := range exchange.Executions() {
+		r.Trades++
+		if x.Realised > 0 {
+			r.Wins++
+		} else if x.Realised < 0 {
+			r.Losses++
+		}
+	}
+	if r.Wins+r.Losses > 0 {
+		r.WinRate = 100 * float64(r.Wins) / float64(r.Wins+r.Losses)
+	}
+	p := exchange.Position()
+	r.Fees = p.Fees
+	r.Realised = p.Realised
+	r.Unrealised = p.Unrealised
+	r.Position = p.Amount
+}
+
+// maxDrawdown returns the largest drop from a high of the curve, in EUR and in percent of the high
+func maxDrawdown(curve []EquityPoint) (money.Price, float64) {
+	var peak, drawdown money.Price
+	percent := 0.0
+	for _, p := range curve {
+		if p.Equity > peak {
+			peak = p.Equity
+		}
+		if d := peak - p.Equity; d > drawdown {
+			drawdown = d
+			percent = 100 * d.Float64() / peak.Float64()
+		}
+	}
+	return drawdown, percent
+}
+
+// sharpe returns the mean divided by the standard deviation of the returns between the points of the curve,
+// annualised for a market that trades all year round
+func sharpe(curve []EquityPoint, interval time.Duration) float64 {
+	returns := make([]float64, 0, len(curve))
+	for i := 1; i < len(curve); i++ {
+		if prev := curve[i-1].Equity; prev > 0 {
+			returns = append(returns, (curve[i].Equity-prev).Float64()/prev.Float64())
+		}
+	}
+	if len(returns) < 2 || interval <= 0 {
+		return 0
+	}
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	if std == 0 {
+		return 0
+	}
+	periods := float64(365*24*time.Hour) / float64(interval)
+	return mean / std * math.Sqrt(periods)
+}
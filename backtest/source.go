@@ -0,0 +1,241 @@
+package backtest
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/resc/rescbits/bitbot/datastore"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+)
+
+const (
+	// loadWindow is the period the stored sources load at once
+	loadWindow = 6 * time.Hour
+	// maxRows is the most rows the stored sources load for one window
+	maxRows = 500000
+	// syntheticDepth is the amount of the levels of the order books made from trades and price samples
+	syntheticDepth = 1000 * money.Bitcoin
+)
+
+type (
+	// Event is a trade or an order book at a point in time
+	Event struct {
+		Time  time.Time
+		Trade *bl3pfeed.Trade
+		Book  *bl3pfeed.OrderBook
+	}
+
+	// Source returns market events in time order
+	Source interface {
+		// Next returns the next event, or io.EOF after the last event
+		Next() (Event, error)
+		Close() error
+	}
+
+	// sliceSource returns the events of a slice
+	sliceSource struct {
+		events []Event
+	}
+
+	// windowSource loads the events a window at a time
+	windowSource struct {
+		from   time.Time
+		to     time.Time
+		load   func(from, to time.Time) ([]Event, error)
+		events []Event
+	}
+
+	// recordingSource returns the messages of a recorded feed
+	recordingSource struct {
+		frames *bl3pfeed.FrameReader
+		market string
+	}
+)
+
+// Events returns a source for the events, they should be in time order
+func Events(events ...Event) Source {
+	return &sliceSource{events: events}
+}
+
+// Trades returns a source for the stored trades, they should be in time order.
+// Every trade is preceded by an order book with the trade price on both sides, so market orders fill at the last traded price.
+func Trades(trades []datastore.Trade) Source {
+	return &sliceSource{events: tradeEvents(trades)}
+}
+
+// Samples returns a source for the stored price samples, they should be in time order.
+// The buy (B) and sell (S) prices of a timestamp become an order book with an ask at the buy price
+// and a bid at the sell price, followed by a trade without volume at the mid price.
+// Market orders fill against these books, resting limit orders don't fill because there's no traded volume.
+func Samples(samples []datastore.PriceSample) Source {
+	return &sliceSource{events: sampleEvents(samples)}
+}
+
+// StoredTrades returns a source that loads the stored trades of the market between from and to
+func StoredTrades(ds datastore.DataStore, market string, from, to time.Time) Source {
+	return &windowSource{from: from, to: to, load: func(from, to time.Time) ([]Event, error) {
+		var trades []datastore.Trade
+		err := datastore.WithUow(ds, func(uow datastore.UnitOfWork) error {
+			var total int
+			var err error
+			trades, total, err = uow.LoadTrades(market, from, to, maxRows)
+			if err == nil && total > len(trades) {
+				err = fmt.Errorf("more than %d trades between %s and %s", maxRows, from, to)
+			}
+			return err
+		})
+		return tradeEvents(trades), err
+	}}
+}
+
+// StoredSamples returns a source that loads the stored price samples between from and to, see Samples
+func StoredSamples(ds datastore.DataStore, from, to time.Time) Source {
+	return &windowSource{from: from, to: to, load: func(from, to time.Time) ([]Event, error) {
+		var samples []datastore.PriceSample
+		err := datastore.WithUow(ds, func(uow datastore.UnitOfWork) error {
+			var total int
+			var err error
+			samples, total, err = uow.LoadPriceSamples(from, to, maxRows)
+			if err == nil && total > len(samples) {
+				err = fmt.Errorf("more than %d price samples between %s and %s", maxRows, from, to)
+			}
+			return err
+		})
+		return sampleEvents(samples), err
+	}}
+}
+
+// Recording returns a source for the trades and order books of the market in a recording of bl3pfeed,
+// the events have the time they were recorded
+func Recording(path, market string) (Source, error) {
+	frames, err := bl3pfeed.OpenRecording(path)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingSource{frames: frames, market: market}, nil
+}
+
+func (s *sliceSource) Next() (Event, error) {
+	if len(s.events) == 0 {
+		return Event{}, io.EOF
+	}
+	e := s.events[0]
+	s.events = s.events[1:]
+	return e, nil
+}
+
+func (s *sliceSource) Close() error {
+	s.events = nil
+	return nil
+}
+
+func (s *windowSource) Next() (Event, error) {
+	for len(s.events) == 0 {
+		if !s.from.Before(s.to) {
+			return Event{}, io.EOF
+		}
+		end := s.from.Add(loadWindow)
+		if end.After(s.to) {
+			end = s.to
+		}
+		// the queries include both ends, so stop just before the start of the next window
+		events, err := s.load(s.from, end.Add(-time.Microsecond))
+		if err != nil {
+			return Event{}, err
+		}
+		s.events = events
+		s.from = end
+	}
+	e := s.events[0]
+	s.events = s.events[1:]
+	return e, nil
+}
+
+func (s *windowSource) Close() error {
+	s.events = nil
+	s.from = s.to
+	return nil
+}
+
+func (s *recordingSource) Next() (Event, error) {
+	for {
+		f, err := s.frames.Next()
+		if err != nil {
+			return Event{}, err
+		}
+		if f.Market != s.market {
+			continue
+		}
+		d, ok := bl3pfeed.DecoderFor(f.Channel)
+		if !ok {
+			continue
+		}
+		msg, err := d.Decode(f.Data)
+		if err != nil {
+			return Event{}, fmt.Errorf("invalid %s message recorded at %s: %v", f.Channel, f.Time, err)
+		}
+		switch m := msg.(type) {
+		case *bl3pfeed.Trade:
+			return Event{Time: f.Time, Trade: m}, nil
+		case *bl3pfeed.OrderBook:
+			return Event{Time: f.Time, Book: m}, nil
+		}
+	}
+}
+
+func (s *recordingSource) Close() error {
+	return s.frames.Close()
+}
+
+func tradeEvents(trades []datastore.Trade) []Event {
+	events := make([]Event, 0, 2*len(trades))
+	for _, t := range trades {
+		events = append(events,
+			Event{Time: t.Timestamp, Book: syntheticBook(t.Market, t.Price, t.Price)},
+			Event{Time: t.Timestamp, Trade: &bl3pfeed.Trade{
+				Date:        t.Timestamp.Unix(),
+				Marketplace: t.Market,
+				Price:       t.Price,
+				Type:        t.Type,
+				Amount:      t.Amount,
+			}})
+	}
+	return events
+}
+
+func sampleEvents(samples []datastore.PriceSample) []Event {
+	events := make([]Event, 0)
+	for i := 0; i < len(samples); {
+		at := samples[i].Timestamp
+		var buy, sell money.Price
+		for ; i < len(samples) && samples[i].Timestamp.Equal(at); i++ {
+			switch samples[i].Type {
+			case "B":
+				buy = samples[i].Price
+			case "S":
+				sell = samples[i].Price
+			}
+		}
+		if buy == 0 || sell == 0 {
+			continue
+		}
+		events = append(events,
+			Event{Time: at, Book: syntheticBook("", buy, sell)},
+			Event{Time: at, Trade: &bl3pfeed.Trade{
+				Date:  at.Unix(),
+				Price: buy.Add(sell).MulDiv(1, 2, money.RoundDown),
+			}})
+	}
+	return events
+}
+
+// syntheticBook returns an order book with a single ask and bid level
+func syntheticBook(market string, ask, bid money.Price) *bl3pfeed.OrderBook {
+	return &bl3pfeed.OrderBook{
+		Market: market,
+		Asks:   []*bl3pfeed.Order{{Price: ask, Amount: syntheticDepth}},
+		Bids:   []*bl3pfeed.Order{{Price: bid, Amount: syntheticDepth}},
+	}
+}
@@ -0,0 +1,191 @@
+// Package alerts checks the users' price alerts against the polled prices.
+package alerts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/resc/rescbits/bitbot/datastore"
+	"github.com/resc/rescbits/bitbot/notify"
+	"github.com/resc/rescbits/bitbot/prices"
+	"github.com/resc/rescbits/money"
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxCooldown caps the growing delay between repeated notifications for the same alert
+const MaxCooldown = 24 * time.Hour
+
+type (
+	// Evaluator checks all alerts on every price update and notifies the users when the price crosses their alert price.
+	// An alert is armed while the price is on the other side of the alert price and is disarmed by the notification.
+	// A crossing within the cooldown of the last notification is notified once the cooldown has passed, if the price
+	// is still past the alert price. The cooldown doubles with every notification up to MaxCooldown, the count
+	// is reset when the price is back on the other side after the cooldown.
+	Evaluator struct {
+		ds       datastore.DataStore
+		notify   notify.Notifier
+		cooldown time.Duration
+		now      func() time.Time
+	}
+)
+
+var _ prices.PriceListener = (*Evaluator)(nil)
+
+// NewEvaluator creates an evaluator, cooldown is the delay before the first repeated notification
+func NewEvaluator(ds datastore.DataStore, notify notify.Notifier, cooldown time.Duration) (*Evaluator, error) {
+	if ds == nil {
+		return nil, errors.New("ds datastore.DataStore is nil")
+	}
+	if notify == nil {
+		return nil, errors.New("notify notify.Notifier is nil")
+	}
+	if cooldown <= 0 {
+		return nil, errors.New("cooldown should be positive")
+	}
+	return &Evaluator{
+		ds:       ds,
+		notify:   notify,
+		cooldown: cooldown,
+		now:      time.Now,
+	}, nil
+}
+
+// OnPrices evaluates the alerts for the polled prices, failed price requests are skipped
+func (e *Evaluator) OnPrices(buy, sell *prices.Response) {
+	var buyPrice, sellPrice money.Price
+	if buy != nil && buy.Error == "" {
+		buyPrice = buy.Price
+	}
+	if sell != nil && sell.Error == "" {
+		sellPrice = sell.Price
+	}
+	if err := e.Evaluate(buyPrice, sellPrice, e.now()); err != nil {
+		log.Errorf("Error evaluating price alerts: %v", err)
+	}
+}
+
+// Evaluate checks all alerts against the buy and sell price, a zero price means the price is unknown
+func (e *Evaluator) Evaluate(buy, sell money.Price, now time.Time) error {
+	alerts, err := e.loadAlerts()
+	if err != nil {
+		return errors.Wrap(err, "Error loading price alerts")
+	}
+
+	for _, a := range alerts {
+		price := buy
+		if a.Action == datastore.AlertActionSell {
+			price = sell
+		}
+		if price == 0 {
+			continue
+		}
+
+		coolingDown := a.TriggerCount > 0 && now.Before(a.LastTriggerTimestamp.Add(Cooldown(e.cooldown, a.TriggerCount)))
+		if !IsTriggered(a, price) {
+			if !a.Armed || (a.TriggerCount > 0 && !coolingDown) {
+				err := datastore.WithUow(e.ds, func(uow datastore.UnitOfWork) error {
+					if a.TriggerCount > 0 && !coolingDown {
+						if err := uow.ResetAlertTriggerCount(a.Id); err != nil {
+							return err
+						}
+					}
+					return uow.ArmAlert(a.Id)
+				})
+				if err != nil {
+					log.Errorf("Error arming price alert %d: %v", a.Id, err)
+				}
+			}
+			continue
+		}
+
+		// only a crossing triggers the alert
+		if !a.Armed || coolingDown {
+			continue
+		}
+
+		// record the trigger before notifying, so a failing database doesn't spam the user
+		err := datastore.WithUow(e.ds, func(uow datastore.UnitOfWork) error {
+			_, err := uow.IncrementAlertTriggerCount(a.Id, now)
+			return err
+		})
+		if err != nil {
+			log.Errorf("Error updating price alert %d: %v", a.Id, err)
+			continue
+		}
+
+		if err := e.notify(a.UserID, Message(a, price)); err != nil {
+			log.Errorf("Error sending price alert %d to user %s: %v", a.Id, a.UserID, err)
+		}
+	}
+	return nil
+}
+
+// IsTriggered returns true if the price is on the alerting side of the alert price
+func IsTriggered(a datastore.PriceAlert, price money.Price) bool {
+	switch a.Direction {
+	case datastore.AlertAbove:
+		return price > a.Price
+	case datastore.AlertBelow:
+		return price < a.Price
+	default:
+		return false
+	}
+}
+
+// Cooldown returns the delay after the given number of notifications, it doubles with every notification
+func Cooldown(cooldown time.Duration, triggerCount int32) time.Duration {
+	d := cooldown
+	for i := int32(1); i < triggerCount && d < MaxCooldown; i++ {
+		d *= 2
+	}
+	if d > MaxCooldown {
+		d = MaxCooldown
+	}
+	return d
+}
+
+// Message formats the notification for the alert
+func Message(a datastore.PriceAlert, price money.Price) string {
+	return fmt.Sprintf("Price alert #%d: the %s price is %s EUR/BTC, %s your alert at %s EUR/BTC",
+		a.Id, ActionName(a.Action), price.StringFixed(2), DirectionName(a.Direction), a.Price.StringFixed(2))
+}
+
+// Describe formats the alert for listings
+func Describe(a datastore.PriceAlert) string {
+	return fmt.Sprintf("#%d: %s price %s %s EUR/BTC", a.Id, ActionName(a.Action), DirectionName(a.Direction), a.Price.StringFixed(2))
+}
+
+// ActionName returns buy or sell
+func ActionName(action int64) string {
+	switch action {
+	case datastore.AlertActionBuy:
+		return prices.ActionBuy
+	case datastore.AlertActionSell:
+		return prices.ActionSell
+	default:
+		return "unknown"
+	}
+}
+
+// DirectionName returns above or below
+func DirectionName(direction int64) string {
+	switch direction {
+	case datastore.AlertAbove:
+		return "above"
+	case datastore.AlertBelow:
+		return "below"
+	default:
+		return "unknown"
+	}
+}
+
+func (e *Evaluator) loadAlerts() ([]datastore.PriceAlert, error) {
+	var alerts []datastore.PriceAlert
+	err := datastore.WithUow(e.ds, func(uow datastore.UnitOfWork) error {
+		var err error
+		alerts, err = uow.LoadAlerts()
+		return err
+	})
+	return alerts, err
+}
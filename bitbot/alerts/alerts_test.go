@@ -0,0 +1,214 @@
+package alerts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bitbot/datastore"
+	"github.com/resc/rescbits/money"
+)
+
+type (
+	fakeDataStore struct {
+		datastore.DataStore
+
+		alerts []datastore.PriceAlert
+	}
+
+	// fakeUow applies the changes directly, the evaluator commits every change on its own
+	fakeUow struct {
+		datastore.UnitOfWork
+		ds *fakeDataStore
+	}
+
+	message struct {
+		userID string
+		text   string
+	}
+)
+
+func (ds *fakeDataStore) StartUow() (datastore.UnitOfWork, error) {
+	return &fakeUow{ds: ds}, nil
+}
+
+func (u *fakeUow) LoadAlerts(userID ...string) ([]datastore.PriceAlert, error) {
+	result := make([]datastore.PriceAlert, len(u.ds.alerts))
+	copy(result, u.ds.alerts)
+	return result, nil
+}
+
+func (u *fakeUow) ResetAlertTriggerCount(id int64) error {
+	for i := range u.ds.alerts {
+		if u.ds.alerts[i].Id == id {
+			u.ds.alerts[i].TriggerCount = 0
+			return nil
+		}
+	}
+	return errors.New("not found")
+}
+
+func (u *fakeUow) ArmAlert(id int64) error {
+	for i := range u.ds.alerts {
+		if u.ds.alerts[i].Id == id {
+			u.ds.alerts[i].Armed = true
+			return nil
+		}
+	}
+	return errors.New("not found")
+}
+
+func (u *fakeUow) IncrementAlertTriggerCount(id int64, timestamp time.Time) (datastore.PriceAlert, error) {
+	for i := range u.ds.alerts {
+		if u.ds.alerts[i].Id == id {
+			u.ds.alerts[i].TriggerCount++
+			u.ds.alerts[i].LastTriggerTimestamp = timestamp
+			u.ds.alerts[i].Armed = false
+			return u.ds.alerts[i], nil
+		}
+	}
+	return datastore.PriceAlert{}, errors.New("not found")
+}
+
+func (u *fakeUow) Commit() error {
+	return nil
+}
+
+func (u *fakeUow) Rollback() error {
+	return nil
+}
+
+func newTestEvaluator(t *testing.T, alerts ...datastore.PriceAlert) (*Evaluator, *fakeDataStore, *[]message) {
+	ds := &fakeDataStore{alerts: alerts}
+	messages := make([]message, 0)
+	e, err := NewEvaluator(ds, func(userID string, text string) error {
+		messages = append(messages, message{userID, text})
+		return nil
+	}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, ds, &messages
+}
+
+func TestEvaluator_TriggersOnCrossing(t *testing.T) {
+	e, _, messages := newTestEvaluator(t,
+		datastore.PriceAlert{Id: 1, UserID: "U1", Action: datastore.AlertActionBuy, Direction: datastore.AlertAbove, Price: 9000 * money.Euro},
+		datastore.PriceAlert{Id: 2, UserID: "U2", Action: datastore.AlertActionSell, Direction: datastore.AlertBelow, Price: 8000 * money.Euro},
+	)
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := e.Evaluate(8500*money.Euro, 8400*money.Euro, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(*messages) != 0 {
+		t.Fatalf("Expected no messages, got %+v", *messages)
+	}
+
+	if err := e.Evaluate(9100*money.Euro, 7900*money.Euro, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(*messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %+v", *messages)
+	}
+	if m := (*messages)[0]; m.userID != "U1" || !strings.Contains(m.text, "buy price is 9100.00 EUR/BTC, above your alert at 9000.00") {
+		t.Errorf("Unexpected message %+v", m)
+	}
+	if m := (*messages)[1]; m.userID != "U2" || !strings.Contains(m.text, "sell price is 7900.00 EUR/BTC, below your alert at 8000.00") {
+		t.Errorf("Unexpected message %+v", m)
+	}
+}
+
+func TestEvaluator_Cooldown(t *testing.T) {
+	e, ds, messages := newTestEvaluator(t,
+		datastore.PriceAlert{Id: 1, UserID: "U1", Action: datastore.AlertActionBuy, Direction: datastore.AlertAbove, Price: 9000 * money.Euro, Armed: true},
+	)
+	start := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// cooldowns after each notification: 1h, 2h
+	for _, step := range []struct {
+		after    time.Duration
+		price    money.Price
+		expected int
+	}{
+		{0, 9100 * money.Euro, 1},
+		// staying above isn't a crossing
+		{10 * time.Minute, 9100 * money.Euro, 1},
+		{20 * time.Minute, 8900 * money.Euro, 1},
+		// a crossing within the cooldown waits for the cooldown
+		{30 * time.Minute, 9100 * money.Euro, 1},
+		{time.Hour, 9100 * money.Euro, 2},
+		{time.Hour + 10*time.Minute, 8900 * money.Euro, 2},
+		{2 * time.Hour, 9100 * money.Euro, 2},
+		// back below after the cooldown resets the count
+		{3*time.Hour + 30*time.Minute, 8900 * money.Euro, 2},
+		{3*time.Hour + 40*time.Minute, 9100 * money.Euro, 3},
+	} {
+		if err := e.Evaluate(step.price, 0, start.Add(step.after)); err != nil {
+			t.Fatal(err)
+		}
+		if len(*messages) != step.expected {
+			t.Fatalf("After %v: expected %d messages, got %d", step.after, step.expected, len(*messages))
+		}
+	}
+	if ds.alerts[0].TriggerCount != 1 {
+		t.Fatalf("Expected the trigger count to be reset, got %d", ds.alerts[0].TriggerCount)
+	}
+}
+
+func TestEvaluator_OnlyOnCrossing(t *testing.T) {
+	// the price was already above the alert price when the alert was created
+	e, ds, messages := newTestEvaluator(t,
+		datastore.PriceAlert{Id: 1, UserID: "U1", Action: datastore.AlertActionBuy, Direction: datastore.AlertAbove, Price: 9000 * money.Euro},
+	)
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := e.Evaluate(9100*money.Euro, 0, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(*messages) != 0 {
+		t.Fatalf("Expected no message without a crossing, got %+v", *messages)
+	}
+	if err := e.Evaluate(8900*money.Euro, 0, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if !ds.alerts[0].Armed {
+		t.Fatal("Expected the alert to be armed below the alert price")
+	}
+	if err := e.Evaluate(9100*money.Euro, 0, now.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*messages) != 1 {
+		t.Fatalf("Expected a message for the crossing, got %+v", *messages)
+	}
+}
+
+func TestEvaluator_SkipsUnknownPrices(t *testing.T) {
+	e, _, messages := newTestEvaluator(t,
+		datastore.PriceAlert{Id: 1, UserID: "U1", Action: datastore.AlertActionSell, Direction: datastore.AlertBelow, Price: 8000 * money.Euro},
+	)
+	if err := e.Evaluate(9100*money.Euro, 0, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(*messages) != 0 {
+		t.Fatalf("Expected no messages for an unknown sell price, got %+v", *messages)
+	}
+}
+
+func TestCooldown(t *testing.T) {
+	for _, tc := range []struct {
+		count    int32
+		expected time.Duration
+	}{
+		{0, time.Hour},
+		{1, time.Hour},
+		{2, 2 * time.Hour},
+		{5, 16 * time.Hour},
+		{6, MaxCooldown},
+		{1000, MaxCooldown},
+	} {
+		if d := Cooldown(time.Hour, tc.count); d != tc.expected {
+			t.Errorf("Cooldown(1h, %d): expected %v, got %v", tc.count, tc.expected, d)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package bitonic
 
 import (
+	"context"
+	"strconv"
 	"time"
 	"net/http"
 	"encoding/json"
@@ -9,128 +11,232 @@ import (
 	"fmt"
 	"strings"
 	log "github.com/sirupsen/logrus"
-	"github.com/resc/rescbits/bitbot/datastore"
+	"github.com/resc/rescbits/bitbot/prices"
+	"github.com/resc/rescbits/money"
 )
 
-const (
-	ActionBuy   = "buy"
-	ActionSell  = "sell"
-	CurrencyEur = "eur"
-	CurrencyBtc = "btc"
-)
+// Name is the name of the bitonic price source
+const Name = "bitonic"
+
+var _ prices.Source = (*Api)(nil)
+
+// DefaultTimeout is the default deadline for a single price request
+const DefaultTimeout = 10 * time.Second
 
 type (
 	Api struct {
 		buyUrl  string
 		sellUrl string
+		client  *http.Client
+		timeout time.Duration
+	}
+
+	// StatusError is returned when bitonic responds with an unexpected http status
+	StatusError struct {
+		StatusCode int
+		Status     string
+		// Body is the start of the response body
+		Body string
 	}
 
-	PriceRequest struct {
-		Action   string
-		Currency string
-		Amount   float64
+	// RateLimitError is returned when bitonic responds with 429 Too Many Requests
+	RateLimitError struct {
+		// RetryAfter is the delay from the Retry-After header, zero if there was none
+		RetryAfter time.Duration
 	}
 
-	PriceResponse struct {
-		Request PriceRequest
-		Time    time.Time
-		Btc     float64
-		Eur     float64
-		Price   float64
-		Error   string
+	// ApiError is returned when bitonic responds with an unsuccessful quote, e.g. for an invalid amount
+	ApiError struct {
+		Message string
 	}
 )
 
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("Bitonic responded with %s", e.Status)
+	}
+	return fmt.Sprintf("Bitonic responded with %s: %s", e.Status, e.Body)
+}
+
+// Temporary returns true for server errors, the request can be retried later
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("Bitonic rate limit exceeded, retry after %v", e.RetryAfter)
+	}
+	return "Bitonic rate limit exceeded"
+}
+
+// Temporary returns true, the request can be retried later
+func (e *RateLimitError) Temporary() bool {
+	return true
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("Bitonic said: %s", e.Message)
+}
+
+// IsTemporary returns true if the error is temporary and the request can be retried later, like server errors, rate limits and timeouts
+func IsTemporary(err error) bool {
+	if t, ok := err.(interface {
+		Temporary() bool
+	}); ok {
+		return t.Temporary()
+	}
+	return err == context.DeadlineExceeded
+}
+
+// New creates an api with its own http client and the DefaultTimeout
 func New(buyUrl, sellUrl string) *Api {
+	return NewWithClient(buyUrl, sellUrl, &http.Client{})
+}
+
+// NewWithClient creates an api that sends its requests with the client and the DefaultTimeout
+func NewWithClient(buyUrl, sellUrl string, client *http.Client) *Api {
+	if client == nil {
+		client = &http.Client{}
+	}
 	return &Api{
 		buyUrl:  buyUrl,
 		sellUrl: sellUrl,
+		client:  client,
+		timeout: DefaultTimeout,
 	}
 }
 
-func (b *Api) RequestPrice(request *PriceRequest) <-chan *PriceResponse {
-	response := make(chan *PriceResponse)
-	go func() {
-		defer func() {
-			err := recover()
-			if err != nil {
-				errmsg := fmt.Sprint(err)
-				if len(errmsg) == 0 {
-					errmsg = "unknown error"
-				}
-
-				response <- &PriceResponse{
-					Time:    time.Now(),
-					Request: *request,
-					Error:   errmsg,
-				}
-			}
-			close(response)
-		}()
-
-		url, err := b.buildRequestUrl(request)
-		panicIf(err)
-
-		log.Printf("Sending request %s", url)
-		resp, err := http.Get(url)
-		panicIf(err)
-
-		defer resp.Body.Close()
-		bytes, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
-		panicIf(err)
-
-		log.Printf("Got response %s\n%s", resp.Status, string(bytes))
-		priceData := &struct {
-			Success bool    `json:"success"`
-			Btc     float64 `json:"btc"`
-			Eur     float64 `json:"eur"`
-			Price   float64 `json:"price"`
-			Method  string  `json:"method"`
-			Error   string  `json:"error"`
-		}{}
-
-		err = json.Unmarshal(bytes, priceData)
-		panicIf(err)
-
-		if !priceData.Success || priceData.Error != "" {
-			response <- &PriceResponse{
-				Time:    time.Now(),
-				Request: *request,
-				Error:   fmt.Sprintf("Bitonic said: %s", priceData.Error),
-			}
-		} else {
-			response <- &PriceResponse{
-				Time:    time.Now(),
-				Request: *request,
-				Btc:     priceData.Btc,
-				Eur:     priceData.Eur,
-				Price:   priceData.Price,
-			}
+// SetTimeout sets the deadline for a single request, zero means no deadline other than the context's
+func (b *Api) SetTimeout(timeout time.Duration) {
+	b.timeout = timeout
+}
+
+// Quote requests a price quote, it returns a *StatusError, *RateLimitError or *ApiError when bitonic rejects the request
+func (b *Api) Quote(ctx context.Context, request prices.Request) (prices.Response, error) {
+	response := prices.Response{Source: Name, Request: request}
+
+	url, err := b.buildRequestUrl(&request)
+	if err != nil {
+		return response, err
+	}
+
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return response, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
+	log.Debugf("Sending request %s", url)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		// report the context error, the client wraps it in an url.Error
+		if ctx.Err() != nil {
+			return response, ctx.Err()
 		}
-	}()
+		return response, err
+	}
+	defer resp.Body.Close()
 
-	return response
+	bytes, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		if ctx.Err() != nil {
+			return response, ctx.Err()
+		}
+		return response, err
+	}
+	log.Debugf("Got response %s\n%s", resp.Status, string(bytes))
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return response, &RateLimitError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return response, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: truncate(strings.TrimSpace(string(bytes)), 200)}
+	}
+
+	priceData := &struct {
+		Success bool         `json:"success"`
+		Btc     money.Amount `json:"btc"`
+		Eur     money.Price  `json:"eur"`
+		Price   money.Price  `json:"price"`
+		Method  string       `json:"method"`
+		Error   string       `json:"error"`
+	}{}
+	if err := json.Unmarshal(bytes, priceData); err != nil {
+		return response, fmt.Errorf("invalid response from bitonic: %v", err)
+	}
+
+	response.Time = time.Now()
+	if !priceData.Success || priceData.Error != "" {
+		return response, &ApiError{Message: priceData.Error}
+	}
+	response.Btc = priceData.Btc
+	response.Eur = priceData.Eur
+	response.Price = priceData.Price
+	return response, nil
+}
+
+// Name returns the name of the price source
+func (b *Api) Name() string {
+	return Name
 }
 
-func (b *Api) buildRequestUrl(request *PriceRequest) (string, error) {
+// RequestPrice quotes the price in the background, see prices.RequestPrice
+func (b *Api) RequestPrice(request *prices.Request) <-chan *prices.Response {
+	return prices.RequestPrice(b, request)
+}
+
+// parseRetryAfter parses the delay seconds or http date of a Retry-After header
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
+
+func (b *Api) buildRequestUrl(request *prices.Request) (string, error) {
 	action := strings.ToLower(request.Action)
 	currency := strings.ToLower(request.Currency)
 	url := ""
 
 	switch action {
-	case ActionBuy:
+	case prices.ActionBuy:
 		url = b.buyUrl
-	case ActionSell:
+	case prices.ActionSell:
 		url = b.sellUrl
 	default:
 		return "", fmt.Errorf("invalid action: %s", request.Action)
 	}
 
 	switch currency {
-	case CurrencyBtc:
-		url = fmt.Sprintf("%s?%s=%f", url, CurrencyBtc, request.Amount)
-	case CurrencyEur:
-		url = fmt.Sprintf("%s?%s=%f", url, CurrencyEur, request.Amount)
+	case prices.CurrencyBtc:
+		url = fmt.Sprintf("%s?%s=%s", url, prices.CurrencyBtc, request.Btc)
+	case prices.CurrencyEur:
+		url = fmt.Sprintf("%s?%s=%s", url, prices.CurrencyEur, request.Eur)
 	default:
 		return "", fmt.Errorf("invalid currency: %s", request.Currency)
 	}
@@ -138,80 +244,3 @@ func (b *Api) buildRequestUrl(request *PriceRequest) (string, error) {
 	return url, nil
 
 }
-
-func PricePoller(bitonicApi *Api, ds datastore.DataStore, pollInterval time.Duration, shutdown <-chan struct{}) {
-	defer func() {
-
-		err := recover()
-		if err != nil {
-			log.Errorf("bitonicpPricePoller: %v", err)
-			duration := 60 * time.Second
-			log.Infof("bitonicpPricePoller: suspended due to error, resuming in %v", duration)
-			select {
-			case <-shutdown:
-				return // quick exit on shutdown
-			case <-time.After(duration):
-				log.Infof("bitonicpPricePoller: resumed polling")
-				go PricePoller(bitonicApi, ds, pollInterval, shutdown)
-			}
-		}
-	}()
-	for {
-		select {
-		case <-shutdown:
-			return
-		case <-time.After(pollInterval):
-			buyResponse := bitonicApi.RequestPrice(&PriceRequest{
-				Amount:   1,
-				Currency: CurrencyBtc,
-				Action:   ActionBuy,
-			})
-			sellResponse := bitonicApi.RequestPrice(&PriceRequest{
-				Amount:   1,
-				Currency: CurrencyBtc,
-				Action:   ActionSell,
-			})
-			if uow, err := ds.StartUow(); err != nil {
-				log.Errorf("")
-			} else {
-				func() {
-					defer uow.Commit()
-
-					buy := <-buyResponse
-					if buy.Error == "" {
-						err := uow.SavePriceSamples(datastore.PriceSample{
-							Type:      "B",
-							Timestamp: buy.Time,
-							Price:     int64(buy.Price * 1e5),
-						})
-						if err != nil {
-							log.Errorf("Error saving price sample", err)
-						}
-					} else {
-						log.Errorf("Error fetching buy price: %s", buy.Error)
-					}
-
-					sell := <-sellResponse
-					if sell.Error == "" {
-						err := uow.SavePriceSamples(datastore.PriceSample{
-							Type:      "S",
-							Timestamp: sell.Time,
-							Price:     int64(sell.Price * 1e5),
-						})
-						if err != nil {
-							log.Errorf("Error saving price sample", err)
-						}
-					} else {
-						log.Errorf("Error fetching buy price: %s", sell.Error)
-					}
-				}()
-			}
-		}
-	}
-}
-
-func panicIf(err error) {
-	if err != nil {
-		panic(err)
-	}
-}
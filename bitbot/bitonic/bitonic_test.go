@@ -0,0 +1,158 @@
+package bitonic
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bitbot/prices"
+	"github.com/resc/rescbits/money"
+)
+
+func newTestApi(handler http.HandlerFunc) (*Api, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	api := NewWithClient(server.URL+"/buy", server.URL+"/sell", server.Client())
+	return api, server
+}
+
+func TestApi_Quote(t *testing.T) {
+	api, server := newTestApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/buy" || r.URL.Query().Get("btc") != "0.50000000" {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		fmt.Fprint(w, `{"success":true,"btc":0.5,"eur":4000.12,"price":8000.24,"method":"buy"}`)
+	})
+	defer server.Close()
+
+	response, err := api.Quote(context.Background(), prices.Request{Action: prices.ActionBuy, Currency: prices.CurrencyBtc, Btc: money.Bitcoin / 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Btc != money.Bitcoin/2 || response.Eur != 400012000 || response.Price != 800024000 || response.Time.IsZero() {
+		t.Fatalf("Unexpected response %+v", response)
+	}
+}
+
+func TestApi_QuoteErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		status    int
+		header    string
+		body      string
+		check     func(err error) bool
+		temporary bool
+	}{
+		{"api error", http.StatusOK, "", `{"success":false,"error":"amount too small"}`, func(err error) bool {
+			e, ok := err.(*ApiError)
+			return ok && e.Message == "amount too small"
+		}, false},
+		{"bad request", http.StatusBadRequest, "", `bad request`, func(err error) bool {
+			e, ok := err.(*StatusError)
+			return ok && e.StatusCode == 400 && e.Body == "bad request"
+		}, false},
+		{"server error", http.StatusBadGateway, "", ``, func(err error) bool {
+			e, ok := err.(*StatusError)
+			return ok && e.StatusCode == 502
+		}, true},
+		{"rate limit", http.StatusTooManyRequests, "30", ``, func(err error) bool {
+			e, ok := err.(*RateLimitError)
+			return ok && e.RetryAfter == 30*time.Second
+		}, true},
+		{"invalid json", http.StatusOK, "", `<html>`, func(err error) bool {
+			return err != nil
+		}, false},
+	} {
+		api, server := newTestApi(func(w http.ResponseWriter, r *http.Request) {
+			if tc.header != "" {
+				w.Header().Set("Retry-After", tc.header)
+			}
+			w.WriteHeader(tc.status)
+			fmt.Fprint(w, tc.body)
+		})
+
+		_, err := api.Quote(context.Background(), prices.Request{Action: prices.ActionSell, Currency: prices.CurrencyEur, Eur: 100 * money.Euro})
+		if !tc.check(err) {
+			t.Errorf("%s: unexpected error %#v", tc.name, err)
+		}
+		if err != nil && IsTemporary(err) != tc.temporary {
+			t.Errorf("%s: expected temporary %t for %v", tc.name, tc.temporary, err)
+		}
+		server.Close()
+	}
+}
+
+func TestApi_QuoteTimeout(t *testing.T) {
+	release := make(chan struct{})
+	api, server := newTestApi(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	defer server.Close()
+	defer close(release)
+
+	api.SetTimeout(50 * time.Millisecond)
+	started := time.Now()
+	_, err := api.Quote(context.Background(), prices.Request{Action: prices.ActionBuy, Currency: prices.CurrencyBtc, Btc: money.Bitcoin})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected a deadline exceeded error, got %v", err)
+	}
+	if !IsTemporary(err) {
+		t.Error("Expected a timeout to be temporary")
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("Quote took %v", elapsed)
+	}
+
+	// a canceled context stops the request too
+	api.SetTimeout(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := api.Quote(ctx, prices.Request{Action: prices.ActionBuy, Currency: prices.CurrencyBtc, Btc: money.Bitcoin}); err != context.Canceled {
+		t.Fatalf("Expected a canceled error, got %v", err)
+	}
+}
+
+func TestApi_QuoteInvalidRequest(t *testing.T) {
+	api := New("http://localhost/buy", "http://localhost/sell")
+	if _, err := api.Quote(context.Background(), prices.Request{Action: "hodl", Currency: prices.CurrencyBtc}); err == nil {
+		t.Error("Expected an error for an invalid action")
+	}
+	if _, err := api.Quote(context.Background(), prices.Request{Action: prices.ActionBuy, Currency: "usd"}); err == nil {
+		t.Error("Expected an error for an invalid currency")
+	}
+}
+
+func TestApi_RequestPrice(t *testing.T) {
+	api, server := newTestApi(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer server.Close()
+
+	response := <-api.RequestPrice(&prices.Request{Action: prices.ActionBuy, Currency: prices.CurrencyBtc, Btc: money.Bitcoin})
+	if response == nil || response.Error == "" || response.Request.Action != prices.ActionBuy || response.Source != Name {
+		t.Fatalf("Expected an error response, got %+v", response)
+	}
+
+	// nobody reads the response, the goroutine should still finish
+	api.RequestPrice(&prices.Request{Action: prices.ActionBuy, Currency: prices.CurrencyBtc, Btc: money.Bitcoin})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	for value, expected := range map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-1":                            0,
+		"soon":                          0,
+		"Mon, 01 Jan 2018 12:01:00 GMT": time.Minute,
+	} {
+		if d := parseRetryAfter(value, now); d != expected {
+			t.Errorf("parseRetryAfter(%q): expected %v, got %v", value, expected, d)
+		}
+	}
+}
@@ -5,8 +5,9 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/resc/slack"
 	"fmt"
-	"github.com/resc/rescbits/bitbot/bitonic"
+	"github.com/resc/rescbits/bitbot/prices"
 	"github.com/resc/rescbits/bitbot/datastore"
+	"github.com/resc/rescbits/bitbot/notify"
 )
 
 type bot struct {
@@ -15,20 +16,32 @@ type bot struct {
 	// Tag is <@bot.ID>
 	Tag           string
 	rtm           *slack.RTM
-	agent         *bitonic.Api
+	// post sends the messages to the channels
+	post          notify.Notifier
+	agent         prices.Source
+	// sampled is the source of the price samples and the price alerts
+	sampled       prices.Source
+	// venues are the price sources that are compared by the compare command
+	venues        []prices.Source
 	ds            datastore.DataStore
 	conversations map[string]*conversation
 	channels      []slack.Channel
+	// fileUploads is false if the bot isn't allowed to upload files, e.g. charts
+	fileUploads bool
 }
 
-func newBot(rtm *slack.RTM, userID string, agent *bitonic.Api, ds datastore.DataStore) (*bot, error) {
+func newBot(rtm *slack.RTM, userID string, agent prices.Source, sampled prices.Source, ds datastore.DataStore, fileUploads bool, venues ...prices.Source) (*bot, error) {
 	b := &bot{
 		ID:            userID,
 		Tag:           "<@" + userID + ">",
 		rtm:           rtm,
+		post:          notify.Channel(rtm),
 		agent:         agent,
+		sampled:       sampled,
 		ds:            ds,
 		conversations: make(map[string]*conversation),
+		fileUploads:   fileUploads,
+		venues:        venues,
 	}
 
 	return b, nil;
@@ -61,9 +74,7 @@ func (bot *bot) sendMessagef(channel string, format string, args ...interface{})
 }
 
 func (bot *bot) sendMessage(channelID string, text string) error {
-	msg := bot.rtm.NewOutgoingMessage(text, channelID)
-	bot.rtm.SendMessage(msg)
-	return nil
+	return bot.post(channelID, text)
 }
 
 func (bot *bot) HandleMessage(ev *slack.MessageEvent) {
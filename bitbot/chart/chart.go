@@ -0,0 +1,207 @@
+// Package chart renders price lines as PNG images or text sparklines, without external dependencies.
+package chart
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"time"
+
+	"github.com/resc/rescbits/money"
+)
+
+// the chart colors
+var (
+	Background = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	Grid       = color.RGBA{R: 0xe0, G: 0xe0, B: 0xe0, A: 0xff}
+	Axis       = color.RGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xff}
+	Green      = color.RGBA{R: 0x2e, G: 0x9e, B: 0x44, A: 0xff}
+	Red        = color.RGBA{R: 0xd0, G: 0x32, B: 0x2e, A: 0xff}
+)
+
+var (
+	sparks = []rune("▁▂▃▄▅▆▇█")
+)
+
+const (
+	margin    = 10
+	gridLines = 4
+)
+
+type (
+	// Point is a price at a moment in time
+	Point struct {
+		Time  time.Time
+		Price money.Price
+	}
+
+	// Series is a line on the chart, the points must be sorted by time
+	Series struct {
+		Name   string
+		Color  color.Color
+		Points []Point
+	}
+)
+
+// Bounds returns the time and price range of all points, ok is false if there are no points
+func Bounds(series ...Series) (from, to time.Time, min, max money.Price, ok bool) {
+	for _, s := range series {
+		for _, p := range s.Points {
+			if !ok {
+				from, to, min, max, ok = p.Time, p.Time, p.Price, p.Price, true
+				continue
+			}
+			if p.Time.Before(from) {
+				from = p.Time
+			}
+			if p.Time.After(to) {
+				to = p.Time
+			}
+			min = min.Min(p.Price)
+			max = max.Max(p.Price)
+		}
+	}
+	return from, to, min, max, ok
+}
+
+// Render draws the series as lines on a width x height image with a light grid
+func Render(width, height int, series ...Series) (*image.RGBA, error) {
+	if width <= 2*margin || height <= 2*margin {
+		return nil, errors.New("chart too small")
+	}
+	from, to, min, max, ok := Bounds(series...)
+	if !ok {
+		return nil, errors.New("no data to chart")
+	}
+
+	// pad the price range so flat lines end up in the middle and the lines don't touch the border
+	padding := (max - min) / 20
+	if padding == 0 {
+		padding = money.Euro
+	}
+	min, max = min-padding, max+padding
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: Background}, image.ZP, draw.Src)
+
+	plot := image.Rect(margin, margin, width-margin, height-margin)
+	for i := 1; i < gridLines; i++ {
+		y := plot.Min.Y + i*plot.Dy()/gridLines
+		line(img, plot.Min.X, y, plot.Max.X-1, y, Grid)
+		x := plot.Min.X + i*plot.Dx()/gridLines
+		line(img, x, plot.Min.Y, x, plot.Max.Y-1, Grid)
+	}
+	line(img, plot.Min.X, plot.Max.Y-1, plot.Max.X-1, plot.Max.Y-1, Axis)
+	line(img, plot.Min.X, plot.Min.Y, plot.Min.X, plot.Max.Y-1, Axis)
+
+	span := to.Sub(from)
+	toX := func(t time.Time) int {
+		if span <= 0 {
+			return plot.Min.X + plot.Dx()/2
+		}
+		return plot.Min.X + int(float64(plot.Dx()-1)*float64(t.Sub(from))/float64(span))
+	}
+	toY := func(p money.Price) int {
+		return plot.Max.Y - 1 - int(int64(plot.Dy()-1)*int64(p-min)/int64(max-min))
+	}
+
+	for _, s := range series {
+		c := s.Color
+		if c == nil {
+			c = Axis
+		}
+		for i, p := range s.Points {
+			x, y := toX(p.Time), toY(p.Price)
+			if i == 0 {
+				img.Set(x, y, c)
+				continue
+			}
+			prev := s.Points[i-1]
+			line(img, toX(prev.Time), toY(prev.Price), x, y, c)
+		}
+	}
+	return img, nil
+}
+
+// RenderPNG renders the chart and writes it to w as a PNG image
+func RenderPNG(w io.Writer, width, height int, series ...Series) error {
+	if img, err := Render(width, height, series...); err != nil {
+		return err
+	} else {
+		return png.Encode(w, img)
+	}
+}
+
+// Sparkline returns the points as a line of at most width block characters, every character is the average of its points
+func Sparkline(points []Point, width int) string {
+	if len(points) == 0 || width <= 0 {
+		return ""
+	}
+	if width > len(points) {
+		width = len(points)
+	}
+
+	averages := make([]money.Price, width)
+	min, max := money.Price(0), money.Price(0)
+	for i := 0; i < width; i++ {
+		start, end := i*len(points)/width, (i+1)*len(points)/width
+		sum := money.Price(0)
+		for _, p := range points[start:end] {
+			sum += p.Price
+		}
+		averages[i] = sum.MulDiv(1, int64(end-start), money.RoundHalfUp)
+		if i == 0 {
+			min, max = averages[i], averages[i]
+		} else {
+			min, max = min.Min(averages[i]), max.Max(averages[i])
+		}
+	}
+
+	runes := make([]rune, width)
+	for i, avg := range averages {
+		level := 0
+		if max > min {
+			level = int(int64(len(sparks)-1) * int64(avg-min) / int64(max-min))
+		}
+		runes[i] = sparks[level]
+	}
+	return string(runes)
+}
+
+// line draws a line with Bresenham's algorithm
+func line(img draw.Image, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
@@ -0,0 +1,88 @@
+package chart
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/money"
+)
+
+func testPoints(prices ...int64) []Point {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	points := make([]Point, len(prices))
+	for i, p := range prices {
+		points[i] = Point{Time: start.Add(time.Duration(i) * time.Minute), Price: money.Price(p) * money.Euro}
+	}
+	return points
+}
+
+func TestRenderPNG(t *testing.T) {
+	buy := Series{Name: "buy", Color: Green, Points: testPoints(100, 110, 105, 120)}
+	sell := Series{Name: "sell", Color: Red, Points: testPoints(95, 104, 100, 115)}
+
+	buf := &bytes.Buffer{}
+	if err := RenderPNG(buf, 200, 100, buy, sell); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 200 || b.Dy() != 100 {
+		t.Fatalf("Unexpected image size %v", b)
+	}
+
+	// the first buy point is at the left edge of the plot, the highest buy point at the right edge near the top
+	found := map[string]bool{}
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			switch {
+			case r>>8 == uint32(Green.R) && g>>8 == uint32(Green.G) && b>>8 == uint32(Green.B):
+				found["buy"] = true
+			case r>>8 == uint32(Red.R) && g>>8 == uint32(Red.G) && b>>8 == uint32(Red.B):
+				found["sell"] = true
+			}
+		}
+	}
+	if !found["buy"] || !found["sell"] {
+		t.Fatalf("Expected both lines to be drawn, found %v", found)
+	}
+}
+
+func TestRender_Errors(t *testing.T) {
+	if _, err := Render(200, 100); err == nil {
+		t.Error("Expected an error without data")
+	}
+	if _, err := Render(10, 10, Series{Points: testPoints(1)}); err == nil {
+		t.Error("Expected an error for a tiny chart")
+	}
+	// a single point and a flat line should not divide by zero
+	if _, err := Render(200, 100, Series{Points: testPoints(1)}); err != nil {
+		t.Error(err)
+	}
+	if _, err := Render(200, 100, Series{Points: testPoints(5, 5, 5)}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	for _, tc := range []struct {
+		prices   []int64
+		width    int
+		expected string
+	}{
+		{nil, 10, ""},
+		{[]int64{1, 2, 3, 4, 5, 6, 7, 8}, 8, "▁▂▃▄▅▆▇█"},
+		{[]int64{8, 1}, 10, "█▁"},
+		{[]int64{3, 3, 3}, 3, "▁▁▁"},
+		// pairs are averaged: 1.5, 5.5, 9.5
+		{[]int64{1, 2, 5, 6, 9, 10}, 3, "▁▄█"},
+	} {
+		if s := Sparkline(testPoints(tc.prices...), tc.width); s != tc.expected {
+			t.Errorf("Sparkline(%v, %d): expected %s, got %s", tc.prices, tc.width, tc.expected, s)
+		}
+	}
+}
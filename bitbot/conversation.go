@@ -4,9 +4,21 @@ import (
 	log "github.com/sirupsen/logrus"
 	"strings"
 	"fmt"
-	"strconv"
 	"github.com/resc/slack"
 	"github.com/resc/rescbits/bitbot/bitonic"
+	"github.com/resc/rescbits/bitbot/prices"
+	"github.com/resc/rescbits/money"
+	"github.com/resc/rescbits/bitbot/datastore"
+	"github.com/resc/rescbits/bitbot/alerts"
+	"strconv"
+	"sort"
+	"time"
+	"bytes"
+	"github.com/resc/rescbits/bitbot/chart"
+	"github.com/resc/rescbits/bitbot/env"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/tape"
+	"github.com/resc/rescbits/bitbot/whales"
 )
 
 type conversation struct {
@@ -19,6 +31,32 @@ type conversation struct {
 const (
 	buyHelpText  = "*buy [amount] [currency]*: Get a price quote for buying the given amount of the given currency (btc or eur)"
 	sellHelpText = "*sell [amount] [currency]*: Get a price quote for selling the given amount of the given currency (btc or eur)"
+
+	alertHelpText       = "*alert [buy|sell] [above|below] [price]*: Get a direct message when the buy or sell price in EUR/BTC crosses the given price"
+	alertsHelpText      = "*alerts*: List your price alerts"
+	alertDeleteHelpText = "*alert delete [id]*: Delete one of your price alerts"
+	chartHelpText       = "*chart [1h|24h|7d|30d]*: Show a chart of the buy and sell prices of the given period, 24h by default"
+	compareHelpText     = "*compare [amount] [currency]*: Compare the buying and selling prices of bitonic and the BL3P order book for the given amount of the given currency (btc or eur)"
+	statsHelpText       = "*stats [1h|24h|7d|30d]*: Show the price statistics of the given period, 24h by default"
+	volumeHelpText      = "*volume [1h|24h|7d|30d]*: Show the BL3P trade volume, VWAP and buy/sell imbalance of the given period and the shorter periods, 24h by default"
+	whalesHelpText      = "*whales [size [btc]|sigma [n]|move [percent] [seconds]|off]*: Post BL3P trades of at least the given size or n standard deviations above the average size, and price moves of the given percentage within the given seconds to this channel, 0 turns one off"
+)
+
+const (
+	chartWidth      = 800
+	chartHeight     = 300
+	sparklineWidth  = 40
+	maxChartSamples = 250000
+	largestTrades   = 3
+)
+
+var (
+	periods = map[string]time.Duration{
+		"1h":  time.Hour,
+		"24h": 24 * time.Hour,
+		"7d":  7 * 24 * time.Hour,
+		"30d": 30 * 24 * time.Hour,
+	}
 )
 
 func (c *conversation) HandleMessage(ev *slack.MessageEvent) {
@@ -40,6 +78,20 @@ func (c *conversation) HandleMessage(ev *slack.MessageEvent) {
 			txt, err = c.HandleBuy(parameters)
 		case "sell":
 			txt, err = c.HandleSell(parameters)
+		case "alert":
+			txt, err = c.HandleAlert(parameters)
+		case "alerts":
+			txt, err = c.HandleAlerts(parameters)
+		case "chart":
+			txt, err = c.HandleChart(ev.Channel, parameters)
+		case "stats":
+			txt, err = c.HandleStats(parameters)
+		case "compare":
+			txt, err = c.HandleCompare(parameters)
+		case "volume":
+			txt, err = c.HandleVolume(parameters)
+		case "whales":
+			txt, err = c.HandleWhales(ev.Channel, parameters)
 		default:
 			txt += fmt.Sprintf( "I don't know this '%s' you're speaking of...\n", cmd)
 			fallthrough
@@ -47,36 +99,42 @@ func (c *conversation) HandleMessage(ev *slack.MessageEvent) {
 			txt += "*Commands:*\n" +
 				"*hello*: test if the bot responds\n" +
 				buyHelpText + "\n" +
-				sellHelpText + "\n"
+				sellHelpText + "\n" +
+				compareHelpText + "\n" +
+				alertHelpText + "\n" +
+				alertsHelpText + "\n" +
+				alertDeleteHelpText + "\n" +
+				chartHelpText + "\n" +
+				statsHelpText + "\n" +
+				volumeHelpText + "\n" +
+				whalesHelpText + "\n"
 		}
 	}
 	if err != nil {
 		txt = "Something failed, please try again:  " + err.Error()
 	}
-	outMsg := c.rtm.NewOutgoingMessage(txt, ev.Channel)
-	c.rtm.SendMessage(outMsg)
+	if txt == "" {
+		// the response was already sent, e.g. as a file upload
+		return
+	}
+	if err := c.bot.sendMessage(ev.Channel, txt); err != nil {
+		log.Errorf("Error sending the response to channel %s: %v", ev.Channel, err)
+	}
 }
 func (c *conversation) HandleBuy(parameters []string) (string, error) {
 	if len(parameters) != 2 {
 		return "I didn't understand that\nHere's how the buy command works:\n" + buyHelpText, nil
 	}
-	amount, err := strconv.ParseFloat(parameters[0], 64)
+	request, err := newPriceRequest(prices.ActionBuy, parameters[0], parameters[1])
 	if err != nil {
-		return "The amount should be a number like 1.23\n" +
-			err.Error() + "\n" +
+		return err.Error() + "\n" +
 			"Here's how the buy command works:\n" + buyHelpText, nil
 	}
 
-	response := <-c.bot.agent.RequestPrice(&bitonic.PriceRequest{
-		Action:   bitonic.ActionBuy,
-		Amount:   amount,
-		Currency: parameters[1],
-	})
+	response := <-prices.RequestPrice(c.bot.agent, request)
 
 	if response.Error == "" {
-		price:= fmt.Sprintf("%.2f",response.Price)
-
-		return fmt.Sprintf("The buying price is %.2f EUR for %f BTC ( %s EUR/BTC )\n https://bitonic.nl/#buy", response.Eur, response.Btc, price), nil
+		return fmt.Sprintf("The buying price is %s EUR for %s BTC ( %s EUR/BTC )%s", response.Eur.StringFixed(2), response.Btc, response.Price.StringFixed(2), venueLink(response)), nil
 	} else {
 		return response.Error, nil
 	}
@@ -87,26 +145,570 @@ func (c *conversation) HandleSell(parameters []string) (string, error) {
 	if len(parameters) != 2 {
 		return "I didn't understand that\nHere's how the sell command works:\n" + sellHelpText, nil
 	}
-	amount, err := strconv.ParseFloat(parameters[0], 64)
+	request, err := newPriceRequest(prices.ActionSell, parameters[0], parameters[1])
 	if err != nil {
-		return "The amount should be a number like 1.23\n" +
-			err.Error() + "\n" +
-			"Here's how the sell command works:\n" + buyHelpText, nil
+		return err.Error() + "\n" +
+			"Here's how the sell command works:\n" + sellHelpText, nil
 	}
 
-	response := <-c.bot.agent.RequestPrice(&bitonic.PriceRequest{
-		Action:   bitonic.ActionSell,
-		Amount:   amount,
-		Currency: parameters[1],
-	})
+	response := <-prices.RequestPrice(c.bot.agent, request)
 
 	if response.Error == "" {
-		price:= fmt.Sprintf("%.2f",response.Price)
-
-		return fmt.Sprintf("The selling price is %.2f EUR for %f BTC ( %s EUR/BTC )\n https://bitonic.nl/#sell", response.Eur, response.Btc, price), nil
+		return fmt.Sprintf("The selling price is %s EUR for %s BTC ( %s EUR/BTC )%s", response.Eur.StringFixed(2), response.Btc, response.Price.StringFixed(2), venueLink(response)), nil
 	} else {
 		return response.Error, nil
 	}
 
 }
 
+func (c *conversation) HandleAlert(parameters []string) (string, error) {
+	if len(parameters) == 2 && strings.ToLower(parameters[0]) == "delete" {
+		return c.HandleAlertDelete(parameters[1])
+	}
+	if len(parameters) != 3 {
+		return "I didn't understand that\nHere's how the alert command works:\n" + alertHelpText + "\n" + alertDeleteHelpText, nil
+	}
+
+	alert, err := newPriceAlert(c.userID, parameters[0], parameters[1], parameters[2])
+	if err != nil {
+		return err.Error() + "\n" +
+			"Here's how the alert command works:\n" + alertHelpText, nil
+	}
+
+	// the alert only triggers when the price crosses the alert price, so it's armed if the price is on the other side
+	response := <-prices.RequestPrice(c.bot.sampled, &prices.Request{
+		Action:   alerts.ActionName(alert.Action),
+		Currency: prices.CurrencyBtc,
+		Btc:      money.Bitcoin,
+	})
+	alert.Armed = response.Error == "" && !alerts.IsTriggered(alert, response.Price)
+
+	err = datastore.WithUow(c.bot.ds, func(uow datastore.UnitOfWork) error {
+		alert, err = uow.SaveAlert(alert)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	txt := fmt.Sprintf("Ok, I'll send you a message when the %s price goes %s %s EUR/BTC (alert #%d)", alerts.ActionName(alert.Action), alerts.DirectionName(alert.Direction), alert.Price.StringFixed(2), alert.Id)
+	if response.Error == "" && !alert.Armed {
+		txt += fmt.Sprintf("\nThe %s price is already %s EUR/BTC, so that's after it's back on the other side", alerts.ActionName(alert.Action), response.Price.StringFixed(2))
+	}
+	return txt, nil
+}
+
+func (c *conversation) HandleAlerts(parameters []string) (string, error) {
+	var userAlerts []datastore.PriceAlert
+	err := datastore.WithUow(c.bot.ds, func(uow datastore.UnitOfWork) error {
+		var err error
+		userAlerts, err = uow.LoadAlerts(c.userID)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(userAlerts) == 0 {
+		return "You have no price alerts\n" + alertHelpText, nil
+	}
+
+	txt := "*Your price alerts:*\n"
+	for _, a := range userAlerts {
+		txt += alerts.Describe(a) + "\n"
+	}
+	return txt, nil
+}
+
+func (c *conversation) HandleAlertDelete(id string) (string, error) {
+	alertID, err := strconv.ParseInt(strings.TrimPrefix(id, "#"), 10, 64)
+	if err != nil {
+		return fmt.Sprintf("The alert id should be a number, not '%s'\n%s", id, alertDeleteHelpText), nil
+	}
+
+	deleted := 0
+	err = datastore.WithUow(c.bot.ds, func(uow datastore.UnitOfWork) error {
+		userAlerts, err := uow.LoadAlerts(c.userID)
+		if err != nil {
+			return err
+		}
+		// users can only delete their own alerts
+		for _, a := range userAlerts {
+			if a.Id == alertID {
+				deleted, err = uow.DeleteAlerts(alertID)
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if deleted == 0 {
+		return fmt.Sprintf("You have no price alert #%d\n%s", alertID, alertsHelpText), nil
+	}
+	return fmt.Sprintf("Price alert #%d deleted", alertID), nil
+}
+
+func (c *conversation) HandleChart(channelID string, parameters []string) (string, error) {
+	name := "24h"
+	if len(parameters) > 1 {
+		return "I didn't understand that\nHere's how the chart command works:\n" + chartHelpText, nil
+	} else if len(parameters) == 1 && parameters[0] != "" {
+		name = strings.ToLower(parameters[0])
+	}
+	period, err := parsePeriod(name)
+	if err != nil {
+		return err.Error() + "\n" +
+			"Here's how the chart command works:\n" + chartHelpText, nil
+	}
+
+	to := time.Now()
+	var samples []datastore.PriceSample
+	err = datastore.WithUow(c.bot.ds, func(uow datastore.UnitOfWork) error {
+		var err error
+		samples, _, err = uow.LoadPriceSamples(to.Add(-period), to, maxChartSamples)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	buy := chart.Series{Name: "buy", Color: chart.Green, Points: make([]chart.Point, 0)}
+	sell := chart.Series{Name: "sell", Color: chart.Red, Points: make([]chart.Point, 0)}
+	for _, s := range samples {
+		switch s.Type {
+		case "B":
+			buy.Points = append(buy.Points, chart.Point{Time: s.Timestamp, Price: s.Price})
+		case "S":
+			sell.Points = append(sell.Points, chart.Point{Time: s.Timestamp, Price: s.Price})
+		}
+	}
+	if len(buy.Points) == 0 && len(sell.Points) == 0 {
+		return fmt.Sprintf("I have no prices for the last %s", name), nil
+	}
+
+	summary := fmt.Sprintf("Bitonic prices of the last %s: %s, %s", name, describeSeries(buy), describeSeries(sell))
+	if !c.bot.fileUploads {
+		return summary + "\n" + sparklines(buy, sell), nil
+	}
+
+	buf := &bytes.Buffer{}
+	if err := chart.RenderPNG(buf, chartWidth, chartHeight, buy, sell); err != nil {
+		return "", err
+	}
+	_, err = c.rtm.UploadFile(slack.FileUploadParameters{
+		Reader:         buf,
+		Filename:       "bitbot-chart-" + name + ".png",
+		Filetype:       "png",
+		Title:          "Bitonic prices of the last " + name,
+		InitialComment: summary + " (buy is green, sell is red)",
+		Channels:       []string{channelID},
+	})
+	if err != nil {
+		log.Warnf("Error uploading chart, falling back to text: %v", err)
+		return summary + "\n" + sparklines(buy, sell), nil
+	}
+	return "", nil
+}
+
+func (c *conversation) HandleStats(parameters []string) (string, error) {
+	name := "24h"
+	if len(parameters) > 1 {
+		return "I didn't understand that\nHere's how the stats command works:\n" + statsHelpText, nil
+	} else if len(parameters) == 1 && parameters[0] != "" {
+		name = strings.ToLower(parameters[0])
+	}
+	period, err := parsePeriod(name)
+	if err != nil {
+		return err.Error() + "\n" +
+			"Here's how the stats command works:\n" + statsHelpText, nil
+	}
+
+	to := time.Now()
+	var stats []datastore.PriceSampleStats
+	err = datastore.WithUow(c.bot.ds, func(uow datastore.UnitOfWork) error {
+		var err error
+		stats, err = uow.LoadPriceSampleStats(to.Add(-period), to)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var buy, sell *datastore.PriceSampleStats
+	for i := range stats {
+		switch stats[i].Type {
+		case "B":
+			buy = &stats[i]
+		case "S":
+			sell = &stats[i]
+		}
+	}
+	if buy == nil && sell == nil {
+		return fmt.Sprintf("I have no prices for the last %s", name), nil
+	}
+
+	txt := fmt.Sprintf("*Bitonic prices of the last %s:*\n", name)
+	if buy != nil {
+		txt += describeStats("Buy", buy) + "\n"
+	}
+	if sell != nil {
+		txt += describeStats("Sell", sell) + "\n"
+	}
+	if buy != nil && sell != nil {
+		spread := buy.Last - sell.Last
+		mid := buy.Last.Add(sell.Last).MulDiv(1, 2, money.RoundHalfUp)
+		txt += fmt.Sprintf("Spread: %s EUR/BTC now (%.2f%%), %s EUR/BTC on average\n",
+			spread.StringFixed(2), percentOf(spread, mid), (buy.Avg - sell.Avg).StringFixed(2))
+	}
+	return txt, nil
+}
+
+func (c *conversation) HandleVolume(parameters []string) (string, error) {
+	name := "24h"
+	if len(parameters) > 1 {
+		return "I didn't understand that\nHere's how the volume command works:\n" + volumeHelpText, nil
+	} else if len(parameters) == 1 && parameters[0] != "" {
+		name = strings.ToLower(parameters[0])
+	}
+	period, err := parsePeriod(name)
+	if err != nil {
+		return err.Error() + "\n" +
+			"Here's how the volume command works:\n" + volumeHelpText, nil
+	}
+
+	windows := make([]time.Duration, 0, len(periods))
+	for _, d := range periods {
+		if d <= period {
+			windows = append(windows, d)
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i] < windows[j] })
+
+	market := env.String(BITBOT_BL3P_MARKET)
+	to := time.Now()
+	var volumes []datastore.TradeVolume
+	err = datastore.WithUow(c.bot.ds, func(uow datastore.UnitOfWork) error {
+		var err error
+		volumes, err = uow.LoadTradeVolumes(market, to, largestTrades, windows...)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(volumes) == 0 || volumes[len(volumes)-1].Count == 0 {
+		return fmt.Sprintf("I have no %s trades for the last %s", market, name), nil
+	}
+
+	txt := fmt.Sprintf("*BL3P %s trades of the last %s:*\n", market, name)
+	stats := make([]tape.Stats, len(volumes))
+	for i := range volumes {
+		stats[i] = volumeStats(&volumes[i], to)
+		txt += describeVolume(&stats[i]) + "\n"
+	}
+	if largest := stats[len(stats)-1].Largest; len(largest) > 0 {
+		txt += "Largest trades:"
+		for i, l := range largest {
+			if i > 0 {
+				txt += ","
+			}
+			txt += fmt.Sprintf(" %s %s BTC at %s EUR/BTC (%s)",
+				l.Type, l.Amount.StringFixed(5), l.Price.StringFixed(2), time.Unix(l.Date, 0).Format("Jan 2 15:04"))
+		}
+		txt += "\n"
+	}
+	return txt, nil
+}
+
+func (c *conversation) HandleWhales(channelID string, parameters []string) (string, error) {
+	settings := datastore.WhaleAlertSettings{ChannelID: channelID}
+	err := datastore.WithUow(c.bot.ds, func(uow datastore.UnitOfWork) error {
+		if channelSettings, err := uow.LoadWhaleAlertSettings(channelID); err != nil {
+			return err
+		} else if len(channelSettings) > 0 {
+			settings = channelSettings[0]
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(parameters) == 0 || (len(parameters) == 1 && parameters[0] == "") {
+		return whales.Describe(settings) + "\n" + whalesHelpText, nil
+	}
+
+	switch strings.ToLower(parameters[0]) {
+	case "off":
+		if len(parameters) != 1 {
+			return "I didn't understand that\nHere's how the whales command works:\n" + whalesHelpText, nil
+		}
+		settings = datastore.WhaleAlertSettings{ChannelID: channelID}
+	case "size":
+		if len(parameters) != 2 {
+			return "I didn't understand that\nHere's how the whales command works:\n" + whalesHelpText, nil
+		}
+		if amount, err := money.ParseAmount(parameters[1]); err != nil || amount < 0 {
+			return fmt.Sprintf("The size should be an amount of BTC, not '%s'\n%s", parameters[1], whalesHelpText), nil
+		} else {
+			settings.MinAmount = amount
+		}
+	case "sigma":
+		if len(parameters) != 2 {
+			return "I didn't understand that\nHere's how the whales command works:\n" + whalesHelpText, nil
+		}
+		if sigma, err := strconv.ParseFloat(parameters[1], 64); err != nil || sigma < 0 {
+			return fmt.Sprintf("The number of standard deviations should be a number, not '%s'\n%s", parameters[1], whalesHelpText), nil
+		} else {
+			settings.Sigma = sigma
+		}
+	case "move":
+		if len(parameters) != 3 {
+			return "I didn't understand that\nHere's how the whales command works:\n" + whalesHelpText, nil
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(parameters[1], "%"), 64)
+		if err != nil || percent < 0 {
+			return fmt.Sprintf("The percentage should be a number, not '%s'\n%s", parameters[1], whalesHelpText), nil
+		}
+		seconds, err := strconv.ParseInt(parameters[2], 10, 32)
+		if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > whales.MaxMoveWindow {
+			return fmt.Sprintf("The seconds should be a number up to %d, not '%s'\n%s",
+				int(whales.MaxMoveWindow/time.Second), parameters[2], whalesHelpText), nil
+		}
+		settings.MovePercent, settings.MoveSeconds = percent, int32(seconds)
+	default:
+		return "I didn't understand that\nHere's how the whales command works:\n" + whalesHelpText, nil
+	}
+
+	err = datastore.WithUow(c.bot.ds, func(uow datastore.UnitOfWork) error {
+		if settings.IsEmpty() {
+			_, err := uow.DeleteWhaleAlertSettings(channelID)
+			return err
+		}
+		return uow.SaveWhaleAlertSettings(settings)
+	})
+	if err != nil {
+		return "", err
+	}
+	return whales.Describe(settings), nil
+}
+
+// volumeStats converts the stored trade volume of a window ending at end to tape statistics
+func volumeStats(v *datastore.TradeVolume, end time.Time) tape.Stats {
+	s := tape.Stats{
+		Window:     v.Window,
+		End:        end,
+		Count:      v.Count,
+		Volume:     v.Volume,
+		Turnover:   v.Turnover,
+		VWAP:       money.AveragePrice(v.Turnover, v.Volume, money.RoundHalfUp),
+		BuyVolume:  v.BuyVolume,
+		SellVolume: v.SellVolume,
+		Largest:    make([]bl3pfeed.Trade, len(v.Largest)),
+	}
+	for i, t := range v.Largest {
+		s.Largest[i] = bl3pfeed.Trade{
+			Date:        t.Timestamp.Unix(),
+			Marketplace: t.Market,
+			Price:       t.Price,
+			Type:        t.Type,
+			Amount:      t.Amount,
+		}
+	}
+	return s
+}
+
+// describeVolume formats the trade statistics of one window on a single line
+func describeVolume(s *tape.Stats) string {
+	name := s.Window.String()
+	for n, d := range periods {
+		if d == s.Window {
+			name = n
+		}
+	}
+	return fmt.Sprintf("%s: %s BTC (%s EUR) in %d trades, VWAP %s EUR/BTC, bought %s BTC, sold %s BTC, imbalance %+.0f%%",
+		name, s.Volume.StringFixed(5), s.Turnover.StringFixed(2), s.Count, s.VWAP.StringFixed(2),
+		s.BuyVolume.StringFixed(5), s.SellVolume.StringFixed(5), 100*s.Imbalance())
+}
+
+// describeStats formats the statistics of one sample type on a single line
+func describeStats(name string, s *datastore.PriceSampleStats) string {
+	return fmt.Sprintf("%s: %s -> %s EUR/BTC (%+.2f%%), min %s, max %s, avg %s, volatility %.3f%% over %d samples",
+		name, s.First.StringFixed(2), s.Last.StringFixed(2), s.Change(),
+		s.Min.StringFixed(2), s.Max.StringFixed(2), s.Avg.StringFixed(2), s.Volatility, s.Count)
+}
+
+// percentOf returns part as a percentage of total
+func percentOf(part, total money.Price) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(total)
+}
+
+// describeSeries formats the first and last price of the series like: buy 8000.00 -> 8100.00 EUR/BTC
+func describeSeries(s chart.Series) string {
+	if len(s.Points) == 0 {
+		return "no " + s.Name + " prices"
+	}
+	first, last := s.Points[0], s.Points[len(s.Points)-1]
+	return fmt.Sprintf("%s %s -> %s EUR/BTC", s.Name, first.Price.StringFixed(2), last.Price.StringFixed(2))
+}
+
+// sparklines renders the series as text, for channels where the bot can't upload files
+func sparklines(series ...chart.Series) string {
+	txt := "```"
+	for _, s := range series {
+		if len(s.Points) > 0 {
+			_, _, min, max, _ := chart.Bounds(s)
+			txt += fmt.Sprintf("%-4s %s  %s - %s\n", s.Name, chart.Sparkline(s.Points, sparklineWidth), min.StringFixed(2), max.StringFixed(2))
+		}
+	}
+	return strings.TrimSuffix(txt, "\n") + "```"
+}
+
+// parsePeriod parses a period like 1h, 24h, 7d or 30d
+func parsePeriod(s string) (time.Duration, error) {
+	if d, ok := periods[s]; ok {
+		return d, nil
+	}
+	return 0, fmt.Errorf("The period should be 1h, 24h, 7d or 30d, not '%s'", s)
+}
+
+// newPriceAlert parses an alert like: buy above 8000
+func newPriceAlert(userID, action, direction, price string) (datastore.PriceAlert, error) {
+	alert := datastore.PriceAlert{UserID: userID}
+	switch strings.ToLower(action) {
+	case prices.ActionBuy:
+		alert.Action = datastore.AlertActionBuy
+	case prices.ActionSell:
+		alert.Action = datastore.AlertActionSell
+	default:
+		return alert, fmt.Errorf("The action should be buy or sell, not '%s'", action)
+	}
+	switch strings.ToLower(direction) {
+	case "above":
+		alert.Direction = datastore.AlertAbove
+	case "below":
+		alert.Direction = datastore.AlertBelow
+	default:
+		return alert, fmt.Errorf("The direction should be above or below, not '%s'", direction)
+	}
+	p, err := money.ParsePrice(price)
+	if err != nil || p <= 0 {
+		return alert, fmt.Errorf("The price should be a positive number like 1234.56 with at most 5 decimals, not '%s'", price)
+	}
+	alert.Price = p
+	return alert, nil
+}
+
+// venueLink returns where the quote can be traded, e.g. the bitonic buy page
+func venueLink(response *prices.Response) string {
+	switch response.Source {
+	case bitonic.Name:
+		return fmt.Sprintf("\n https://bitonic.nl/#%s", response.Request.Action)
+	case "":
+		return ""
+	default:
+		return " at " + response.Source
+	}
+}
+
+func (c *conversation) HandleCompare(parameters []string) (string, error) {
+	if len(parameters) != 2 {
+		return "I didn't understand that\nHere's how the compare command works:\n" + compareHelpText, nil
+	}
+	if len(c.bot.venues) < 2 {
+		return "I can only compare prices when the BL3P order book is enabled", nil
+	}
+
+	txt := ""
+	for _, action := range []string{prices.ActionBuy, prices.ActionSell} {
+		request, err := newPriceRequest(action, parameters[0], parameters[1])
+		if err != nil {
+			return err.Error() + "\n" +
+				"Here's how the compare command works:\n" + compareHelpText, nil
+		}
+
+		// quote all venues at the same time
+		pending := make([]<-chan *prices.Response, len(c.bot.venues))
+		for i, venue := range c.bot.venues {
+			pending[i] = prices.RequestPrice(venue, request)
+		}
+		responses := make([]*prices.Response, len(pending))
+		for i := range pending {
+			responses[i] = <-pending[i]
+		}
+
+		txt += compareResponses(action, request, responses[0], responses[1]) + "\n"
+	}
+	return txt, nil
+}
+
+// compareResponses formats the quotes of two venues and which one is better
+func compareResponses(action string, request *prices.Request, a, b *prices.Response) string {
+	amount := request.Btc.String() + " BTC"
+	if request.Currency == prices.CurrencyEur {
+		amount = "for " + request.Eur.StringFixed(2) + " EUR"
+	}
+	verb := "Buying"
+	if action == prices.ActionSell {
+		verb = "Selling"
+	}
+
+	txt := fmt.Sprintf("*%s %s:*\n", verb, amount)
+	for _, r := range []*prices.Response{a, b} {
+		if r.Error != "" {
+			txt += fmt.Sprintf("%s: %s\n", r.Source, r.Error)
+		} else {
+			txt += fmt.Sprintf("%s: %s BTC for %s EUR ( %s EUR/BTC ), %s old\n",
+				r.Source, r.Btc, r.Eur.StringFixed(2), r.Price.StringFixed(2), formatAge(time.Since(r.Time)))
+		}
+	}
+	if a.Error != "" || b.Error != "" {
+		return txt + "I can't compare the prices"
+	}
+
+	comparison, err := prices.Compare(*a, *b)
+	if err != nil {
+		return txt + "I can't compare the prices: " + err.Error()
+	}
+	if comparison.Best.Price == comparison.Worst.Price {
+		return txt + "Both venues have the same price"
+	}
+	if action == prices.ActionBuy {
+		return txt + fmt.Sprintf("%s is cheaper by %s EUR (%.2f%%)", comparison.Best.Source, comparison.Difference.StringFixed(2), comparison.Percent)
+	}
+	return txt + fmt.Sprintf("%s pays %s EUR more (%.2f%%)", comparison.Best.Source, comparison.Difference.StringFixed(2), comparison.Percent)
+}
+
+// formatAge formats the age of a data point in whole seconds
+func formatAge(age time.Duration) string {
+	if age < time.Second {
+		return "<1s"
+	}
+	return (age - age%time.Second).String()
+}
+
+// newPriceRequest parses the amount in the given currency, amounts with more decimals than the currency supports are rejected.
+func newPriceRequest(action, amount, currency string) (*prices.Request, error) {
+	request := &prices.Request{
+		Action:   action,
+		Currency: strings.ToLower(currency),
+	}
+	switch request.Currency {
+	case prices.CurrencyBtc:
+		btc, err := money.ParseAmount(amount)
+		if err != nil {
+			return nil, fmt.Errorf("The amount should be a number like 1.23 with at most 8 decimals\n%s", err.Error())
+		}
+		request.Btc = btc
+	case prices.CurrencyEur:
+		eur, err := money.ParsePrice(amount)
+		if err != nil {
+			return nil, fmt.Errorf("The amount should be a number like 1.23 with at most 5 decimals\n%s", err.Error())
+		}
+		request.Eur = eur
+	default:
+		return nil, fmt.Errorf("The currency should be btc or eur, not '%s'", currency)
+	}
+	return request, nil
+}
@@ -9,13 +9,88 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/pkg/errors"
+	"strings"
+	"github.com/resc/rescbits/candles"
+	"github.com/resc/rescbits/money"
 )
 
 const (
 	queryInsertPriceSample      = "INSERT INTO public.pricesamples (timestamp,type,price) VALUES ($1, $2, $3)"
-	querySelectPriceSample      = "SELECT timestamp,type,price FROM public.pricesamples WHERE timestamp BETWEEN $1 AND $2 ORDER BY timestamp LIMIT $3"
-	querySelectPriceSampleCount = "SELECT count(timestamp) FROM public.pricesamples WHERE  $1 <= timestamp AND timestamp < $2"
+	querySelectPriceSample      = "SELECT timestamp,type,avg FROM " + priceSampleHistory + " h WHERE timestamp BETWEEN $1 AND $2 ORDER BY timestamp LIMIT $3"
+	querySelectPriceSampleCount = "SELECT count(timestamp) FROM " + priceSampleHistory + " h WHERE  $1 <= timestamp AND timestamp < $2"
 	queryDeletePriceSamples     = "DELETE FROM public.pricesamples WHERE  $1 <= timestamp AND timestamp < $2"
+	queryDeletePriceRollups     = "DELETE FROM public.pricesamplerollups WHERE  $1 <= timestamp AND timestamp < $2"
+
+	// priceSampleHistory combines the raw samples with the rollups of the older samples.
+	// Compacting replaces the samples with their rollups in one transaction, so every period is stored at a single resolution.
+	priceSampleHistory = `(SELECT timestamp, type, price AS open, price AS high, price AS low, price AS close, price AS avg, 1 AS count FROM public.pricesamples
+UNION ALL SELECT timestamp, type, open, high, low, close, avg, count FROM public.pricesamplerollups)`
+
+	// the compact queries aggregate the rows before $3 into rollups of $1 seconds, rollups that already exist are merged
+	queryCompactPriceSamples = `INSERT INTO public.pricesamplerollups AS r (timestamp,resolution,type,open,high,low,close,closetimestamp,avg,count)
+SELECT to_timestamp(bucket * $1::BIGINT) AT TIME ZONE 'UTC', $1::INT, type, (array_agg(price ORDER BY timestamp ASC))[1], max(price), min(price), (array_agg(price ORDER BY timestamp DESC))[1], max(timestamp), round(avg(price))::BIGINT, count(*)
+FROM (SELECT floor(extract(epoch FROM timestamp) / $1::BIGINT)::BIGINT AS bucket, timestamp, type, price FROM public.pricesamples WHERE timestamp < $2) s
+GROUP BY bucket, type ` + mergePriceRollups
+	queryCompactPriceRollups = `INSERT INTO public.pricesamplerollups AS r (timestamp,resolution,type,open,high,low,close,closetimestamp,avg,count)
+SELECT to_timestamp(bucket * $1::BIGINT) AT TIME ZONE 'UTC', $1::INT, type, (array_agg(open ORDER BY timestamp ASC))[1], max(high), min(low), (array_agg(close ORDER BY closetimestamp DESC))[1], max(closetimestamp), round(sum(avg * count)::NUMERIC / sum(count))::BIGINT, sum(count)
+FROM (SELECT floor(extract(epoch FROM timestamp) / $1::BIGINT)::BIGINT AS bucket, timestamp, type, open, high, low, close, closetimestamp, avg, count FROM public.pricesamplerollups WHERE resolution = $3 AND timestamp < $2) s
+GROUP BY bucket, type ` + mergePriceRollups
+	// a merged rollup keeps the close of the newest sample, which isn't always the close of the rollup that's merged in
+	mergePriceRollups = `ON CONFLICT (resolution, type, timestamp) DO UPDATE SET high = greatest(r.high, EXCLUDED.high), low = least(r.low, EXCLUDED.low),
+close = CASE WHEN EXCLUDED.closetimestamp >= r.closetimestamp THEN EXCLUDED.close ELSE r.close END, closetimestamp = greatest(r.closetimestamp, EXCLUDED.closetimestamp),
+avg = round((r.avg * r.count + EXCLUDED.avg * EXCLUDED.count)::NUMERIC / (r.count + EXCLUDED.count))::BIGINT, count = r.count + EXCLUDED.count`
+	queryDeleteCompactedPriceSamples = "DELETE FROM public.pricesamples WHERE timestamp < $1"
+	queryDeleteCompactedPriceRollups = "DELETE FROM public.pricesamplerollups WHERE resolution = $2 AND timestamp < $1"
+
+	queryInsertTrade      = "INSERT INTO public.trades (market,timestamp,type,price,amount) VALUES ($1, $2, $3, $4, $5)"
+	querySelectTrade      = "SELECT market,timestamp,type,price,amount FROM public.trades WHERE market = $1 AND timestamp BETWEEN $2 AND $3 ORDER BY timestamp, id LIMIT $4"
+	querySelectTradeCount = "SELECT count(timestamp) FROM public.trades WHERE market = $1 AND timestamp BETWEEN $2 AND $3"
+
+	// the volume of a window includes the trades after its start up to and including its end, the turnover rounds per trade
+	querySelectTradeVolume = `SELECT count(*), coalesce(sum(amount), 0)::BIGINT, coalesce(sum(round(price::NUMERIC * amount / 100000000)), 0)::BIGINT,
+coalesce(sum(amount) FILTER (WHERE type = 'buy'), 0)::BIGINT, coalesce(sum(amount) FILTER (WHERE type = 'sell'), 0)::BIGINT
+FROM public.trades WHERE market = $1 AND $2 < timestamp AND timestamp <= $3`
+	querySelectLargestTrades = "SELECT market,timestamp,type,price,amount FROM public.trades WHERE market = $1 AND $2 < timestamp AND timestamp <= $3 ORDER BY amount DESC, timestamp, id LIMIT $4"
+
+	// the candle queries bucket the rows by the number of interval seconds since the epoch
+	querySelectTradeCandles = `SELECT bucket, (array_agg(price ORDER BY timestamp ASC))[1], max(price), min(price), (array_agg(price ORDER BY timestamp DESC))[1], sum(amount)::BIGINT, count(*)
+FROM (SELECT floor(extract(epoch FROM timestamp) / $1)::BIGINT AS bucket, timestamp, price, amount FROM public.trades WHERE market = $2 AND $3 <= timestamp AND timestamp < $4) t
+GROUP BY bucket ORDER BY bucket`
+	querySelectPriceSampleCandles = `SELECT bucket, (array_agg(open ORDER BY timestamp ASC))[1], max(high), min(low), (array_agg(close ORDER BY timestamp DESC))[1], 0::BIGINT, sum(count)::BIGINT
+FROM (SELECT floor(extract(epoch FROM timestamp) / $1)::BIGINT AS bucket, timestamp, open, high, low, close, count FROM ` + priceSampleHistory + ` h WHERE type = $2 AND $3 <= timestamp AND timestamp < $4) t
+GROUP BY bucket ORDER BY bucket`
+
+	// the volatility is the standard deviation of the percent changes between consecutive samples of a type
+	querySelectPriceSampleStats = `SELECT type, sum(count)::BIGINT, min(low), max(high), round(sum(avg * count)::NUMERIC / sum(count))::BIGINT,
+(array_agg(open ORDER BY timestamp ASC))[1], (array_agg(close ORDER BY timestamp DESC))[1], min(timestamp), max(timestamp),
+coalesce(stddev_samp(change), 0)::FLOAT8
+FROM (SELECT type, timestamp, open, high, low, close, avg, count, 100.0 * (avg - lag(avg) OVER w) / nullif(lag(avg) OVER w, 0) AS change
+FROM ` + priceSampleHistory + ` h WHERE $1 <= timestamp AND timestamp < $2 WINDOW w AS (PARTITION BY type ORDER BY timestamp)) s
+GROUP BY type ORDER BY type`
+
+	queryInsertPriceAlert         = "INSERT INTO public.pricealerts (userid,action,direction,price,lasttriggertimestamp,triggercount,armed) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id"
+	querySelectPriceAlerts        = "SELECT id,userid,action,direction,price,lasttriggertimestamp,triggercount,armed FROM public.pricealerts"
+	queryDeletePriceAlert         = "DELETE FROM public.pricealerts WHERE id = $1"
+	queryResetPriceAlertTrigger   = "UPDATE public.pricealerts SET triggercount = 0 WHERE id = $1"
+	queryArmPriceAlert            = "UPDATE public.pricealerts SET armed = TRUE WHERE id = $1"
+	queryIncrementPriceAlertCount = "UPDATE public.pricealerts SET triggercount = triggercount + 1, lasttriggertimestamp = $2, armed = FALSE WHERE id = $1 RETURNING id,userid,action,direction,price,lasttriggertimestamp,triggercount,armed"
+
+	queryUpsertWhaleAlertSettings = `INSERT INTO public.whalealertsettings (channelid,minamount,sigma,movepercent,moveseconds) VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (channelid) DO UPDATE SET minamount = EXCLUDED.minamount, sigma = EXCLUDED.sigma, movepercent = EXCLUDED.movepercent, moveseconds = EXCLUDED.moveseconds`
+	querySelectWhaleAlertSettings = "SELECT channelid,minamount,sigma,movepercent,moveseconds FROM public.whalealertsettings"
+	queryDeleteWhaleAlertSettings = "DELETE FROM public.whalealertsettings WHERE channelid = $1"
+)
+
+const (
+	// AlertActionBuy alerts on the buy price
+	AlertActionBuy int64 = 1
+	// AlertActionSell alerts on the sell price
+	AlertActionSell int64 = 2
+
+	// AlertAbove triggers when the price rises above the alert price
+	AlertAbove int64 = 1
+	// AlertBelow triggers when the price drops below the alert price
+	AlertBelow int64 = 2
 )
 
 /* INSERT
@@ -42,13 +117,45 @@ type (
 		// SavePriceSamples save te given price samples
 		SavePriceSamples(samples ...PriceSample) error
 
-		// LoadPriceSamples loads the the numberof price samples from the given datae
+		// LoadPriceSamples loads the the numberof price samples from the given datae.
+		// Compacted periods return a sample with the average price per rollup.
 		LoadPriceSamples(from time.Time, to time.Time, maxResults int) (results []PriceSample, totalResults int, err error)
 
-		// DeletePriceSamples deletes the samples between from and to.
+		// DeletePriceSamples deletes the samples and rollups between from and to.
 		// It returns the number of deleted entries, or an error
 		DeletePriceSamples(from time.Time, to time.Time) (int, error)
 
+		// CompactPriceSamples replaces the raw samples before the start of the period that contains before with rollups of the resolution.
+		// It returns the number of compacted samples, or an error
+		CompactPriceSamples(resolution time.Duration, before time.Time) (int, error)
+
+		// CompactPriceSampleRollups replaces the rollups of resolution from with rollups of resolution to, before the start of the period that contains before.
+		// It returns the number of compacted rollups, or an error
+		CompactPriceSampleRollups(from time.Duration, to time.Duration, before time.Time) (int, error)
+
+		// SaveTrades saves the given trades, identical trades are saved as separate trades,
+		// so the caller should skip the trades the feed repeats after a reconnect.
+		// It returns the number of saved trades, or an error
+		SaveTrades(trades ...Trade) (int, error)
+
+		// LoadTrades loads at most maxResults trades for the market between from and to, oldest first
+		LoadTrades(market string, from time.Time, to time.Time, maxResults int) (results []Trade, totalResults int, err error)
+
+		// LoadTradeVolumes computes the volume of the trades for the market in every window that ends at to,
+		// in the order of the windows, with at most largest of the largest trades of the window
+		LoadTradeVolumes(market string, to time.Time, largest int, windows ...time.Duration) ([]TradeVolume, error)
+
+		// LoadCandles aggregates the trades for the market between from and to into candles, oldest first.
+		// Intervals without trades are filled with empty candles.
+		LoadCandles(market string, interval time.Duration, from time.Time, to time.Time) ([]candles.Candle, error)
+
+		// LoadPriceSampleCandles aggregates the price samples of the type (B/S) between from and to into candles, oldest first.
+		// Intervals without samples are filled with empty candles.
+		LoadPriceSampleCandles(sampleType string, interval time.Duration, from time.Time, to time.Time) ([]candles.Candle, error)
+
+		// LoadPriceSampleStats computes the statistics of the price samples between from and to, one row per sample type (B/S)
+		LoadPriceSampleStats(from time.Time, to time.Time) ([]PriceSampleStats, error)
+
 		// LoadAlerts loads all alerts for the users or all alerts if no userID is supplied
 		LoadAlerts(userID ...string) ([]PriceAlert, error)
 
@@ -58,13 +165,26 @@ type (
 		// SaveAlert saves a new alert
 		SaveAlert(alert PriceAlert) (PriceAlert, error)
 
-		// Resets the buy and sell trigger counts
+		// Resets the trigger count
 		ResetAlertTriggerCount(id int64) error
 
-		// UpdateBuyAlert updates the alert by incrementing the buy trigger count by 1 and updating the buy trigger timestamp
+		// ArmAlert arms the alert, because the price is on the other side of the alert price
+		ArmAlert(id int64) error
+
+		// IncrementAlertTriggerCount updates the alert by incrementing the trigger count by 1 and updating the trigger timestamp,
+		// the alert is disarmed until the price is back on the other side of the alert price.
 		// returns the updated PriceAlert
 		IncrementAlertTriggerCount(id int64, timestamp time.Time) (PriceAlert, error)
 
+		// LoadWhaleAlertSettings loads the whale alert settings of the channels or of all channels if no channelID is supplied
+		LoadWhaleAlertSettings(channelID ...string) ([]WhaleAlertSettings, error)
+
+		// SaveWhaleAlertSettings saves the settings, replacing the existing settings of the channel
+		SaveWhaleAlertSettings(settings WhaleAlertSettings) error
+
+		// DeleteWhaleAlertSettings deletes the settings of the channel, it returns the number of deleted settings
+		DeleteWhaleAlertSettings(channelID string) (int, error)
+
 		// Commits the transaction
 		Commit() error
 
@@ -80,17 +200,41 @@ type (
 		// The user that set the price alert.
 		UserID string
 
-		// Action can be buy or sell
+		// Action can be buy or sell, see AlertActionBuy and AlertActionSell
 		Action int64
 
-		// Price in 1e5 EUR / BTC
-		Price int64
+		// Direction can be above or below, see AlertAbove and AlertBelow
+		Direction int64
+
+		// Price in EUR / BTC
+		Price money.Price
 
 		// LastTriggerTimestamp is the last time when the alert was triggered
 		LastTriggerTimestamp time.Time
 
 		// TriggerCount  is the number of times the alert was triggered
 		TriggerCount int32
+
+		// Armed is true when the price was on the other side of the alert price since the last trigger,
+		// only armed alerts trigger, so they trigger when the price crosses the alert price
+		Armed bool
+	}
+
+	// WhaleAlertSettings are the thresholds of the large trade and price move alerts of a slack channel,
+	// a zero threshold disables that alert
+	WhaleAlertSettings struct {
+		// The channel the alerts are posted to
+		ChannelID string
+
+		// MinAmount alerts on trades of at least this amount of BTC
+		MinAmount money.Amount
+
+		// Sigma alerts on trades that are this many standard deviations above the average amount of the recent trades
+		Sigma float64
+
+		// MovePercent alerts when the price moves this percentage within MoveSeconds
+		MovePercent float64
+		MoveSeconds int32
 	}
 )
 
@@ -101,11 +245,95 @@ type (
 		Timestamp time.Time
 		// Type  B/S for Buy/Sell
 		Type string
-		// SellPrice in 1e5 EUR / BTC
-		Price int64
+		// Price in EUR / BTC
+		Price money.Price
+	}
+)
+
+type (
+	// PriceSampleStats are the statistics of the price samples of one type in a period
+	PriceSampleStats struct {
+		// Type  B/S for Buy/Sell
+		Type string
+		// Count is the number of samples
+		Count int
+		// Min, Max, Avg, First and Last price in EUR / BTC
+		Min   money.Price
+		Max   money.Price
+		Avg   money.Price
+		First money.Price
+		Last  money.Price
+		// Time of the first and last sample
+		FirstTimestamp time.Time
+		LastTimestamp  time.Time
+		// Volatility is the standard deviation of the percent changes between consecutive samples
+		Volatility float64
+	}
+)
+
+type (
+	// Trade is a trade on the BL3P exchange
+	Trade struct {
+		// Market like BTCEUR
+		Market string
+		// Time of the trade
+		Timestamp time.Time
+		// Type  buy/sell
+		Type string
+		// Price in EUR / BTC
+		Price money.Price
+		// Amount in BTC
+		Amount money.Amount
+	}
+
+	// TradeVolume is the volume of the trades of a market in a window
+	TradeVolume struct {
+		Window time.Duration
+		Count  int
+		Volume money.Amount
+		// Turnover is the EUR value of the volume
+		Turnover money.Price
+		// BuyVolume and SellVolume are the volumes of the trades where the buyer or the seller was the aggressor
+		BuyVolume  money.Amount
+		SellVolume money.Amount
+		// Largest are the largest trades, largest first
+		Largest []Trade
 	}
 )
 
+// Scan scans a row like: count, volume, turnover, buyvolume, sellvolume
+func (v *TradeVolume) Scan(r *sql.Row) error {
+	return r.Scan(&v.Count, &v.Volume, &v.Turnover, &v.BuyVolume, &v.SellVolume)
+}
+
+// Scan scans a row like: id, userid, action, direction, price, lasttriggertimestamp, triggercount, armed
+func (a *PriceAlert) Scan(r *sql.Rows) error {
+	return r.Scan(&a.Id, &a.UserID, &a.Action, &a.Direction, &a.Price, &a.LastTriggerTimestamp, &a.TriggerCount, &a.Armed)
+}
+
+// Scan scans a row like: channelid, minamount, sigma, movepercent, moveseconds
+func (s *WhaleAlertSettings) Scan(r *sql.Rows) error {
+	return r.Scan(&s.ChannelID, &s.MinAmount, &s.Sigma, &s.MovePercent, &s.MoveSeconds)
+}
+
+// IsEmpty returns true if all alerts are disabled
+func (s *WhaleAlertSettings) IsEmpty() bool {
+	return s.MinAmount <= 0 && s.Sigma <= 0 && (s.MovePercent <= 0 || s.MoveSeconds <= 0)
+}
+
+// Scan scans a row like: type, count, min, max, avg, first, last, firsttimestamp, lasttimestamp, volatility
+func (s *PriceSampleStats) Scan(r *sql.Rows) error {
+	return r.Scan(&s.Type, &s.Count, &s.Min, &s.Max, &s.Avg, &s.First, &s.Last, &s.FirstTimestamp, &s.LastTimestamp, &s.Volatility)
+}
+
+// Change returns the percent change from the first to the last price
+func (s *PriceSampleStats) Change() float64 {
+	if s.First == 0 {
+		return 0
+	}
+	return 100 * float64(s.Last-s.First) / float64(s.First)
+}
+
 func (s *PriceSample) Scan(r *sql.Rows) error {
 	return r.Scan(&s.Timestamp, &s.Type, &s.Price)
 }
@@ -141,6 +369,19 @@ func (ds *datastore) StartUow() (UnitOfWork, error) {
 	}
 }
 
+// WithUow runs f in a unit of work, which is committed if f succeeds and rolled back otherwise
+func WithUow(ds DataStore, f func(uow UnitOfWork) error) error {
+	if uow, err := ds.StartUow(); err != nil {
+		return err
+	} else {
+		if err := f(uow); err != nil {
+			uow.Rollback()
+			return err
+		}
+		return uow.Commit()
+	}
+}
+
 func (ds *datastore) Ping() error {
 	return ds.db.Ping()
 }
@@ -227,42 +468,359 @@ func (u *uow) LoadPriceSamples(from time.Time, to time.Time, maxResults int) ([]
 }
 
 func (u *uow) DeletePriceSamples(from time.Time, to time.Time) (int, error) {
-	if stmt, err := u.tx.Prepare(queryDeletePriceSamples); err != nil {
+	deleted := 0
+	for _, query := range []string{queryDeletePriceSamples, queryDeletePriceRollups} {
+		if res, err := u.tx.Exec(query, from.UTC(), to.UTC()); err != nil {
+			return 0, err
+		} else {
+			if rowsAffected, err := res.RowsAffected(); err != nil {
+				return 0, err
+			} else {
+				deleted += int(rowsAffected)
+			}
+		}
+	}
+	return deleted, nil
+}
+
+func (u *uow) CompactPriceSamples(resolution time.Duration, before time.Time) (int, error) {
+	seconds, err := resolutionSeconds(resolution)
+	if err != nil {
+		return 0, err
+	}
+	// only compact whole periods, samples in the current period could still be added
+	before = before.UTC().Truncate(resolution)
+	if _, err := u.tx.Exec(queryCompactPriceSamples, seconds, before); err != nil {
+		return 0, err
+	}
+	return u.deleteCompacted(queryDeleteCompactedPriceSamples, before)
+}
+
+func (u *uow) CompactPriceSampleRollups(from time.Duration, to time.Duration, before time.Time) (int, error) {
+	fromSeconds, err := resolutionSeconds(from)
+	if err != nil {
+		return 0, err
+	}
+	toSeconds, err := resolutionSeconds(to)
+	if err != nil {
+		return 0, err
+	}
+	if to <= from || to%from != 0 {
+		return 0, errors.Errorf("Invalid rollup resolution %v, should be a multiple of %v", to, from)
+	}
+	before = before.UTC().Truncate(to)
+	if _, err := u.tx.Exec(queryCompactPriceRollups, toSeconds, before, fromSeconds); err != nil {
+		return 0, err
+	}
+	return u.deleteCompacted(queryDeleteCompactedPriceRollups, before, fromSeconds)
+}
+
+func (u *uow) deleteCompacted(query string, args ...interface{}) (int, error) {
+	if res, err := u.tx.Exec(query, args...); err != nil {
 		return 0, err
 	} else {
-		defer stmt.Close()
-		if res, err := stmt.Exec(from.UTC(), to.UTC()); err != nil {
+		if rowsAffected, err := res.RowsAffected(); err != nil {
 			return 0, err
 		} else {
-			if rowsAffected, err := res.RowsAffected(); err != nil {
+			return int(rowsAffected), nil
+		}
+	}
+}
+
+func resolutionSeconds(resolution time.Duration) (int64, error) {
+	seconds := int64(resolution / time.Second)
+	if seconds < 1 || resolution%time.Second != 0 {
+		return 0, errors.Errorf("Invalid rollup resolution %v, should be a whole number of seconds", resolution)
+	}
+	return seconds, nil
+}
+
+func (u *uow) SaveTrades(trades ...Trade) (int, error) {
+	if stmt, err := u.tx.Prepare(queryInsertTrade); err != nil {
+		return 0, err
+	} else {
+		defer stmt.Close()
+		saved := 0
+		for i := range trades {
+			t := trades[i]
+			if res, err := stmt.Exec(t.Market, t.Timestamp.UTC(), t.Type, t.Price, t.Amount); err != nil {
+				return 0, err
+			} else {
+				if rowsAffected, err := res.RowsAffected(); err != nil {
+					return 0, err
+				} else {
+					saved += int(rowsAffected)
+				}
+			}
+		}
+		return saved, nil
+	}
+}
+
+func (u *uow) LoadTrades(market string, from time.Time, to time.Time, maxResults int) ([]Trade, int, error) {
+	totalResults := int64(0)
+	if err := u.tx.QueryRow(querySelectTradeCount, market, from.UTC(), to.UTC()).Scan(&totalResults); err != nil {
+		return nil, 0, err
+	}
+
+	if totalResults == 0 {
+		return nil, 0, nil
+	}
+
+	if int(totalResults) < maxResults {
+		maxResults = int(totalResults)
+	}
+
+	if rows, err := u.tx.Query(querySelectTrade, market, from.UTC(), to.UTC(), maxResults); err != nil {
+		return nil, 0, err
+	} else {
+		defer rows.Close()
+		results := make([]Trade, 0, maxResults)
+		for rows.Next() {
+			row := Trade{}
+			if err := rows.Scan(&row.Market, &row.Timestamp, &row.Type, &row.Price, &row.Amount); err != nil {
+				return nil, 0, err
+			} else {
+				results = append(results, row)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, 0, err
+		}
+		return results, int(totalResults), nil
+	}
+}
+
+func (u *uow) LoadTradeVolumes(market string, to time.Time, largest int, windows ...time.Duration) ([]TradeVolume, error) {
+	results := make([]TradeVolume, 0, len(windows))
+	for _, w := range windows {
+		v := TradeVolume{Window: w}
+		from := to.Add(-w)
+		if err := v.Scan(u.tx.QueryRow(querySelectTradeVolume, market, from.UTC(), to.UTC())); err != nil {
+			return nil, err
+		}
+		if v.Count > 0 && largest > 0 {
+			if trades, err := u.loadLargestTrades(market, from, to, largest); err != nil {
+				return nil, err
+			} else {
+				v.Largest = trades
+			}
+		}
+		results = append(results, v)
+	}
+	return results, nil
+}
+
+// loadLargestTrades loads the largest trades for the market after from up to and including to, largest first
+func (u *uow) loadLargestTrades(market string, from time.Time, to time.Time, maxResults int) ([]Trade, error) {
+	if rows, err := u.tx.Query(querySelectLargestTrades, market, from.UTC(), to.UTC(), maxResults); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		results := make([]Trade, 0, maxResults)
+		for rows.Next() {
+			row := Trade{}
+			if err := rows.Scan(&row.Market, &row.Timestamp, &row.Type, &row.Price, &row.Amount); err != nil {
+				return nil, err
+			} else {
+				results = append(results, row)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+}
+
+func (u *uow) LoadPriceSampleStats(from time.Time, to time.Time) ([]PriceSampleStats, error) {
+	if rows, err := u.tx.Query(querySelectPriceSampleStats, from.UTC(), to.UTC()); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		results := make([]PriceSampleStats, 0)
+		for rows.Next() {
+			row := PriceSampleStats{}
+			if err := row.Scan(rows); err != nil {
+				return nil, err
+			} else {
+				results = append(results, row)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+}
+
+func (u *uow) LoadAlerts(userID ...string) ([]PriceAlert, error) {
+	query := querySelectPriceAlerts
+	args := make([]interface{}, 0, len(userID))
+	if len(userID) > 0 {
+		placeholders := make([]string, 0, len(userID))
+		for i := range userID {
+			args = append(args, userID[i])
+			placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+		}
+		query += " WHERE userid IN (" + strings.Join(placeholders, ",") + ")"
+	}
+	query += " ORDER BY id"
+
+	if rows, err := u.tx.Query(query, args...); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		results := make([]PriceAlert, 0)
+		for rows.Next() {
+			row := PriceAlert{}
+			if err := row.Scan(rows); err != nil {
+				return nil, err
+			} else {
+				results = append(results, row)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+}
+
+func (u *uow) DeleteAlerts(id ...int64) (int, error) {
+	if stmt, err := u.tx.Prepare(queryDeletePriceAlert); err != nil {
+		return 0, err
+	} else {
+		defer stmt.Close()
+		deleted := 0
+		for i := range id {
+			if res, err := stmt.Exec(id[i]); err != nil {
 				return 0, err
 			} else {
-				return int(rowsAffected), nil
+				if rowsAffected, err := res.RowsAffected(); err != nil {
+					return 0, err
+				} else {
+					deleted += int(rowsAffected)
+				}
 			}
 		}
+		return deleted, nil
 	}
-	return 0, nil
 }
 
+func (u *uow) SaveAlert(alert PriceAlert) (PriceAlert, error) {
+	if alert.Id != 0 {
+		return alert, errors.Errorf("Alert %d already saved", alert.Id)
+	}
+	if alert.Action != AlertActionBuy && alert.Action != AlertActionSell {
+		return alert, errors.Errorf("Invalid alert action %d", alert.Action)
+	}
+	if alert.Direction != AlertAbove && alert.Direction != AlertBelow {
+		return alert, errors.Errorf("Invalid alert direction %d", alert.Direction)
+	}
 
-func (*uow) LoadAlerts(userID ...string) ([]PriceAlert, error) {
-	panic("implement me")
+	err := u.tx.QueryRow(queryInsertPriceAlert, alert.UserID, alert.Action, alert.Direction, alert.Price, alert.LastTriggerTimestamp.UTC(), alert.TriggerCount, alert.Armed).Scan(&alert.Id)
+	if err != nil {
+		return alert, err
+	}
+	return alert, nil
 }
 
-func (*uow) DeleteAlerts(id ...int64) (int, error) {
-	panic("implement me")
+func (u *uow) ResetAlertTriggerCount(id int64) error {
+	if res, err := u.tx.Exec(queryResetPriceAlertTrigger, id); err != nil {
+		return err
+	} else {
+		if rowsAffected, err := res.RowsAffected(); err != nil {
+			return err
+		} else if rowsAffected < 1 {
+			return errors.Errorf("Alert %d not found", id)
+		}
+		return nil
+	}
+}
+
+func (u *uow) ArmAlert(id int64) error {
+	if res, err := u.tx.Exec(queryArmPriceAlert, id); err != nil {
+		return err
+	} else {
+		if rowsAffected, err := res.RowsAffected(); err != nil {
+			return err
+		} else if rowsAffected < 1 {
+			return errors.Errorf("Alert %d not found", id)
+		}
+		return nil
+	}
 }
 
-func (*uow) SaveAlert(alert PriceAlert) (PriceAlert, error) {
-	panic("implement me")
+func (u *uow) IncrementAlertTriggerCount(id int64, timestamp time.Time) (PriceAlert, error) {
+	alert := PriceAlert{}
+	if rows, err := u.tx.Query(queryIncrementPriceAlertCount, id, timestamp.UTC()); err != nil {
+		return alert, err
+	} else {
+		defer rows.Close()
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return alert, err
+			}
+			return alert, errors.Errorf("Alert %d not found", id)
+		}
+		if err := alert.Scan(rows); err != nil {
+			return alert, err
+		}
+		return alert, rows.Err()
+	}
 }
 
-func (*uow) ResetAlertTriggerCount(id int64) error {
-	panic("implement me")
+func (u *uow) LoadCandles(market string, interval time.Duration, from time.Time, to time.Time) ([]candles.Candle, error) {
+	return u.loadCandles(querySelectTradeCandles, market, interval, from, to)
 }
 
-func (*uow) IncrementAlertTriggerCount(id int64, timestamp time.Time) (PriceAlert, error) {
-	panic("implement me")
+func (u *uow) LoadPriceSampleCandles(sampleType string, interval time.Duration, from time.Time, to time.Time) ([]candles.Candle, error) {
+	return u.loadCandles(querySelectPriceSampleCandles, sampleType, interval, from, to)
+}
+
+func (u *uow) loadCandles(query string, filter string, interval time.Duration, from time.Time, to time.Time) ([]candles.Candle, error) {
+	seconds := int64(interval / time.Second)
+	if seconds < 1 || interval%time.Second != 0 {
+		return nil, errors.Errorf("Invalid candle interval %v, should be a whole number of seconds", interval)
+	}
+
+	if rows, err := u.tx.Query(query, seconds, filter, from.UTC(), to.UTC()); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		results := make([]candles.Candle, 0)
+		for rows.Next() {
+			bucket := int64(0)
+			row := candles.Candle{Interval: interval}
+			if err := rows.Scan(&bucket, &row.Open, &row.High, &row.Low, &row.Close, &row.Volume, &row.Count); err != nil {
+				return nil, err
+			} else {
+				row.Start = time.Unix(bucket*seconds, 0).UTC()
+				results = append(results, row)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return candles.FillGaps(results, interval), nil
+	}
+}
+
+// PriceSampleCandles aggregates the price samples of the type (B/S) into candles, oldest first
+func PriceSampleCandles(samples []PriceSample, sampleType string, interval time.Duration) ([]candles.Candle, error) {
+	cc := make([]candles.Candle, 0)
+	b, err := candles.NewBuilder(interval, candles.UntilFlush, func(c candles.Candle) { cc = append(cc, c) })
+	if err != nil {
+		return nil, err
+	}
+	for i := range samples {
+		if samples[i].Type == sampleType {
+			b.AddSample(samples[i].Timestamp, samples[i].Price)
+		}
+	}
+	b.Flush()
+	return cc, nil
 }
 
 func (u *uow) Commit() error {
@@ -272,3 +830,59 @@ func (u *uow) Commit() error {
 func (u *uow) Rollback() error {
 	return u.tx.Rollback()
 }
+
+func (u *uow) LoadWhaleAlertSettings(channelID ...string) ([]WhaleAlertSettings, error) {
+	query := querySelectWhaleAlertSettings
+	args := make([]interface{}, 0, len(channelID))
+	if len(channelID) > 0 {
+		placeholders := make([]string, 0, len(channelID))
+		for i := range channelID {
+			args = append(args, channelID[i])
+			placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+		}
+		query += " WHERE channelid IN (" + strings.Join(placeholders, ",") + ")"
+	}
+	query += " ORDER BY channelid"
+
+	if rows, err := u.tx.Query(query, args...); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		results := make([]WhaleAlertSettings, 0)
+		for rows.Next() {
+			row := WhaleAlertSettings{}
+			if err := row.Scan(rows); err != nil {
+				return nil, err
+			} else {
+				results = append(results, row)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+}
+
+func (u *uow) SaveWhaleAlertSettings(settings WhaleAlertSettings) error {
+	if settings.ChannelID == "" {
+		return errors.New("Whale alert settings need a channel")
+	}
+	if settings.MinAmount < 0 || settings.Sigma < 0 || settings.MovePercent < 0 || settings.MoveSeconds < 0 {
+		return errors.Errorf("Invalid whale alert settings %+v", settings)
+	}
+	_, err := u.tx.Exec(queryUpsertWhaleAlertSettings, settings.ChannelID, settings.MinAmount, settings.Sigma, settings.MovePercent, settings.MoveSeconds)
+	return err
+}
+
+func (u *uow) DeleteWhaleAlertSettings(channelID string) (int, error) {
+	if res, err := u.tx.Exec(queryDeleteWhaleAlertSettings, channelID); err != nil {
+		return 0, err
+	} else {
+		if rowsAffected, err := res.RowsAffected(); err != nil {
+			return 0, err
+		} else {
+			return int(rowsAffected), nil
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 	"github.com/pkg/errors"
 	"time"
+	"github.com/resc/rescbits/money"
 )
 
 func TestUow_SavePriceSamples(t *testing.T) {
@@ -45,7 +46,7 @@ func TestUow_SavePriceSamples(t *testing.T) {
 	samples = make([]PriceSample, 10)
 	for i := 0; i < len(samples); i++ {
 		samples[i] = PriceSample{
-			Price:     int64(i) * 1000,
+			Price:     money.Price(i) * money.Cent,
 			Timestamp: now.Add(time.Duration(-i) * time.Second),
 			Type:      "B",
 		}
@@ -88,3 +89,414 @@ func TestUow_SavePriceSamples(t *testing.T) {
 	}
 
 }
+
+func TestUow_SaveTrades(t *testing.T) {
+	ds, err := Open(TestDbConnStr)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening data store"))
+	}
+	defer ds.Close()
+
+	uow, err := ds.StartUow()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	trades := make([]Trade, 10)
+	for i := 0; i < len(trades); i++ {
+		trades[i] = Trade{
+			Market:    "BTCEUR",
+			Timestamp: now.Add(time.Duration(-i) * time.Second),
+			Type:      "buy",
+			Price:     money.Price(8000+i) * money.Euro,
+			Amount:    money.Bitcoin / 10,
+		}
+	}
+
+	saved, err := uow.SaveTrades(trades...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != len(trades) {
+		t.Fatalf("Expected %d saved trades, got %d", len(trades), saved)
+	}
+
+	// identical trades in the same second are different trades
+	saved, err = uow.SaveTrades(trades[:5]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != 5 {
+		t.Fatalf("Expected identical trades to be saved, got %d saved", saved)
+	}
+
+	err = uow.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uow, err = ds.StartUow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uow.Rollback()
+
+	loaded, totalResults, err := uow.LoadTrades("BTCEUR", now.Add(-time.Minute), now, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totalResults != len(trades)+5 || len(loaded) != 5 {
+		t.Fatalf("Expected 5 of %d trades, got %d of %d", len(trades)+5, len(loaded), totalResults)
+	}
+	if loaded[0].Price != trades[len(trades)-1].Price || loaded[0].Amount != money.Bitcoin/10 {
+		t.Fatalf("Expected the oldest trade first, got %+v", loaded[0])
+	}
+}
+
+func TestUow_LoadTradeVolumes(t *testing.T) {
+	ds, err := Open(TestDbConnStr)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening data store"))
+	}
+	defer ds.Close()
+
+	uow, err := ds.StartUow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uow.Rollback()
+
+	end := time.Date(2017, 12, 2, 12, 0, 0, 0, time.UTC)
+	_, err = uow.SaveTrades(
+		Trade{Market: "VOLUME", Timestamp: end.Add(-2 * time.Hour), Type: "buy", Price: 100 * money.Euro, Amount: 5 * money.Bitcoin},
+		Trade{Market: "VOLUME", Timestamp: end.Add(-30 * time.Minute), Type: "buy", Price: 100 * money.Euro, Amount: money.Bitcoin},
+		Trade{Market: "VOLUME", Timestamp: end.Add(-time.Minute), Type: "sell", Price: 110 * money.Euro, Amount: 2 * money.Bitcoin},
+		Trade{Market: "VOLUME", Timestamp: end, Type: "buy", Price: 120 * money.Euro, Amount: money.Bitcoin / 3},
+		Trade{Market: "VOLUME", Timestamp: end.Add(time.Second), Type: "buy", Price: 120 * money.Euro, Amount: 9 * money.Bitcoin},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volumes, err := uow.LoadTradeVolumes("VOLUME", end, 2, time.Hour, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 2 {
+		t.Fatalf("Expected 2 windows, got %d", len(volumes))
+	}
+	hour := volumes[0]
+	// 100 + 220 + 40 EUR, the turnover of the third of a bitcoin is rounded per trade
+	if hour.Window != time.Hour || hour.Count != 3 || hour.Volume != 3*money.Bitcoin+money.Bitcoin/3 ||
+		hour.Turnover != 360*money.Euro || hour.BuyVolume != money.Bitcoin+money.Bitcoin/3 || hour.SellVolume != 2*money.Bitcoin {
+		t.Fatalf("Unexpected volume of the hour %+v", hour)
+	}
+	if len(hour.Largest) != 2 || hour.Largest[0].Amount != 2*money.Bitcoin || hour.Largest[1].Amount != money.Bitcoin {
+		t.Fatalf("Unexpected largest trades of the hour %+v", hour.Largest)
+	}
+	if day := volumes[1]; day.Count != 4 || day.Largest[0].Amount != 5*money.Bitcoin {
+		t.Fatalf("Unexpected volume of the day %+v", day)
+	}
+
+	volumes, err = uow.LoadTradeVolumes("VOLUME", end.Add(-24*time.Hour), 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 1 || volumes[0].Count != 0 || volumes[0].Volume != 0 || len(volumes[0].Largest) != 0 {
+		t.Fatalf("Expected an empty window, got %+v", volumes)
+	}
+}
+
+func TestUow_LoadCandles(t *testing.T) {
+	ds, err := Open(TestDbConnStr)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening data store"))
+	}
+	defer ds.Close()
+
+	uow, err := ds.StartUow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uow.Rollback()
+
+	start := time.Date(2017, 12, 1, 12, 0, 0, 0, time.UTC)
+	trades := []Trade{
+		{Market: "CANDLE", Timestamp: start.Add(10 * time.Second), Type: "buy", Price: 100, Amount: 1},
+		{Market: "CANDLE", Timestamp: start.Add(20 * time.Second), Type: "buy", Price: 120, Amount: 2},
+		{Market: "CANDLE", Timestamp: start.Add(30 * time.Second), Type: "sell", Price: 90, Amount: 3},
+		{Market: "CANDLE", Timestamp: start.Add(150 * time.Second), Type: "sell", Price: 110, Amount: 4},
+	}
+	if _, err := uow.SaveTrades(trades...); err != nil {
+		t.Fatal(err)
+	}
+
+	cc, err := uow.LoadCandles("CANDLE", time.Minute, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cc) != 3 {
+		t.Fatalf("Expected 3 candles, got %d", len(cc))
+	}
+	if c := cc[0]; !c.Start.Equal(start) || c.Open != 100 || c.High != 120 || c.Low != 90 || c.Close != 90 || c.Volume != 6 || c.Count != 3 {
+		t.Fatalf("Unexpected first candle %+v", c)
+	}
+	if !cc[1].IsEmpty() || cc[1].Close != 90 {
+		t.Fatalf("Expected an empty second candle, got %+v", cc[1])
+	}
+}
+
+func TestUow_PriceAlerts(t *testing.T) {
+	ds, err := Open(TestDbConnStr)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening data store"))
+	}
+	defer ds.Close()
+
+	uow, err := ds.StartUow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uow.Rollback()
+
+	alert, err := uow.SaveAlert(PriceAlert{
+		UserID:    "U123",
+		Action:    AlertActionBuy,
+		Direction: AlertAbove,
+		Price:     9000 * money.Euro,
+		Armed:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alert.Id == 0 {
+		t.Fatal("Expected a generated alert id")
+	}
+	if _, err := uow.SaveAlert(alert); err == nil {
+		t.Fatal("Expected an error when saving an alert twice")
+	}
+
+	other, err := uow.SaveAlert(PriceAlert{UserID: "U456", Action: AlertActionSell, Direction: AlertBelow, Price: 8000 * money.Euro})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alerts, err := uow.LoadAlerts("U123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Id != alert.Id || alerts[0].Price != 9000*money.Euro || !alerts[0].LastTriggerTimestamp.IsZero() || !alerts[0].Armed {
+		t.Fatalf("Unexpected alerts %+v", alerts)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	updated, err := uow.IncrementAlertTriggerCount(alert.Id, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.TriggerCount != 1 || !updated.LastTriggerTimestamp.Equal(now.UTC()) || updated.Armed {
+		t.Fatalf("Unexpected updated alert %+v", updated)
+	}
+
+	if err := uow.ArmAlert(alert.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := uow.ResetAlertTriggerCount(alert.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := uow.DeleteAlerts(alert.Id, other.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Fatalf("Expected 2 deleted alerts, got %d", deleted)
+	}
+}
+
+func TestUow_WhaleAlertSettings(t *testing.T) {
+	ds, err := Open(TestDbConnStr)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening data store"))
+	}
+	defer ds.Close()
+
+	uow, err := ds.StartUow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uow.Rollback()
+
+	if err := uow.SaveWhaleAlertSettings(WhaleAlertSettings{MinAmount: money.Bitcoin}); err == nil {
+		t.Fatal("Expected an error when saving settings without a channel")
+	}
+	if err := uow.SaveWhaleAlertSettings(WhaleAlertSettings{ChannelID: "C123", MinAmount: 10 * money.Bitcoin}); err != nil {
+		t.Fatal(err)
+	}
+	if err := uow.SaveWhaleAlertSettings(WhaleAlertSettings{ChannelID: "C456", Sigma: 4}); err != nil {
+		t.Fatal(err)
+	}
+	// replaces the settings of the channel
+	if err := uow.SaveWhaleAlertSettings(WhaleAlertSettings{ChannelID: "C123", MinAmount: 5 * money.Bitcoin, MovePercent: 2.5, MoveSeconds: 60}); err != nil {
+		t.Fatal(err)
+	}
+
+	settings, err := uow.LoadWhaleAlertSettings("C123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings) != 1 || settings[0].MinAmount != 5*money.Bitcoin || settings[0].MovePercent != 2.5 || settings[0].MoveSeconds != 60 {
+		t.Fatalf("Unexpected settings %+v", settings)
+	}
+	if settings, err := uow.LoadWhaleAlertSettings(); err != nil || len(settings) != 2 {
+		t.Fatalf("Expected the settings of 2 channels, got %+v, %v", settings, err)
+	}
+
+	deleted, err := uow.DeleteWhaleAlertSettings("C123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Fatalf("Expected 1 deleted setting, got %d", deleted)
+	}
+}
+
+func TestUow_LoadPriceSampleStats(t *testing.T) {
+	ds, err := Open(TestDbConnStr)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening data store"))
+	}
+	defer ds.Close()
+
+	uow, err := ds.StartUow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uow.Rollback()
+
+	start := time.Date(2017, 11, 1, 12, 0, 0, 0, time.UTC)
+	err = uow.SavePriceSamples(
+		PriceSample{Timestamp: start, Type: "B", Price: 100 * money.Euro},
+		PriceSample{Timestamp: start.Add(time.Minute), Type: "B", Price: 110 * money.Euro},
+		PriceSample{Timestamp: start.Add(2 * time.Minute), Type: "B", Price: 99 * money.Euro},
+		PriceSample{Timestamp: start, Type: "S", Price: 95 * money.Euro},
+		PriceSample{Timestamp: start.Add(time.Minute), Type: "S", Price: 96 * money.Euro},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := uow.LoadPriceSampleStats(start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("Expected stats for 2 sample types, got %d", len(stats))
+	}
+
+	buy := stats[0]
+	if buy.Type != "B" || buy.Count != 3 || buy.Min != 99*money.Euro || buy.Max != 110*money.Euro ||
+		buy.Avg != 103*money.Euro || buy.First != 100*money.Euro || buy.Last != 99*money.Euro {
+		t.Fatalf("Unexpected buy stats %+v", buy)
+	}
+	if !buy.FirstTimestamp.Equal(start) || !buy.LastTimestamp.Equal(start.Add(2*time.Minute)) {
+		t.Fatalf("Unexpected buy timestamps %+v", buy)
+	}
+	// changes are +10% and -10%
+	if buy.Volatility < 14.14 || buy.Volatility > 14.15 {
+		t.Fatalf("Unexpected buy volatility %f", buy.Volatility)
+	}
+	if change := buy.Change(); change > -0.99 || change < -1.01 {
+		t.Fatalf("Unexpected buy change %f", change)
+	}
+
+	if sell := stats[1]; sell.Type != "S" || sell.Count != 2 || sell.Last != 96*money.Euro {
+		t.Fatalf("Unexpected sell stats %+v", sell)
+	}
+}
+
+func TestUow_CompactPriceSamples(t *testing.T) {
+	ds, err := Open(TestDbConnStr)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening data store"))
+	}
+	defer ds.Close()
+
+	uow, err := ds.StartUow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uow.Rollback()
+
+	start := time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC)
+	samples := make([]PriceSample, 0)
+	for i := 0; i < 24; i++ {
+		// two samples per 5 minutes, 2 hours in total
+		samples = append(samples,
+			PriceSample{Timestamp: start.Add(time.Duration(i) * 5 * time.Minute), Type: "B", Price: money.Price(100+i) * money.Euro},
+			PriceSample{Timestamp: start.Add(time.Duration(i)*5*time.Minute + 30*time.Second), Type: "B", Price: money.Price(102+i) * money.Euro},
+		)
+	}
+	if err := uow.SavePriceSamples(samples...); err != nil {
+		t.Fatal(err)
+	}
+	end := start.Add(2 * time.Hour)
+
+	// the samples in the period that contains before aren't compacted
+	compacted, err := uow.CompactPriceSamples(RollupResolution, start.Add(time.Hour+time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compacted != 24 {
+		t.Fatalf("Expected 24 compacted samples, got %d", compacted)
+	}
+
+	loaded, total, err := uow.LoadPriceSamples(start, end, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 12+24 || len(loaded) != total {
+		t.Fatalf("Expected 12 rollups and 24 samples, got %d of %d", len(loaded), total)
+	}
+	if s := loaded[0]; !s.Timestamp.Equal(start) || s.Price != 101*money.Euro {
+		t.Fatalf("Unexpected first rollup %+v", s)
+	}
+
+	// a late sample before the close of its rollup doesn't replace the close
+	if err := uow.SavePriceSamples(PriceSample{Timestamp: start.Add(55*time.Minute + 10*time.Second), Type: "B", Price: 112 * money.Euro}); err != nil {
+		t.Fatal(err)
+	}
+	compacted, err = uow.CompactPriceSamples(RollupResolution, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compacted != 1 {
+		t.Fatalf("Expected 1 compacted sample, got %d", compacted)
+	}
+
+	compacted, err = uow.CompactPriceSampleRollups(RollupResolution, ArchiveResolution, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compacted != 12 {
+		t.Fatalf("Expected 12 compacted rollups, got %d", compacted)
+	}
+
+	stats, err := uow.LoadPriceSampleStats(start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Count != 49 || stats[0].Min != 100*money.Euro || stats[0].Max != 125*money.Euro || stats[0].First != 100*money.Euro {
+		t.Fatalf("Unexpected stats over the compacted samples %+v", stats)
+	}
+
+	cc, err := uow.LoadPriceSampleCandles("B", time.Hour, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cc) != 2 || cc[0].Count != 25 || cc[0].Open != 100*money.Euro || cc[0].Close != 113*money.Euro {
+		t.Fatalf("Unexpected candles over the compacted samples %+v", cc)
+	}
+}
@@ -0,0 +1,84 @@
+package datastore
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// RollupResolution is the resolution of the samples after the raw retention period
+	RollupResolution = 5 * time.Minute
+	// ArchiveResolution is the resolution of the samples after the rollup retention period, they're kept forever
+	ArchiveResolution = time.Hour
+)
+
+type (
+	// Retention is the retention policy for the price samples
+	Retention struct {
+		// Raw is how long the raw samples are kept
+		Raw time.Duration
+		// Rollup is how long the RollupResolution rollups are kept, counting from now
+		Rollup time.Duration
+	}
+)
+
+// DefaultRetention keeps the raw samples for 7 days and the 5 minute rollups for 90 days
+var DefaultRetention = Retention{
+	Raw:    7 * 24 * time.Hour,
+	Rollup: 90 * 24 * time.Hour,
+}
+
+// Validate checks that the raw samples are kept for at least a rollup period and the rollups longer than the raw samples
+func (r Retention) Validate() error {
+	if r.Raw < RollupResolution {
+		return errors.Errorf("Raw retention %v should be at least %v", r.Raw, RollupResolution)
+	}
+	if r.Rollup < r.Raw+ArchiveResolution {
+		return errors.Errorf("Rollup retention %v should be at least an hour longer than the raw retention %v", r.Rollup, r.Raw)
+	}
+	return nil
+}
+
+// Apply compacts the samples that are older than the retention periods in a single unit of work
+func (r Retention) Apply(ds DataStore, now time.Time) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	uow, err := ds.StartUow()
+	if err != nil {
+		return err
+	}
+
+	samples, err := uow.CompactPriceSamples(RollupResolution, now.Add(-r.Raw))
+	if err != nil {
+		uow.Rollback()
+		return errors.Wrap(err, "Error compacting price samples")
+	}
+	rollups, err := uow.CompactPriceSampleRollups(RollupResolution, ArchiveResolution, now.Add(-r.Rollup))
+	if err != nil {
+		uow.Rollback()
+		return errors.Wrap(err, "Error compacting price sample rollups")
+	}
+
+	if err := uow.Commit(); err != nil {
+		return err
+	}
+	log.Infof("retention: compacted %d price samples and %d rollups", samples, rollups)
+	return nil
+}
+
+// RetentionJob applies the retention policy on startup and then every interval until shutdown is closed
+func RetentionJob(ds DataStore, r Retention, interval time.Duration, shutdown <-chan struct{}) {
+	for {
+		if err := r.Apply(ds, time.Now()); err != nil {
+			log.Errorf("retention: %v", err)
+		}
+		select {
+		case <-shutdown:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
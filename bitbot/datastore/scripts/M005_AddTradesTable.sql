@@ -0,0 +1,9 @@
+CREATE TABLE public.trades (
+  Market    VARCHAR(16) NOT NULL,
+  Timestamp TIMESTAMP   NOT NULL,
+  Type      VARCHAR(8)  NOT NULL,
+  Price     BIGINT      NOT NULL,
+  Amount    BIGINT      NOT NULL,
+  -- BL3P trades have no id, identical trades in the same second are stored once
+  PRIMARY KEY (Market, Timestamp, Type, Price, Amount)
+)
\ No newline at end of file
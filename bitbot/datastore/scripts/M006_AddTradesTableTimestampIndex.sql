@@ -0,0 +1 @@
+CREATE INDEX trades_timestamp_idx ON public.trades (timestamp)
\ No newline at end of file
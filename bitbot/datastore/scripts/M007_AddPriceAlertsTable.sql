@@ -0,0 +1,10 @@
+CREATE TABLE public.pricealerts (
+  Id                   BIGSERIAL PRIMARY KEY,
+  UserID               VARCHAR(64) NOT NULL,
+  Action               BIGINT      NOT NULL,
+  Direction            BIGINT      NOT NULL,
+  Price                BIGINT      NOT NULL,
+  -- the zero time 0001-01-01 means the alert was never triggered
+  LastTriggerTimestamp TIMESTAMP   NOT NULL,
+  TriggerCount         INT         NOT NULL DEFAULT 0
+)
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX pricealerts_userid_idx ON public.pricealerts (userid)
\ No newline at end of file
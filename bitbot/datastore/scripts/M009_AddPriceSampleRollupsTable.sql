@@ -0,0 +1,13 @@
+CREATE TABLE public.pricesamplerollups (
+  -- Timestamp is the start of the rollup period, Resolution its length in seconds
+  Timestamp  TIMESTAMP NOT NULL,
+  Resolution INT       NOT NULL,
+  Type       CHAR(1)   NOT NULL,
+  Open       BIGINT    NOT NULL,
+  High       BIGINT    NOT NULL,
+  Low        BIGINT    NOT NULL,
+  Close      BIGINT    NOT NULL,
+  Avg        BIGINT    NOT NULL,
+  Count      INT       NOT NULL,
+  PRIMARY KEY (Resolution, Type, Timestamp)
+)
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX pricesamplerollups_timestamp_idx ON public.pricesamplerollups (timestamp)
\ No newline at end of file
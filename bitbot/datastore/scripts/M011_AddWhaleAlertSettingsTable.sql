@@ -0,0 +1,8 @@
+CREATE TABLE public.whalealertsettings (
+  ChannelID   VARCHAR(64)      PRIMARY KEY,
+  -- a zero threshold disables that alert
+  MinAmount   BIGINT           NOT NULL DEFAULT 0,
+  Sigma       DOUBLE PRECISION NOT NULL DEFAULT 0,
+  MovePercent DOUBLE PRECISION NOT NULL DEFAULT 0,
+  MoveSeconds INT              NOT NULL DEFAULT 0
+)
\ No newline at end of file
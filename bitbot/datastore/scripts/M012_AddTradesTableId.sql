@@ -0,0 +1,3 @@
+ALTER TABLE public.trades DROP CONSTRAINT trades_pkey;
+-- BL3P trades have no id, so identical trades in the same second are separate rows
+ALTER TABLE public.trades ADD COLUMN Id BIGSERIAL PRIMARY KEY
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- alerts only notify when the price crosses the alert price, so they are armed while the price is on the other side
+ALTER TABLE public.pricealerts ADD COLUMN Armed BOOLEAN NOT NULL DEFAULT FALSE
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- the timestamp of the close, so merging older samples into a rollup keeps its close
+ALTER TABLE public.pricesamplerollups ADD COLUMN CloseTimestamp TIMESTAMP;
+UPDATE public.pricesamplerollups SET CloseTimestamp = Timestamp;
+ALTER TABLE public.pricesamplerollups ALTER COLUMN CloseTimestamp SET NOT NULL
\ No newline at end of file
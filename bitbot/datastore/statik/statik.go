@@ -7,6 +7,6 @@ import (
 )
 
 func init() {
-	data := "PK\x03\x04\x14\x00\x08\x00\x08\x00\nq\x99K\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x1d\x00\x00\x00M001_AddPriceSamplesTable.sqlT\xccQK\xc30\x14\x05\xe0\xf7\xc1\xfe\xc3yl\xc1	\n\xfb\x01\xd7\x19\xb1\xd8\xa6#\xbbS\xf6\x18\x9b;\x17HjH\xeb\x83\xff^\xdaM\xd8\xee\xdb\xe5|\xe7l\x8c\"V`z\xaa\x15\xd2\xcfg\xf0\xdd}\xca\xbe\x93\xc1\xc6\x14d@\xb1\\\x00\xab\x15\xf8$\xf0\x0e~\xc0\x97\xf4\x92\xed(\x0e\xc7\xfc\x1d1\x9e\x04G\x1f\x04\xbd\x8d2\xe1\xca\xe1r\x95flM\xd5\x909\xe0M\x1d\xee\xa6\x94R\n^\\\xdb\x83\xabF\xed\x98\x9a\xedDu\xcb\xd0\xfb\xba\xc6\xb3z\xa1}\xcd\xd0\xedGQ\xce\x0d\xfeMr\xde\xdb\xbc\x92)\x1e\xca\xf3\xf3\xdf\x98\x8d\xb6\xf1b\xde\xc9\xcc\xecq\xbd.o\xcd\xae\xcb>\x8dW\xe6vg\xb9(\xff\x02\x00\x00\xff\xffPK\x07\x08tX2 \xbd\x00\x00\x00\x0d\x01\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00Qp\x99K\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x1e\x00\x00\x00M002_DropPriceSamplesTable.sqlr	\xf2\x0fP\x08qt\xf2qU((M\xca\xc9L\xd6+(\xcaLN-N\xcc-\xc8I-\x06\x04\x00\x00\xff\xffPK\x07\x08\x9c\xaa8\xe4$\x00\x00\x00\x1e\x00\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\nq\x99K\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x1d\x00\x00\x00M003_AddPriceSamplesTable.sqlr\x0eru\x0cqU\x08qt\xf2qU((M\xca\xc9L\xd6+(\xcaLN-N\xcc-\xc8I-V\xd0\xe0\xe5RP\x08\xc9\xccM-.I\xcc-P\x08\xf1\xf4u\x0d\x0eq\xf4\x0dP\xf0\xf3\x0fQ\xf0\x0b\xf5\xf1\xd1\x01+\xa8,HU\x00\x03g\x0f\xc7 \x0dCM\x05\x05T\x05\x01 3\xc1\n\x9c<\xdd=\xfdB\x14\x90\x14\xf0ri\x02\x02\x00\x00\xff\xffPK\x07\x08\xde\x05\x86\xcfm\x00\x00\x00\x87\x00\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\xb7j\x9aK\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00+\x00\x00\x00M004_AddPriceSamplesTableTimestampIndex.sqlr\x0eru\x0cqU\xf0\xf4sq\x8dP((\xcaLN-N\xcc-\xc8I-\x8e/\xc9\xccM-.I\xcc-\x88\xcfL\xa9P\xf0\xf7S((M\xca\xc9L\xd6CV\xa4\xa0\x01W\xa5	\x08\x00\x00\xff\xffPK\x07\x08\xdcS\x96\xe9?\x00\x00\x00J\x00\x00\x00PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\nq\x99KtX2 \xbd\x00\x00\x00\x0d\x01\x00\x00\x1d\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x81\x00\x00\x00\x00M001_AddPriceSamplesTable.sqlPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00Qp\x99K\x9c\xaa8\xe4$\x00\x00\x00\x1e\x00\x00\x00\x1e\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x81\x08\x01\x00\x00M002_DropPriceSamplesTable.sqlPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\nq\x99K\xde\x05\x86\xcfm\x00\x00\x00\x87\x00\x00\x00\x1d\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x81x\x01\x00\x00M003_AddPriceSamplesTable.sqlPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\xb7j\x9aK\xdcS\x96\xe9?\x00\x00\x00J\x00\x00\x00+\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb6\x810\x02\x00\x00M004_AddPriceSamplesTableTimestampIndex.sqlPK\x05\x06\x00\x00\x00\x00\x04\x00\x04\x00;\x01\x00\x00\xc8\x02\x00\x00\x00\x00"
+	data := "PK\x03\x04\x14\x00\x08\x00\x08\x00Q\xac<L\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x1d\x00	\x00M001_AddPriceSamplesTable.sqlUT\x05\x00\x01\xeaAnZT\xcc\xc1J\xc40\x14\x85\xe1}\x9f\xe2,[p\x04\x85y\x80\xeb\x18\xb1\xd8\xa6C\xe6\x8e2\xcb\xd8\xdcq\x02I\x0di]\xf8\xf6\x12\x15\xa9\x9c\xedw\xfe\x9dQ\xc4\nLw\x9dB\xfax\x0d~\xbcN\xd9\x8f2\xdb\x98\x82\xcc\xa8+`\xb3\x01_\x04\xde\xc1\xcfx\x93I\xb2]\xc4\xe1\x9c\xdf#\x96\x8b\xe0\xec\x83`\xb2Q*\xa0u\xc0\xcfZ\xcd\xd8\x9b\xb6's\xc2\x93:]U\x00\xa5\x14\xbc\xb8a\x02\xb7\xbd:0\xf5\xfbB\xf5\xc0\xd0\xc7\xae\xc3\xbdz\xa0c\xc7\xd0\xc3K\xdd\x94\x03\x7f&)\x02\xd8=\x92\xa9o\x1a`}(D\xdb\xf8K\x9e\xc9|\xab\xdb\xed\xb6\xf9k\x16r\x18\xb3O\xcb\x8a\xfc\xafT\xcd\xd7\x00PK\x07\x08\x17J\xd2\xf3\xb6\x00\x00\x00\x06\x01\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00Q\xac<L\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x1e\x00	\x00M002_DropPriceSamplesTable.sqlUT\x05\x00\x01\xeaAnZ\x00\x1e\x00\xe1\xffDROP TABLE public.pricesamples\x03\x00PK\x07\x08\x9c\xaa8\xe4%\x00\x00\x00\x1e\x00\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00Q\xac<L\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x1d\x00	\x00M003_AddPriceSamplesTable.sqlUT\x05\x00\x01\xeaAnZr\x0eru\x0cqU\x08qt\xf2qU((M\xca\xc9L\xd6+(\xcaLN-N\xcc-\xc8I-V\xd0\xe0RP\x08\xc9\xccM-.I\xcc-P\x08\xf1\xf4u\x0d\x0eq\xf4\x0dP\xf0\xf3\x0fQ\xf0\x0b\xf5\xf1\xd1\x01\xc9W\x16\xa4*\x80\x81\xb3\x87c\x90\x86\xa1\xa6\x82\x02\x8a|\x00\xc8@\x90\xb4\x82\x93\xa7\xbb\xa7_\x88\x02\x92<\x97&`\x00PK\x07\x08\x83\x8b\xb64h\x00\x00\x00\x83\x00\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00Q\xac<L\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00+\x00	\x00M004_AddPriceSamplesTableTimestampIndex.sqlUT\x05\x00\x01\xeaAnZ\x00J\x00\xb5\xffCREATE INDEX pricesamples_timestamp_idx ON public.pricesamples (timestamp)\x03\x00PK\x07\x08\xdcS\x96\xe9Q\x00\x00\x00J\x00\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\xed*Q]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x17\x00	\x00M005_AddTradesTable.sqlUT\x05\x00\x01N\x06\xd3j|\xd0AK\xc40\x10\x05\xe0{\x7f\xc5;\xb6\x90\x15D\x10\xaf\xe9\x12\xb4\xd8\xd6\x12\xa3\xb0\xc7\x98\x0clp\x93\x94$\x15\xfc\xf7B\xabh/\xde\x06\xe6cxo\x8eRp%\xa0x\xdb\x0b\xcc\xcb\xdb\xc5\x99\xab\x92\xb4\xa5\x8c\xba\x02\x06\x9d\xde\xa9\x00\xc0+\x97\xc7\x07.\xeb\xeb\xdb\x06\xe3\x93\xc2\xf8\xd2\xf7\xac\x02\x94\xf3\x94\x8b\xf63T7\x88g\xc5\x87	\xd8\x8b\xcf\x99\x80\xbf7\xee\x9a\xbd\x98\x923\x1bi\xbb\xfbnT\xeb\xb8\x13\xdc\xc7%\x94\xff\xc4\xe1\x80\xb6\xbf\x99\xf0\x1d\xfe\xac?\x08!\xc2Y\x06g)\x14g\xf4\xe5g\xe9\x02\xca\x99\x90\xb5'd21X\xe8D\xc8%&\xb2\x88\xc1P\x05L\xb2\x1b\xb8<\xe1Q\x9cPo\x7f`\xbfm\xd9Z\x8bm\xd1\x19\xb8\x8fK(M\xd5|\x0d\x00PK\x07\x08\xe0<\xfc?\xcc\x00\x00\x00P\x01\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\xed*Q]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00%\x00	\x00M006_AddTradesTableTimestampIndex.sqlUT\x05\x00\x01N\x06\xd3j\x00>\x00\xc1\xffCREATE INDEX trades_timestamp_idx ON public.trades (timestamp)\x03\x00PK\x07\x08\xb6\xd3E\xeeE\x00\x00\x00>\x00\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\xed*Q]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x1c\x00	\x00M007_AddPriceAlertsTable.sqlUT\x05\x00\x01N\x06\xd3j\x8c\xd0_K\xf30\x14\x06\xf0\xfb~\x8a\xe7r\x83\xb7/\x15\xc4\xfb\xac\x8d\x1aLk\xc9N\x85]\xc6\xee0\x03\xeb\x1f\x92L\xc1O/\xad\xba\xa9C\xf0\x90\x8b\x84\xfcx\xc8\x93\xdcHA\x12$VZb<<\xee]\xfb\x7f\xf4\xaee\xbbg\x1f\x03\x16	\xa0\xb68\x9f\x95\xbaYK\xa3\x84FmT)\xcc\x06wr\xf3/\x01\x9a\xc0^\x15'8\xcf\x830\xf9\xad0\x8b\xab\xcb%\xaa{B\xd5h=a\xd1F7\xf4'\xf7\x19\xad*\x9av\xf8\x86\x0b\xe7\xf9\xcc\xff\x86\xeb\xa9\x04\xfe\x98\x9c\xa6\x88O\x8cW\xf6\x03\xa2\xeb\x18Y\x96]\xa4\xf3B\xc7\xb6\x0f\xf3\xf5\xfc%x\xb1\x01=?\xb3G\xf4n\xb7c\xcf\xdb\x04\xd06Dz?\x93\xeb8D\xdb\x8d U\xca5\x89\xb2\xfeQ\xe4\x03\xe6\xc3\xa1\x8f\xc7\xc7\x1d+\x7f\xc1(\xe4\xb5h4!K\x96o\x03\x00PK\x07\x08\xb2\xe3\x83\x10\xdf\x00\x00\x00\xaa\x01\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\xed*Q]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00'\x00	\x00M008_AddPriceAlertsTableUserIdIndex.sqlUT\x05\x00\x01N\x06\xd3j\x00B\x00\xbd\xffCREATE INDEX pricealerts_userid_idx ON public.pricealerts (userid)\x03\x00PK\x07\x08\x97\x8eb\x8bI\x00\x00\x00B\x00\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\xed*Q]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00#\x00	\x00M009_AddPriceSampleRollupsTable.sqlUT\x05\x00\x01N\x06\xd3j\x84\x90\xc1j\xb40\x14\x85\xf7>\xc5Y*8?\xfc\x8f\x90\x91\xd0\x91\xaa3\xa4\xe9b\x96\xd6\xb9\xd5@L\x827\xb6\xf4\xed\x0b\x8e0R\xa8\xcd.\xf7~|\x97s\n%\x85\x96\xd0\xe2XI\x84\xf9\xcd\x9a\xee_\x98LG\xdc\x8e\xc1\xd2\xe4\xad\x9d\x03#M\x80\xc3\x01\xda\x8c\xc4\xb1\x1d\x03\x0c#\x0e\x04\x8e\xed\x14\xe1\xdf\x97\xcf\x1dF\xa0\xc9\xf8[\x0eE\xec\xed\x1c\x8dw0\x91a\xc9\xf5q\x80q`\xea\xbc\xbbq\x82\x8d\x0f\xba\xac\xe5\x8b\x16\xf5\x05\xcdY\xa3y\xad\xaa<\xc1\xd6Q6\x1a\xf7\xb7\x05\xf4W\xa0u\\\x9c\x84J\xffg?\x80s \xb7\x02\xc7\xf2i\x95l\x0d'\xd3\x0f\xbb@\xe5?\xb1k(\xacg\xda;!>\xfa?\x0c~vq\xd9\xff\x12\xf3\xa2\xcaZ\xa8+\x9e\xe5\x15\xe9\xa3\x94|\xc9\x9f?z\xcc\x92\xec{\x00PK\x07\x08\xdf\xd5\x01\x86\xd8\x00\x00\x00\xd2\x01\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\xed*Q]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x001\x00	\x00M010_AddPriceSampleRollupsTableTimestampIndex.sqlUT\x05\x00\x01N\x06\xd3j\x00V\x00\xa9\xffCREATE INDEX pricesamplerollups_timestamp_idx ON public.pricesamplerollups (timestamp)\x03\x00PK\x07\x08Q2\xdf\xc6]\x00\x00\x00V\x00\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\xed*Q]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00#\x00	\x00M011_AddWhaleAlertSettingsTable.sqlUT\x05\x00\x01N\x06\xd3j\x94\x8e\xcdJ\xc40\x14F\xf7}\x8ao9\x03\x8e\xb8\x10\xf7\x996j\xb0\x7f\xa4\xa90\xcbL{\x99\x042\x894w\x14|z\xa9\x08\"\xe8\xc2{\xb7\xdf9\x9cRKa$\x8c\xd8\xd7\x12/\x97c\xf0\xd3\xf5\x9b\xb3\x81l\xa0\x8531\xfbx\xca\xd8\x14@\xe9l\x8c\x14T\x05\xe0Y\xe8\xf2Q\xe8\xcd\xdd\xed\x16X\xbf\xd7\xaa\x11\xfa\x80'y\xb8*\x80\xdd\x0e\x16\xef\xb4$\xb0[(\xbb\x14f\xcc>\xdbc\xa0\x0cv\x96\xf1\xe9/\x80\xc6GqN\x97\xc8\x00\xf6\xeaA\xb5\x06\xdf\xd7v\x06\xedX\xd7\xa8\xe4\xbd\x18k\x83\x9bU>\xf8\xd3\xd9~M\xaan\\\xcb{-K5\xa8\xae\xfd\x03i\xd2+\xf5\xb4L\x14\xf9?\xc8@S\x8as\xc6\xcf\xaa_\xc3\x8a\xed\xc7\x00PK\x07\x08\x83z\xa8\x01\xc4\x00\x00\x00K\x01\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\xf3*Q]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x19\x00	\x00M012_AddTradesTableId.sqlUT\x05\x00\x01[\x06\xd3jt\xce;\x8e\xc20\x18\x04\xe0>\xa7\x98\x03l\xb6\xd9r+'\xb1\x90\x85\xf3\x90c\x8aT\xc8\xc4\xbf\x14\x8b\xe0D\xb6\x01q{\x14\x01%\xd5\x8c\xbei\x86I\xcd\x154+$\xc7z=\xcdn\xfcM\xc1X\x8a\xa8T\xdb\xa1l\x9b^+&\x1a\x8d\x17\x1f\xd73=\xfe\xb3<G!\xff\xba7b27\x82_\xe0\xec\x0f\xe2\x16\xe4\x93\x1b\xcd\xfc\xd9\x9dG\x9a\x08\xd1\\\x08\x91\xc6\xc5[\x98\xb0\xd5\xd5\x04\x93\x08a\xb9\xc7\xec\xfb\x15VU([y\xa8\x1b\x08\x8bB\xecz\xae\x04\x93\xe8\x94\xa8\x99\x1a\xb0\xe7\xc3s\x00PK\x07\x08|}\xe6\xa8\x97\x00\x00\x00\xc8\x00\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\xf3*Q]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00!\x00	\x00M013_AddPriceAlertsTableArmed.sqlUT\x05\x00\x01[\x06\xd3jL\x8eA\xce\x820\x14\x84\xf7\xff)\xe6\x00?\xde\xe1!e\xf5l\x13-\x07@x\xa6M*%m\x0d\xe1\xf6\x86\xea\xc2\xe5|\x99\xf92M\x831H*\x19q	;\x96X\xfcc\xc7\xe6dAq\x825\xf9I0\xa5\x98\xb3\xe4Jj\xfb\xc3\xff\x91\xe3\xc1v\x8cI0\xa6\xa7\xcc\xd8\x9c\x0f\xf23\xf5\x87\xb8\xe6X\x9c$d?\xcb\x1f\xb1UWXjYa}\xdd\x83\x9fNU\xf8}B]\x87\xb3\xe1\xe1\xa2AU\xda\x1a\xc3\x8a4\xb4\xb1\xd0\x033:\xd5\xd3\xc0\x16=\xf1M\xbd\x07\x00PK\x07\x08DB\x8e\xb4\x90\x00\x00\x00\xc3\x00\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x83,Q]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x001\x00	\x00M014_AddPriceSampleRollupsTableCloseTimestamp.sqlUT\x05\x00\x01G	\xd3j\x8c\x8eKN\x800\x14E\xe7\xac\xe2.@\xdc\x00qP\xa1\x03\x93\xf2\x89<\x16\x80\xf8\xc4\xc6\x966}e\xff\x06H\x18\x18c\x9c\xde\xe4\xdcs\xca\x12\xf9\x93\x91\xadg\xc9\xb3\x8f\x08\x1f\xe7\xb0\xb8 \xfc\x00	\xf0\x9cV\xbb\xad\x08\xee\x9d\x13d\xf6\xd1\xb1\xc0n9`F\n\xce\xed\x11_\xccQ`\xb3\\\\\xa1\x0c\xe9W\x90z6\x1aq\x7fsvy\x8c\xc9.|\xd1\x17$PM\x83\xba7S\xdb\xa1>ttG\xd0K\xabGR\xedP\x15\xd3\xd0(\xfa\xebe\xd4\xf4\x13\x7f\xc2}U\xfd\xb7\xe5,\xfe\xbd\xe60t=\xa1\x9b\x8c\xf9\x1e\x00PK\x07\x08h\xc9$\x16\xa0\x00\x00\x000\x01\x00\x00PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00Q\xac<L\x17J\xd2\xf3\xb6\x00\x00\x00\x06\x01\x00\x00\x1d\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\x00\x00\x00\x00M001_AddPriceSamplesTable.sqlUT\x05\x00\x01\xeaAnZPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00Q\xac<L\x9c\xaa8\xe4%\x00\x00\x00\x1e\x00\x00\x00\x1e\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\n\x01\x00\x00M002_DropPriceSamplesTable.sqlUT\x05\x00\x01\xeaAnZPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00Q\xac<L\x83\x8b\xb64h\x00\x00\x00\x83\x00\x00\x00\x1d\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\x84\x01\x00\x00M003_AddPriceSamplesTable.sqlUT\x05\x00\x01\xeaAnZPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00Q\xac<L\xdcS\x96\xe9Q\x00\x00\x00J\x00\x00\x00+\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81@\x02\x00\x00M004_AddPriceSamplesTableTimestampIndex.sqlUT\x05\x00\x01\xeaAnZPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\xed*Q]\xe0<\xfc?\xcc\x00\x00\x00P\x01\x00\x00\x17\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\xf3\x02\x00\x00M005_AddTradesTable.sqlUT\x05\x00\x01N\x06\xd3jPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\xed*Q]\xb6\xd3E\xeeE\x00\x00\x00>\x00\x00\x00%\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\x0d\x04\x00\x00M006_AddTradesTableTimestampIndex.sqlUT\x05\x00\x01N\x06\xd3jPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\xed*Q]\xb2\xe3\x83\x10\xdf\x00\x00\x00\xaa\x01\x00\x00\x1c\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\xae\x04\x00\x00M007_AddPriceAlertsTable.sqlUT\x05\x00\x01N\x06\xd3jPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\xed*Q]\x97\x8eb\x8bI\x00\x00\x00B\x00\x00\x00'\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\xe0\x05\x00\x00M008_AddPriceAlertsTableUserIdIndex.sqlUT\x05\x00\x01N\x06\xd3jPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\xed*Q]\xdf\xd5\x01\x86\xd8\x00\x00\x00\xd2\x01\x00\x00#\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\x87\x06\x00\x00M009_AddPriceSampleRollupsTable.sqlUT\x05\x00\x01N\x06\xd3jPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\xed*Q]Q2\xdf\xc6]\x00\x00\x00V\x00\x00\x001\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\xb9\x07\x00\x00M010_AddPriceSampleRollupsTableTimestampIndex.sqlUT\x05\x00\x01N\x06\xd3jPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\xed*Q]\x83z\xa8\x01\xc4\x00\x00\x00K\x01\x00\x00#\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81~\x08\x00\x00M011_AddWhaleAlertSettingsTable.sqlUT\x05\x00\x01N\x06\xd3jPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\xf3*Q]|}\xe6\xa8\x97\x00\x00\x00\xc8\x00\x00\x00\x19\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\x9c	\x00\x00M012_AddTradesTableId.sqlUT\x05\x00\x01[\x06\xd3jPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\xf3*Q]DB\x8e\xb4\x90\x00\x00\x00\xc3\x00\x00\x00!\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\x83\n\x00\x00M013_AddPriceAlertsTableArmed.sqlUT\x05\x00\x01[\x06\xd3jPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x83,Q]h\xc9$\x16\xa0\x00\x00\x000\x01\x00\x001\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81k\x0b\x00\x00M014_AddPriceSampleRollupsTableCloseTimestamp.sqlUT\x05\x00\x01G	\xd3jPK\x05\x06\x00\x00\x00\x00\x0e\x00\x0e\x00\xe6\x04\x00\x00s\x0c\x00\x00\x00\x00"
 	fs.Register(data)
 }
@@ -25,9 +25,9 @@ type (
 
 var (
 	// KeyPattern contains the validation pattern for env keys.
-	// The default accepts variables like ALL_CAPS_WITH_UNDERSCORES.
+	// The default accepts variables like ALL_CAPS_WITH_UNDERSCORES, the parts after the first letter may contain digits like BL3P_URL.
 	// It can be changed, but you should do so before you register any variables
-	KeyPattern string         = "^[A-Z]+(_[A-Z]+)*$"
+	KeyPattern string         = "^[A-Z][A-Z0-9]*(_[A-Z0-9]+)*$"
 	vars       map[string]Var = make(map[string]Var)
 	lock       sync.Mutex
 )
@@ -11,6 +11,20 @@ func TestKeyPattern(t *testing.T) {
 	ensureKeyValid("THIS_IS_A")
 	ensureKeyValid("THIS_IS_A_VALID")
 	ensureKeyValid("THIS_IS_A_VALID_KEY")
+	ensureKeyValid("BL3P_URL")
+	ensureKeyValid("BITBOT_BL3P_FEED")
+	ensureKeyValid("RETENTION_30_DAYS")
+
+	for _, key := range []string{"", "3D", "lower", "TRAILING_", "DOUBLE__UNDERSCORE", "_LEADING"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected key '%s' to be invalid", key)
+				}
+			}()
+			ensureKeyValid(key)
+		}()
+	}
 }
 
 func TestStringVar(t *testing.T) {
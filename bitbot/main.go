@@ -11,6 +11,11 @@ import (
 	"github.com/resc/rescbits/bitbot/migrations"
 	"github.com/resc/rescbits/bitbot/env"
 	"github.com/resc/rescbits/bitbot/bitonic"
+	"github.com/resc/rescbits/bitbot/alerts"
+	"github.com/resc/rescbits/bitbot/prices"
+	"github.com/resc/rescbits/bitbot/notify"
+	"github.com/resc/rescbits/bitbot/whales"
+	"github.com/resc/rescbits/bl3pfeed"
 )
 
 // environment variables
@@ -23,6 +28,18 @@ const (
 	BITBOT_BITONIC_SELL_URL      = "BITBOT_BITONIC_SELL_URL"
 	BITBOT_DATABASE_AUTO_MIGRATE = "BITBOT_DATABASE_AUTO_MIGRATE"
 	BITBOT_SLACK_API_DEBUG       = "BITBOT_SLACK_API_DEBUG"
+	BITBOT_ALERT_COOLDOWN_SEC    = "BITBOT_ALERT_COOLDOWN_SEC"
+	BITBOT_SLACK_FILE_UPLOADS    = "BITBOT_SLACK_FILE_UPLOADS"
+
+	BITBOT_BL3P_FEED        = "BITBOT_BL3P_FEED"
+	BITBOT_BL3P_URL         = "BITBOT_BL3P_URL"
+	BITBOT_BL3P_MARKET      = "BITBOT_BL3P_MARKET"
+	BITBOT_BL3P_MAX_AGE_SEC = "BITBOT_BL3P_MAX_AGE_SEC"
+	BITBOT_WHALE_HISTORY    = "BITBOT_WHALE_HISTORY"
+
+	BITBOT_RETENTION_RAW_DAYS     = "BITBOT_RETENTION_RAW_DAYS"
+	BITBOT_RETENTION_ROLLUP_DAYS  = "BITBOT_RETENTION_ROLLUP_DAYS"
+	BITBOT_RETENTION_INTERVAL_MIN = "BITBOT_RETENTION_INTERVAL_MIN"
 )
 
 func main() {
@@ -52,6 +69,17 @@ func run() {
 	env.OptionalInt(BITBOT_POLL_INTERVAL_SEC, 30, "the bitonic poll interval (min= 10sec)")
 	env.OptionalBool(BITBOT_DATABASE_AUTO_MIGRATE, false, "set this variable to true if the database schema should be auto-migrated on startup")
 	env.OptionalBool(BITBOT_SLACK_API_DEBUG, false, "set this variable to true if the slack api library debug logging should be turned on")
+	env.OptionalBool(BITBOT_SLACK_FILE_UPLOADS, true, "set this variable to false if the bot isn't allowed to upload files, charts are then sent as text")
+	env.OptionalInt(BITBOT_ALERT_COOLDOWN_SEC, 3600, "the delay before a triggered price alert is repeated, it doubles with every repeat up to a day")
+
+	env.OptionalBool(BITBOT_BL3P_FEED, true, "set this variable to false to disable the BL3P order book, which is used for comparing prices and when bitonic is unavailable, and the BL3P trades of the whale alerts")
+	env.Optional(BITBOT_BL3P_URL, "wss://api.bl3p.eu", "the BL3P websocket api url")
+	env.Optional(BITBOT_BL3P_MARKET, "BTCEUR", "the BL3P market")
+	env.OptionalInt(BITBOT_BL3P_MAX_AGE_SEC, 60, "the age in seconds after which the BL3P order book is considered stale")
+	env.OptionalInt(BITBOT_WHALE_HISTORY, whales.DefaultHistory, "the number of recent BL3P trades the whale alerts compare the trade size to")
+	env.OptionalInt(BITBOT_RETENTION_RAW_DAYS, 7, "the number of days the raw price samples are kept, older samples are compacted into 5 minute rollups")
+	env.OptionalInt(BITBOT_RETENTION_ROLLUP_DAYS, 90, "the number of days the 5 minute rollups are kept, older rollups are compacted into hourly rollups")
+	env.OptionalInt(BITBOT_RETENTION_INTERVAL_MIN, 60, "the interval in minutes between price sample compactions")
 
 	env.MustParse()
 
@@ -90,6 +118,28 @@ func run() {
 	sellUrl := env.String(BITBOT_BITONIC_SELL_URL)
 	bitonicApi := bitonic.New(buyUrl, sellUrl)
 
+	// the BL3P order book is the fallback price source of the price commands
+	source := prices.Source(bitonicApi)
+	venues := []prices.Source{bitonicApi}
+	if env.Bool(BITBOT_BL3P_FEED) {
+		bookSource := prices.NewBookSource("bl3p", time.Duration(env.Int(BITBOT_BL3P_MAX_AGE_SEC))*time.Second)
+		listener, err := bl3pfeed.NewBookListener(bookSource)
+		panicIf(err)
+		orderBooks, err := bl3pfeed.NewOrderBook(env.String(BITBOT_BL3P_URL), "1", env.String(BITBOT_BL3P_MARKET), listener)
+		panicIf(err)
+		// quotes only need the latest book
+		orderBooks.SetQueueOptions(bl3pfeed.QueueOptions{Size: 1, Overflow: bl3pfeed.OverflowConflate})
+		// bitonic serves the prices on its own until the order book feed connects
+		go func() {
+			if err := bl3pfeed.OpenWithBackoff(orderBooks, nil, bl3pfeed.DefaultBackoff, shutdown); err != nil {
+				log.Errorf("Error connecting to the BL3P order book feed: %v", err)
+			}
+		}()
+		defer orderBooks.Close()
+		source = prices.Fallback(bitonicApi, bookSource)
+		venues = append(venues, bookSource)
+	}
+
 	// slack slackApi initialization
 	slackApi := slack.New(env.String(BITBOT_SLACK_API_TOKEN))
 	if env.Bool(BITBOT_SLACK_API_DEBUG) {
@@ -104,16 +154,45 @@ func run() {
 	// spawn slack web socket message loop
 	go rtm.ManageConnection()
 
-	// spawn bitonic price poller
+	// price alerts are sent as direct messages
+	cooldown := time.Duration(env.Int(BITBOT_ALERT_COOLDOWN_SEC)) * time.Second
+	evaluator, err := alerts.NewEvaluator(ds, notify.User(rtm), cooldown)
+	panicIf(err)
+
+	// whale alerts are sent to the channels that turned them on
+	if env.Bool(BITBOT_BL3P_FEED) {
+		detector, err := whales.NewDetector(ds, notify.Channel(rtm), env.Int(BITBOT_WHALE_HISTORY))
+		panicIf(err)
+		trades, err := bl3pfeed.NewTrades(env.String(BITBOT_BL3P_URL), "1", env.String(BITBOT_BL3P_MARKET), detector)
+		panicIf(err)
+		// the whale alerts are optional, so the bot keeps running until the trades feed connects
+		go func() {
+			if err := bl3pfeed.OpenWithBackoff(trades, nil, bl3pfeed.DefaultBackoff, shutdown); err != nil {
+				log.Errorf("Error connecting to the BL3P trades feed: %v", err)
+			}
+		}()
+		defer trades.Close()
+	}
+
+	// spawn price sample retention job
+	retention := datastore.Retention{
+		Raw:    time.Duration(env.Int(BITBOT_RETENTION_RAW_DAYS)) * 24 * time.Hour,
+		Rollup: time.Duration(env.Int(BITBOT_RETENTION_ROLLUP_DAYS)) * 24 * time.Hour,
+	}
+	panicIf(retention.Validate())
+	retentionInterval := time.Duration(env.Int(BITBOT_RETENTION_INTERVAL_MIN)) * time.Minute
+	go datastore.RetentionJob(ds, retention, retentionInterval, shutdown)
+
+	// spawn bitonic price poller, the stored price samples and the price alerts only use bitonic prices
 	pollInterval := time.Duration(env.Int(BITBOT_POLL_INTERVAL_SEC)) * time.Second
-	go bitonic.PricePoller(bitonicApi, ds, pollInterval, shutdown)
+	go prices.PricePoller(bitonicApi, ds, pollInterval, shutdown, evaluator)
 
-	processSlackMessages(rtm, bitonicApi, ds)
+	processSlackMessages(rtm, source, bitonicApi, ds, env.Bool(BITBOT_SLACK_FILE_UPLOADS), venues)
 }
 
-func processSlackMessages(rtm *slack.RTM, bitonicApi *bitonic.Api, ds datastore.DataStore) {
+func processSlackMessages(rtm *slack.RTM, source prices.Source, sampled prices.Source, ds datastore.DataStore, fileUploads bool, venues []prices.Source) {
 	// bot initialization
-	bot, err := newBot(rtm, "", bitonicApi, ds)
+	bot, err := newBot(rtm, "", source, sampled, ds, fileUploads, venues...)
 	panicIf(err)
 	// run slack bot message loop
 	for {
@@ -124,7 +203,7 @@ func processSlackMessages(rtm *slack.RTM, bitonicApi *bitonic.Api, ds datastore.
 			case *slack.HelloEvent:
 				log.Debug("Hello received")
 			case *slack.ConnectedEvent:
-				if bot, err = newBot(rtm, ev.Info.User.ID, bitonicApi, ds); err != nil {
+				if bot, err = newBot(rtm, ev.Info.User.ID, source, sampled, ds, fileUploads, venues...); err != nil {
 					log.Errorf("Error connecting bot: %s", err.Error())
 				} else {
 					log.Debugf("Connected: bot id is %s", bot.ID)
@@ -0,0 +1,29 @@
+// Package notify sends the messages of the bot to the slack channels and users.
+package notify
+
+import (
+	"github.com/resc/slack"
+)
+
+// Notifier sends the text to the recipient, a slack channel or user id depending on the notifier
+type Notifier func(recipient string, text string) error
+
+// Channel returns a notifier that posts to the channel with the recipient id
+func Channel(rtm *slack.RTM) Notifier {
+	return func(channelID string, text string) error {
+		rtm.SendMessage(rtm.NewOutgoingMessage(text, channelID))
+		return nil
+	}
+}
+
+// User returns a notifier that sends a direct message to the user with the recipient id
+func User(rtm *slack.RTM) Notifier {
+	post := Channel(rtm)
+	return func(userID string, text string) error {
+		if _, _, channelID, err := rtm.OpenIMChannel(userID); err != nil {
+			return err
+		} else {
+			return post(channelID, text)
+		}
+	}
+}
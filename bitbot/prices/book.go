@@ -0,0 +1,121 @@
+package prices
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/resc/rescbits/bl3pfeed"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// BookSource quotes prices by simulating market orders on the latest BL3P order book.
+	// It's a bl3pfeed.BookFeedListener, register it with bl3pfeed.NewBookListener.
+	BookSource struct {
+		name   string
+		maxAge time.Duration
+
+		lock      sync.RWMutex
+		book      *bl3pfeed.Book
+		connected bool
+	}
+)
+
+var _ Source = (*BookSource)(nil)
+var _ bl3pfeed.BookFeedListener = (*BookSource)(nil)
+
+// NewBookSource creates a source without a book, books older than maxAge are considered unavailable
+func NewBookSource(name string, maxAge time.Duration) *BookSource {
+	return &BookSource{
+		name:   name,
+		maxAge: maxAge,
+	}
+}
+
+func (s *BookSource) Name() string {
+	return s.name
+}
+
+// Book returns the latest book, or nil if there's none yet
+func (s *BookSource) Book() *bl3pfeed.Book {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.book
+}
+
+func (s *BookSource) Quote(ctx context.Context, request Request) (Response, error) {
+	response := Response{Source: s.name, Request: request}
+	if err := request.Validate(); err != nil {
+		return response, err
+	}
+	if err := ctx.Err(); err != nil {
+		return response, err
+	}
+
+	s.lock.RLock()
+	book, connected := s.book, s.connected
+	s.lock.RUnlock()
+
+	if book == nil {
+		return response, errors.Wrap(ErrUnavailable, "no order book received yet")
+	}
+	if !connected {
+		return response, errors.Wrap(ErrUnavailable, "order book feed disconnected")
+	}
+	if age := time.Since(book.Updated()); s.maxAge > 0 && age > s.maxAge {
+		return response, errors.Wrapf(ErrUnavailable, "order book is %v old", age.Truncate(time.Second))
+	}
+
+	var fill *bl3pfeed.Fill
+	var err error
+	if strings.ToLower(request.Currency) == CurrencyBtc {
+		fill, err = book.Simulate(request.Action, request.Btc)
+	} else {
+		fill, err = book.SimulateEur(request.Action, request.Eur)
+	}
+	if err != nil {
+		return response, err
+	}
+	if !fill.IsComplete() {
+		return response, errors.Wrapf(ErrInsufficientLiquidity, "the %s order book can fill %s BTC for %s EUR", s.name, fill.Amount, fill.Cost.StringFixed(2))
+	}
+
+	response.Time = book.Updated()
+	response.Btc = fill.Amount
+	response.Eur = fill.Cost
+	response.Price = fill.AveragePrice
+	return response, nil
+}
+
+func (s *BookSource) FeedDisconnected(channel string, err error) {
+	log.Warnf("%s %s feed disconnected: %v", s.name, channel, err)
+	s.setConnected(false)
+}
+
+func (s *BookSource) FeedReconnected(channel string, attempts int) {
+	log.Infof("%s %s feed reconnected after %d attempt(s)", s.name, channel, attempts)
+}
+
+func (s *BookSource) FeedClosed(channel string, err error) {
+	if err != nil {
+		log.Errorf("%s %s feed closed: %v", s.name, channel, err)
+	}
+	s.setConnected(false)
+}
+
+func (s *BookSource) OnBookChanged(b *bl3pfeed.Book, diff *bl3pfeed.BookDiff) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.book = b
+	// the feed is only trusted again once a book arrives after reconnecting
+	s.connected = true
+}
+
+func (s *BookSource) setConnected(connected bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.connected = connected
+}
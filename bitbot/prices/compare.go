@@ -0,0 +1,56 @@
+package prices
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/resc/rescbits/money"
+)
+
+type (
+	// Comparison compares the quotes of two venues for the same request
+	Comparison struct {
+		Action string
+		// Best is the quote with the lowest price for buying and the highest price for selling
+		Best  Response
+		Worst Response
+		// Difference is the EUR saved (buy) or earned (sell) at the best venue for the requested amount
+		Difference money.Price
+		// Percent is the price difference as a percentage of the best price
+		Percent float64
+	}
+)
+
+// Compare finds the best of the quotes, both should be successful quotes for the same request
+func Compare(a, b Response) (Comparison, error) {
+	if a.Request != b.Request {
+		return Comparison{}, errors.New("the quotes are for different requests")
+	}
+	if a.Price <= 0 || b.Price <= 0 {
+		return Comparison{}, errors.New("the quotes should have a price")
+	}
+
+	action := strings.ToLower(a.Request.Action)
+	c := Comparison{Action: action, Best: a, Worst: b}
+	switch action {
+	case ActionBuy:
+		if b.Price < a.Price {
+			c.Best, c.Worst = b, a
+		}
+	case ActionSell:
+		if b.Price > a.Price {
+			c.Best, c.Worst = b, a
+		}
+	default:
+		return Comparison{}, errors.Errorf("invalid action: %s", a.Request.Action)
+	}
+
+	if strings.ToLower(a.Request.Currency) == CurrencyEur {
+		// the same EUR buys more or needs less BTC at the best venue, valued at the best price
+		c.Difference = c.Best.Price.Total(c.Best.Btc.Sub(c.Worst.Btc).Abs(), money.RoundHalfUp)
+	} else {
+		c.Difference = c.Best.Eur.Sub(c.Worst.Eur).Abs()
+	}
+	c.Percent = 100 * float64(c.Best.Price.Sub(c.Worst.Price).Abs()) / float64(c.Best.Price)
+	return c, nil
+}
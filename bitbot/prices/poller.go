@@ -0,0 +1,92 @@
+package prices
+
+import (
+	"time"
+
+	"github.com/resc/rescbits/bitbot/datastore"
+	"github.com/resc/rescbits/money"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// PriceListener receives the buy and sell price responses of every poll
+	PriceListener interface {
+		OnPrices(buy, sell *Response)
+	}
+)
+
+// PricePoller polls the buy and sell price of 1 BTC from the source, saves them as price samples and passes them to the listeners
+func PricePoller(source Source, ds datastore.DataStore, pollInterval time.Duration, shutdown <-chan struct{}, listeners ...PriceListener) {
+	defer func() {
+
+		err := recover()
+		if err != nil {
+			log.Errorf("pricePoller: %v", err)
+			duration := 60 * time.Second
+			log.Infof("pricePoller: suspended due to error, resuming in %v", duration)
+			select {
+			case <-shutdown:
+				return // quick exit on shutdown
+			case <-time.After(duration):
+				log.Infof("pricePoller: resumed polling")
+				go PricePoller(source, ds, pollInterval, shutdown, listeners...)
+			}
+		}
+	}()
+	for {
+		select {
+		case <-shutdown:
+			return
+		case <-time.After(pollInterval):
+			buyResponse := RequestPrice(source, &Request{
+				Btc:      money.Bitcoin,
+				Currency: CurrencyBtc,
+				Action:   ActionBuy,
+			})
+			sellResponse := RequestPrice(source, &Request{
+				Btc:      money.Bitcoin,
+				Currency: CurrencyBtc,
+				Action:   ActionSell,
+			})
+			if uow, err := ds.StartUow(); err != nil {
+				log.Errorf("Error starting unit of work: %v", err)
+			} else {
+				func() {
+					defer uow.Commit()
+
+					buy := <-buyResponse
+					if buy.Error == "" {
+						err := uow.SavePriceSamples(datastore.PriceSample{
+							Type:      "B",
+							Timestamp: buy.Time,
+							Price:     buy.Price,
+						})
+						if err != nil {
+							log.Errorf("Error saving price sample: %v", err)
+						}
+					} else {
+						log.Errorf("Error fetching buy price: %s", buy.Error)
+					}
+
+					sell := <-sellResponse
+					if sell.Error == "" {
+						err := uow.SavePriceSamples(datastore.PriceSample{
+							Type:      "S",
+							Timestamp: sell.Time,
+							Price:     sell.Price,
+						})
+						if err != nil {
+							log.Errorf("Error saving price sample: %v", err)
+						}
+					} else {
+						log.Errorf("Error fetching sell price: %s", sell.Error)
+					}
+
+					for _, l := range listeners {
+						l.OnPrices(buy, sell)
+					}
+				}()
+			}
+		}
+	}
+}
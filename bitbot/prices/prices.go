@@ -0,0 +1,145 @@
+// Package prices defines the price sources the bot can quote from, like the bitonic api or a BL3P order book.
+package prices
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/resc/rescbits/money"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ActionBuy   = "buy"
+	ActionSell  = "sell"
+	CurrencyEur = "eur"
+	CurrencyBtc = "btc"
+)
+
+var (
+	// ErrUnavailable is the cause of the errors of sources that have no recent data, e.g. a disconnected feed
+	ErrUnavailable = errors.New("price source unavailable")
+	// ErrInsufficientLiquidity is the cause of the errors of sources that can't fill the requested amount
+	ErrInsufficientLiquidity = errors.New("insufficient liquidity")
+)
+
+type (
+	// Source quotes buy and sell prices for an amount of BTC or EUR
+	Source interface {
+		// Name of the venue, e.g. bitonic
+		Name() string
+
+		// Quote returns the price for the request, or an error if the source can't quote it
+		Quote(ctx context.Context, request Request) (Response, error)
+	}
+
+	Request struct {
+		Action   string
+		Currency string
+		// Btc is the amount to quote when Currency is btc
+		Btc money.Amount
+		// Eur is the amount to quote when Currency is eur
+		Eur money.Price
+	}
+
+	Response struct {
+		// Source is the name of the source that quoted the price
+		Source  string
+		Request Request
+		// Time of the quote, for order books this is the time of the last update
+		Time  time.Time
+		Btc   money.Amount
+		Eur   money.Price
+		Price money.Price
+		// Error is only set by RequestPrice
+		Error string
+	}
+
+	fallback struct {
+		sources []Source
+	}
+)
+
+var _ Source = (*fallback)(nil)
+
+// Validate checks the action and currency of the request
+func (r *Request) Validate() error {
+	switch strings.ToLower(r.Action) {
+	case ActionBuy, ActionSell:
+	default:
+		return errors.Errorf("invalid action: %s", r.Action)
+	}
+	switch strings.ToLower(r.Currency) {
+	case CurrencyBtc, CurrencyEur:
+	default:
+		return errors.Errorf("invalid currency: %s", r.Currency)
+	}
+	return nil
+}
+
+// IsUnavailable returns true if the source failed because it has no recent data
+func IsUnavailable(err error) bool {
+	return errors.Cause(err) == ErrUnavailable
+}
+
+// RequestPrice quotes the price in the background, the channel receives a single response with Error set on failure.
+// A panicking source fails the request. The channel is buffered, so it doesn't leak when nobody reads it.
+func RequestPrice(source Source, request *Request) <-chan *Response {
+	response := make(chan *Response, 1)
+	go func() {
+		defer close(response)
+		r, err := quote(source, request)
+		if err != nil {
+			r.Source = source.Name()
+			r.Request = *request
+			r.Time = time.Now()
+			r.Error = err.Error()
+		}
+		response <- &r
+	}()
+	return response
+}
+
+// quote quotes the price from the source and turns a panic into an error
+func quote(source Source, request *Request) (r Response, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Errorf("%s panicked quoting %+v: %v", source.Name(), *request, p)
+			r, err = Response{}, errors.Errorf("%s failed: %v", source.Name(), p)
+		}
+	}()
+	return source.Quote(context.Background(), *request)
+}
+
+// Fallback returns a source that quotes from the first source that succeeds, in the given order
+func Fallback(sources ...Source) Source {
+	if len(sources) == 1 {
+		return sources[0]
+	}
+	return &fallback{sources: sources}
+}
+
+func (f *fallback) Name() string {
+	names := make([]string, len(f.sources))
+	for i, s := range f.sources {
+		names[i] = s.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *fallback) Quote(ctx context.Context, request Request) (Response, error) {
+	var err error = errors.New("no price sources")
+	for _, s := range f.sources {
+		var response Response
+		if response, err = s.Quote(ctx, request); err == nil {
+			return response, nil
+		}
+		if ctx.Err() != nil {
+			return Response{Request: request}, ctx.Err()
+		}
+		log.Warnf("Price source %s failed, trying the next one: %v", s.Name(), err)
+	}
+	return Response{Request: request}, err
+}
@@ -0,0 +1,183 @@
+package prices
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+)
+
+type (
+	fakeSource struct {
+		name     string
+		err      error
+		panic    interface{}
+		price    money.Price
+		requests int
+	}
+)
+
+func (s *fakeSource) Name() string {
+	return s.name
+}
+
+func (s *fakeSource) Quote(ctx context.Context, request Request) (Response, error) {
+	s.requests++
+	if s.panic != nil {
+		panic(s.panic)
+	}
+	if s.err != nil {
+		return Response{Source: s.name, Request: request}, s.err
+	}
+	return Response{Source: s.name, Request: request, Time: time.Now(), Price: s.price}, nil
+}
+
+func testBookSource() *BookSource {
+	s := NewBookSource("bl3p", time.Minute)
+	book := bl3pfeed.NewBook()
+	book.Update(&bl3pfeed.OrderBook{
+		Market: "BTCEUR",
+		Asks: []*bl3pfeed.Order{
+			{Price: 8000 * money.Euro, Amount: money.Bitcoin / 2},
+			{Price: 8100 * money.Euro, Amount: money.Bitcoin},
+		},
+		Bids: []*bl3pfeed.Order{
+			{Price: 7900 * money.Euro, Amount: money.Bitcoin},
+		},
+	})
+	s.OnBookChanged(book, &bl3pfeed.BookDiff{})
+	return s
+}
+
+func TestFallback(t *testing.T) {
+	down := &fakeSource{name: "down", err: errors.New("down")}
+	up := &fakeSource{name: "up", price: 8000 * money.Euro}
+	source := Fallback(down, up)
+
+	if name := source.Name(); name != "down,up" {
+		t.Errorf("Unexpected name %s", name)
+	}
+	response, err := source.Quote(context.Background(), Request{Action: ActionBuy, Currency: CurrencyBtc, Btc: money.Bitcoin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Source != "up" || response.Price != 8000*money.Euro || down.requests != 1 {
+		t.Fatalf("Unexpected response %+v", response)
+	}
+
+	up.err = errors.New("also down")
+	if _, err := source.Quote(context.Background(), Request{}); err != up.err {
+		t.Fatalf("Expected the last error, got %v", err)
+	}
+
+	// a canceled context doesn't try the other sources
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	up.requests = 0
+	if _, err := source.Quote(ctx, Request{}); err != context.Canceled || up.requests != 0 {
+		t.Fatalf("Expected a canceled error without trying the next source, got %v", err)
+	}
+}
+
+func TestRequestPrice(t *testing.T) {
+	source := &fakeSource{name: "down", err: errors.New("down")}
+	response := <-RequestPrice(source, &Request{Action: ActionSell})
+	if response.Error != "down" || response.Source != "down" || response.Request.Action != ActionSell {
+		t.Fatalf("Unexpected response %+v", response)
+	}
+
+	source = &fakeSource{name: "broken", panic: "invalid price"}
+	response = <-RequestPrice(source, &Request{Action: ActionBuy})
+	if response.Error != "broken failed: invalid price" || response.Source != "broken" {
+		t.Fatalf("Expected the panic as an error, got %+v", response)
+	}
+}
+
+func TestBookSource_Quote(t *testing.T) {
+	s := testBookSource()
+
+	response, err := s.Quote(context.Background(), Request{Action: ActionBuy, Currency: CurrencyBtc, Btc: money.Bitcoin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// half at 8000, half at 8100
+	if response.Source != "bl3p" || response.Btc != money.Bitcoin || response.Eur != 8050*money.Euro || response.Price != 8050*money.Euro {
+		t.Fatalf("Unexpected response %+v", response)
+	}
+
+	response, err = s.Quote(context.Background(), Request{Action: ActionSell, Currency: CurrencyEur, Eur: 3950 * money.Euro})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Btc != money.Bitcoin/2 || response.Price != 7900*money.Euro {
+		t.Fatalf("Unexpected response %+v", response)
+	}
+
+	if _, err := s.Quote(context.Background(), Request{Action: ActionSell, Currency: CurrencyBtc, Btc: 2 * money.Bitcoin}); err == nil || IsUnavailable(err) {
+		t.Fatalf("Expected an insufficient liquidity error, got %v", err)
+	}
+	if _, err := s.Quote(context.Background(), Request{Action: "hodl", Currency: CurrencyBtc}); err == nil {
+		t.Fatal("Expected an error for an invalid action")
+	}
+}
+
+func TestBookSource_Unavailable(t *testing.T) {
+	request := Request{Action: ActionBuy, Currency: CurrencyBtc, Btc: money.Bitcoin}
+
+	if _, err := NewBookSource("bl3p", time.Minute).Quote(context.Background(), request); !IsUnavailable(err) {
+		t.Fatalf("Expected unavailable without a book, got %v", err)
+	}
+
+	s := testBookSource()
+	s.FeedDisconnected("orderbook", errors.New("connection lost"))
+	if _, err := s.Quote(context.Background(), request); !IsUnavailable(err) {
+		t.Fatalf("Expected unavailable while disconnected, got %v", err)
+	}
+	s.OnBookChanged(s.Book(), &bl3pfeed.BookDiff{})
+	if _, err := s.Quote(context.Background(), request); err != nil {
+		t.Fatalf("Expected a quote after a new book, got %v", err)
+	}
+
+	s.maxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if _, err := s.Quote(context.Background(), request); !IsUnavailable(err) {
+		t.Fatalf("Expected unavailable for a stale book, got %v", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	buyBtc := Request{Action: ActionBuy, Currency: CurrencyBtc, Btc: money.Bitcoin}
+	a := Response{Source: "a", Request: buyBtc, Btc: money.Bitcoin, Eur: 8100 * money.Euro, Price: 8100 * money.Euro}
+	b := Response{Source: "b", Request: buyBtc, Btc: money.Bitcoin, Eur: 8000 * money.Euro, Price: 8000 * money.Euro}
+
+	c, err := Compare(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Best.Source != "b" || c.Difference != 100*money.Euro || c.Percent != 1.25 {
+		t.Fatalf("Unexpected buy comparison %+v", c)
+	}
+
+	// selling at the higher price is better
+	sellBtc := buyBtc
+	sellBtc.Action = ActionSell
+	a.Request, b.Request = sellBtc, sellBtc
+	if c, err := Compare(a, b); err != nil || c.Best.Source != "a" || c.Difference != 100*money.Euro {
+		t.Fatalf("Unexpected sell comparison %+v %v", c, err)
+	}
+
+	// for EUR orders the BTC difference is valued at the best price
+	buyEur := Request{Action: ActionBuy, Currency: CurrencyEur, Eur: 8000 * money.Euro}
+	a = Response{Source: "a", Request: buyEur, Btc: 98765432, Eur: 8000 * money.Euro, Price: 8100 * money.Euro}
+	b = Response{Source: "b", Request: buyEur, Btc: money.Bitcoin, Eur: 8000 * money.Euro, Price: 8000 * money.Euro}
+	if c, err := Compare(a, b); err != nil || c.Best.Source != "b" || c.Difference != 9876544 {
+		t.Fatalf("Unexpected eur comparison %+v %v", c, err)
+	}
+
+	if _, err := Compare(a, Response{Request: buyBtc, Price: 1}); err == nil {
+		t.Fatal("Expected an error for different requests")
+	}
+}
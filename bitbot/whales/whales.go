@@ -0,0 +1,301 @@
+// Package whales watches the BL3P trades for large trades and sudden price moves and notifies the configured channels.
+package whales
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/resc/rescbits/bitbot/datastore"
+	"github.com/resc/rescbits/bitbot/notify"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultHistory is the default number of recent trades of the size statistics
+	DefaultHistory = 500
+	// MinHistory is the number of recent trades needed before trades are compared to their average size
+	MinHistory = 30
+	// MaxMoveWindow is the longest period of the price move alerts
+	MaxMoveWindow = time.Hour
+	// SettingsRefresh is how often the detector reloads the whale alert settings of the channels
+	SettingsRefresh = time.Minute
+)
+
+type (
+	// Detector checks every trade against the whale alert settings of the channels and notifies the channels of the alerts.
+	// A trade alerts when it's at least the minimum amount, or when it's more than sigma standard deviations above
+	// the average amount of the recent trades. A price move alerts when the price moved the percentage within the period,
+	// after which the channel gets no price move alerts for the rest of that period.
+	// The settings are reloaded every SettingsRefresh, so changed settings apply within that time.
+	Detector struct {
+		ds      datastore.DataStore
+		notify  notify.Notifier
+		history int
+		now     func() time.Time
+
+		lock     sync.Mutex
+		settings []datastore.WhaleAlertSettings
+		refresh  time.Time        // the time the settings should be reloaded
+		sizes    []money.Amount   // the amounts of the recent trades, oldest first
+		trades   []bl3pfeed.Trade // the trades of the last MaxMoveWindow, oldest first
+		moved    map[string]int64 // the time of the last price move alert per channel
+	}
+
+	// sizeStats are the statistics of the amounts of the recent trades
+	sizeStats struct {
+		count int
+		mean  float64
+		std   float64
+	}
+)
+
+var _ bl3pfeed.TradesFeedListener = (*Detector)(nil)
+
+// NewDetector creates a detector that compares the trades to the average size of the given number of recent trades
+func NewDetector(ds datastore.DataStore, notify notify.Notifier, history int) (*Detector, error) {
+	if ds == nil {
+		return nil, errors.New("ds datastore.DataStore is nil")
+	}
+	if notify == nil {
+		return nil, errors.New("notify notify.Notifier is nil")
+	}
+	if history < MinHistory {
+		return nil, errors.Errorf("history should be at least %d trades", MinHistory)
+	}
+	return &Detector{
+		ds:      ds,
+		notify:  notify,
+		history: history,
+		now:     time.Now,
+		moved:   make(map[string]int64),
+	}, nil
+}
+
+func (d *Detector) OnTrade(t *bl3pfeed.Trade) {
+	if err := d.Check(t); err != nil {
+		log.Errorf("Error checking whale alerts: %v", err)
+	}
+}
+
+func (d *Detector) FeedDisconnected(channel string, err error) {
+	log.Warnf("BL3P %s feed disconnected: %v", channel, err)
+}
+
+func (d *Detector) FeedReconnected(channel string, attempts int) {
+	log.Infof("BL3P %s feed reconnected after %d attempt(s)", channel, attempts)
+}
+
+func (d *Detector) FeedClosed(channel string, err error) {
+	if err != nil {
+		log.Errorf("BL3P %s feed closed: %v", channel, err)
+	}
+}
+
+// Check checks the trade against the settings of all channels and notifies the channels of the alerts.
+// The trade is always added to the history, if the settings were never loaded no channel is notified.
+func (d *Detector) Check(t *bl3pfeed.Trade) error {
+	settings, err := d.currentSettings()
+	messages := d.detect(t, settings)
+	for _, s := range settings {
+		if text, ok := messages[s.ChannelID]; ok {
+			if err := d.notify(s.ChannelID, text); err != nil {
+				log.Errorf("Error sending whale alert to channel %s: %v", s.ChannelID, err)
+			}
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, "Error loading whale alert settings")
+	}
+	return nil
+}
+
+// currentSettings returns the cached settings and reloads them every SettingsRefresh,
+// if reloading fails the previous settings are used until the next refresh
+func (d *Detector) currentSettings() ([]datastore.WhaleAlertSettings, error) {
+	d.lock.Lock()
+	settings := d.settings
+	now := d.now()
+	if now.Before(d.refresh) {
+		d.lock.Unlock()
+		return settings, nil
+	}
+	d.refresh = now.Add(SettingsRefresh)
+	d.lock.Unlock()
+
+	loaded, err := d.loadSettings()
+	if err != nil {
+		return settings, err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.settings = loaded
+	return loaded, nil
+}
+
+// detect returns the alert text per channel and adds the trade to the history
+func (d *Detector) detect(t *bl3pfeed.Trade, settings []datastore.WhaleAlertSettings) map[string]string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// compare the trade to the trades before it
+	stats := d.sizeStats()
+	d.add(t)
+
+	messages := make(map[string]string)
+	for _, s := range settings {
+		lines := make([]string, 0, 2)
+		if text, ok := sizeAlert(s, t, stats); ok {
+			lines = append(lines, text)
+		}
+		if text, ok := d.moveAlert(s, t); ok {
+			lines = append(lines, text)
+		}
+		if len(lines) > 0 {
+			messages[s.ChannelID] = strings.Join(lines, "\n")
+		}
+	}
+	return messages
+}
+
+// sizeAlert returns the alert for a large trade
+func sizeAlert(s datastore.WhaleAlertSettings, t *bl3pfeed.Trade, stats sizeStats) (string, bool) {
+	var reason string
+	if s.MinAmount > 0 && t.Amount >= s.MinAmount {
+		reason = fmt.Sprintf("at least %s BTC", s.MinAmount.StringFixed(2))
+	}
+	if sigmas, ok := stats.sigmas(t.Amount); ok && s.Sigma > 0 && sigmas > s.Sigma {
+		if reason != "" {
+			reason += " and "
+		}
+		reason += fmt.Sprintf("%.1f standard deviations above the average of %s BTC of the last %d trades",
+			sigmas, money.Amount(math.Round(stats.mean)).StringFixed(5), stats.count)
+	}
+	if reason == "" {
+		return "", false
+	}
+	total := t.Price.Total(t.Amount, money.RoundHalfUp)
+	return fmt.Sprintf(":whale: Whale alert: a %s of %s BTC at %s EUR/BTC (%s EUR) on %s, %s",
+		t.Type, t.Amount.StringFixed(5), t.Price.StringFixed(2), total.StringFixed(2), t.Marketplace, reason), true
+}
+
+// moveAlert returns the alert for a price move of the trade from the lowest or highest price within the period of the settings
+func (d *Detector) moveAlert(s datastore.WhaleAlertSettings, t *bl3pfeed.Trade) (string, bool) {
+	if s.MovePercent <= 0 || s.MoveSeconds <= 0 {
+		return "", false
+	}
+	seconds := int64(s.MoveSeconds)
+	if max := int64(MaxMoveWindow / time.Second); seconds > max {
+		seconds = max
+	}
+	if last, ok := d.moved[s.ChannelID]; ok && t.Date < last+seconds {
+		return "", false
+	}
+
+	var low, high *bl3pfeed.Trade
+	for i := range d.trades {
+		p := &d.trades[i]
+		if p.Date < t.Date-seconds {
+			continue
+		}
+		if low == nil || p.Price < low.Price {
+			low = p
+		}
+		if high == nil || p.Price > high.Price {
+			high = p
+		}
+	}
+	if low == nil {
+		return "", false
+	}
+
+	from, direction := low, "rose"
+	if up, down := t.Price-low.Price, high.Price-t.Price; down > up {
+		from, direction = high, "dropped"
+	}
+	change := 100 * (t.Price - from.Price).Float64() / from.Price.Float64()
+	if math.Abs(change) < s.MovePercent {
+		return "", false
+	}
+	d.moved[s.ChannelID] = t.Date
+	return fmt.Sprintf(":chart_with_upwards_trend: Price move: %s %s %.2f%% from %s to %s EUR/BTC in %s",
+		t.Marketplace, direction, math.Abs(change), from.Price.StringFixed(2), t.Price.StringFixed(2),
+		time.Duration(t.Date-from.Date)*time.Second), true
+}
+
+// add adds the trade to the size history and the price window
+func (d *Detector) add(t *bl3pfeed.Trade) {
+	d.sizes = append(d.sizes, t.Amount)
+	if len(d.sizes) > d.history {
+		d.sizes = append(d.sizes[:0], d.sizes[len(d.sizes)-d.history:]...)
+	}
+
+	d.trades = append(d.trades, *t)
+	oldest := t.Date - int64(MaxMoveWindow/time.Second)
+	n := 0
+	for n < len(d.trades) && d.trades[n].Date < oldest {
+		n++
+	}
+	if n > 0 {
+		d.trades = append(d.trades[:0], d.trades[n:]...)
+	}
+}
+
+// sizeStats returns the mean and sample standard deviation of the recent trade amounts in BTC units
+func (d *Detector) sizeStats() sizeStats {
+	s := sizeStats{count: len(d.sizes)}
+	if s.count < 2 {
+		return s
+	}
+	for _, a := range d.sizes {
+		s.mean += float64(a)
+	}
+	s.mean /= float64(s.count)
+	variance := 0.0
+	for _, a := range d.sizes {
+		variance += (float64(a) - s.mean) * (float64(a) - s.mean)
+	}
+	s.std = math.Sqrt(variance / float64(s.count-1))
+	return s
+}
+
+// sigmas returns the number of standard deviations the amount is above the mean, ok is false without enough history
+func (s sizeStats) sigmas(amount money.Amount) (float64, bool) {
+	if s.count < MinHistory || s.std == 0 {
+		return 0, false
+	}
+	return (float64(amount) - s.mean) / s.std, true
+}
+
+// Describe formats the settings of a channel
+func Describe(s datastore.WhaleAlertSettings) string {
+	if s.IsEmpty() {
+		return "Whale alerts are off"
+	}
+	parts := make([]string, 0, 3)
+	if s.MinAmount > 0 {
+		parts = append(parts, fmt.Sprintf("trades of at least %s BTC", s.MinAmount.StringFixed(2)))
+	}
+	if s.Sigma > 0 {
+		parts = append(parts, fmt.Sprintf("trades %.1f standard deviations above the average", s.Sigma))
+	}
+	if s.MovePercent > 0 && s.MoveSeconds > 0 {
+		parts = append(parts, fmt.Sprintf("price moves of %.2f%% within %s", s.MovePercent, time.Duration(s.MoveSeconds)*time.Second))
+	}
+	return "Whale alerts on " + strings.Join(parts, ", ")
+}
+
+func (d *Detector) loadSettings() ([]datastore.WhaleAlertSettings, error) {
+	var settings []datastore.WhaleAlertSettings
+	err := datastore.WithUow(d.ds, func(uow datastore.UnitOfWork) error {
+		var err error
+		settings, err = uow.LoadWhaleAlertSettings()
+		return err
+	})
+	return settings, err
+}
@@ -0,0 +1,265 @@
+package whales
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bitbot/datastore"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+)
+
+type (
+	fakeDataStore struct {
+		datastore.DataStore
+
+		settings []datastore.WhaleAlertSettings
+		err      error
+		loads    int
+	}
+
+	fakeUow struct {
+		datastore.UnitOfWork
+		ds *fakeDataStore
+	}
+
+	message struct {
+		channelID string
+		text      string
+	}
+)
+
+var start = time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func (ds *fakeDataStore) StartUow() (datastore.UnitOfWork, error) {
+	if ds.err != nil {
+		return nil, ds.err
+	}
+	return &fakeUow{ds: ds}, nil
+}
+
+func (u *fakeUow) LoadWhaleAlertSettings(channelID ...string) ([]datastore.WhaleAlertSettings, error) {
+	u.ds.loads++
+	result := make([]datastore.WhaleAlertSettings, len(u.ds.settings))
+	copy(result, u.ds.settings)
+	return result, nil
+}
+
+func (u *fakeUow) Commit() error {
+	return nil
+}
+
+func (u *fakeUow) Rollback() error {
+	return nil
+}
+
+func newTestDetector(t *testing.T, settings ...datastore.WhaleAlertSettings) (*Detector, *[]message) {
+	ds := &fakeDataStore{settings: settings}
+	messages := make([]message, 0)
+	d, err := NewDetector(ds, func(channelID string, text string) error {
+		messages = append(messages, message{channelID, text})
+		return nil
+	}, DefaultHistory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, &messages
+}
+
+func trade(offset time.Duration, price money.Price, amount money.Amount) *bl3pfeed.Trade {
+	return &bl3pfeed.Trade{
+		Date:        start.Add(offset).Unix(),
+		Marketplace: "BTCEUR",
+		Price:       price,
+		Type:        bl3pfeed.ActionBuy,
+		Amount:      amount,
+	}
+}
+
+func TestNewDetector(t *testing.T) {
+	notify := func(string, string) error { return nil }
+	if _, err := NewDetector(nil, notify, DefaultHistory); err == nil {
+		t.Error("Expected an error without a datastore")
+	}
+	if _, err := NewDetector(&fakeDataStore{}, nil, DefaultHistory); err == nil {
+		t.Error("Expected an error without a notifier")
+	}
+	if _, err := NewDetector(&fakeDataStore{}, notify, MinHistory-1); err == nil {
+		t.Error("Expected an error for a too short history")
+	}
+}
+
+func TestDetector_Size(t *testing.T) {
+	d, messages := newTestDetector(t,
+		datastore.WhaleAlertSettings{ChannelID: "C1", MinAmount: 10 * money.Bitcoin},
+		datastore.WhaleAlertSettings{ChannelID: "C2", MinAmount: 50 * money.Bitcoin},
+	)
+	if err := d.Check(trade(0, 8000*money.Euro, 9*money.Bitcoin)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*messages) != 0 {
+		t.Fatalf("Expected no messages, got %+v", *messages)
+	}
+	if err := d.Check(trade(time.Second, 8000*money.Euro, 10*money.Bitcoin)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*messages) != 1 {
+		t.Fatalf("Expected 1 message, got %+v", *messages)
+	}
+	if m := (*messages)[0]; m.channelID != "C1" ||
+		!strings.Contains(m.text, "a buy of 10.00000 BTC at 8000.00 EUR/BTC (80000.00 EUR) on BTCEUR, at least 10.00 BTC") {
+		t.Errorf("Unexpected message %+v", m)
+	}
+}
+
+func TestDetector_Sigma(t *testing.T) {
+	d, messages := newTestDetector(t, datastore.WhaleAlertSettings{ChannelID: "C1", Sigma: 3})
+
+	// the sizes aren't compared before there's enough history
+	for i := 0; i < MinHistory; i++ {
+		amount := money.Bitcoin
+		if i%2 == 0 {
+			amount = 2 * money.Bitcoin
+		}
+		if i == 0 {
+			amount = 3 * money.Bitcoin
+		}
+		if err := d.Check(trade(time.Duration(i)*time.Second, 8000*money.Euro, amount)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(*messages) != 0 {
+		t.Fatalf("Expected no messages, got %+v", *messages)
+	}
+
+	if err := d.Check(trade(time.Minute, 8000*money.Euro, 3*money.Bitcoin)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*messages) != 0 {
+		t.Fatalf("Expected no message for a trade within 3 standard deviations, got %+v", *messages)
+	}
+	if err := d.Check(trade(time.Minute, 8000*money.Euro, 5*money.Bitcoin)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*messages) != 1 || !strings.Contains((*messages)[0].text, "standard deviations above the average of 1.5") {
+		t.Fatalf("Expected a sigma alert, got %+v", *messages)
+	}
+}
+
+func TestDetector_Move(t *testing.T) {
+	d, messages := newTestDetector(t, datastore.WhaleAlertSettings{ChannelID: "C1", MovePercent: 5, MoveSeconds: 60})
+
+	steps := []struct {
+		offset   time.Duration
+		price    money.Price
+		expected int
+	}{
+		{0, 8000 * money.Euro, 0},
+		{30 * time.Second, 8300 * money.Euro, 0},
+		// +5% from the low within the minute
+		{50 * time.Second, 8400 * money.Euro, 1},
+		// cooldown of the period
+		{80 * time.Second, 7900 * money.Euro, 1},
+		// the 8000 low is outside the minute, -5.95% from the 8400 high
+		{110 * time.Second, 7900 * money.Euro, 2},
+		// no other trades within the minute
+		{3 * time.Minute, 8300 * money.Euro, 2},
+	}
+	for _, step := range steps {
+		if err := d.Check(trade(step.offset, step.price, money.Bitcoin)); err != nil {
+			t.Fatal(err)
+		}
+		if len(*messages) != step.expected {
+			t.Fatalf("After %v: expected %d messages, got %+v", step.offset, step.expected, *messages)
+		}
+	}
+	if m := (*messages)[0].text; !strings.Contains(m, "BTCEUR rose 5.00% from 8000.00 to 8400.00 EUR/BTC in 50s") {
+		t.Errorf("Unexpected message %s", m)
+	}
+	if m := (*messages)[1].text; !strings.Contains(m, "BTCEUR dropped 5.95% from 8400.00 to 7900.00 EUR/BTC in 1m0s") {
+		t.Errorf("Unexpected message %s", m)
+	}
+}
+
+func TestDetector_SettingsRefresh(t *testing.T) {
+	d, messages := newTestDetector(t, datastore.WhaleAlertSettings{ChannelID: "C1", MinAmount: 10 * money.Bitcoin})
+	ds := d.ds.(*fakeDataStore)
+	now := start
+	d.now = func() time.Time { return now }
+
+	if err := d.Check(trade(0, 8000*money.Euro, 10*money.Bitcoin)); err != nil {
+		t.Fatal(err)
+	}
+	// the changed settings apply after the refresh
+	ds.settings = []datastore.WhaleAlertSettings{{ChannelID: "C2", MinAmount: 10 * money.Bitcoin}}
+	now = now.Add(SettingsRefresh - time.Second)
+	if err := d.Check(trade(time.Second, 8000*money.Euro, 10*money.Bitcoin)); err != nil {
+		t.Fatal(err)
+	}
+	if ds.loads != 1 {
+		t.Errorf("Expected the settings to be loaded once, got %d loads", ds.loads)
+	}
+	now = now.Add(time.Second)
+	if err := d.Check(trade(2*time.Second, 8000*money.Euro, 10*money.Bitcoin)); err != nil {
+		t.Fatal(err)
+	}
+	if ds.loads != 2 {
+		t.Errorf("Expected the settings to be reloaded, got %d loads", ds.loads)
+	}
+	if len(*messages) != 3 || (*messages)[1].channelID != "C1" || (*messages)[2].channelID != "C2" {
+		t.Fatalf("Unexpected messages %+v", *messages)
+	}
+}
+
+func TestDetector_SettingsError(t *testing.T) {
+	d, messages := newTestDetector(t, datastore.WhaleAlertSettings{ChannelID: "C1", MinAmount: 10 * money.Bitcoin})
+	ds := d.ds.(*fakeDataStore)
+	now := start
+	d.now = func() time.Time { return now }
+
+	// without settings the trades are added to the history, but no channel is notified
+	ds.err = errors.New("database down")
+	if err := d.Check(trade(0, 8000*money.Euro, 10*money.Bitcoin)); err == nil {
+		t.Error("Expected an error loading the settings")
+	}
+	if err := d.Check(trade(time.Second, 8000*money.Euro, 10*money.Bitcoin)); err != nil {
+		t.Errorf("Expected no reload before the refresh, got %v", err)
+	}
+	if len(*messages) != 0 {
+		t.Fatalf("Expected no messages, got %+v", *messages)
+	}
+	if len(d.sizes) != 2 || len(d.trades) != 2 {
+		t.Fatalf("Expected 2 trades in the history, got %d sizes and %d trades", len(d.sizes), len(d.trades))
+	}
+
+	ds.err = nil
+	now = now.Add(SettingsRefresh)
+	if err := d.Check(trade(time.Minute, 8000*money.Euro, 10*money.Bitcoin)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*messages) != 1 {
+		t.Fatalf("Expected 1 message, got %+v", *messages)
+	}
+
+	// a failed reload keeps the loaded settings
+	ds.err = errors.New("database down")
+	now = now.Add(SettingsRefresh)
+	if err := d.Check(trade(2*time.Minute, 8000*money.Euro, 10*money.Bitcoin)); err == nil {
+		t.Error("Expected an error reloading the settings")
+	}
+	if len(*messages) != 2 || len(d.sizes) != 4 {
+		t.Fatalf("Expected 2 messages and 4 trades in the history, got %+v and %d trades", *messages, len(d.sizes))
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	if s := Describe(datastore.WhaleAlertSettings{ChannelID: "C1"}); s != "Whale alerts are off" {
+		t.Errorf("Unexpected description %s", s)
+	}
+	s := Describe(datastore.WhaleAlertSettings{ChannelID: "C1", MinAmount: 25 * money.Bitcoin, MovePercent: 2.5, MoveSeconds: 300})
+	if s != "Whale alerts on trades of at least 25.00 BTC, price moves of 2.50% within 5m0s" {
+		t.Errorf("Unexpected description %s", s)
+	}
+}
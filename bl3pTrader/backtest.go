@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/resc/rescbits/backtest"
+	"github.com/resc/rescbits/bitbot/env"
+	"github.com/resc/rescbits/money"
+	"github.com/resc/rescbits/paper"
+	log "github.com/sirupsen/logrus"
+)
+
+// runBacktest runs the configured strategy over the history of the market and prints the report.
+// The source is trades or samples for the stored data between from and to, or the path of a recording.
+func runBacktest(ctx context.Context, market, source, from, to, reportPath string) error {
+	name := env.String(BL3PTRADER_STRATEGY)
+	if name == "" {
+		return errors.Errorf("%s is needed for a backtest", BL3PTRADER_STRATEGY)
+	}
+	s, err := newStrategy(name)
+	if err != nil {
+		return err
+	}
+	limits, err := parseLimits()
+	if err != nil {
+		return err
+	}
+	eur, err := money.ParsePrice(env.String(BL3PTRADER_PAPER_EUR))
+	if err != nil {
+		return err
+	}
+	fee := env.Float(BL3PTRADER_PAPER_FEE)
+
+	src, err := openBacktestSource(source, market, from, to)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	log.Infof("Backtesting %s on %s with %s EUR", name, market, eur)
+	report, err := backtest.Run(ctx, s, src, backtest.Config{
+		Paper:  paper.Config{Market: market, Eur: eur, MakerFee: fee, TakerFee: fee},
+		Limits: limits,
+	})
+	if err != nil {
+		return errors.Wrap(err, "backtest failed")
+	}
+
+	if reportPath != "" {
+		f, err := os.Create(reportPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := report.WriteJSON(f); err != nil {
+			return err
+		}
+		log.Infof("Wrote the backtest report to %s", reportPath)
+	}
+	return report.WriteText(os.Stdout)
+}
+
+// openBacktestSource opens the stored trades or price samples between the configured times, or a recording
+func openBacktestSource(source, market, from, to string) (backtest.Source, error) {
+	if source != "trades" && source != "samples" {
+		return backtest.Recording(source, market)
+	}
+
+	start, err := parseTime(from)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid start")
+	}
+	end := time.Now()
+	if to != "" {
+		if end, err = parseTime(to); err != nil {
+			return nil, errors.Wrap(err, "invalid end")
+		}
+	}
+	if !start.Before(end) {
+		return nil, errors.New("the backtest should start before it ends")
+	}
+
+	ds, err := openDataStore(env.String(BL3PTRADER_DATABASE_URL))
+	if err != nil {
+		return nil, err
+	}
+	if ds == nil {
+		return nil, errors.Errorf("%s is needed for a backtest over stored data", BL3PTRADER_DATABASE_URL)
+	}
+	if source == "trades" {
+		return &closingSource{Source: backtest.StoredTrades(ds, market, start, end), close: ds.Close}, nil
+	}
+	return &closingSource{Source: backtest.StoredSamples(ds, start, end), close: ds.Close}, nil
+}
+
+// parseTime parses a date or an RFC3339 timestamp
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+type (
+	// closingSource closes the datastore with the source
+	closingSource struct {
+		backtest.Source
+		close func() error
+	}
+)
+
+func (s *closingSource) Close() error {
+	s.Source.Close()
+	return s.close()
+}
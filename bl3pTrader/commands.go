@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/candles"
+	"github.com/resc/rescbits/tape"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// options are the global command line options
+	options struct {
+		baseUrl string
+		version string
+		markets []string
+		out     *output
+	}
+
+	command struct {
+		name        string
+		args        string
+		description string
+		run         func(ctx context.Context, o *options, args []string) error
+	}
+
+	// printer writes the trades and order books of the feeds of one market to the output
+	printer struct {
+		out    *output
+		closed chan<- error                   // receives the error of the feed when it's closed
+		book   bl3pfeed.OrderBookFeedListener // maintains the book and calls OnBookChanged
+	}
+)
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "", "follows the feeds, persists the trades and runs the strategy, this is the default command", runTrader},
+		{"watch", "trades|orderbook", "prints the trades or the best prices of the order books", watch},
+		{"record", "<file>", "records the trades and order book feeds to the file", record},
+		{"replay", "[-speed n] <file>", "prints the trades and best prices of a recording", replay},
+		{"candles", "[-interval 1m]", "prints the candles of the trades when they close", watchCandles},
+		{"tape", "[-windows 1m,5m,1h] [-largest 3] [-every 10s]", "prints the volume, vwap and buy/sell imbalance of the trades of the windows", watchTape},
+		{"book-depth", "[-levels 10] [-every 5s]", "prints the first levels of the order books with their cumulative amounts", bookDepth},
+		{"backtest", "[-from date] [-to date] [-report file] trades|samples|<file>", "runs the strategy over the stored trades, price samples or a recording", backtestCommand},
+	}
+}
+
+// usage prints the commands and the global flags
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command] [args]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %s %s\n    \t%s\n", c.name, c.args, c.description)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// runCommand runs the command named by the first argument, or the run command if there are no arguments
+func runCommand(ctx context.Context, o *options, args []string) error {
+	name := "run"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	for _, c := range commands {
+		if c.name == name {
+			err := c.run(ctx, o, args)
+			if err == flag.ErrHelp {
+				return nil
+			}
+			return err
+		}
+	}
+	usage()
+	return errors.Errorf("unknown command %s", name)
+}
+
+func (o *options) client() *bl3pfeed.Client {
+	return bl3pfeed.NewClient(o.baseUrl, o.version)
+}
+
+// subscribe subscribes the listener to the channel of all markets
+func (o *options) subscribe(client *bl3pfeed.Client, channel string, l bl3pfeed.FeedListener) error {
+	for _, market := range o.markets {
+		if _, err := client.Subscribe(market, channel, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func watch(ctx context.Context, o *options, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: watch trades|orderbook")
+	}
+	var channel string
+	switch args[0] {
+	case "trades":
+		channel = bl3pfeed.ChannelTrades
+	case "orderbook":
+		channel = bl3pfeed.ChannelOrderBook
+	default:
+		return errors.Errorf("can't watch %s, use trades or orderbook", args[0])
+	}
+
+	client := o.client()
+	defer client.Close()
+	closed := make(chan error, len(o.markets))
+	for _, market := range o.markets {
+		p, err := newPrinter(o.out, closed)
+		if err != nil {
+			return err
+		}
+		if _, err := client.Subscribe(market, channel, p); err != nil {
+			return err
+		}
+	}
+	return waitClosed(ctx, closed, len(o.markets))
+}
+
+func record(ctx context.Context, o *options, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: record <file>")
+	}
+	recorder, err := openRecorder(args[0])
+	if err != nil {
+		return err
+	}
+	defer recorder.Close()
+
+	client := o.client()
+	client.SetRecorder(recorder)
+	defer client.Close()
+	if err := o.subscribe(client, bl3pfeed.ChannelTrades, bl3pfeed.TradeFunc(func(*bl3pfeed.Trade) {})); err != nil {
+		return err
+	}
+	if err := o.subscribe(client, bl3pfeed.ChannelOrderBook, bl3pfeed.OrderBookFunc(func(*bl3pfeed.OrderBook) {})); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("Recorded %d messages", recorder.Frames())
+			return nil
+		case <-ticker.C:
+			log.Infof("Recorded %d messages", recorder.Frames())
+		}
+	}
+}
+
+func replay(ctx context.Context, o *options, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	speed := flags.Float64("speed", 1, "the replay speed, 1 is real time and 0 is as fast as possible")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: replay [-speed n] <file>")
+	}
+
+	closed := make(chan error, len(o.markets))
+	for _, market := range o.markets {
+		p, err := newPrinter(o.out, closed)
+		if err != nil {
+			return err
+		}
+		r, err := bl3pfeed.NewReplay(flags.Arg(0), market, "", p)
+		if err != nil {
+			return err
+		}
+		r.SetSpeed(*speed)
+		if err := r.Open(nil); err != nil {
+			return err
+		}
+		defer r.Close()
+	}
+
+	// the replays close their printers at the end of the recording
+	return waitClosed(ctx, closed, len(o.markets))
+}
+
+// waitClosed waits until n feeds are closed or the context is done,
+// it returns the error of the first feed that closed with an error as soon as it's closed
+func waitClosed(ctx context.Context, closed <-chan error, n int) error {
+	for i := 0; i < n; i++ {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-closed:
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func watchCandles(ctx context.Context, o *options, args []string) error {
+	flags := flag.NewFlagSet("candles", flag.ContinueOnError)
+	interval := flags.String("interval", "1m", "the candle interval, e.g. 1m, 5m, 1h or 1d")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	d, err := candles.ParseInterval(*interval)
+	if err != nil {
+		return err
+	}
+
+	client := o.client()
+	defer client.Close()
+	var lock sync.Mutex
+	builders := make([]*candles.Builder, 0, len(o.markets))
+	for _, market := range o.markets {
+		market := market
+		builder, err := candles.NewBuilder(d, 0, func(c candles.Candle) {
+			if err := o.out.candle(market, c); err != nil {
+				log.Error(err)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		builders = append(builders, builder)
+		if _, err := client.Subscribe(market, bl3pfeed.ChannelTrades, bl3pfeed.TradeFunc(func(t *bl3pfeed.Trade) {
+			lock.Lock()
+			defer lock.Unlock()
+			builder.AddTrade(t)
+		})); err != nil {
+			return err
+		}
+	}
+
+	// close the candles of quiet markets too
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			lock.Lock()
+			for _, b := range builders {
+				b.Advance(now)
+			}
+			lock.Unlock()
+		}
+	}
+}
+
+func watchTape(ctx context.Context, o *options, args []string) error {
+	flags := flag.NewFlagSet("tape", flag.ContinueOnError)
+	windows := flags.String("windows", "1m,5m,1h", "comma separated list of the windows")
+	largest := flags.Int("largest", tape.DefaultLargest, "the number of largest trades of every window")
+	every := flags.Duration("every", 10*time.Second, "the interval between the prints")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *every <= 0 {
+		return errors.New("the interval should be positive")
+	}
+	durations := make([]time.Duration, 0)
+	for _, w := range strings.Split(*windows, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(w))
+		if err != nil {
+			return err
+		}
+		durations = append(durations, d)
+	}
+
+	client := o.client()
+	defer client.Close()
+	tapes := make(map[string]*tape.Tape)
+	for _, market := range o.markets {
+		t, err := tape.New(*largest, durations...)
+		if err != nil {
+			return err
+		}
+		tapes[market] = t
+		if _, err := client.Subscribe(market, bl3pfeed.ChannelTrades, t); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(*every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			for _, market := range o.markets {
+				for _, s := range tapes[market].Stats(now) {
+					if err := o.out.tape(market, s); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+}
+
+func bookDepth(ctx context.Context, o *options, args []string) error {
+	flags := flag.NewFlagSet("book-depth", flag.ContinueOnError)
+	levels := flags.Int("levels", 10, "the number of levels of each side")
+	every := flags.Duration("every", 5*time.Second, "the interval between the prints")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *levels <= 0 || *every <= 0 {
+		return errors.New("the levels and the interval should be positive")
+	}
+
+	client := o.client()
+	defer client.Close()
+	books := make([]*bl3pfeed.Book, 0, len(o.markets))
+	for _, market := range o.markets {
+		book := bl3pfeed.NewBook()
+		books = append(books, book)
+		if _, err := client.Subscribe(market, bl3pfeed.ChannelOrderBook, bl3pfeed.OrderBookFunc(func(ob *bl3pfeed.OrderBook) {
+			book.Update(ob)
+		})); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(*every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			for _, b := range books {
+				if b.Updated().IsZero() {
+					continue
+				}
+				if err := o.out.depth(b.Updated(), b, *levels); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func backtestCommand(ctx context.Context, o *options, args []string) error {
+	flags := flag.NewFlagSet("backtest", flag.ContinueOnError)
+	from := flags.String("from", "", "the start of a backtest over stored data, as a date or RFC3339 timestamp")
+	to := flags.String("to", "", "the end of a backtest over stored data, now if empty")
+	report := flags.String("report", "", "writes the report as json to this file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: backtest [-from date] [-to date] [-report file] trades|samples|<file>")
+	}
+	return runBacktest(ctx, o.markets[0], flags.Arg(0), *from, *to, *report)
+}
+
+// newPrinter creates a printer for the feeds of one market, closed should have room for the error of every printer
+func newPrinter(out *output, closed chan<- error) (*printer, error) {
+	p := &printer{
+		out:    out,
+		closed: closed,
+	}
+	book, err := bl3pfeed.NewBookListener(p)
+	if err != nil {
+		return nil, err
+	}
+	p.book = book
+	return p, nil
+}
+
+func (p *printer) FeedDisconnected(channel string, err error) {
+	log.Warnf("%s feed disconnected: %v", channel, err)
+}
+
+func (p *printer) FeedReconnected(channel string, attempts int) {
+	log.Infof("%s feed reconnected after %d attempt(s)", channel, attempts)
+}
+
+func (p *printer) FeedClosed(channel string, err error) {
+	if err != nil {
+		log.Errorf("%s feed closed: %v", channel, err)
+	}
+	select {
+	case p.closed <- err:
+	default:
+	}
+}
+
+func (p *printer) OnTrade(t *bl3pfeed.Trade) {
+	if err := p.out.trade(t); err != nil {
+		log.Error(err)
+	}
+}
+
+// OnOrderBookChanged updates the book, replays deliver the order books of the market to the printer itself
+func (p *printer) OnOrderBookChanged(o *bl3pfeed.OrderBook) {
+	p.book.OnOrderBookChanged(o)
+}
+
+// OnBookChanged prints the best prices when the book changed
+func (p *printer) OnBookChanged(b *bl3pfeed.Book, diff *bl3pfeed.BookDiff) {
+	if diff.IsEmpty() {
+		return
+	}
+	if err := p.out.book(b.Updated(), b); err != nil {
+		log.Error(err)
+	}
+}
+
+var (
+	_ bl3pfeed.TradesFeedListener    = (*printer)(nil)
+	_ bl3pfeed.OrderBookFeedListener = (*printer)(nil)
+	_ bl3pfeed.BookFeedListener      = (*printer)(nil)
+)
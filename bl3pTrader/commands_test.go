@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitClosed(t *testing.T) {
+	// the error of the second feed returns while the first feed is still open
+	closed := make(chan error, 2)
+	p1, err := newPrinter(nil, closed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := newPrinter(nil, closed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken := errors.New("retries exhausted")
+	p2.FeedClosed("trades", broken)
+
+	result := make(chan error, 1)
+	go func() { result <- waitClosed(context.Background(), closed, 2) }()
+	select {
+	case err := <-result:
+		if err != broken {
+			t.Errorf("Expected the error of the second feed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for waitClosed")
+	}
+
+	// feeds closed without an error return when all are closed
+	closed = make(chan error, 2)
+	p1.closed, p2.closed = closed, closed
+	p1.FeedClosed("trades", nil)
+	p2.FeedClosed("trades", nil)
+	if err := waitClosed(context.Background(), closed, 2); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := waitClosed(ctx, make(chan error), 1); err != nil {
+		t.Errorf("Expected no error when the context is done, got %v", err)
+	}
+}
@@ -1,105 +1,197 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"github.com/pkg/errors"
+	"github.com/resc/rescbits/bitbot/datastore"
+	"github.com/resc/rescbits/bitbot/env"
+	"github.com/resc/rescbits/bitbot/migrations"
+	"github.com/resc/rescbits/bl3papi"
 	"github.com/resc/rescbits/bl3pfeed"
 	log "github.com/sirupsen/logrus"
 	"os"
-	"bufio"
-	"fmt"
+	"strings"
 	"time"
 )
 
-func main() {
-
-	baseUrl := "wss://api.bl3p.eu"
-	version := "1"
-	market := "BTCEUR"
-
-	run(baseUrl, version, market)
-}
+// environment variables
+const (
+	BL3PTRADER_DATABASE_URL        = "BL3PTRADER_DATABASE_URL"
+	BL3PTRADER_TRADES_BATCH_SIZE   = "BL3PTRADER_TRADES_BATCH_SIZE"
+	BL3PTRADER_TRADES_FLUSH_SEC    = "BL3PTRADER_TRADES_FLUSH_SEC"
+	BL3PTRADER_TRADES_BUFFER_LIMIT = "BL3PTRADER_TRADES_BUFFER_LIMIT"
+	BL3PTRADER_RECORD_FILE         = "BL3PTRADER_RECORD_FILE"
+	BL3PTRADER_MARKETS             = "BL3PTRADER_MARKETS"
+	BL3PTRADER_API_URL             = "BL3PTRADER_API_URL"
+	BL3PTRADER_API_KEY             = "BL3PTRADER_API_KEY"
+	BL3PTRADER_API_SECRET          = "BL3PTRADER_API_SECRET"
+	BL3PTRADER_STRATEGY            = "BL3PTRADER_STRATEGY"
+	BL3PTRADER_LIVE                = "BL3PTRADER_LIVE"
+	BL3PTRADER_PAPER_EUR           = "BL3PTRADER_PAPER_EUR"
+	BL3PTRADER_PAPER_FEE           = "BL3PTRADER_PAPER_FEE"
+	BL3PTRADER_ORDER_SIZE          = "BL3PTRADER_ORDER_SIZE"
+	BL3PTRADER_MAX_POSITION        = "BL3PTRADER_MAX_POSITION"
+	BL3PTRADER_MAX_DAILY_LOSS      = "BL3PTRADER_MAX_DAILY_LOSS"
+	BL3PTRADER_CROSSOVER           = "BL3PTRADER_CROSSOVER"
+	BL3PTRADER_MAKER_SPREAD        = "BL3PTRADER_MAKER_SPREAD"
+	BL3PTRADER_URL                 = "BL3PTRADER_URL"
+	BL3PTRADER_VERSION             = "BL3PTRADER_VERSION"
+	BL3PTRADER_FORMAT              = "BL3PTRADER_FORMAT"
+)
 
-func run(baseUrl string, version string, market string) {
-	trades, err := runTrades(baseUrl, version, market)
+func main() {
+	env.Optional(BL3PTRADER_DATABASE_URL, "", "The postgres database uri for persisting trades, trades are only logged if empty")
+	env.OptionalInt(BL3PTRADER_TRADES_BATCH_SIZE, 100, "the number of trades written in one batch")
+	env.OptionalInt(BL3PTRADER_TRADES_FLUSH_SEC, 5, "the interval for writing buffered trades")
+	env.OptionalInt(BL3PTRADER_TRADES_BUFFER_LIMIT, 100000, "the number of trades kept in memory while the database is unavailable")
+	env.Optional(BL3PTRADER_RECORD_FILE, "", "records the raw feed messages to this file for replaying them later, nothing is recorded if empty")
+	env.Optional(BL3PTRADER_MARKETS, "BTCEUR", "comma separated list of the markets to follow, e.g. BTCEUR,LTCEUR")
+	env.Optional(BL3PTRADER_API_URL, bl3papi.DefaultBaseUrl, "the BL3P http api url")
+	env.Optional(BL3PTRADER_API_KEY, "", "the BL3P api key, the account isn't used if empty")
+	env.Optional(BL3PTRADER_API_SECRET, "", "the base64 encoded BL3P api secret")
+	env.Optional(BL3PTRADER_STRATEGY, "", "the strategy to run on every market, crossover or spread-maker, no strategy runs if empty")
+	env.OptionalBool(BL3PTRADER_LIVE, false, "set this variable to true to trade with the BL3P account instead of on paper")
+	env.Optional(BL3PTRADER_PAPER_EUR, "1000", "the starting EUR balance for paper trading")
+	env.OptionalFloat(BL3PTRADER_PAPER_FEE, 0.25, "the fee percentage for paper trading")
+	env.Optional(BL3PTRADER_ORDER_SIZE, "0.01", "the BTC amount the strategy trades, it's also the max order size")
+	env.Optional(BL3PTRADER_MAX_POSITION, "0.1", "the largest long or short BTC position the strategy may take")
+	env.Optional(BL3PTRADER_MAX_DAILY_LOSS, "100", "the EUR loss that halts the strategy for the rest of the day")
+	env.Optional(BL3PTRADER_CROSSOVER, "5m,5,20", "the candle interval and the fast and slow moving average lengths of the crossover strategy")
+	env.Optional(BL3PTRADER_MAKER_SPREAD, "5", "the minimum EUR spread the spread-maker strategy quotes")
+	env.Optional(BL3PTRADER_URL, "wss://api.bl3p.eu", "the BL3P websocket api url, the -url flag overrides it")
+	env.Optional(BL3PTRADER_VERSION, "1", "the BL3P websocket api version, the -version flag overrides it")
+	env.Optional(BL3PTRADER_FORMAT, formatHuman, "the output format of the commands, human, json or csv, the -format flag overrides it")
+	env.MustParse()
+
+	flag.Usage = usage
+	baseUrl := flag.String("url", env.String(BL3PTRADER_URL), "the BL3P websocket api `url`")
+	version := flag.String("version", env.String(BL3PTRADER_VERSION), "the BL3P websocket api `version`")
+	markets := flag.String("market", env.String(BL3PTRADER_MARKETS), "comma separated list of the `markets`, the backtest uses the first")
+	format := flag.String("format", env.String(BL3PTRADER_FORMAT), "the output `format`, human, json (lines) or csv")
+	flag.Parse()
+
+	out, err := newOutput(os.Stdout, *format)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer trades.Close()
-
-	//orderBooks, err := runOrderBooks(baseUrl, version, market)
-	//if err != nil {
-	//	log.Fatal(err)
-	//}
-	//defer orderBooks.Close()
+	o := &options{baseUrl: *baseUrl, version: *version, out: out}
+	for _, market := range strings.Split(*markets, ",") {
+		if market = strings.TrimSpace(market); market != "" {
+			o.markets = append(o.markets, market)
+		}
+	}
+	if len(o.markets) == 0 {
+		log.Fatal("no markets")
+	}
 
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Println("Press return to exit")
-	reader.ReadString('\n')
+	if err := runCommand(signalContext(), o, flag.Args()); err != nil {
+		log.Fatal(err)
+	}
 }
 
-type (
-	tradePersister struct {
+// runTrader follows the feeds, persists the trades and runs the strategy until ctx is done
+func runTrader(ctx context.Context, o *options, args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: run")
+	}
+	ds, err := openDataStore(env.String(BL3PTRADER_DATABASE_URL))
+	if err != nil {
+		return err
+	}
+	if ds != nil {
+		defer ds.Close()
 	}
-)
 
-func (t *tradePersister) FeedClosed(channel string, err error) {
-}
+	persister := newTradePersister(ds,
+		env.Int(BL3PTRADER_TRADES_BATCH_SIZE),
+		time.Duration(env.Int(BL3PTRADER_TRADES_FLUSH_SEC))*time.Second,
+		env.Int(BL3PTRADER_TRADES_BUFFER_LIMIT))
+	defer persister.Close()
 
-func (t *tradePersister) OnTrade(trade *bl3pfeed.Trade) {
-	amount := float64(trade.Amount) / 1e8
-	price := float64(trade.Price) / 1e5
-	log.Debugf("%s %4s %2.5f BC %5.2f EUR (%.5f) %s", trade.Marketplace, trade.Type, amount, price*amount, price, time.Unix(trade.Date, 0).String())
-}
+	recorder, err := openRecorder(env.String(BL3PTRADER_RECORD_FILE))
+	if err != nil {
+		return err
+	}
+	if recorder != nil {
+		defer recorder.Close()
+	}
 
-var _ bl3pfeed.TradesFeedListener = (*tradePersister)(nil)
+	if err := logBalances(env.String(BL3PTRADER_API_URL), env.String(BL3PTRADER_API_KEY), env.String(BL3PTRADER_API_SECRET)); err != nil {
+		return err
+	}
 
-func runTrades(baseUrl string, version string, market string) (bl3pfeed.Feed, error) {
-	var listener = &tradePersister{}
-	trades, err := bl3pfeed.NewTrades(baseUrl, version, market, listener)
+	client := o.client()
+	client.SetRecorder(recorder)
+	defer client.Close()
 
-	if err != nil {
-		return nil, err
+	if err := o.subscribe(client, bl3pfeed.ChannelTrades, persister); err != nil {
+		return err
 	}
-	err = trades.Open(nil)
+
+	strategies, err := startStrategies(ctx, client, o.markets)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return trades, nil
+	log.Info("Press ctrl+c to exit")
+	<-ctx.Done()
+	strategies.Wait()
+	return nil
 }
 
-type (
-	orderbookPersister struct {
+// openDataStore opens the datastore and checks the schema, it returns nil if no connection string is configured
+func openDataStore(connectionString string) (datastore.DataStore, error) {
+	if connectionString == "" {
+		log.Warnf("%s not set, trades will not be persisted", BL3PTRADER_DATABASE_URL)
+		return nil, nil
 	}
-)
 
-func (t *orderbookPersister) FeedClosed(channel string, err error) {
-}
+	m, err := migrations.New(connectionString)
+	if err != nil {
+		return nil, errors.Wrap(err, "error initializing database migrations")
+	}
+	if ok, err := m.IsUpToDate(); err != nil {
+		return nil, errors.Wrap(err, "error checking database schema")
+	} else if !ok {
+		return nil, errors.New("database schema not up to date, please run bitbot with auto-migrate enabled")
+	}
 
-func (t *orderbookPersister) OnOrderBookChanged(o *bl3pfeed.OrderBook) {
-	log.Print("Orderbook:")
-	for _, ask := range o.Asks {
-		amount := float64(ask.Amount) / 1e8
-		price := float64(ask.Price) / 1e5
-		log.Printf("\tASK: %.5f BC %.5f EUR", amount, price)
+	ds, err := datastore.Open(connectionString)
+	if err != nil {
+		return nil, err
 	}
-	for _, bid := range o.Bids {
-		amount := float64(bid.Amount) / 1e8
-		price := float64(bid.Price) / 1e5
-		log.Printf("\tBID: %.5f BC %.5f EUR", amount, price)
+	if err := ds.Ping(); err != nil {
+		ds.Close()
+		return nil, err
 	}
+	return ds, nil
 }
 
-func runOrderBooks(baseUrl string, version string, market string) (bl3pfeed.Feed, error) {
-	listener := &orderbookPersister{}
-	orders, err := bl3pfeed.NewOrderBook(baseUrl, version, market, listener)
-
+// logBalances checks the api credentials by logging the account balances, it does nothing if no key is configured
+func logBalances(url, key, secret string) error {
+	if key == "" {
+		return nil
+	}
+	api, err := bl3papi.New(url, key, secret)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	err = orders.Open(nil)
+	info, err := api.Info(context.Background())
 	if err != nil {
-		return nil, err
+		return errors.Wrap(err, "error reading the BL3P account")
+	}
+	for _, w := range info.Wallets {
+		log.Infof("%s balance %s, available %s", w.Currency, w.Balance, w.Available)
 	}
+	return nil
+}
 
-	return orders, nil
+// openRecorder creates the recording file, it returns nil if no file is configured
+func openRecorder(path string) (*bl3pfeed.Recorder, error) {
+	if path == "" {
+		return nil, nil
+	}
+	log.Infof("Recording feed messages to %s", path)
+	return bl3pfeed.CreateRecording(path)
 }
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/candles"
+	"github.com/resc/rescbits/money"
+	"github.com/resc/rescbits/tape"
+)
+
+// output formats
+const (
+	formatHuman = "human"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+// humanTime is the time layout of the human output
+const humanTime = "2006-01-02 15:04:05"
+
+type (
+	// field is a named value of an output record
+	field struct {
+		name  string
+		value interface{}
+	}
+
+	// output writes records as human readable lines, json lines or csv, it's safe for concurrent use
+	output struct {
+		lock    sync.Mutex
+		w       io.Writer
+		format  string
+		csv     *csv.Writer
+		columns string // the csv header of the last record
+	}
+)
+
+// newOutput creates an output in the format, human, json or csv
+func newOutput(w io.Writer, format string) (*output, error) {
+	o := &output{w: w, format: format}
+	switch format {
+	case formatHuman, formatJSON:
+	case formatCSV:
+		o.csv = csv.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown output format %s, use human, json or csv", format)
+	}
+	return o, nil
+}
+
+// trade writes a trade
+func (o *output) trade(t *bl3pfeed.Trade) error {
+	at := time.Unix(t.Date, 0)
+	total := t.Price.Total(t.Amount, money.RoundHalfUp)
+	return o.write(
+		fmt.Sprintf("%s %s %4s %s BTC at %s EUR (%s EUR)",
+			at.Format(humanTime), t.Marketplace, t.Type, t.Amount.StringFixed(5), t.Price.StringFixed(2), total.StringFixed(2)),
+		field{"event", "trade"},
+		field{"time", at},
+		field{"market", t.Marketplace},
+		field{"type", t.Type},
+		field{"price", t.Price},
+		field{"amount", t.Amount},
+		field{"total", total})
+}
+
+// book writes the best prices of an order book, it does nothing if a side is empty
+func (o *output) book(at time.Time, b *bl3pfeed.Book) error {
+	ask, bid, ok := b.Best()
+	if !ok {
+		return nil
+	}
+	spread := ask.Price - bid.Price
+	mid := ask.Price.Add(bid.Price).MulDiv(1, 2, money.RoundDown)
+	return o.write(
+		fmt.Sprintf("%s %s bid %s EUR (%s BTC) ask %s EUR (%s BTC) spread %s EUR mid %s EUR",
+			at.Format(humanTime), b.Market(), bid.Price.StringFixed(2), bid.Amount.StringFixed(5),
+			ask.Price.StringFixed(2), ask.Amount.StringFixed(5), spread.StringFixed(2), mid.StringFixed(2)),
+		field{"event", "orderbook"},
+		field{"time", at},
+		field{"market", b.Market()},
+		field{"bid", bid.Price},
+		field{"bid_amount", bid.Amount},
+		field{"ask", ask.Price},
+		field{"ask_amount", ask.Amount},
+		field{"spread", spread},
+		field{"mid", mid})
+}
+
+// candle writes a candle of the market
+func (o *output) candle(market string, c candles.Candle) error {
+	return o.write(
+		fmt.Sprintf("%s %s %s O %s H %s L %s C %s V %s BTC (%d trades)",
+			c.Start.Format(humanTime), market, candles.FormatInterval(c.Interval), c.Open.StringFixed(2), c.High.StringFixed(2),
+			c.Low.StringFixed(2), c.Close.StringFixed(2), c.Volume.StringFixed(5), c.Count),
+		field{"event", "candle"},
+		field{"time", c.Start},
+		field{"market", market},
+		field{"interval", candles.FormatInterval(c.Interval)},
+		field{"open", c.Open},
+		field{"high", c.High},
+		field{"low", c.Low},
+		field{"close", c.Close},
+		field{"volume", c.Volume},
+		field{"count", c.Count})
+}
+
+// tape writes the statistics of a window of the trades of the market, the human format lists the largest trades
+func (o *output) tape(market string, s tape.Stats) error {
+	var largest bl3pfeed.Trade
+	human := fmt.Sprintf("%s %s %s", s.End.Format(humanTime), market, &s)
+	for i, t := range s.Largest {
+		if i == 0 {
+			largest = t
+			human += ", largest"
+		}
+		human += fmt.Sprintf(" %s BTC at %s", t.Amount.StringFixed(5), t.Price.StringFixed(2))
+	}
+	return o.write(human,
+		field{"event", "tape"},
+		field{"time", s.End},
+		field{"market", market},
+		field{"window", s.Window.String()},
+		field{"count", s.Count},
+		field{"volume", s.Volume},
+		field{"turnover", s.Turnover},
+		field{"vwap", s.VWAP},
+		field{"buy_volume", s.BuyVolume},
+		field{"sell_volume", s.SellVolume},
+		field{"imbalance", s.Imbalance()},
+		field{"largest_amount", largest.Amount},
+		field{"largest_price", largest.Price})
+}
+
+// depth writes the first levels of both sides of the book with their cumulative amounts, the asks from high to low
+func (o *output) depth(at time.Time, b *bl3pfeed.Book, levels int) error {
+	asks, bids := b.Depth(levels)
+	if o.format == formatHuman {
+		o.lock.Lock()
+		defer o.lock.Unlock()
+		lines := &bytes.Buffer{}
+		fmt.Fprintf(lines, "%s %s\n", at.Format(humanTime), b.Market())
+		for i := len(asks) - 1; i >= 0; i-- {
+			fmt.Fprintf(lines, "\tASK %12s EUR %14s BTC %14s BTC\n",
+				asks[i].Price.StringFixed(2), asks[i].Amount.StringFixed(5), cumulative(asks[:i+1]).StringFixed(5))
+		}
+		for i := range bids {
+			fmt.Fprintf(lines, "\tBID %12s EUR %14s BTC %14s BTC\n",
+				bids[i].Price.StringFixed(2), bids[i].Amount.StringFixed(5), cumulative(bids[:i+1]).StringFixed(5))
+		}
+		_, err := o.w.Write(lines.Bytes())
+		return err
+	}
+
+	for i := len(asks) - 1; i >= 0; i-- {
+		if err := o.level(at, b.Market(), "ask", i+1, asks[i], cumulative(asks[:i+1])); err != nil {
+			return err
+		}
+	}
+	for i := range bids {
+		if err := o.level(at, b.Market(), "bid", i+1, bids[i], cumulative(bids[:i+1])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *output) level(at time.Time, market, side string, n int, l bl3pfeed.Level, cumulative money.Amount) error {
+	return o.write("",
+		field{"event", "depth"},
+		field{"time", at},
+		field{"market", market},
+		field{"side", side},
+		field{"level", n},
+		field{"price", l.Price},
+		field{"amount", l.Amount},
+		field{"cumulative", cumulative})
+}
+
+// write writes the human line or the fields in the output format
+func (o *output) write(human string, fields ...field) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	switch o.format {
+	case formatJSON:
+		line := &bytes.Buffer{}
+		line.WriteByte('{')
+		for i, f := range fields {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			name, _ := json.Marshal(f.name)
+			value, err := json.Marshal(f.value)
+			if err != nil {
+				return err
+			}
+			line.Write(name)
+			line.WriteByte(':')
+			line.Write(value)
+		}
+		line.WriteString("}\n")
+		_, err := o.w.Write(line.Bytes())
+		return err
+	case formatCSV:
+		names := make([]string, len(fields))
+		values := make([]string, len(fields))
+		for i, f := range fields {
+			names[i] = f.name
+			values[i] = csvValue(f.value)
+		}
+		// a header for every change of record type
+		if columns := strings.Join(names, ","); columns != o.columns {
+			o.columns = columns
+			if err := o.csv.Write(names); err != nil {
+				return err
+			}
+		}
+		if err := o.csv.Write(values); err != nil {
+			return err
+		}
+		o.csv.Flush()
+		return o.csv.Error()
+	default:
+		_, err := fmt.Fprintln(o.w, human)
+		return err
+	}
+}
+
+func csvValue(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
+
+func cumulative(levels []bl3pfeed.Level) money.Amount {
+	sum := money.Amount(0)
+	for _, l := range levels {
+		sum += l.Amount
+	}
+	return sum
+}
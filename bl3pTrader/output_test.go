@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+	"github.com/resc/rescbits/tape"
+)
+
+func outputTrade() *bl3pfeed.Trade {
+	return &bl3pfeed.Trade{
+		Date:        time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC).Unix(),
+		Marketplace: "BTCEUR",
+		Price:       8000 * money.Euro,
+		Type:        "buy",
+		Amount:      money.Bitcoin / 2,
+	}
+}
+
+func testBook() *bl3pfeed.Book {
+	b := bl3pfeed.NewBook()
+	b.Update(&bl3pfeed.OrderBook{
+		Market: "BTCEUR",
+		Asks: []*bl3pfeed.Order{
+			{Price: 8010 * money.Euro, Amount: money.Bitcoin},
+			{Price: 8020 * money.Euro, Amount: 2 * money.Bitcoin},
+		},
+		Bids: []*bl3pfeed.Order{{Price: 7990 * money.Euro, Amount: 3 * money.Bitcoin}},
+	})
+	return b
+}
+
+func TestNewOutput(t *testing.T) {
+	for _, format := range []string{formatHuman, formatJSON, formatCSV} {
+		if _, err := newOutput(&bytes.Buffer{}, format); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+	}
+	if _, err := newOutput(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestOutput_Human(t *testing.T) {
+	b := &bytes.Buffer{}
+	o, _ := newOutput(b, formatHuman)
+	if err := o.trade(outputTrade()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "BTCEUR  buy 0.50000 BTC at 8000.00 EUR (4000.00 EUR)") {
+		t.Errorf("unexpected trade line %q", b)
+	}
+
+	b.Reset()
+	if err := o.depth(time.Now(), testBook(), 5); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[1], "ASK      8020.00 EUR        2.00000 BTC        3.00000 BTC") ||
+		!strings.Contains(lines[3], "BID      7990.00 EUR        3.00000 BTC        3.00000 BTC") {
+		t.Errorf("unexpected depth\n%s", b)
+	}
+}
+
+func TestOutput_JSON(t *testing.T) {
+	b := &bytes.Buffer{}
+	o, _ := newOutput(b, formatJSON)
+	if err := o.trade(outputTrade()); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.book(time.Now(), testBook()); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 json lines, got %q", b)
+	}
+	if !strings.HasPrefix(lines[0], `{"event":"trade","time":"2018-03-01T`) {
+		t.Errorf("expected the fields in order, got %s", lines[0])
+	}
+	trade := struct {
+		Price  money.Price
+		Amount money.Amount
+		Total  money.Price
+	}{}
+	if err := json.Unmarshal([]byte(lines[0]), &trade); err != nil {
+		t.Fatal(err)
+	}
+	if trade.Price != 8000*money.Euro || trade.Amount != money.Bitcoin/2 || trade.Total != 4000*money.Euro {
+		t.Errorf("unexpected trade %+v", trade)
+	}
+	book := struct {
+		Event  string
+		Spread money.Price
+		Mid    money.Price
+	}{}
+	if err := json.Unmarshal([]byte(lines[1]), &book); err != nil {
+		t.Fatal(err)
+	}
+	if book.Event != "orderbook" || book.Spread != 20*money.Euro || book.Mid != 8000*money.Euro {
+		t.Errorf("unexpected book %+v", book)
+	}
+}
+
+func TestOutput_CSV(t *testing.T) {
+	b := &bytes.Buffer{}
+	o, _ := newOutput(b, formatCSV)
+	o.trade(outputTrade())
+	o.trade(outputTrade())
+	o.book(time.Now(), testBook())
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected a header for every record type, got\n%s", b)
+	}
+	if lines[0] != "event,time,market,type,price,amount,total" ||
+		lines[1] != "trade,2018-03-01T12:00:00Z,BTCEUR,buy,8000.00000,0.50000000,4000.00000" ||
+		lines[1] != lines[2] ||
+		lines[3] != "event,time,market,bid,bid_amount,ask,ask_amount,spread,mid" {
+		t.Errorf("unexpected csv\n%s", b)
+	}
+}
+
+func TestOutput_Tape(t *testing.T) {
+	tp, _ := tape.New(tape.DefaultLargest, time.Minute)
+	tp.AddTrade(outputTrade())
+	s := tp.Stats(time.Unix(outputTrade().Date, 0))[0]
+
+	b := &bytes.Buffer{}
+	o, _ := newOutput(b, formatHuman)
+	if err := o.tape("BTCEUR", s); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "1m0s: 1 trades, volume 0.50000 BTC (4000.00 EUR), vwap 8000.00 EUR") ||
+		!strings.HasSuffix(b.String(), "largest 0.50000 BTC at 8000.00\n") {
+		t.Errorf("unexpected tape line %q", b)
+	}
+
+	b.Reset()
+	o, _ = newOutput(b, formatJSON)
+	if err := o.tape("BTCEUR", s); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"window":"1m0s","count":1,"volume":0.50000000,"turnover":4000.00000,"vwap":8000.00000`) ||
+		!strings.Contains(b.String(), `"imbalance":1,"largest_amount":0.50000000`) {
+		t.Errorf("unexpected tape json %s", b)
+	}
+}
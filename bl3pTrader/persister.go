@@ -0,0 +1,226 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/resc/rescbits/bitbot/datastore"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// tradePersister writes the trades from the feed to the datastore in batches.
+	// Trades are buffered in memory while the database is unavailable, up to maxBuffer trades.
+	// BL3P trades have no id and identical trades in the same second do happen, so only the trades
+	// that the feed repeats after a reconnect are skipped.
+	tradePersister struct {
+		ds        datastore.DataStore
+		batchSize int
+		interval  time.Duration
+		maxBuffer int
+		maxSeen   int
+
+		lock      sync.Mutex
+		buffer    []datastore.Trade
+		seen      map[datastore.Trade]int // the number of identical trades of the previous connections
+		current   map[datastore.Trade]int // the number of identical trades of the current connection
+		seenOrder []datastore.Trade       // the recent trades, oldest first
+		inWindow  map[datastore.Trade]int // the number of occurrences of a trade in seenOrder
+		dropped   int
+
+		flush   chan struct{}
+		done    chan struct{}
+		stopped chan struct{}
+		close   sync.Once
+	}
+)
+
+var _ bl3pfeed.TradesFeedListener = (*tradePersister)(nil)
+
+// newTradePersister creates a persister and starts its flush loop, ds can be nil to only log the trades
+func newTradePersister(ds datastore.DataStore, batchSize int, interval time.Duration, maxBuffer int) *tradePersister {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if maxBuffer < batchSize {
+		maxBuffer = batchSize
+	}
+	t := &tradePersister{
+		ds:        ds,
+		batchSize: batchSize,
+		interval:  interval,
+		maxBuffer: maxBuffer,
+		maxSeen:   10000,
+		seen:      make(map[datastore.Trade]int),
+		current:   make(map[datastore.Trade]int),
+		inWindow:  make(map[datastore.Trade]int),
+		flush:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+func (t *tradePersister) FeedDisconnected(channel string, err error) {
+	log.Warnf("%s feed disconnected: %v", channel, err)
+}
+
+func (t *tradePersister) FeedReconnected(channel string, attempts int) {
+	log.Infof("%s feed reconnected after %d attempt(s)", channel, attempts)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for row, n := range t.current {
+		if n > t.seen[row] {
+			t.seen[row] = n
+		}
+	}
+	t.current = make(map[datastore.Trade]int)
+}
+
+func (t *tradePersister) FeedClosed(channel string, err error) {
+	if err != nil {
+		log.Errorf("%s feed closed: %v", channel, err)
+	}
+}
+
+func (t *tradePersister) OnTrade(trade *bl3pfeed.Trade) {
+	total := trade.Price.Total(trade.Amount, money.RoundHalfUp)
+	log.Debugf("%s %4s %s BC %s EUR (%s) %s", trade.Marketplace, trade.Type, trade.Amount.StringFixed(5), total.StringFixed(2), trade.Price, time.Unix(trade.Date, 0).String())
+
+	if t.ds == nil {
+		return
+	}
+
+	row := datastore.Trade{
+		Market:    trade.Marketplace,
+		Timestamp: time.Unix(trade.Date, 0).UTC(),
+		Type:      trade.Type,
+		Price:     trade.Price,
+		Amount:    trade.Amount,
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// the feed can repeat recent trades after a reconnect, those were already seen on the previous connection
+	t.current[row]++
+	if t.current[row] <= t.seen[row] {
+		return
+	}
+	t.seenOrder = append(t.seenOrder, row)
+	t.inWindow[row]++
+	if len(t.seenOrder) > t.maxSeen {
+		// an identical newer trade keeps the counts, so it's still skipped when the feed repeats it
+		oldest := t.seenOrder[0]
+		t.seenOrder = t.seenOrder[1:]
+		if t.inWindow[oldest]--; t.inWindow[oldest] == 0 {
+			delete(t.inWindow, oldest)
+			delete(t.seen, oldest)
+			delete(t.current, oldest)
+		}
+	}
+
+	t.buffer = append(t.buffer, row)
+	t.trimBuffer()
+
+	if len(t.buffer) >= t.batchSize {
+		select {
+		case t.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close writes the remaining trades and stops the flush loop
+func (t *tradePersister) Close() error {
+	t.close.Do(func() {
+		close(t.done)
+	})
+	<-t.stopped
+	return nil
+}
+
+func (t *tradePersister) run() {
+	defer close(t.stopped)
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			t.save()
+			return
+		case <-ticker.C:
+			t.save()
+		case <-t.flush:
+			t.save()
+		}
+	}
+}
+
+// save writes the buffered trades in a single transaction, on failure they're put back in the buffer
+func (t *tradePersister) save() {
+	if t.ds == nil {
+		return
+	}
+
+	t.lock.Lock()
+	pending := t.buffer
+	t.buffer = nil
+	t.lock.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	saved, err := t.saveTrades(pending)
+	if err != nil {
+		log.Warnf("Error saving %d trades, retrying later: %v", len(pending), err)
+		t.lock.Lock()
+		t.buffer = append(pending, t.buffer...)
+		t.trimBuffer()
+		t.lock.Unlock()
+		return
+	}
+	log.Debugf("Saved %d of %d trades", saved, len(pending))
+}
+
+func (t *tradePersister) saveTrades(trades []datastore.Trade) (int, error) {
+	uow, err := t.ds.StartUow()
+	if err != nil {
+		return 0, err
+	}
+
+	saved := 0
+	for start := 0; start < len(trades); start += t.batchSize {
+		end := start + t.batchSize
+		if end > len(trades) {
+			end = len(trades)
+		}
+		n, err := uow.SaveTrades(trades[start:end]...)
+		if err != nil {
+			uow.Rollback()
+			return 0, err
+		}
+		saved += n
+	}
+
+	if err := uow.Commit(); err != nil {
+		return 0, err
+	}
+	return saved, nil
+}
+
+// trimBuffer drops the oldest trades when the buffer is full, the caller must hold the lock
+func (t *tradePersister) trimBuffer() {
+	if over := len(t.buffer) - t.maxBuffer; over > 0 {
+		t.dropped += over
+		log.Errorf("Trade buffer full, dropped %d trades (%d in total)", over, t.dropped)
+		t.buffer = t.buffer[over:]
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bitbot/datastore"
+	"github.com/resc/rescbits/bl3pfeed"
+)
+
+type (
+	fakeDataStore struct {
+		datastore.DataStore
+
+		lock   sync.Mutex
+		down   bool
+		trades []datastore.Trade
+	}
+
+	fakeUow struct {
+		datastore.UnitOfWork
+		ds      *fakeDataStore
+		pending []datastore.Trade
+	}
+)
+
+func (ds *fakeDataStore) StartUow() (datastore.UnitOfWork, error) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	if ds.down {
+		return nil, errors.New("database unavailable")
+	}
+	return &fakeUow{ds: ds}, nil
+}
+
+func (ds *fakeDataStore) setDown(down bool) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	ds.down = down
+}
+
+func (ds *fakeDataStore) count() int {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	return len(ds.trades)
+}
+
+func (u *fakeUow) SaveTrades(trades ...datastore.Trade) (int, error) {
+	u.pending = append(u.pending, trades...)
+	return len(trades), nil
+}
+
+func (u *fakeUow) Commit() error {
+	u.ds.lock.Lock()
+	defer u.ds.lock.Unlock()
+	u.ds.trades = append(u.ds.trades, u.pending...)
+	return nil
+}
+
+func (u *fakeUow) Rollback() error {
+	return nil
+}
+
+func testTrade(i int) *bl3pfeed.Trade {
+	return &bl3pfeed.Trade{
+		Date:        int64(1500000000 + i),
+		Marketplace: "BTCEUR",
+		Type:        "buy",
+		Price:       800000000,
+		Amount:      1e7,
+	}
+}
+
+func TestTradePersister_Dedup(t *testing.T) {
+	ds := &fakeDataStore{}
+	p := newTradePersister(ds, 10, time.Hour, 100)
+
+	for i := 0; i < 5; i++ {
+		p.OnTrade(testTrade(i))
+	}
+	// identical trades in the same second are different trades
+	p.OnTrade(testTrade(4))
+	// the feed repeats the last trades after a reconnect
+	p.FeedReconnected("trades", 1)
+	for i := 3; i < 8; i++ {
+		p.OnTrade(testTrade(i))
+	}
+	p.OnTrade(testTrade(4))
+	p.Close()
+
+	if n := ds.count(); n != 9 {
+		t.Fatalf("expected 9 trades, got %d", n)
+	}
+}
+
+func TestTradePersister_DedupEviction(t *testing.T) {
+	ds := &fakeDataStore{}
+	p := newTradePersister(ds, 10, time.Hour, 100)
+	p.maxSeen = 3
+
+	// the first of the identical trades is evicted, the second one is still recent
+	p.OnTrade(testTrade(0))
+	p.OnTrade(testTrade(0))
+	p.OnTrade(testTrade(1))
+	p.OnTrade(testTrade(2))
+	p.FeedReconnected("trades", 1)
+	p.OnTrade(testTrade(0))
+	p.OnTrade(testTrade(0))
+	p.OnTrade(testTrade(1))
+	p.OnTrade(testTrade(2))
+	p.Close()
+
+	if n := ds.count(); n != 4 {
+		t.Fatalf("expected 4 trades, got %d", n)
+	}
+}
+
+func TestTradePersister_BuffersWhileDown(t *testing.T) {
+	ds := &fakeDataStore{}
+	ds.setDown(true)
+	p := newTradePersister(ds, 2, time.Hour, 5)
+
+	for i := 0; i < 8; i++ {
+		p.OnTrade(testTrade(i))
+	}
+	p.save()
+	if n := ds.count(); n != 0 {
+		t.Fatalf("expected no saved trades while the database is down, got %d", n)
+	}
+
+	ds.setDown(false)
+	p.Close()
+
+	if n := ds.count(); n != 5 {
+		t.Fatalf("expected the 5 buffered trades to be saved, got %d", n)
+	}
+	if p.dropped != 3 {
+		t.Fatalf("expected 3 dropped trades, got %d", p.dropped)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/resc/rescbits/bitbot/env"
+	"github.com/resc/rescbits/bl3papi"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/candles"
+	"github.com/resc/rescbits/money"
+	"github.com/resc/rescbits/paper"
+	"github.com/resc/rescbits/strategy"
+	log "github.com/sirupsen/logrus"
+)
+
+// signalContext returns a context that is cancelled on SIGINT or SIGTERM
+func signalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-signals
+		log.Infof("Received %s, shutting down", s)
+		signal.Stop(signals)
+		cancel()
+	}()
+	return ctx
+}
+
+// startStrategies starts a strategy runner for every market, the returned WaitGroup is done when they've stopped
+func startStrategies(ctx context.Context, client *bl3pfeed.Client, markets []string) (*sync.WaitGroup, error) {
+	wg := &sync.WaitGroup{}
+	name := env.String(BL3PTRADER_STRATEGY)
+	if name == "" {
+		return wg, nil
+	}
+
+	var live bl3papi.Trader
+	if env.Bool(BL3PTRADER_LIVE) {
+		api, err := bl3papi.New(env.String(BL3PTRADER_API_URL), env.String(BL3PTRADER_API_KEY), env.String(BL3PTRADER_API_SECRET))
+		if err != nil {
+			return nil, errors.Wrap(err, "live trading needs the api credentials")
+		}
+		log.Warn("Trading live with the BL3P account")
+		live = api
+	}
+
+	limits, err := parseLimits()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, market := range markets {
+		s, err := newStrategy(name)
+		if err != nil {
+			return nil, err
+		}
+		trader := live
+		var exchange *paper.Exchange
+		if trader == nil {
+			if exchange, err = newPaperExchange(client, market); err != nil {
+				return nil, err
+			}
+			trader = exchange
+		}
+		runner, err := strategy.NewRunner(s, trader, market, limits)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := client.SubscribeWithQueue(market, bl3pfeed.ChannelTrades, runner, strategy.TradesQueue); err != nil {
+			return nil, err
+		}
+		if _, err := client.SubscribeWithQueue(market, bl3pfeed.ChannelOrderBook, runner, strategy.OrderBookQueue); err != nil {
+			return nil, err
+		}
+
+		wg.Add(1)
+		go func(market string) {
+			defer wg.Done()
+			if err := runner.Run(ctx); err != nil {
+				log.Errorf("Strategy on %s stopped: %v", market, err)
+			}
+			if exchange != nil {
+				p := exchange.Position()
+				log.Infof("Paper trading %s: position %s BTC, realised %s EUR, unrealised %s EUR, fees %s EUR, equity %s EUR",
+					market, p.Amount, p.Realised, p.Unrealised, p.Fees, exchange.Equity())
+			}
+		}(market)
+	}
+	return wg, nil
+}
+
+// newStrategy creates the strategy by name, configured by the environment
+func newStrategy(name string) (strategy.Strategy, error) {
+	amount, err := money.ParseAmount(env.String(BL3PTRADER_ORDER_SIZE))
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "crossover":
+		parts := strings.Split(env.String(BL3PTRADER_CROSSOVER), ",")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%s should be interval,fast,slow", BL3PTRADER_CROSSOVER)
+		}
+		interval, err := candles.ParseInterval(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		fast, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		slow, err := strconv.Atoi(strings.TrimSpace(parts[2]))
+		if err != nil {
+			return nil, err
+		}
+		return strategy.NewCrossover(interval, fast, slow, amount)
+	case "spread-maker":
+		spread, err := money.ParsePrice(env.String(BL3PTRADER_MAKER_SPREAD))
+		if err != nil {
+			return nil, err
+		}
+		maxPosition, err := money.ParseAmount(env.String(BL3PTRADER_MAX_POSITION))
+		if err != nil {
+			return nil, err
+		}
+		return strategy.NewSpreadMaker(amount, spread, money.Cent, maxPosition)
+	default:
+		return nil, fmt.Errorf("unknown strategy %s, use crossover or spread-maker", name)
+	}
+}
+
+func parseLimits() (strategy.Limits, error) {
+	limits := strategy.Limits{}
+	var err error
+	if limits.MaxPosition, err = money.ParseAmount(env.String(BL3PTRADER_MAX_POSITION)); err != nil {
+		return limits, err
+	}
+	if limits.MaxOrder, err = money.ParseAmount(env.String(BL3PTRADER_ORDER_SIZE)); err != nil {
+		return limits, err
+	}
+	if limits.MaxDailyLoss, err = money.ParsePrice(env.String(BL3PTRADER_MAX_DAILY_LOSS)); err != nil {
+		return limits, err
+	}
+	return limits, nil
+}
+
+// newPaperExchange creates a paper exchange with the configured balance that fills against the market's feeds
+func newPaperExchange(client *bl3pfeed.Client, market string) (*paper.Exchange, error) {
+	eur, err := money.ParsePrice(env.String(BL3PTRADER_PAPER_EUR))
+	if err != nil {
+		return nil, err
+	}
+	fee := env.Float(BL3PTRADER_PAPER_FEE)
+	exchange, err := paper.NewExchange(paper.Config{Market: market, Eur: eur, MakerFee: fee, TakerFee: fee})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.Subscribe(market, bl3pfeed.ChannelTrades, exchange); err != nil {
+		return nil, err
+	}
+	if _, err := client.Subscribe(market, bl3pfeed.ChannelOrderBook, exchange); err != nil {
+		return nil, err
+	}
+	log.Infof("Paper trading %s with %s EUR", market, eur)
+	return exchange, nil
+}
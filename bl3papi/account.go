@@ -0,0 +1,121 @@
+package bl3papi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/resc/rescbits/money"
+)
+
+type (
+	// Value is an amount of a currency in the integer unit of the currency, 1e8 for BTC and 1e5 for EUR
+	Value struct {
+		Int      int64
+		Currency string
+	}
+
+	// Wallet is the balance of one currency
+	Wallet struct {
+		Currency string
+		// Balance is the total balance, including the funds reserved for open orders
+		Balance Value
+		// Available is the balance that can be used for new orders
+		Available Value
+	}
+
+	// Info is the account information
+	Info struct {
+		UserId int64
+		// TradeFee is the fee percentage, e.g. 0.25
+		TradeFee float64
+		// Wallets are ordered by currency
+		Wallets []Wallet
+	}
+
+	// valueMessage is the wire format of a value, value_int is a string
+	valueMessage struct {
+		Int      json.Number `json:"value_int"`
+		Currency string      `json:"currency"`
+	}
+
+	infoMessage struct {
+		UserId   int64       `json:"user_id"`
+		TradeFee json.Number `json:"trade_fee"`
+		Wallets  map[string]struct {
+			Balance   *valueMessage `json:"balance"`
+			Available *valueMessage `json:"available"`
+		} `json:"wallets"`
+	}
+)
+
+// Amount returns the value as a BTC amount
+func (v Value) Amount() money.Amount { return money.Amount(v.Int) }
+
+// Price returns the value as a EUR amount
+func (v Value) Price() money.Price { return money.Price(v.Int) }
+
+func (v Value) String() string {
+	switch v.Currency {
+	case CurrencyBtc:
+		return v.Amount().String() + " BTC"
+	case CurrencyEur:
+		return v.Price().String() + " EUR"
+	default:
+		return fmt.Sprintf("%d %s", v.Int, v.Currency)
+	}
+}
+
+// value converts the wire format, a nil message is a zero value
+func (m *valueMessage) value() (Value, error) {
+	if m == nil || m.Int == "" {
+		return Value{}, nil
+	}
+	i, err := strconv.ParseInt(string(m.Int), 10, 64)
+	if err != nil {
+		return Value{}, fmt.Errorf("invalid value_int %q", m.Int)
+	}
+	return Value{Int: i, Currency: m.Currency}, nil
+}
+
+// Wallet returns the wallet of the currency
+func (i Info) Wallet(currency string) (Wallet, bool) {
+	for _, w := range i.Wallets {
+		if w.Currency == currency {
+			return w, true
+		}
+	}
+	return Wallet{}, false
+}
+
+// Info returns the account information and balances
+func (c *Client) Info(ctx context.Context) (Info, error) {
+	m := infoMessage{}
+	if err := c.call(ctx, "GENMKT/money/info", nil, &m); err != nil {
+		return Info{}, err
+	}
+	info := Info{UserId: m.UserId}
+	if m.TradeFee != "" {
+		fee, err := m.TradeFee.Float64()
+		if err != nil {
+			return Info{}, fmt.Errorf("invalid trade fee %q", m.TradeFee)
+		}
+		info.TradeFee = fee
+	}
+	for currency, w := range m.Wallets {
+		balance, err := w.Balance.value()
+		if err != nil {
+			return Info{}, fmt.Errorf("invalid %s balance: %v", currency, err)
+		}
+		available, err := w.Available.value()
+		if err != nil {
+			return Info{}, fmt.Errorf("invalid %s balance: %v", currency, err)
+		}
+		balance.Currency, available.Currency = currency, currency
+		info.Wallets = append(info.Wallets, Wallet{Currency: currency, Balance: balance, Available: available})
+	}
+	sort.Slice(info.Wallets, func(i, j int) bool { return info.Wallets[i].Currency < info.Wallets[j].Currency })
+	return info, nil
+}
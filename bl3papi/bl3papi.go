@@ -0,0 +1,190 @@
+// Package bl3papi is a client for the authenticated BL3P http api.
+// Prices and amounts are integers like in bl3pfeed, see the money package.
+package bl3papi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultBaseUrl is the url of the live api
+	DefaultBaseUrl = "https://api.bl3p.eu"
+	// Version is the api version
+	Version = "1"
+	// DefaultTimeout is the default deadline for a single request
+	DefaultTimeout = 10 * time.Second
+)
+
+type (
+	// Client signs its requests with the api key and secret
+	Client struct {
+		baseUrl string
+		key     string
+		secret  []byte
+		client  *http.Client
+		timeout time.Duration
+
+		lock  sync.Mutex
+		nonce int64
+	}
+
+	// response is the envelope of all api responses
+	response struct {
+		Result string          `json:"result"`
+		Data   json.RawMessage `json:"data"`
+	}
+
+	errorMessage struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+)
+
+// New creates a client with its own http client, secret is the base64 encoded api secret
+func New(baseUrl, key, secret string) (*Client, error) {
+	return NewWithClient(baseUrl, key, secret, &http.Client{})
+}
+
+// NewWithClient creates a client that sends its requests with client, secret is the base64 encoded api secret
+func NewWithClient(baseUrl, key, secret string, client *http.Client) (*Client, error) {
+	if key == "" {
+		return nil, errors.New("No api key supplied")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api secret: %v", err)
+	}
+	if len(decoded) == 0 {
+		return nil, errors.New("No api secret supplied")
+	}
+	if client == nil {
+		client = &http.Client{}
+	}
+	return &Client{
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		key:     key,
+		secret:  decoded,
+		client:  client,
+		timeout: DefaultTimeout,
+	}, nil
+}
+
+// SetTimeout sets the deadline for a single request, zero means no deadline other than the context's
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// Sign returns the Rest-Sign header value for the call path, e.g. BTCEUR/money/order/add, and the url encoded body
+func Sign(secret []byte, path, body string) string {
+	mac := hmac.New(sha512.New, secret)
+	mac.Write([]byte(path))
+	mac.Write([]byte{0})
+	mac.Write([]byte(body))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// nextNonce returns an increasing nonce based on the time in microseconds
+func (c *Client) nextNonce() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	nonce := time.Now().UnixNano() / 1000
+	if nonce <= c.nonce {
+		nonce = c.nonce + 1
+	}
+	c.nonce = nonce
+	return nonce
+}
+
+// call posts the signed params to the path and decodes the data of the response into result, result can be nil.
+// It returns a *StatusError or *ApiError when BL3P rejects the request.
+func (c *Client) call(ctx context.Context, path string, params url.Values, result interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("nonce", strconv.FormatInt(c.nextNonce(), 10))
+	body := params.Encode()
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s/%s", c.baseUrl, Version, path), strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Rest-Key", c.key)
+	req.Header.Set("Rest-Sign", Sign(c.secret, path, body))
+
+	log.Debugf("Sending request %s", path)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// report the context error, the client wraps it in an url.Error
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	bytes, err := ioutil.ReadAll(io.LimitReader(resp.Body, 10*1024*1024))
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	log.Debugf("Got response %s\n%s", resp.Status, string(bytes))
+
+	r := response{}
+	if err := json.Unmarshal(bytes, &r); err != nil {
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: truncate(strings.TrimSpace(string(bytes)), 200)}
+		}
+		return fmt.Errorf("invalid response from BL3P: %v", err)
+	}
+	if r.Result != "success" {
+		m := errorMessage{}
+		if err := json.Unmarshal(r.Data, &m); err != nil || m.Code == "" {
+			return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: truncate(strings.TrimSpace(string(bytes)), 200)}
+		}
+		return &ApiError{StatusCode: resp.StatusCode, Code: m.Code, Message: m.Message}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: truncate(strings.TrimSpace(string(bytes)), 200)}
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(r.Data, result); err != nil {
+		return fmt.Errorf("invalid response data from BL3P: %v", err)
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
@@ -0,0 +1,249 @@
+package bl3papi
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/money"
+)
+
+const (
+	testKey    = "test-key"
+	testSecret = "c2VjcmV0" // "secret"
+)
+
+type (
+	// stubRequest is a request received by the stub server
+	stubRequest struct {
+		path   string
+		params url.Values
+	}
+)
+
+// newStubServer verifies the signature of every request and responds with the response for its path
+func newStubServer(t *testing.T, responses map[string]string) (*Client, *httptest.Server, <-chan stubRequest) {
+	requests := make(chan stubRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		path := strings.TrimPrefix(r.URL.Path, "/"+Version+"/")
+		secret, _ := base64.StdEncoding.DecodeString(testSecret)
+		if r.Method != http.MethodPost || r.Header.Get("Rest-Key") != testKey || r.Header.Get("Rest-Sign") != Sign(secret, path, string(body)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"result":"error","data":{"code":"SIGN_INVALID","message":"invalid signature"}}`)
+			return
+		}
+		params, _ := url.ParseQuery(string(body))
+		if params.Get("nonce") == "" {
+			t.Errorf("No nonce in %s", body)
+		}
+		requests <- stubRequest{path: path, params: params}
+		if response, ok := responses[path]; ok {
+			fmt.Fprint(w, response)
+		} else {
+			http.NotFound(w, r)
+		}
+	}))
+	client, err := NewWithClient(server.URL+"/", testKey, testSecret, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server, requests
+}
+
+func TestSign(t *testing.T) {
+	// base64(hmac-sha512(base64decode(secret), path + "\x00" + body)) as in the BL3P api examples
+	secret, _ := base64.StdEncoding.DecodeString(testSecret)
+	sign := Sign(secret, "BTCEUR/money/order/add", "amount_int=100000000&type=bid")
+	if sign != "FArMSnqUxVWqXj8NVeJR5PGvKT6/ayDEjrLub+2XG0n+RNqcqrEb2ITipGPQwVEo8nEq2lvdcAGJloJ9J9xCYQ==" {
+		t.Fatalf("Unexpected signature %s", sign)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(DefaultBaseUrl, "", testSecret); err == nil {
+		t.Error("Expected an error without a key")
+	}
+	if _, err := New(DefaultBaseUrl, testKey, "not base64!"); err == nil {
+		t.Error("Expected an error for an invalid secret")
+	}
+}
+
+func TestClient_Info(t *testing.T) {
+	client, server, _ := newStubServer(t, map[string]string{
+		"GENMKT/money/info": `{"result":"success","data":{"user_id":42,"trade_fee":"0.25","wallets":{
+			"EUR":{"balance":{"value_int":"100000000","currency":"EUR"},"available":{"value_int":"50000000","currency":"EUR"}},
+			"BTC":{"balance":{"value_int":"150000000","currency":"BTC"},"available":{"value_int":"150000000","currency":"BTC"}}}}}`,
+	})
+	defer server.Close()
+
+	info, err := client.Info(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UserId != 42 || info.TradeFee != 0.25 || len(info.Wallets) != 2 || info.Wallets[0].Currency != CurrencyBtc {
+		t.Fatalf("Unexpected info %+v", info)
+	}
+	eur, ok := info.Wallet(CurrencyEur)
+	if !ok || eur.Balance.Price() != 1000*money.Euro || eur.Available.Price() != 500*money.Euro {
+		t.Fatalf("Unexpected EUR wallet %+v", eur)
+	}
+	if btc, _ := info.Wallet(CurrencyBtc); btc.Available.Amount() != 3*money.Bitcoin/2 {
+		t.Fatalf("Unexpected BTC wallet %+v", btc)
+	}
+}
+
+func TestClient_Orders(t *testing.T) {
+	order := `{"order_id":123,"label":"","currency":"EUR","item":"BTC","type":"bid","status":"closed","date":1514808000,
+		"amount":{"value_int":"100000000","currency":"BTC"},"price":{"value_int":"800000000","currency":"EUR"},
+		"total_amount":{"value_int":"100000000","currency":"BTC"},"total_spent":{"value_int":"799000000","currency":"EUR"},
+		"total_fee":{"value_int":"250000","currency":"BTC"},"avg_cost":{"value_int":"799000000","currency":"EUR"}}`
+	client, server, requests := newStubServer(t, map[string]string{
+		"BTCEUR/money/order/add":    `{"result":"success","data":{"order_id":123}}`,
+		"BTCEUR/money/order/cancel": `{"result":"success","data":{}}`,
+		"BTCEUR/money/order/result": `{"result":"success","data":` + order + `}`,
+		"BTCEUR/money/orders":       `{"result":"success","data":{"orders":[` + order + `]}}`,
+	})
+	defer server.Close()
+	ctx := context.Background()
+
+	id, err := client.PlaceLimitOrder(ctx, LimitOrder{Market: "BTCEUR", Type: TypeBid, Amount: money.Bitcoin, Price: 8000 * money.Euro})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := <-requests
+	if id != 123 || r.path != "BTCEUR/money/order/add" || r.params.Get("type") != "bid" || r.params.Get("amount_int") != "100000000" ||
+		r.params.Get("price_int") != "800000000" || r.params.Get("fee_currency") != "BTC" {
+		t.Fatalf("Unexpected limit order request %+v", r)
+	}
+
+	if _, err := client.PlaceMarketOrder(ctx, MarketOrder{Market: "BTCEUR", Type: TypeAsk, Funds: 100 * money.Euro, FeeCurrency: CurrencyEur}); err != nil {
+		t.Fatal(err)
+	}
+	r = <-requests
+	if r.params.Get("amount_funds_int") != "10000000" || r.params.Get("amount_int") != "" || r.params.Get("price_int") != "" || r.params.Get("fee_currency") != "EUR" {
+		t.Fatalf("Unexpected market order request %+v", r)
+	}
+
+	if err := client.CancelOrder(ctx, "BTCEUR", 123); err != nil {
+		t.Fatal(err)
+	}
+	if r = <-requests; r.params.Get("order_id") != "123" {
+		t.Fatalf("Unexpected cancel request %+v", r)
+	}
+
+	o, err := client.OrderStatus(ctx, "BTCEUR", 123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Id != 123 || o.Market != "BTCEUR" || !o.IsDone() || o.Amount != money.Bitcoin || o.Price != 8000*money.Euro ||
+		o.TotalSpent != 7990*money.Euro || o.TotalFee.Amount() != 250000 || o.TotalFee.Currency != CurrencyBtc ||
+		!o.Date.Equal(time.Unix(1514808000, 0)) {
+		t.Fatalf("Unexpected order %+v", o)
+	}
+	<-requests
+
+	orders, err := client.OpenOrders(ctx, "BTCEUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 || orders[0] != o {
+		t.Fatalf("Unexpected open orders %+v", orders)
+	}
+}
+
+func TestClient_InvalidOrders(t *testing.T) {
+	client, server, requests := newStubServer(t, nil)
+	defer server.Close()
+	ctx := context.Background()
+
+	for _, o := range []LimitOrder{
+		{Type: TypeBid, Amount: money.Bitcoin, Price: 1},
+		{Market: "BTCEUR", Type: "buy", Amount: money.Bitcoin, Price: 1},
+		{Market: "BTCEUR", Type: TypeBid, Price: 1},
+		{Market: "BTCEUR", Type: TypeBid, Amount: money.Bitcoin},
+		{Market: "BTCEUR", Type: TypeBid, Amount: money.Bitcoin, Price: 1, FeeCurrency: "LTC"},
+	} {
+		if _, err := client.PlaceLimitOrder(ctx, o); err == nil {
+			t.Errorf("Expected an error for %+v", o)
+		}
+	}
+	for _, o := range []MarketOrder{
+		{Market: "BTCEUR", Type: TypeAsk},
+		{Market: "BTCEUR", Type: TypeAsk, Amount: money.Bitcoin, Funds: money.Euro},
+		{Market: "BTCEUR", Type: TypeAsk, Amount: -money.Bitcoin},
+	} {
+		if _, err := client.PlaceMarketOrder(ctx, o); err == nil {
+			t.Errorf("Expected an error for %+v", o)
+		}
+	}
+	if len(requests) != 0 {
+		t.Fatal("Expected invalid orders not to be sent")
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		status    int
+		body      string
+		check     func(err error) bool
+		temporary bool
+	}{
+		{"api error", http.StatusOK, `{"result":"error","data":{"code":"INSUFFICIENT_FUNDS","message":"Insufficient funds"}}`, func(err error) bool {
+			return IsCode(err, CodeInsufficientFunds)
+		}, false},
+		{"api error with status", http.StatusBadRequest, `{"result":"error","data":{"code":"INVALID_AMOUNT","message":"Invalid amount"}}`, func(err error) bool {
+			e, ok := err.(*ApiError)
+			return ok && e.StatusCode == 400 && e.Message == "Invalid amount"
+		}, false},
+		{"server error", http.StatusBadGateway, `bad gateway`, func(err error) bool {
+			e, ok := err.(*StatusError)
+			return ok && e.StatusCode == 502 && e.Body == "bad gateway"
+		}, true},
+		{"rate limit", http.StatusTooManyRequests, ``, func(err error) bool {
+			_, ok := err.(*StatusError)
+			return ok
+		}, true},
+		{"invalid json", http.StatusOK, `{"result":`, func(err error) bool {
+			return strings.Contains(err.Error(), "invalid response")
+		}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, tc.body)
+			}))
+			defer server.Close()
+			client, _ := NewWithClient(server.URL, testKey, testSecret, server.Client())
+
+			err := client.CancelOrder(context.Background(), "BTCEUR", 1)
+			if err == nil || !tc.check(err) {
+				t.Fatalf("Unexpected error %#v", err)
+			}
+			if IsTemporary(err) != tc.temporary {
+				t.Fatalf("Expected temporary %v for %v", tc.temporary, err)
+			}
+		})
+	}
+}
+
+func TestClient_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+	client, _ := NewWithClient(server.URL, testKey, testSecret, server.Client())
+	client.SetTimeout(20 * time.Millisecond)
+
+	if _, err := client.Info(context.Background()); err != context.DeadlineExceeded || !IsTemporary(err) {
+		t.Fatalf("Expected a deadline error, got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package bl3papi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// CodeInsufficientFunds is the ApiError code for orders the account can't pay for
+const CodeInsufficientFunds = "INSUFFICIENT_FUNDS"
+
+type (
+	// StatusError is returned when BL3P responds with an unexpected http status
+	StatusError struct {
+		StatusCode int
+		Status     string
+		// Body is the start of the response body
+		Body string
+	}
+
+	// ApiError is returned when BL3P rejects the request, e.g. for insufficient funds
+	ApiError struct {
+		StatusCode int
+		Code       string
+		Message    string
+	}
+)
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("BL3P responded with %s", e.Status)
+	}
+	return fmt.Sprintf("BL3P responded with %s: %s", e.Status, e.Body)
+}
+
+// Temporary returns true for server errors and rate limits, the request can be retried later
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("BL3P said: %s (%s)", e.Message, e.Code)
+}
+
+// IsTemporary returns true if the error is temporary and the request can be retried later, like server errors, rate limits and timeouts
+func IsTemporary(err error) bool {
+	if t, ok := err.(interface {
+		Temporary() bool
+	}); ok {
+		return t.Temporary()
+	}
+	return err == context.DeadlineExceeded
+}
+
+// IsCode returns true if err is an *ApiError with the code
+func IsCode(err error, code string) bool {
+	e, ok := err.(*ApiError)
+	return ok && e.Code == code
+}
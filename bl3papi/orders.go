@@ -0,0 +1,272 @@
+package bl3papi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/resc/rescbits/money"
+)
+
+// order types
+const (
+	// TypeBid buys BTC
+	TypeBid = "bid"
+	// TypeAsk sells BTC
+	TypeAsk = "ask"
+)
+
+// order statuses
+const (
+	StatusPending   = "pending"
+	StatusOpen      = "open"
+	StatusPlaced    = "placed"
+	StatusClosed    = "closed"
+	StatusCancelled = "cancelled"
+)
+
+// currencies
+const (
+	CurrencyBtc = "BTC"
+	CurrencyEur = "EUR"
+)
+
+type (
+	// Trader places and manages orders, it's implemented by the Client and by simulations like paper trading
+	Trader interface {
+		PlaceLimitOrder(ctx context.Context, o LimitOrder) (int64, error)
+		PlaceMarketOrder(ctx context.Context, o MarketOrder) (int64, error)
+		CancelOrder(ctx context.Context, market string, id int64) error
+		OpenOrders(ctx context.Context, market string) ([]Order, error)
+		OrderStatus(ctx context.Context, market string, id int64) (Order, error)
+		Info(ctx context.Context) (Info, error)
+	}
+
+	// LimitOrder buys or sells the amount at the price or better
+	LimitOrder struct {
+		Market string
+		Type   string
+		Amount money.Amount
+		Price  money.Price
+		// FeeCurrency is the currency the fee is paid in, BTC or EUR
+		FeeCurrency string
+	}
+
+	// MarketOrder buys or sells at the best available prices, either the Amount of BTC or for the Funds in EUR
+	MarketOrder struct {
+		Market string
+		Type   string
+		Amount money.Amount
+		Funds  money.Price
+		// FeeCurrency is the currency the fee is paid in, BTC or EUR
+		FeeCurrency string
+	}
+
+	// Order is the state of an order
+	Order struct {
+		Id     int64
+		Label  string
+		Market string
+		Type   string
+		Status string
+		Date   time.Time
+
+		// Amount is the ordered BTC amount, zero for market orders with funds
+		Amount money.Amount
+		// Price is the limit price, zero for market orders
+		Price money.Price
+		// Funds is the EUR amount of a market order
+		Funds money.Price
+
+		// TotalAmount is the filled BTC amount
+		TotalAmount money.Amount
+		// TotalSpent is the EUR value of the fills
+		TotalSpent money.Price
+		// TotalFee is the paid fee
+		TotalFee Value
+		// AverageCost is the average price of the fills
+		AverageCost money.Price
+	}
+
+	// orderMessage is the wire format of an order
+	orderMessage struct {
+		Id          int64         `json:"order_id"`
+		Label       string        `json:"label"`
+		Currency    string        `json:"currency"`
+		Item        string        `json:"item"`
+		Type        string        `json:"type"`
+		Status      string        `json:"status"`
+		Date        int64         `json:"date"`
+		Amount      *valueMessage `json:"amount"`
+		Price       *valueMessage `json:"price"`
+		Funds       *valueMessage `json:"amount_funds"`
+		TotalAmount *valueMessage `json:"total_amount"`
+		TotalSpent  *valueMessage `json:"total_spent"`
+		TotalFee    *valueMessage `json:"total_fee"`
+		AverageCost *valueMessage `json:"avg_cost"`
+	}
+)
+
+var _ Trader = (*Client)(nil)
+
+// Validate returns an error if the order can't be placed
+func (o LimitOrder) Validate() error {
+	if err := validateOrder(o.Market, o.Type, o.FeeCurrency); err != nil {
+		return err
+	}
+	if o.Amount <= 0 {
+		return fmt.Errorf("invalid amount: %s", o.Amount)
+	}
+	if o.Price <= 0 {
+		return fmt.Errorf("invalid price: %s", o.Price)
+	}
+	return nil
+}
+
+// Validate returns an error if the order can't be placed
+func (o MarketOrder) Validate() error {
+	if err := validateOrder(o.Market, o.Type, o.FeeCurrency); err != nil {
+		return err
+	}
+	if (o.Amount > 0) == (o.Funds > 0) || o.Amount < 0 || o.Funds < 0 {
+		return errors.New("a market order needs either an amount or funds")
+	}
+	return nil
+}
+
+func validateOrder(market, typ, feeCurrency string) error {
+	if market == "" {
+		return errors.New("no market")
+	}
+	if typ != TypeBid && typ != TypeAsk {
+		return fmt.Errorf("invalid order type: %s", typ)
+	}
+	if feeCurrency != "" && feeCurrency != CurrencyBtc && feeCurrency != CurrencyEur {
+		return fmt.Errorf("invalid fee currency: %s", feeCurrency)
+	}
+	return nil
+}
+
+// IsDone returns true if the order is closed or cancelled
+func (o Order) IsDone() bool {
+	return o.Status == StatusClosed || o.Status == StatusCancelled
+}
+
+// PlaceLimitOrder places the order and returns its id
+func (c *Client) PlaceLimitOrder(ctx context.Context, o LimitOrder) (int64, error) {
+	if err := o.Validate(); err != nil {
+		return 0, err
+	}
+	params := orderParams(o.Type, o.FeeCurrency)
+	params.Set("amount_int", strconv.FormatInt(int64(o.Amount), 10))
+	params.Set("price_int", strconv.FormatInt(int64(o.Price), 10))
+	return c.addOrder(ctx, o.Market, params)
+}
+
+// PlaceMarketOrder places the order and returns its id
+func (c *Client) PlaceMarketOrder(ctx context.Context, o MarketOrder) (int64, error) {
+	if err := o.Validate(); err != nil {
+		return 0, err
+	}
+	params := orderParams(o.Type, o.FeeCurrency)
+	if o.Amount > 0 {
+		params.Set("amount_int", strconv.FormatInt(int64(o.Amount), 10))
+	} else {
+		params.Set("amount_funds_int", strconv.FormatInt(int64(o.Funds), 10))
+	}
+	return c.addOrder(ctx, o.Market, params)
+}
+
+func orderParams(typ, feeCurrency string) url.Values {
+	if feeCurrency == "" {
+		feeCurrency = CurrencyBtc
+	}
+	return url.Values{
+		"type":         {typ},
+		"fee_currency": {feeCurrency},
+	}
+}
+
+func (c *Client) addOrder(ctx context.Context, market string, params url.Values) (int64, error) {
+	result := struct {
+		Id int64 `json:"order_id"`
+	}{}
+	if err := c.call(ctx, market+"/money/order/add", params, &result); err != nil {
+		return 0, err
+	}
+	return result.Id, nil
+}
+
+// CancelOrder cancels the open order
+func (c *Client) CancelOrder(ctx context.Context, market string, id int64) error {
+	params := url.Values{"order_id": {strconv.FormatInt(id, 10)}}
+	return c.call(ctx, market+"/money/order/cancel", params, nil)
+}
+
+// OpenOrders returns the open orders of the market
+func (c *Client) OpenOrders(ctx context.Context, market string) ([]Order, error) {
+	result := struct {
+		Orders []orderMessage `json:"orders"`
+	}{}
+	if err := c.call(ctx, market+"/money/orders", nil, &result); err != nil {
+		return nil, err
+	}
+	orders := make([]Order, 0, len(result.Orders))
+	for _, m := range result.Orders {
+		o, err := m.order(market)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, nil
+}
+
+// OrderStatus returns the state of the order
+func (c *Client) OrderStatus(ctx context.Context, market string, id int64) (Order, error) {
+	params := url.Values{"order_id": {strconv.FormatInt(id, 10)}}
+	m := orderMessage{}
+	if err := c.call(ctx, market+"/money/order/result", params, &m); err != nil {
+		return Order{}, err
+	}
+	return m.order(market)
+}
+
+// order converts the wire format, market is used when the message has no currencies
+func (m orderMessage) order(market string) (Order, error) {
+	if m.Item != "" && m.Currency != "" {
+		market = m.Item + m.Currency
+	}
+	o := Order{
+		Id:     m.Id,
+		Label:  m.Label,
+		Market: market,
+		Type:   m.Type,
+		Status: m.Status,
+	}
+	if m.Date > 0 {
+		o.Date = time.Unix(m.Date, 0).UTC()
+	}
+	var err error
+	parse := func(v *valueMessage) Value {
+		value, e := v.value()
+		if e != nil && err == nil {
+			err = fmt.Errorf("invalid order %d: %v", m.Id, e)
+		}
+		return value
+	}
+	o.Amount = parse(m.Amount).Amount()
+	o.Price = parse(m.Price).Price()
+	o.Funds = parse(m.Funds).Price()
+	o.TotalAmount = parse(m.TotalAmount).Amount()
+	o.TotalSpent = parse(m.TotalSpent).Price()
+	o.TotalFee = parse(m.TotalFee)
+	o.AverageCost = parse(m.AverageCost).Price()
+	if err != nil {
+		return Order{}, err
+	}
+	return o, nil
+}
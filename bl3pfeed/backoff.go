@@ -0,0 +1,125 @@
+package bl3pfeed
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Backoff configures how a feed redials after the connection is lost.
+	Backoff struct {
+		// Min is the delay before the first reconnect attempt
+		Min time.Duration
+		// Max caps the delay between reconnect attempts
+		Max time.Duration
+		// Factor is the multiplier applied to the delay after each failed attempt
+		Factor float64
+		// Jitter is the fraction (0..1) of the delay that is randomized
+		Jitter float64
+		// MaxAttempts is the number of reconnect attempts before giving up, 0 means retry forever
+		MaxAttempts int
+	}
+)
+
+var (
+	// DefaultBackoff is used by new feeds, it retries forever
+	DefaultBackoff = Backoff{
+		Min:         500 * time.Millisecond,
+		Max:         60 * time.Second,
+		Factor:      2,
+		Jitter:      0.5,
+		MaxAttempts: 0,
+	}
+
+	// ErrRetriesExhausted is passed to FeedClosed when the feed gave up reconnecting
+	ErrRetriesExhausted = errors.New("reconnect attempts exhausted")
+
+	errFeedClosed = errors.New("feed closed")
+)
+
+// Delay returns the delay before the given reconnect attempt, attempts start at 1.
+func (b Backoff) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	factor := b.Factor
+	if factor < 1 {
+		factor = 1
+	}
+	delay := float64(b.Min) * math.Pow(factor, float64(attempt-1))
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		jitter := math.Min(b.Jitter, 1)
+		delay = delay - jitter*delay*rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// Exhausted returns true if no more reconnect attempts should be made after the given attempt.
+func (b Backoff) Exhausted(attempt int) bool {
+	return b.MaxAttempts > 0 && attempt >= b.MaxAttempts
+}
+
+// redial dials url until it succeeds, the backoff is exhausted or done is closed.
+// It returns the connection and the number of attempts it took.
+func redial(url string, h http.Header, b Backoff, done <-chan struct{}, l *log.Entry) (*websocket.Conn, int, error) {
+	for attempt := 1; ; attempt++ {
+		delay := b.Delay(attempt)
+		l.Infof("Reconnecting to %s in %v (attempt %d)", url, delay, attempt)
+		select {
+		case <-done:
+			return nil, attempt, errFeedClosed
+		case <-time.After(delay):
+		}
+
+		conn, _, err := websocket.DefaultDialer.Dial(url, h)
+		if err == nil {
+			l.Infof("Reconnected to %s after %d attempt(s)", url, attempt)
+			return conn, attempt, nil
+		}
+
+		l.Warnf("Reconnect attempt %d to %s failed: %v", attempt, url, err)
+		if b.Exhausted(attempt) {
+			return nil, attempt, ErrRetriesExhausted
+		}
+	}
+}
+
+// OpenWithBackoff opens the feed and retries with the backoff while the dial fails, so a feed can be started
+// while the api is down. It returns nil once the feed is open, ErrRetriesExhausted when the backoff gives up
+// and the last dial error when done is closed first.
+func OpenWithBackoff(f Feed, h http.Header, b Backoff, done <-chan struct{}) error {
+	l := log.WithFields(log.Fields{
+		"market":  f.Market(),
+		"channel": f.Channel(),
+	})
+	for attempt := 1; ; attempt++ {
+		err := f.Open(h)
+		if err == nil {
+			if attempt > 1 {
+				l.Infof("Connected after %d attempt(s)", attempt)
+			}
+			return nil
+		}
+		if b.Exhausted(attempt) {
+			l.Errorf("Dial attempt %d failed, giving up: %v", attempt, err)
+			return ErrRetriesExhausted
+		}
+
+		delay := b.Delay(attempt)
+		l.Warnf("Dial attempt %d failed, retrying in %v: %v", attempt, delay, err)
+		select {
+		case <-done:
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
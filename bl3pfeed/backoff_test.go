@@ -0,0 +1,57 @@
+package bl3pfeed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{
+		Min:    100 * time.Millisecond,
+		Max:    time.Second,
+		Factor: 2,
+	}
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, e := range expected {
+		if d := b.Delay(i + 1); d != e {
+			t.Fatalf("attempt %d: expected %v, got %v", i+1, e, d)
+		}
+	}
+}
+
+func TestBackoff_Jitter(t *testing.T) {
+	b := Backoff{
+		Min:    time.Second,
+		Max:    time.Second,
+		Factor: 2,
+		Jitter: 0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		if d := b.Delay(1); d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("expected delay between 500ms and 1s, got %v", d)
+		}
+	}
+}
+
+func TestBackoff_Exhausted(t *testing.T) {
+	if DefaultBackoff.Exhausted(1000) {
+		t.Fatal("the default backoff should retry forever")
+	}
+
+	b := Backoff{MaxAttempts: 3}
+	if b.Exhausted(2) {
+		t.Fatal("attempt 2 of 3 should not exhaust the backoff")
+	}
+	if !b.Exhausted(3) {
+		t.Fatal("attempt 3 of 3 should exhaust the backoff")
+	}
+}
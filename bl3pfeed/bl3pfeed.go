@@ -4,6 +4,11 @@ import (
 	"net/http"
 )
 
+const (
+	ChannelTrades    = "trades"
+	ChannelOrderBook = "orderbook"
+)
+
 type (
 	Feed interface {
 		BaseUrl() string
@@ -15,21 +20,33 @@ type (
 
 		// SetDebug to true to log the raw websocket messages instead of processing the messages
 		SetDebug(bool)
+
+		// SetBackoff configures how the feed reconnects when the connection is lost
+		SetBackoff(Backoff)
+
+		// SetRecorder records the raw messages, they're still delivered to the listener. nil stops recording
+		SetRecorder(*Recorder)
 	}
 
 	FeedListener interface {
+		// FeedDisconnected is called when the connection is lost, the feed will try to reconnect
+		FeedDisconnected(channel string, err error)
+
+		// FeedReconnected is called when the connection is restored after the given number of attempts
+		FeedReconnected(channel string, attempts int)
+
+		// FeedClosed is called once when the feed is closed for good.
+		// err is nil when the feed was closed by Close() or ErrRetriesExhausted when reconnecting failed
 		FeedClosed(channel string, err error)
 	}
 
-	TradesFeedListener interface{
+	TradesFeedListener interface {
 		FeedListener
 		OnTrade(t *Trade)
 	}
 
-	OrderBookFeedListener interface{
+	OrderBookFeedListener interface {
 		FeedListener
 		OnOrderBookChanged(o *OrderBook)
 	}
 )
-
-
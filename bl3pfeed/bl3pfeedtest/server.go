@@ -0,0 +1,245 @@
+// Package bl3pfeedtest provides an in-process fake of the BL3P websocket api for testing feeds.
+package bl3pfeedtest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultWriteTimeout limits how long a send waits for a slow consumer
+const DefaultWriteTimeout = 5 * time.Second
+
+type (
+	// Server is a fake BL3P api that serves the /<version>/<market>/trades and /<version>/<market>/orderbook paths.
+	// Every accepted connection is queued until the test picks it up with Accept.
+	Server struct {
+		// URL is the websocket base url of the server, e.g. ws://127.0.0.1:1234
+		URL string
+
+		// WriteTimeout limits how long a send waits for the client to read
+		WriteTimeout time.Duration
+
+		server   *httptest.Server
+		upgrader websocket.Upgrader
+		accepted chan *Conn
+
+		lock   sync.Mutex
+		conns  map[*Conn]struct{}
+		dials  int
+		reject int
+		closed bool
+	}
+
+	// Conn is a client connected to the fake server
+	Conn struct {
+		Version string
+		Market  string
+		Channel string
+
+		server *Server
+		lock   sync.Mutex
+		conn   *websocket.Conn
+		done   chan struct{}
+		close  sync.Once
+	}
+)
+
+// NewServer starts a fake server, stop it with Close
+func NewServer() *Server {
+	s := &Server{
+		WriteTimeout: DefaultWriteTimeout,
+		accepted:     make(chan *Conn, 100),
+		conns:        make(map[*Conn]struct{}),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = "ws" + strings.TrimPrefix(s.server.URL, "http")
+	return s
+}
+
+// Close drops all connections and stops the server, it can be called more than once
+func (s *Server) Close() {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return
+	}
+	s.closed = true
+	conns := make([]*Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.lock.Unlock()
+
+	for _, c := range conns {
+		c.Drop()
+	}
+	s.server.Close()
+}
+
+// Reject makes the server refuse the next n connection attempts with 503 Service Unavailable, -1 refuses all
+func (s *Server) Reject(n int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reject = n
+}
+
+// Dials returns the number of connection attempts, including rejected ones
+func (s *Server) Dials() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.dials
+}
+
+// Connections returns the number of open connections
+func (s *Server) Connections() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.conns)
+}
+
+// Accept returns the next connection, or an error if no client connects within the timeout
+func (s *Server) Accept(timeout time.Duration) (*Conn, error) {
+	select {
+	case c := <-s.accepted:
+		return c, nil
+	case <-time.After(timeout):
+		return nil, errors.New("Timeout waiting for a connection")
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.rejected() {
+		http.Error(w, "rejected", http.StatusServiceUnavailable)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 || (parts[2] != "trades" && parts[2] != "orderbook") {
+		http.NotFound(w, r)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &Conn{
+		Version: parts[0],
+		Market:  parts[1],
+		Channel: parts[2],
+		server:  s,
+		conn:    conn,
+		done:    make(chan struct{}),
+	}
+	if !s.add(c) {
+		conn.Close()
+		return
+	}
+	s.accepted <- c
+	go c.read()
+}
+
+// rejected counts the dial and returns true if it should be refused
+func (s *Server) rejected() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.dials++
+	if s.reject == 0 {
+		return false
+	}
+	if s.reject > 0 {
+		s.reject--
+	}
+	return true
+}
+
+func (s *Server) add(c *Conn) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[c] = struct{}{}
+	return true
+}
+
+func (s *Server) remove(c *Conn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.conns, c)
+}
+
+func (s *Server) writeTimeout() time.Duration {
+	if s.WriteTimeout <= 0 {
+		return DefaultWriteTimeout
+	}
+	return s.WriteTimeout
+}
+
+// Send writes v as a json text message
+func (c *Conn) Send(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.SendRaw(data)
+}
+
+// SendRaw writes data as is, use it for malformed messages
+func (c *Conn) SendRaw(data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.server.writeTimeout()))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Disconnect closes the connection with a websocket close message
+func (c *Conn) Disconnect() error {
+	c.lock.Lock()
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "bye")
+	err := c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(c.server.writeTimeout()))
+	c.lock.Unlock()
+	c.Drop()
+	return err
+}
+
+// Drop closes the connection abruptly, without a close message
+func (c *Conn) Drop() {
+	c.close.Do(func() {
+		c.conn.Close()
+		c.server.remove(c)
+	})
+}
+
+// Done is closed when the client disconnects or the connection is dropped
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// WaitDone waits until the client disconnects, it returns false on timeout
+func (c *Conn) WaitDone(timeout time.Duration) bool {
+	select {
+	case <-c.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// read discards client messages until the connection fails, the feeds never send anything
+func (c *Conn) read() {
+	defer close(c.done)
+	defer c.Drop()
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package bl3pfeed
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/resc/rescbits/money"
+)
+
+const (
+	SideAsk = "ask"
+	SideBid = "bid"
+)
+
+const (
+	LevelAdded ChangeKind = iota
+	LevelRemoved
+	LevelChanged
+)
+
+type (
+	// Level is the total amount available at a price, in the same units as Order
+	Level struct {
+		Price  money.Price
+		Amount money.Amount
+	}
+
+	// ChangeKind tells how a price level changed between two snapshots
+	ChangeKind int
+
+	// LevelChange describes the change of a single price level between two snapshots
+	LevelChange struct {
+		Kind  ChangeKind
+		Side  string
+		Price money.Price
+		// OldAmount is the amount before the change, zero for added levels
+		OldAmount money.Amount
+		// NewAmount is the amount after the change, zero for removed levels
+		NewAmount money.Amount
+	}
+
+	// BookDiff contains all level changes between two snapshots
+	BookDiff struct {
+		Asks []LevelChange
+		Bids []LevelChange
+	}
+
+	// Book maintains a local order book from the OrderBook snapshots of the feed.
+	// Orders with the same price are aggregated into a single level.
+	Book struct {
+		lock    sync.RWMutex
+		market  string
+		asks    []Level // ascending price, best ask first
+		bids    []Level // descending price, best bid first
+		updated time.Time
+	}
+
+	// BookFeedListener receives the maintained order book and the changes of every snapshot
+	BookFeedListener interface {
+		FeedListener
+		OnBookChanged(b *Book, diff *BookDiff)
+	}
+
+	bookListener struct {
+		book     *Book
+		listener BookFeedListener
+	}
+)
+
+var _ OrderBookFeedListener = (*bookListener)(nil)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case LevelAdded:
+		return "added"
+	case LevelRemoved:
+		return "removed"
+	case LevelChanged:
+		return "changed"
+	default:
+		return "unknown"
+	}
+}
+
+// NewBook creates an empty order book
+func NewBook() *Book {
+	return &Book{}
+}
+
+// NewBookListener returns an OrderBookFeedListener that maintains a Book and reports the changes to l
+func NewBookListener(l BookFeedListener) (OrderBookFeedListener, error) {
+	if l == nil {
+		return nil, errors.New("l BookFeedListener is nil")
+	}
+	return &bookListener{
+		book:     NewBook(),
+		listener: l,
+	}, nil
+}
+
+func (b *bookListener) FeedDisconnected(channel string, err error) {
+	b.listener.FeedDisconnected(channel, err)
+}
+
+func (b *bookListener) FeedReconnected(channel string, attempts int) {
+	b.listener.FeedReconnected(channel, attempts)
+}
+
+func (b *bookListener) FeedClosed(channel string, err error) {
+	b.listener.FeedClosed(channel, err)
+}
+
+func (b *bookListener) OnOrderBookChanged(o *OrderBook) {
+	diff := b.book.Update(o)
+	b.listener.OnBookChanged(b.book, diff)
+}
+
+// Update replaces the book contents with the snapshot and returns the changes
+func (b *Book) Update(o *OrderBook) *BookDiff {
+	asks := aggregate(o.Asks, func(a, b money.Price) bool { return a < b })
+	bids := aggregate(o.Bids, func(a, b money.Price) bool { return a > b })
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	diff := &BookDiff{
+		Asks: diffLevels(SideAsk, b.asks, asks),
+		Bids: diffLevels(SideBid, b.bids, bids),
+	}
+	b.market = o.Market
+	b.asks = asks
+	b.bids = bids
+	b.updated = time.Now()
+	return diff
+}
+
+// Market returns the market of the last snapshot
+func (b *Book) Market() string {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.market
+}
+
+// Updated returns the time of the last update
+func (b *Book) Updated() time.Time {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.updated
+}
+
+// BestAsk returns the lowest ask, ok is false if there are no asks
+func (b *Book) BestAsk() (level Level, ok bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if len(b.asks) == 0 {
+		return Level{}, false
+	}
+	return b.asks[0], true
+}
+
+// BestBid returns the highest bid, ok is false if there are no bids
+func (b *Book) BestBid() (level Level, ok bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if len(b.bids) == 0 {
+		return Level{}, false
+	}
+	return b.bids[0], true
+}
+
+// Best returns the lowest ask and the highest bid of the same book, ok is false if a side is empty
+func (b *Book) Best() (ask Level, bid Level, ok bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if len(b.asks) == 0 || len(b.bids) == 0 {
+		return Level{}, Level{}, false
+	}
+	return b.asks[0], b.bids[0], true
+}
+
+// Spread returns the best ask minus the best bid price
+func (b *Book) Spread() (spread money.Price, ok bool) {
+	ask, bid, ok := b.Best()
+	if !ok {
+		return 0, false
+	}
+	return ask.Price - bid.Price, true
+}
+
+// MidPrice returns the price halfway between the best bid and the best ask, rounded down
+func (b *Book) MidPrice() (mid money.Price, ok bool) {
+	ask, bid, ok := b.Best()
+	if !ok {
+		return 0, false
+	}
+	return ask.Price.Add(bid.Price).MulDiv(1, 2, money.RoundDown), true
+}
+
+// Depth returns at most n levels on each side, best prices first
+func (b *Book) Depth(n int) (asks []Level, bids []Level) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return copyLevels(b.asks, n), copyLevels(b.bids, n)
+}
+
+// Asks returns all ask levels, lowest price first
+func (b *Book) Asks() []Level {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return copyLevels(b.asks, len(b.asks))
+}
+
+// Bids returns all bid levels, highest price first
+func (b *Book) Bids() []Level {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return copyLevels(b.bids, len(b.bids))
+}
+
+// CumulativeVolume returns the total amount on the given side at prices up to and including price.
+// For asks these are the levels at or below price, for bids the levels at or above price.
+func (b *Book) CumulativeVolume(side string, price money.Price) money.Amount {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	total := money.Amount(0)
+	switch side {
+	case SideAsk:
+		for _, l := range b.asks {
+			if l.Price > price {
+				break
+			}
+			total += l.Amount
+		}
+	case SideBid:
+		for _, l := range b.bids {
+			if l.Price < price {
+				break
+			}
+			total += l.Amount
+		}
+	}
+	return total
+}
+
+// IsEmpty returns true if the diff contains no changes
+func (d *BookDiff) IsEmpty() bool {
+	return len(d.Asks) == 0 && len(d.Bids) == 0
+}
+
+func aggregate(orders []*Order, less func(a, b money.Price) bool) []Level {
+	amounts := make(map[money.Price]money.Amount)
+	for _, o := range orders {
+		if o == nil {
+			continue
+		}
+		amounts[o.Price] += o.Amount
+	}
+
+	levels := make([]Level, 0, len(amounts))
+	for price, amount := range amounts {
+		if amount > 0 {
+			levels = append(levels, Level{Price: price, Amount: amount})
+		}
+	}
+	sort.Slice(levels, func(i, j int) bool { return less(levels[i].Price, levels[j].Price) })
+	return levels
+}
+
+func diffLevels(side string, old, new []Level) []LevelChange {
+	oldAmounts := make(map[money.Price]money.Amount, len(old))
+	for _, l := range old {
+		oldAmounts[l.Price] = l.Amount
+	}
+
+	changes := make([]LevelChange, 0)
+	for _, l := range new {
+		if amount, ok := oldAmounts[l.Price]; !ok {
+			changes = append(changes, LevelChange{Kind: LevelAdded, Side: side, Price: l.Price, NewAmount: l.Amount})
+		} else {
+			if amount != l.Amount {
+				changes = append(changes, LevelChange{Kind: LevelChanged, Side: side, Price: l.Price, OldAmount: amount, NewAmount: l.Amount})
+			}
+			delete(oldAmounts, l.Price)
+		}
+	}
+	for _, l := range old {
+		if _, ok := oldAmounts[l.Price]; ok {
+			changes = append(changes, LevelChange{Kind: LevelRemoved, Side: side, Price: l.Price, OldAmount: l.Amount})
+		}
+	}
+	return changes
+}
+
+func copyLevels(levels []Level, n int) []Level {
+	if n > len(levels) {
+		n = len(levels)
+	}
+	if n < 0 {
+		n = 0
+	}
+	result := make([]Level, n)
+	copy(result, levels[:n])
+	return result
+}
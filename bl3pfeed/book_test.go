@@ -0,0 +1,133 @@
+package bl3pfeed
+
+import (
+	"testing"
+)
+
+func testOrderBook() *OrderBook {
+	return &OrderBook{
+		Market: "BTCEUR",
+		Asks: []*Order{
+			{Price: 1010000, Amount: 1e8},
+			{Price: 1000000, Amount: 5e7},
+			{Price: 1000000, Amount: 5e7},
+			{Price: 1020000, Amount: 2e8},
+		},
+		Bids: []*Order{
+			{Price: 980000, Amount: 1e8},
+			{Price: 990000, Amount: 3e7},
+			{Price: 970000, Amount: 4e8},
+		},
+	}
+}
+
+func TestBook_Update(t *testing.T) {
+	b := NewBook()
+	diff := b.Update(testOrderBook())
+
+	if len(diff.Asks) != 3 || len(diff.Bids) != 3 {
+		t.Fatalf("expected 3 added asks and bids, got %d asks and %d bids", len(diff.Asks), len(diff.Bids))
+	}
+	for _, c := range append(diff.Asks, diff.Bids...) {
+		if c.Kind != LevelAdded {
+			t.Fatalf("expected only added levels, got %+v", c)
+		}
+	}
+
+	ask, ok := b.BestAsk()
+	if !ok || ask.Price != 1000000 || ask.Amount != 1e8 {
+		t.Fatalf("expected aggregated best ask 10.00000 EUR for 1 BTC, got %+v", ask)
+	}
+	bid, ok := b.BestBid()
+	if !ok || bid.Price != 990000 {
+		t.Fatalf("expected best bid 9.90000 EUR, got %+v", bid)
+	}
+	if spread, _ := b.Spread(); spread != 10000 {
+		t.Fatalf("expected spread 10000, got %d", spread)
+	}
+	if mid, _ := b.MidPrice(); mid != 995000 {
+		t.Fatalf("expected mid price 995000, got %d", mid)
+	}
+
+	asks, bids := b.Depth(2)
+	if len(asks) != 2 || len(bids) != 2 || asks[1].Price != 1010000 || bids[1].Price != 980000 {
+		t.Fatalf("unexpected depth asks %+v bids %+v", asks, bids)
+	}
+
+	if v := b.CumulativeVolume(SideAsk, 1010000); v != 2e8 {
+		t.Fatalf("expected 2 BTC of asks up to 10.1 EUR, got %d", v)
+	}
+	if v := b.CumulativeVolume(SideBid, 980000); v != 13e7 {
+		t.Fatalf("expected 1.3 BTC of bids down to 9.8 EUR, got %d", v)
+	}
+}
+
+func TestBook_Diff(t *testing.T) {
+	b := NewBook()
+	b.Update(testOrderBook())
+
+	next := testOrderBook()
+	// removes the ask at 10.1, halves the ask at 10.0 and adds a bid at 9.6
+	next.Asks = []*Order{{Price: 1000000, Amount: 5e7}, {Price: 1020000, Amount: 2e8}}
+	next.Bids = append(next.Bids, &Order{Price: 960000, Amount: 1})
+	diff := b.Update(next)
+
+	if len(diff.Bids) != 1 || diff.Bids[0].Kind != LevelAdded || diff.Bids[0].Price != 960000 {
+		t.Fatalf("expected one added bid, got %+v", diff.Bids)
+	}
+
+	kinds := make(map[ChangeKind]LevelChange)
+	for _, c := range diff.Asks {
+		kinds[c.Kind] = c
+	}
+	if c, ok := kinds[LevelRemoved]; !ok || c.Price != 1010000 || c.OldAmount != 1e8 {
+		t.Fatalf("expected removed ask at 10.1 EUR, got %+v", diff.Asks)
+	}
+	if c, ok := kinds[LevelChanged]; !ok || c.Price != 1000000 || c.OldAmount != 1e8 || c.NewAmount != 5e7 {
+		t.Fatalf("expected changed ask at 10.0 EUR, got %+v", diff.Asks)
+	}
+
+	if diff := b.Update(next); !diff.IsEmpty() {
+		t.Fatalf("expected no changes for the same snapshot, got %+v", diff)
+	}
+}
+
+func TestBook_Empty(t *testing.T) {
+	b := NewBook()
+	if _, ok := b.Spread(); ok {
+		t.Fatal("an empty book should not have a spread")
+	}
+	if _, ok := b.MidPrice(); ok {
+		t.Fatal("an empty book should not have a mid price")
+	}
+}
+
+func TestBook_SpreadDuringUpdates(t *testing.T) {
+	low := &OrderBook{Market: "BTCEUR", Asks: []*Order{{Price: 1000000, Amount: 1e8}}, Bids: []*Order{{Price: 990000, Amount: 1e8}}}
+	high := &OrderBook{Market: "BTCEUR", Asks: []*Order{{Price: 2000000, Amount: 1e8}}, Bids: []*Order{{Price: 1990000, Amount: 1e8}}}
+	b := NewBook()
+	b.Update(low)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			if i%2 == 0 {
+				b.Update(high)
+			} else {
+				b.Update(low)
+			}
+		}
+	}()
+	// the best ask and bid of different books would give a spread of -990000 or 1010000
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if spread, _ := b.Spread(); spread != 10000 {
+			t.Fatalf("expected the spread of one book, got %d", spread)
+		}
+	}
+}
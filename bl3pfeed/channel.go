@@ -0,0 +1,306 @@
+package bl3pfeed
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// ChannelFeed follows one channel of one market, the messages are decoded by the decoder registered for the channel.
+	// Every listener gets the messages through its own queue, see AddListener.
+	// Trades and OrderBooks are channel feeds for the trades and orderbook channels.
+	ChannelFeed struct {
+		close sync.Once
+
+		baseUrl string
+		version string
+		market  string
+		channel string
+		header  http.Header
+		backoff Backoff
+		decoder Decoder
+
+		lock    sync.Mutex
+		conn    *websocket.Conn
+		queues  []*Queue
+		running bool
+		stopped bool
+		done    chan struct{}
+
+		debug    bool
+		recorder *Recorder
+		log      *log.Entry
+	}
+)
+
+var _ Feed = (*ChannelFeed)(nil)
+
+// NewChannelFeed creates a feed for the market channel, l must be accepted by the decoder of the channel
+func NewChannelFeed(baseUrl, version, market, channel string, l FeedListener) (*ChannelFeed, error) {
+	if l == nil {
+		return nil, errors.New("l FeedListener is nil")
+	}
+	decoder, err := decoderFor(channel, l)
+	if err != nil {
+		return nil, err
+	}
+	f := &ChannelFeed{
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		version: version,
+		market:  market,
+		channel: channel,
+		backoff: DefaultBackoff,
+		decoder: decoder,
+		done:    make(chan struct{}),
+		log: log.WithFields(log.Fields{
+			"market":  market,
+			"channel": channel,
+		}),
+	}
+	f.queues = []*Queue{newQueue(l, decoder, DefaultQueue, f.log)}
+	return f, nil
+}
+
+func (f *ChannelFeed) BaseUrl() string      { return f.baseUrl }
+func (f *ChannelFeed) Version() string      { return f.version }
+func (f *ChannelFeed) Market() string       { return f.market }
+func (f *ChannelFeed) Channel() string      { return f.channel }
+func (f *ChannelFeed) SetDebug(b bool)      { f.debug = b }
+func (f *ChannelFeed) SetBackoff(b Backoff) { f.backoff = b }
+
+// SetRecorder records the received messages, set it before calling Open
+func (f *ChannelFeed) SetRecorder(r *Recorder) { f.recorder = r }
+
+// SetQueueOptions configures the queue of the listener passed to the constructor, set it before calling Open
+func (f *ChannelFeed) SetQueueOptions(o QueueOptions) {
+	f.lock.Lock()
+	q := f.queues[0]
+	f.lock.Unlock()
+	if o.Size < 1 {
+		o.Size = 1
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.options = o
+}
+
+// AddListener adds a listener with its own queue, l must be accepted by the decoder of the channel.
+// Listeners added to an open feed receive the messages from then on.
+func (f *ChannelFeed) AddListener(l FeedListener, o QueueOptions) (*Queue, error) {
+	if l == nil {
+		return nil, errors.New("l FeedListener is nil")
+	}
+	if err := f.decoder.Accepts(l); err != nil {
+		return nil, err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.isClosed() || f.stopped {
+		return nil, errors.New("Already closed")
+	}
+	q := newQueue(l, f.decoder, o, f.log)
+	f.queues = append(f.queues, q)
+	if f.running {
+		q.start()
+	}
+	return q, nil
+}
+
+// Queues returns the listener queues, the first is the queue of the listener passed to the constructor
+func (f *ChannelFeed) Queues() []*Queue {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]*Queue{}, f.queues...)
+}
+
+// Stats returns the queue metrics of the listeners
+func (f *ChannelFeed) Stats() []QueueStats {
+	queues := f.Queues()
+	stats := make([]QueueStats, len(queues))
+	for i, q := range queues {
+		stats[i] = q.Stats()
+	}
+	return stats
+}
+
+func (f *ChannelFeed) url() string {
+	return fmt.Sprintf("%s/%s/%s/%s", f.baseUrl, f.version, f.market, f.channel)
+}
+
+func (f *ChannelFeed) Open(h http.Header) error {
+	url := f.url()
+	f.log.Debugf("Dailing %s...", url)
+	conn, resp, err := websocket.DefaultDialer.Dial(url, h)
+	if err != nil {
+		return err
+	}
+
+	f.log.Infof("Connected to %s (%d %s)", url, resp.StatusCode, resp.Status)
+	f.header = h
+	if !f.setConn(conn) {
+		conn.Close()
+		return errors.New("Already closed")
+	}
+	go f.run()
+
+	return nil
+}
+
+func (f *ChannelFeed) Close() error {
+	closed := false
+	f.close.Do(func() {
+		close(f.done)
+		closed = true
+	})
+	if closed {
+		// closing the connection unblocks the read loop
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		if f.conn != nil {
+			f.conn.Close()
+		}
+		return nil
+	}
+	return errors.New("Already closed")
+}
+
+// Closed returns true if the feed was closed or stopped reconnecting, it doesn't deliver messages anymore
+func (f *ChannelFeed) Closed() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.isClosed() || f.stopped
+}
+
+func (f *ChannelFeed) isClosed() bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// setConn replaces the current connection and starts the queues, it returns false if the feed is already closed
+func (f *ChannelFeed) setConn(conn *websocket.Conn) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.isClosed() {
+		return false
+	}
+	f.conn = conn
+	if !f.running {
+		f.running = true
+		for _, q := range f.queues {
+			q.start()
+		}
+	}
+	return true
+}
+
+// dispatch queues the message for every listener
+func (f *ChannelFeed) dispatch(msg interface{}) {
+	for _, q := range f.Queues() {
+		q.push(msg, f.done)
+	}
+}
+
+// broadcast queues the connection event for every listener, the last event stops the queues
+func (f *ChannelFeed) broadcast(event func(FeedListener), last bool) {
+	f.lock.Lock()
+	f.stopped = f.stopped || last
+	queues := append([]*Queue{}, f.queues...)
+	f.lock.Unlock()
+	for _, q := range queues {
+		q.pushEvent(event, last)
+	}
+}
+
+func (f *ChannelFeed) feedDisconnected(err error) {
+	f.broadcast(func(l FeedListener) { l.FeedDisconnected(f.channel, err) }, false)
+}
+
+func (f *ChannelFeed) feedReconnected(attempts int) {
+	f.broadcast(func(l FeedListener) { l.FeedReconnected(f.channel, attempts) }, false)
+}
+
+func (f *ChannelFeed) feedClosed(err error) {
+	f.broadcast(func(l FeedListener) { l.FeedClosed(f.channel, err) }, true)
+}
+
+func (f *ChannelFeed) getConn() *websocket.Conn {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.conn
+}
+
+// run receives messages and reconnects when the connection is lost,
+// until the feed is closed or the reconnect attempts are exhausted.
+func (f *ChannelFeed) run() {
+	for {
+		err := f.receive(f.getConn())
+		if f.isClosed() {
+			f.feedClosed(nil)
+			return
+		}
+
+		f.log.Errorf("receive: %v", err)
+		f.feedDisconnected(err)
+
+		conn, attempts, err := redial(f.url(), f.header, f.backoff, f.done, f.log)
+		if err == errFeedClosed {
+			f.feedClosed(nil)
+			return
+		}
+		if err != nil {
+			f.feedClosed(err)
+			return
+		}
+		if !f.setConn(conn) {
+			conn.Close()
+			f.feedClosed(nil)
+			return
+		}
+		f.feedReconnected(attempts)
+	}
+}
+
+// receive reads messages from conn until the connection fails or the feed is closed.
+// It always closes conn before returning.
+func (f *ChannelFeed) receive(conn *websocket.Conn) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		if closeErr := conn.Close(); closeErr != nil {
+			f.log.Debugf("receive: %v", closeErr)
+		}
+	}()
+
+	for {
+		typ, bytes, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		f.recorder.record(f.market, f.channel, bytes, f.log)
+		if f.debug {
+			f.log.Infof("%d: %s", typ, string(bytes))
+		} else if msg, err := f.decoder.Decode(bytes); err != nil {
+			f.log.Errorf("receive: invalid %s message: %v", f.channel, err)
+		} else {
+			f.dispatch(msg)
+		}
+
+		select {
+		case <-f.done:
+			return nil
+		default:
+			break
+		}
+	}
+}
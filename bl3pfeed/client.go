@@ -0,0 +1,210 @@
+package bl3pfeed
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+type (
+	// Client follows several markets and channels of one BL3P api.
+	// Every subscription has its own connection, the messages are decoded by the decoder of the channel.
+	Client struct {
+		baseUrl string
+		version string
+
+		lock     sync.Mutex
+		header   http.Header
+		backoff  Backoff
+		recorder *Recorder
+		debug    bool
+		queue    QueueOptions
+		feeds    map[subscription]*ChannelFeed
+		closed   bool
+	}
+
+	subscription struct {
+		market  string
+		channel string
+	}
+)
+
+// NewClient creates a client for the api at baseUrl, e.g. wss://api.bl3p.eu and version 1
+func NewClient(baseUrl, version string) *Client {
+	return &Client{
+		baseUrl: baseUrl,
+		version: version,
+		backoff: DefaultBackoff,
+		queue:   DefaultQueue,
+		feeds:   make(map[subscription]*ChannelFeed),
+	}
+}
+
+func (c *Client) BaseUrl() string { return c.baseUrl }
+func (c *Client) Version() string { return c.version }
+
+// SetHeader sets the header sent when connecting new subscriptions
+func (c *Client) SetHeader(h http.Header) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.header = h
+}
+
+// SetBackoff configures how new subscriptions reconnect
+func (c *Client) SetBackoff(b Backoff) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.backoff = b
+}
+
+// SetRecorder records the messages of new subscriptions
+func (c *Client) SetRecorder(r *Recorder) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.recorder = r
+}
+
+// SetDebug logs the raw messages of new subscriptions instead of processing them
+func (c *Client) SetDebug(b bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.debug = b
+}
+
+// SetQueueOptions configures the listener queues of new subscriptions
+func (c *Client) SetQueueOptions(o QueueOptions) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.queue = o
+}
+
+// Subscribe connects to the market channel and delivers its messages to handler.
+// The handler must be accepted by the decoder of the channel, e.g. a TradesFeedListener for the trades channel.
+// Subscribing again to the same market channel adds the handler to the existing feed,
+// unless that feed is closed, then the subscription gets a new connection.
+// The handler gets a queue with the options of SetQueueOptions.
+func (c *Client) Subscribe(market, channel string, handler FeedListener) (*ChannelFeed, error) {
+	c.lock.Lock()
+	queue := c.queue
+	c.lock.Unlock()
+	return c.SubscribeWithQueue(market, channel, handler, queue)
+}
+
+// SubscribeWithQueue subscribes like Subscribe, the handler gets a queue with the given options,
+// e.g. to keep a slow handler from blocking the other handlers of the feed.
+func (c *Client) SubscribeWithQueue(market, channel string, handler FeedListener, queue QueueOptions) (*ChannelFeed, error) {
+	key := subscription{market: market, channel: channel}
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return nil, errors.New("Client closed")
+	}
+	header := c.header
+	if feed, ok := c.live(key); ok {
+		c.lock.Unlock()
+		return addListener(feed, handler, queue)
+	}
+	feed, err := NewChannelFeed(c.baseUrl, c.version, market, channel, handler)
+	if err == nil {
+		feed.SetQueueOptions(queue)
+		feed.SetBackoff(c.backoff)
+		feed.SetRecorder(c.recorder)
+		feed.SetDebug(c.debug)
+	}
+	c.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// dialing can take a while, so the other subscriptions don't wait for it
+	if err := feed.Open(header); err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		feed.Close()
+		return nil, errors.New("Client closed")
+	}
+	if existing, ok := c.live(key); ok {
+		// another subscription connected to the market channel in the meantime
+		c.lock.Unlock()
+		feed.Close()
+		return addListener(existing, handler, queue)
+	}
+	c.feeds[key] = feed
+	c.lock.Unlock()
+	return feed, nil
+}
+
+// live returns the feed of the subscription if it's still open, closed feeds are removed.
+// The caller must hold c.lock.
+func (c *Client) live(key subscription) (*ChannelFeed, bool) {
+	feed, ok := c.feeds[key]
+	if !ok {
+		return nil, false
+	}
+	if feed.Closed() {
+		delete(c.feeds, key)
+		return nil, false
+	}
+	return feed, true
+}
+
+func addListener(feed *ChannelFeed, handler FeedListener, queue QueueOptions) (*ChannelFeed, error) {
+	if _, err := feed.AddListener(handler, queue); err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+// Unsubscribe closes the connection to the market channel
+func (c *Client) Unsubscribe(market, channel string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := subscription{market: market, channel: channel}
+	feed, ok := c.feeds[key]
+	if !ok {
+		return fmt.Errorf("Not subscribed to %s %s", market, channel)
+	}
+	delete(c.feeds, key)
+	return feed.Close()
+}
+
+// Feeds returns the subscribed feeds ordered by market and channel
+func (c *Client) Feeds() []Feed {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	feeds := make([]Feed, 0, len(c.feeds))
+	for _, f := range c.feeds {
+		feeds = append(feeds, f)
+	}
+	sort.Slice(feeds, func(i, j int) bool {
+		if feeds[i].Market() != feeds[j].Market() {
+			return feeds[i].Market() < feeds[j].Market()
+		}
+		return feeds[i].Channel() < feeds[j].Channel()
+	})
+	return feeds
+}
+
+// Close closes all subscriptions
+func (c *Client) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return errors.New("Already closed")
+	}
+	c.closed = true
+	var err error
+	for key, feed := range c.feeds {
+		if closeErr := feed.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		delete(c.feeds, key)
+	}
+	return err
+}
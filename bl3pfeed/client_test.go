@@ -0,0 +1,269 @@
+package bl3pfeed
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bl3pfeed/bl3pfeedtest"
+	"github.com/resc/rescbits/money"
+)
+
+type (
+	// tickerListener receives the messages of the fake ticker channel
+	tickerListener struct {
+		tickers chan string
+		closed  chan error
+	}
+
+	tickerDecoder struct{}
+)
+
+func (l *tickerListener) FeedDisconnected(channel string, err error)   {}
+func (l *tickerListener) FeedReconnected(channel string, attempts int) {}
+func (l *tickerListener) FeedClosed(channel string, err error)         { l.closed <- err }
+
+func (tickerDecoder) Accepts(l FeedListener) error {
+	if _, ok := l.(*tickerListener); !ok {
+		return errors.New("l should be a tickerListener")
+	}
+	return nil
+}
+
+func (tickerDecoder) Decode(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+func (tickerDecoder) Deliver(msg interface{}, l FeedListener) {
+	l.(*tickerListener).tickers <- msg.(string)
+}
+
+func acceptConns(t *testing.T, server *bl3pfeedtest.Server, n int) map[string]*bl3pfeedtest.Conn {
+	conns := make(map[string]*bl3pfeedtest.Conn)
+	for i := 0; i < n; i++ {
+		conn, err := server.Accept(testTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[conn.Market+"/"+conn.Channel] = conn
+	}
+	return conns
+}
+
+func TestClient_Subscribe(t *testing.T) {
+	server := bl3pfeedtest.NewServer()
+	defer server.Close()
+	client := NewClient(server.URL+"/", "1")
+
+	btc := make(chan *Trade, 10)
+	ltc := make(chan *Trade, 10)
+	books := make(chan *OrderBook, 10)
+	if _, err := client.Subscribe("BTCEUR", ChannelTrades, TradeFunc(func(t *Trade) { btc <- t })); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Subscribe("LTCEUR", ChannelTrades, TradeFunc(func(t *Trade) { ltc <- t })); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Subscribe("BTCEUR", ChannelOrderBook, OrderBookFunc(func(o *OrderBook) { books <- o })); err != nil {
+		t.Fatal(err)
+	}
+	conns := acceptConns(t, server, 3)
+
+	// a second subscription shares the connection
+	btc2 := make(chan *Trade, 10)
+	if _, err := client.Subscribe("BTCEUR", ChannelTrades, TradeFunc(func(t *Trade) { btc2 <- t })); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Subscribe("BTCEUR", ChannelTrades, OrderBookFunc(func(o *OrderBook) {})); err == nil {
+		t.Error("Expected an error for a handler the decoder doesn't accept")
+	}
+	if _, err := client.Subscribe("BTCEUR", "ticker", TradeFunc(func(t *Trade) {})); err == nil {
+		t.Error("Expected an error for a channel without a decoder")
+	}
+
+	conns["LTCEUR/trades"].Send(&Trade{Marketplace: "LTCEUR", Price: 150 * money.Euro})
+	conns["BTCEUR/trades"].Send(&Trade{Marketplace: "BTCEUR", Price: 8000 * money.Euro})
+	conns["BTCEUR/orderbook"].Send(&OrderBook{Market: "BTCEUR"})
+
+	select {
+	case trade := <-btc:
+		if trade.Marketplace != "BTCEUR" {
+			t.Errorf("Unexpected BTCEUR trade %+v", trade)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timeout waiting for the BTCEUR trade")
+	}
+	select {
+	case <-btc2:
+	case <-time.After(testTimeout):
+		t.Fatal("Timeout waiting for the BTCEUR trade of the second subscription")
+	}
+	if server.Connections() != 3 {
+		t.Errorf("Expected 3 connections, got %d", server.Connections())
+	}
+	select {
+	case trade := <-ltc:
+		if trade.Marketplace != "LTCEUR" {
+			t.Errorf("Unexpected LTCEUR trade %+v", trade)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timeout waiting for the LTCEUR trade")
+	}
+	select {
+	case <-books:
+	case <-time.After(testTimeout):
+		t.Fatal("Timeout waiting for the order book")
+	}
+
+	feeds := client.Feeds()
+	if len(feeds) != 3 || feeds[0].Market() != "BTCEUR" || feeds[0].Channel() != ChannelOrderBook || feeds[2].Market() != "LTCEUR" {
+		t.Fatalf("Unexpected feeds %v", feeds)
+	}
+
+	if err := client.Unsubscribe("LTCEUR", ChannelTrades); err != nil {
+		t.Fatal(err)
+	}
+	if !conns["LTCEUR/trades"].WaitDone(testTimeout) {
+		t.Error("Expected the LTCEUR connection to be closed")
+	}
+	if err := client.Unsubscribe("LTCEUR", ChannelTrades); err == nil {
+		t.Error("Expected an error when unsubscribing twice")
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Close(); err == nil {
+		t.Error("Expected an error when closing twice")
+	}
+	for key, conn := range conns {
+		if !conn.WaitDone(testTimeout) {
+			t.Errorf("Expected the %s connection to be closed", key)
+		}
+	}
+	if _, err := client.Subscribe("BTCEUR", ChannelTrades, TradeFunc(func(t *Trade) {})); err == nil {
+		t.Error("Expected an error when subscribing to a closed client")
+	}
+}
+
+func TestClient_SubscribeClosedFeed(t *testing.T) {
+	server := bl3pfeedtest.NewServer()
+	defer server.Close()
+	client := NewClient(server.URL+"/", "1")
+	defer client.Close()
+
+	feed, err := client.Subscribe("BTCEUR", ChannelTrades, TradeFunc(func(t *Trade) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := acceptConns(t, server, 1)["BTCEUR/trades"]
+	if err := feed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !first.WaitDone(testTimeout) {
+		t.Fatal("Expected the first connection to be closed")
+	}
+	if !feed.Closed() {
+		t.Fatal("Expected the feed to be closed")
+	}
+
+	// the closed feed is replaced by a new connection
+	trades := make(chan *Trade, 10)
+	again, err := client.Subscribe("BTCEUR", ChannelTrades, TradeFunc(func(t *Trade) { trades <- t }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == feed {
+		t.Fatal("Expected a new feed")
+	}
+	second := acceptConns(t, server, 1)["BTCEUR/trades"]
+	second.Send(&Trade{Marketplace: "BTCEUR", Price: 8000 * money.Euro})
+	select {
+	case <-trades:
+	case <-time.After(testTimeout):
+		t.Fatal("Timeout waiting for the trade of the new feed")
+	}
+	if feeds := client.Feeds(); len(feeds) != 1 || feeds[0] != Feed(again) {
+		t.Errorf("Unexpected feeds %v", feeds)
+	}
+}
+
+func TestClient_SubscribeWithQueue(t *testing.T) {
+	server := bl3pfeedtest.NewServer()
+	defer server.Close()
+	client := NewClient(server.URL+"/", "1")
+	defer client.Close()
+
+	// the slow handler drops its oldest trades instead of blocking the feed
+	block := make(chan struct{})
+	defer close(block)
+	slow := TradeFunc(func(t *Trade) { <-block })
+	feed, err := client.SubscribeWithQueue("BTCEUR", ChannelTrades, slow, QueueOptions{Size: 1, Overflow: OverflowDropOldest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trades := make(chan *Trade, 10)
+	if _, err := client.Subscribe("BTCEUR", ChannelTrades, TradeFunc(func(t *Trade) { trades <- t })); err != nil {
+		t.Fatal(err)
+	}
+	conn := acceptConns(t, server, 1)["BTCEUR/trades"]
+	for i := 0; i < 5; i++ {
+		conn.Send(&Trade{Marketplace: "BTCEUR", Price: money.Price(8000+i) * money.Euro})
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case <-trades:
+		case <-time.After(testTimeout):
+			t.Fatalf("Timeout waiting for trade %d", i)
+		}
+	}
+	stats := feed.Stats()
+	if len(stats) != 2 || stats[0].Overflow != OverflowDropOldest || stats[0].Dropped == 0 || stats[1].Overflow != OverflowBlock {
+		t.Errorf("Unexpected queue stats %+v", stats)
+	}
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	// the fake server only serves the known channels, so the custom decoder is tested with a replay
+	RegisterDecoder("ticker", tickerDecoder{})
+	defer func() {
+		decodersLock.Lock()
+		delete(decoders, "ticker")
+		decodersLock.Unlock()
+	}()
+
+	l := &tickerListener{tickers: make(chan string, 10), closed: make(chan error, 1)}
+	if _, err := NewChannelFeed("ws://localhost", "1", "BTCEUR", ChannelTrades, l); err == nil {
+		t.Error("Expected the trades decoder to reject the ticker listener")
+	}
+	if _, err := NewChannelFeed("ws://localhost", "1", "BTCEUR", "ticker", l); err != nil {
+		t.Fatal(err)
+	}
+
+	path := writeRecording(t,
+		Frame{Time: time.Now(), Market: "BTCEUR", Channel: "ticker", Data: []byte("tick")},
+		tradeFrame(t, time.Now(), 1),
+	)
+	defer os.RemoveAll(filepath.Dir(path))
+	replay, err := NewReplay(path, "", "", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay.SetSpeed(AsFastAsPossible)
+	if err := replay.Open(nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-l.closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timeout waiting for FeedClosed")
+	}
+	if len(l.tickers) != 1 || <-l.tickers != "tick" {
+		t.Fatal("Expected one ticker message")
+	}
+}
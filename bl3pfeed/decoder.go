@@ -0,0 +1,109 @@
+package bl3pfeed
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type (
+	// Decoder decodes the raw messages of a channel and delivers them to the listeners.
+	// A message is decoded once and delivered to every listener of the feed.
+	Decoder interface {
+		// Accepts returns an error if the listener can't receive the decoded messages
+		Accepts(l FeedListener) error
+		// Decode decodes the raw message
+		Decode(data []byte) (interface{}, error)
+		// Deliver calls the listener with a message returned by Decode
+		Deliver(msg interface{}, l FeedListener)
+	}
+
+	tradesDecoder    struct{}
+	orderBookDecoder struct{}
+)
+
+var (
+	decodersLock sync.RWMutex
+	decoders     = map[string]Decoder{
+		ChannelTrades:    tradesDecoder{},
+		ChannelOrderBook: orderBookDecoder{},
+	}
+)
+
+// RegisterDecoder registers the decoder for the channel, it replaces an existing decoder
+func RegisterDecoder(channel string, d Decoder) {
+	decodersLock.Lock()
+	defer decodersLock.Unlock()
+	decoders[channel] = d
+}
+
+// DecoderFor returns the decoder registered for the channel
+func DecoderFor(channel string) (Decoder, bool) {
+	decodersLock.RLock()
+	defer decodersLock.RUnlock()
+	d, ok := decoders[channel]
+	return d, ok
+}
+
+// decoderFor returns the decoder for the channel if it accepts the listener
+func decoderFor(channel string, l FeedListener) (Decoder, error) {
+	d, ok := DecoderFor(channel)
+	if !ok {
+		return nil, fmt.Errorf("No decoder for channel %s", channel)
+	}
+	if err := d.Accepts(l); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// acceptsAny returns true if any registered decoder accepts the listener
+func acceptsAny(l FeedListener) bool {
+	decodersLock.RLock()
+	defer decodersLock.RUnlock()
+	for _, d := range decoders {
+		if d.Accepts(l) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (tradesDecoder) Accepts(l FeedListener) error {
+	if _, ok := l.(TradesFeedListener); !ok {
+		return errors.New("l should be a TradesFeedListener")
+	}
+	return nil
+}
+
+func (tradesDecoder) Decode(data []byte) (interface{}, error) {
+	trade := &Trade{}
+	if err := json.Unmarshal(data, trade); err != nil {
+		return nil, err
+	}
+	return trade, nil
+}
+
+func (tradesDecoder) Deliver(msg interface{}, l FeedListener) {
+	l.(TradesFeedListener).OnTrade(msg.(*Trade))
+}
+
+func (orderBookDecoder) Accepts(l FeedListener) error {
+	if _, ok := l.(OrderBookFeedListener); !ok {
+		return errors.New("l should be an OrderBookFeedListener")
+	}
+	return nil
+}
+
+func (orderBookDecoder) Decode(data []byte) (interface{}, error) {
+	orderBook := &OrderBook{}
+	if err := json.Unmarshal(data, orderBook); err != nil {
+		return nil, err
+	}
+	return orderBook, nil
+}
+
+func (orderBookDecoder) Deliver(msg interface{}, l FeedListener) {
+	l.(OrderBookFeedListener).OnOrderBookChanged(msg.(*OrderBook))
+}
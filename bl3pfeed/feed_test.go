@@ -0,0 +1,352 @@
+package bl3pfeed
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bl3pfeed/bl3pfeedtest"
+	"github.com/resc/rescbits/money"
+)
+
+const testTimeout = 5 * time.Second
+
+type (
+	// testListener records the feed events, OnTrade waits for block when it's set to simulate a slow consumer
+	testListener struct {
+		lock       sync.Mutex
+		trades     []*Trade
+		orderBooks []*OrderBook
+
+		block        chan struct{}
+		received     chan struct{}
+		disconnected chan error
+		reconnected  chan int
+		closed       chan error
+	}
+)
+
+var testBackoff = Backoff{Min: 10 * time.Millisecond, Max: 50 * time.Millisecond, Factor: 2}
+
+func newTestListener() *testListener {
+	return &testListener{
+		received:     make(chan struct{}, 1000),
+		disconnected: make(chan error, 10),
+		reconnected:  make(chan int, 10),
+		closed:       make(chan error, 2),
+	}
+}
+
+func (l *testListener) FeedDisconnected(channel string, err error)   { l.disconnected <- err }
+func (l *testListener) FeedReconnected(channel string, attempts int) { l.reconnected <- attempts }
+func (l *testListener) FeedClosed(channel string, err error)         { l.closed <- err }
+
+func (l *testListener) OnTrade(t *Trade) {
+	l.lock.Lock()
+	block := l.block
+	l.lock.Unlock()
+	if block != nil {
+		<-block
+	}
+	l.lock.Lock()
+	l.trades = append(l.trades, t)
+	l.lock.Unlock()
+	l.received <- struct{}{}
+}
+
+func (l *testListener) OnOrderBookChanged(o *OrderBook) {
+	l.lock.Lock()
+	l.orderBooks = append(l.orderBooks, o)
+	l.lock.Unlock()
+	l.received <- struct{}{}
+}
+
+// setBlock makes OnTrade wait until the returned channel is closed
+func (l *testListener) setBlock() chan struct{} {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.block = make(chan struct{})
+	return l.block
+}
+
+func (l *testListener) Trades() []*Trade {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]*Trade{}, l.trades...)
+}
+
+func (l *testListener) waitReceived(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-l.received:
+		case <-time.After(testTimeout):
+			t.Fatalf("Timeout waiting for message %d of %d", i+1, n)
+		}
+	}
+}
+
+func (l *testListener) waitClosed(t *testing.T) error {
+	select {
+	case err := <-l.closed:
+		return err
+	case <-time.After(testTimeout):
+		t.Fatal("Timeout waiting for FeedClosed")
+		return nil
+	}
+}
+
+func openTestTrades(t *testing.T, server *bl3pfeedtest.Server, l *testListener, b Backoff) (*Trades, *bl3pfeedtest.Conn) {
+	trades, err := NewTrades(server.URL, "1", "BTCEUR", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trades.SetBackoff(b)
+	if err := trades.Open(nil); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := server.Accept(testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trades, conn
+}
+
+func testTrade(price money.Price) *Trade {
+	return &Trade{Date: 1514808000, Marketplace: "BTCEUR", Price: price, Type: "buy", Amount: money.Bitcoin}
+}
+
+func TestTrades_Lifecycle(t *testing.T) {
+	server := bl3pfeedtest.NewServer()
+	defer server.Close()
+	l := newTestListener()
+	trades, conn := openTestTrades(t, server, l, testBackoff)
+
+	if conn.Version != "1" || conn.Market != "BTCEUR" || conn.Channel != ChannelTrades {
+		t.Fatalf("Unexpected connection %+v", conn)
+	}
+
+	conn.Send(testTrade(8000 * money.Euro))
+	conn.SendRaw([]byte(`{"price_int": "not a number"`))
+	conn.Send(testTrade(8100 * money.Euro))
+	l.waitReceived(t, 2)
+
+	received := l.Trades()
+	if received[0].Price != 8000*money.Euro || received[1].Price != 8100*money.Euro || received[1].Amount != money.Bitcoin {
+		t.Fatalf("Unexpected trades %+v %+v", received[0], received[1])
+	}
+
+	if err := trades.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.waitClosed(t); err != nil {
+		t.Fatalf("Expected a clean close, got %v", err)
+	}
+	if err := trades.Close(); err == nil {
+		t.Error("Expected an error when closing twice")
+	}
+	if !conn.WaitDone(testTimeout) {
+		t.Error("Expected the connection to be closed")
+	}
+	if len(l.closed) != 0 {
+		t.Error("FeedClosed was called more than once")
+	}
+}
+
+func TestOrderBooks_Lifecycle(t *testing.T) {
+	server := bl3pfeedtest.NewServer()
+	defer server.Close()
+	l := newTestListener()
+	orderBooks, err := NewOrderBook(server.URL, "1", "BTCEUR", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orderBooks.Open(nil); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := server.Accept(testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.Channel != ChannelOrderBook {
+		t.Fatalf("Unexpected channel %s", conn.Channel)
+	}
+
+	conn.SendRaw([]byte("not json"))
+	conn.Send(&OrderBook{
+		Market: "BTCEUR",
+		Asks:   []*Order{{Price: 8000 * money.Euro, Amount: money.Bitcoin}},
+		Bids:   []*Order{{Price: 7900 * money.Euro, Amount: 2 * money.Bitcoin}},
+	})
+	l.waitReceived(t, 1)
+	if o := l.orderBooks[0]; len(o.Asks) != 1 || len(o.Bids) != 1 || o.Bids[0].Amount != 2*money.Bitcoin {
+		t.Fatalf("Unexpected order book %+v", o)
+	}
+
+	if err := orderBooks.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.waitClosed(t); err != nil {
+		t.Fatalf("Expected a clean close, got %v", err)
+	}
+	if err := orderBooks.Close(); err == nil {
+		t.Error("Expected an error when closing twice")
+	}
+	if err := orderBooks.Open(nil); err == nil {
+		t.Error("Expected an error when opening a closed feed")
+	}
+}
+
+func TestTrades_OpenRejected(t *testing.T) {
+	server := bl3pfeedtest.NewServer()
+	defer server.Close()
+	server.Reject(1)
+
+	trades, err := NewTrades(server.URL, "1", "BTCEUR", newTestListener())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := trades.Open(nil); err == nil {
+		t.Fatal("Expected an error when the server rejects the connection")
+	}
+	if err := trades.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenWithBackoff(t *testing.T) {
+	server := bl3pfeedtest.NewServer()
+	defer server.Close()
+	server.Reject(2)
+
+	l := newTestListener()
+	trades, err := NewTrades(server.URL, "1", "BTCEUR", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trades.Close()
+	if err := OpenWithBackoff(trades, nil, testBackoff, nil); err != nil {
+		t.Fatal(err)
+	}
+	if dials := server.Dials(); dials != 3 {
+		t.Errorf("Expected 3 dials, got %d", dials)
+	}
+	conn, err := server.Accept(testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Send(testTrade(8000 * money.Euro))
+	l.waitReceived(t, 1)
+
+	// the backoff gives up, or done stops the retries
+	server.Reject(-1)
+	b := testBackoff
+	b.MaxAttempts = 2
+	other, err := NewTrades(server.URL, "1", "LTCEUR", newTestListener())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := OpenWithBackoff(other, nil, b, nil); err != ErrRetriesExhausted {
+		t.Errorf("Expected ErrRetriesExhausted, got %v", err)
+	}
+	done := make(chan struct{})
+	close(done)
+	if err := OpenWithBackoff(other, nil, testBackoff, done); err == nil || err == ErrRetriesExhausted {
+		t.Errorf("Expected the dial error, got %v", err)
+	}
+}
+
+func TestTrades_Reconnect(t *testing.T) {
+	server := bl3pfeedtest.NewServer()
+	defer server.Close()
+	l := newTestListener()
+	trades, conn := openTestTrades(t, server, l, testBackoff)
+	defer trades.Close()
+
+	conn.Drop()
+	select {
+	case <-l.disconnected:
+	case <-time.After(testTimeout):
+		t.Fatal("Timeout waiting for FeedDisconnected")
+	}
+
+	conn, err := server.Accept(testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case attempts := <-l.reconnected:
+		if attempts != 1 {
+			t.Errorf("Expected 1 attempt, got %d", attempts)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timeout waiting for FeedReconnected")
+	}
+
+	conn.Send(testTrade(8000 * money.Euro))
+	l.waitReceived(t, 1)
+
+	// a graceful disconnect by the server is handled the same way
+	conn.Disconnect()
+	if _, err := server.Accept(testTimeout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrades_RetriesExhausted(t *testing.T) {
+	server := bl3pfeedtest.NewServer()
+	defer server.Close()
+	l := newTestListener()
+	b := testBackoff
+	b.MaxAttempts = 2
+	trades, conn := openTestTrades(t, server, l, b)
+
+	server.Reject(-1)
+	conn.Drop()
+	if err := l.waitClosed(t); err != ErrRetriesExhausted {
+		t.Fatalf("Expected ErrRetriesExhausted, got %v", err)
+	}
+	if dials := server.Dials(); dials != 3 {
+		t.Errorf("Expected 3 dials, got %d", dials)
+	}
+	if err := trades.Close(); err != nil {
+		t.Errorf("Expected the first Close to succeed, got %v", err)
+	}
+}
+
+func TestTrades_SlowConsumer(t *testing.T) {
+	server := bl3pfeedtest.NewServer()
+	defer server.Close()
+	l := newTestListener()
+	block := l.setBlock()
+	trades, conn := openTestTrades(t, server, l, testBackoff)
+
+	const n = 100
+	for i := 0; i < n; i++ {
+		if err := conn.Send(testTrade(money.Price(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(block)
+	l.waitReceived(t, n)
+	for i, trade := range l.Trades() {
+		if trade.Price != money.Price(i) {
+			t.Fatalf("Trade %d out of order: %d", i, trade.Price)
+		}
+	}
+
+	// the messages received before closing are delivered before FeedClosed
+	block = l.setBlock()
+	conn.Send(testTrade(n))
+	conn.Send(testTrade(n + 1))
+	time.Sleep(20 * time.Millisecond)
+	if err := trades.Close(); err != nil {
+		t.Fatal(err)
+	}
+	close(block)
+	if err := l.waitClosed(t); err != nil {
+		t.Fatalf("Expected a clean close, got %v", err)
+	}
+	if received := len(l.Trades()); received != n+2 {
+		t.Fatalf("Expected %d trades, got %d", n+2, received)
+	}
+}
@@ -0,0 +1,171 @@
+package bl3pfeed
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/resc/rescbits/money"
+)
+
+const (
+	ActionBuy   = "buy"
+	ActionSell  = "sell"
+	CurrencyBtc = "btc"
+	CurrencyEur = "eur"
+)
+
+type (
+	// Fill is the result of simulating a market order against the order book.
+	Fill struct {
+		Action string
+		// Currency is btc when a BTC amount was requested, or eur when an EUR total was requested
+		Currency string
+		// Amount is the filled BTC amount
+		Amount money.Amount
+		// Cost is the total EUR paid (buy) or received (sell)
+		Cost money.Price
+		// AveragePrice is the volume weighted average price
+		AveragePrice money.Price
+		// WorstPrice is the price of the last level used
+		WorstPrice money.Price
+		// Levels is the number of price levels used
+		Levels int
+		// UnfilledAmount is the BTC amount that could not be filled for btc requests
+		UnfilledAmount money.Amount
+		// UnfilledCost is the EUR total that could not be filled for eur requests
+		UnfilledCost money.Price
+	}
+)
+
+// IsComplete returns true if the order could be filled completely
+func (f *Fill) IsComplete() bool {
+	return f.UnfilledAmount == 0 && f.UnfilledCost == 0
+}
+
+// Simulate walks the asks (buy) or bids (sell) to fill a market order for the BTC amount
+func (o *OrderBook) Simulate(action string, amount money.Amount) (*Fill, error) {
+	levels, err := o.levelsFor(action)
+	if err != nil {
+		return nil, err
+	}
+	return simulateAmount(action, amount, levels)
+}
+
+// SimulateEur walks the asks (buy) or bids (sell) to fill a market order for the EUR total
+func (o *OrderBook) SimulateEur(action string, total money.Price) (*Fill, error) {
+	levels, err := o.levelsFor(action)
+	if err != nil {
+		return nil, err
+	}
+	return simulateTotal(action, total, levels)
+}
+
+// Simulate walks the asks (buy) or bids (sell) to fill a market order for the BTC amount
+func (b *Book) Simulate(action string, amount money.Amount) (*Fill, error) {
+	levels, err := b.levelsFor(action)
+	if err != nil {
+		return nil, err
+	}
+	return simulateAmount(action, amount, levels)
+}
+
+// SimulateEur walks the asks (buy) or bids (sell) to fill a market order for the EUR total
+func (b *Book) SimulateEur(action string, total money.Price) (*Fill, error) {
+	levels, err := b.levelsFor(action)
+	if err != nil {
+		return nil, err
+	}
+	return simulateTotal(action, total, levels)
+}
+
+func (o *OrderBook) levelsFor(action string) ([]Level, error) {
+	switch strings.ToLower(action) {
+	case ActionBuy:
+		return aggregate(o.Asks, func(a, b money.Price) bool { return a < b }), nil
+	case ActionSell:
+		return aggregate(o.Bids, func(a, b money.Price) bool { return a > b }), nil
+	default:
+		return nil, fmt.Errorf("invalid action: %s", action)
+	}
+}
+
+func (b *Book) levelsFor(action string) ([]Level, error) {
+	switch strings.ToLower(action) {
+	case ActionBuy:
+		return b.Asks(), nil
+	case ActionSell:
+		return b.Bids(), nil
+	default:
+		return nil, fmt.Errorf("invalid action: %s", action)
+	}
+}
+
+// simulateAmount fills the BTC amount against the levels, which must be sorted best price first
+func simulateAmount(action string, amount money.Amount, levels []Level) (*Fill, error) {
+	if amount < 0 {
+		return nil, fmt.Errorf("invalid amount: %s", amount)
+	}
+
+	fill := &Fill{
+		Action:   strings.ToLower(action),
+		Currency: CurrencyBtc,
+	}
+
+	remaining := amount
+	for _, l := range levels {
+		if remaining <= 0 {
+			break
+		}
+		take := l.Amount.Min(remaining)
+		fill.Amount += take
+		fill.Cost += l.Price.Total(take, money.RoundDown)
+		fill.WorstPrice = l.Price
+		fill.Levels++
+		remaining -= take
+	}
+
+	fill.UnfilledAmount = remaining
+	fill.AveragePrice = money.AveragePrice(fill.Cost, fill.Amount, money.RoundDown)
+	return fill, nil
+}
+
+// simulateTotal fills the EUR total against the levels, which must be sorted best price first
+func simulateTotal(action string, total money.Price, levels []Level) (*Fill, error) {
+	if total < 0 {
+		return nil, fmt.Errorf("invalid total: %s", total)
+	}
+
+	fill := &Fill{
+		Action:   strings.ToLower(action),
+		Currency: CurrencyEur,
+	}
+
+	remaining := total
+	for _, l := range levels {
+		if remaining <= 0 || l.Price <= 0 {
+			break
+		}
+		take := l.Amount
+		partial := l.Price.Total(take, money.RoundDown) > remaining
+		if partial {
+			// the largest amount we can get for the remaining EUR at this price
+			take = l.Price.Amount(remaining, money.RoundDown)
+		}
+		if take > 0 {
+			cost := l.Price.Total(take, money.RoundDown)
+			fill.Amount += take
+			fill.Cost += cost
+			fill.WorstPrice = l.Price
+			fill.Levels++
+			remaining -= cost
+		}
+		if partial {
+			// what's left is worth less than a satoshi at this price
+			remaining = 0
+		}
+	}
+
+	fill.UnfilledCost = remaining
+	fill.AveragePrice = money.AveragePrice(fill.Cost, fill.Amount, money.RoundDown)
+	return fill, nil
+}
@@ -0,0 +1,70 @@
+package bl3pfeed
+
+import (
+	"testing"
+
+	"github.com/resc/rescbits/money"
+)
+
+func TestOrderBook_SimulateBuyBtc(t *testing.T) {
+	// asks: 1 BTC @ 10.0, 1 BTC @ 10.1, 2 BTC @ 10.2
+	fill, err := testOrderBook().Simulate(ActionBuy, 15e7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fill.Amount != 15e7 || fill.Cost != 1505000 || fill.Levels != 2 || fill.WorstPrice != 1010000 || !fill.IsComplete() {
+		t.Fatalf("unexpected fill %+v", fill)
+	}
+	if fill.AveragePrice != 1003333 {
+		t.Fatalf("expected average price 1003333, got %d", fill.AveragePrice)
+	}
+}
+
+func TestOrderBook_SimulateSellBtc(t *testing.T) {
+	// bids: 0.3 BTC @ 9.9, 1 BTC @ 9.8, 4 BTC @ 9.7
+	fill, err := testOrderBook().Simulate(ActionSell, 6*money.Bitcoin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fill.Amount != 53e7 || fill.Levels != 3 || fill.WorstPrice != 970000 {
+		t.Fatalf("unexpected fill %+v", fill)
+	}
+	if fill.UnfilledAmount != 7e7 || fill.IsComplete() {
+		t.Fatalf("expected 0.7 BTC unfilled, got %s", fill.UnfilledAmount)
+	}
+}
+
+func TestOrderBook_SimulateBuyEur(t *testing.T) {
+	// 15.05 EUR buys 1 BTC @ 10.0 and 0.5 BTC @ 10.1
+	fill, err := testOrderBook().SimulateEur(ActionBuy, 1505000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fill.Amount != 15e7 || fill.Cost != 1505000 || fill.Levels != 2 || !fill.IsComplete() {
+		t.Fatalf("unexpected fill %+v", fill)
+	}
+}
+
+func TestOrderBook_SimulateSellEurUnfilled(t *testing.T) {
+	// all bids together are worth 51.57 EUR
+	fill, err := testOrderBook().SimulateEur(ActionSell, 100*money.Euro)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fill.Cost != 5157000 || fill.UnfilledCost != 4843000 || fill.IsComplete() {
+		t.Fatalf("unexpected fill %+v", fill)
+	}
+}
+
+func TestOrderBook_SimulateInvalid(t *testing.T) {
+	if _, err := testOrderBook().Simulate("hold", 1); err == nil {
+		t.Fatal("expected an error for an invalid action")
+	}
+	if _, err := testOrderBook().Simulate(ActionBuy, -1); err == nil {
+		t.Fatal("expected an error for a negative amount")
+	}
+}
@@ -1,30 +1,16 @@
 package bl3pfeed
 
 import (
-	"net/http"
-	"github.com/gorilla/websocket"
-	"sync"
-
-	log "github.com/sirupsen/logrus"
-	"fmt"
+	"encoding/json"
 	"errors"
+
+	"github.com/resc/rescbits/money"
 )
 
 type (
+	// OrderBooks is the feed of the orderbook channel
 	OrderBooks struct {
-		close sync.Once
-
-		baseUrl string
-		version string
-		market  string
-		channel string
-
-		conn     *websocket.Conn
-		done     chan struct{}
-		listener OrderBookFeedListener
-
-		debug bool
-		log   *log.Entry
+		*ChannelFeed
 	}
 
 	OrderBook struct {
@@ -34,107 +20,54 @@ type (
 	}
 
 	Order struct {
-		Price  int `json:"price_int"`
-		Amount int `json:"amount_int"`
+		Price  money.Price
+		Amount money.Amount
+	}
+
+	// orderMessage is the wire format of an order, prices and amounts are integers
+	orderMessage struct {
+		Price  int64 `json:"price_int"`
+		Amount int64 `json:"amount_int"`
 	}
 
+	// OrderBookFunc is an OrderBookFeedListener that ignores the connection events
 	OrderBookFunc func(*OrderBook)
 )
 
-var _ Feed = (*OrderBooks)(nil)
+var (
+	_ Feed                  = (*OrderBooks)(nil)
+	_ OrderBookFeedListener = OrderBookFunc(nil)
+)
 
 func NewOrderBook(baseUrl, version, market string, listener OrderBookFeedListener) (*OrderBooks, error) {
 	if listener == nil {
 		return nil, errors.New("No listener supplied")
 	}
-	channel := "orderbook"
-	return &OrderBooks{
-		baseUrl: baseUrl,
-		version: version,
-		market:  market,
-		channel: channel,
-
-		done:     make(chan struct{}),
-		listener: listener,
-		log: log.WithFields(log.Fields{
-			"market":  market,
-			"channel": channel,
-		}),
-	}, nil
+	f, err := NewChannelFeed(baseUrl, version, market, ChannelOrderBook, listener)
+	if err != nil {
+		return nil, err
+	}
+	return &OrderBooks{f}, nil
 }
 
-func (o *OrderBooks) BaseUrl() string { return o.baseUrl }
-func (o *OrderBooks) Version() string { return o.version }
-func (o *OrderBooks) Market() string  { return o.market }
-func (o *OrderBooks) Channel() string { return o.channel }
-
-func (o *OrderBooks) SetDebug(b bool) { o.debug = b }
-
-func (t *OrderBooks) Open(h http.Header) error {
-	url := fmt.Sprintf("%s/%s/%s/%s", t.baseUrl, t.version, t.market, t.channel)
-	log.Debugf("Dailing %s...", url)
-	conn, resp, err := websocket.DefaultDialer.Dial(url, h)
-	if err != nil {
+func (o *Order) UnmarshalJSON(data []byte) error {
+	m := orderMessage{}
+	if err := json.Unmarshal(data, &m); err != nil {
 		return err
 	}
-
-	log.Infof("Connected to %s (%d %s)", url, resp.StatusCode, resp.Status)
-
-	t.conn = conn
-
-	go t.receive()
-
+	o.Price = money.Price(m.Price)
+	o.Amount = money.Amount(m.Amount)
 	return nil
 }
 
-func (t *OrderBooks) Close() error {
-	closed := false
-	t.close.Do(func() {
-		close(t.done)
-		closed = true
+func (o *Order) MarshalJSON() ([]byte, error) {
+	return json.Marshal(orderMessage{
+		Price:  int64(o.Price),
+		Amount: int64(o.Amount),
 	})
-	if closed {
-		return nil
-	}
-	return errors.New("Already closed")
 }
 
-func (t *OrderBooks) receive() {
-	defer func() {
-		err := recover()
-		if err != nil {
-			log.Errorf("receive: ", err)
-		}
-		err = t.conn.Close()
-
-		if err != nil {
-			log.Errorf("receive: ", err)
-		}
-	}()
-
-	for {
-		if t.debug {
-			typ, bytes, err := t.conn.ReadMessage()
-			if err != nil {
-				log.Errorf("readConn: ", err)
-				return
-			}
-			log.Infof("%d: %s", typ, string(bytes))
-		} else {
-			orderBook := &OrderBook{}
-			err := t.conn.ReadJSON(orderBook)
-			if err != nil {
-				log.Errorf("readConn: ", err)
-				return
-			}
-			t.listener.OnOrderBookChanged(orderBook)
-		}
-
-		select {
-		case <-t.done:
-			return
-		default:
-			break
-		}
-	}
-}
\ No newline at end of file
+func (f OrderBookFunc) FeedDisconnected(channel string, err error)   {}
+func (f OrderBookFunc) FeedReconnected(channel string, attempts int) {}
+func (f OrderBookFunc) FeedClosed(channel string, err error)         {}
+func (f OrderBookFunc) OnOrderBookChanged(o *OrderBook)              { f(o) }
@@ -0,0 +1,250 @@
+package bl3pfeed
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Overflow is what a listener queue does with a new message when it's full
+type Overflow int
+
+const (
+	// OverflowBlock blocks the read loop until the listener catches up
+	OverflowBlock Overflow = iota
+	// OverflowDropOldest drops the oldest queued message
+	OverflowDropOldest
+	// OverflowConflate drops all queued messages and keeps the new one, use it for channels that send snapshots like the order book
+	OverflowConflate
+)
+
+type (
+	// QueueOptions configures the queue between a feed and a listener
+	QueueOptions struct {
+		// Size is the number of messages the queue holds
+		Size int
+		// Overflow is what the queue does with a new message when it's full
+		Overflow Overflow
+	}
+
+	// QueueStats are the metrics of a listener queue
+	QueueStats struct {
+		Depth     int
+		Size      int
+		Overflow  Overflow
+		Delivered uint64
+		Dropped   uint64
+	}
+
+	// Queue delivers the messages of a feed to one listener on its own goroutine,
+	// so a slow listener doesn't block the feed or the other listeners.
+	// Connection events are delivered in order with the messages and are never dropped.
+	Queue struct {
+		listener FeedListener
+		decoder  Decoder
+		options  QueueOptions
+		log      *log.Entry
+
+		lock      sync.Mutex
+		items     []queueItem
+		messages  int
+		delivered uint64
+		dropped   uint64
+
+		notEmpty chan struct{}
+		notFull  chan struct{}
+		started  sync.Once
+	}
+
+	// queueItem is a decoded message or a connection event
+	queueItem struct {
+		msg   interface{}
+		event func(FeedListener)
+		last  bool
+	}
+)
+
+// DefaultQueue is used for the listeners passed to the feed constructors
+var DefaultQueue = QueueOptions{Size: 1000, Overflow: OverflowBlock}
+
+func (o Overflow) String() string {
+	switch o {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowConflate:
+		return "conflate"
+	default:
+		return fmt.Sprintf("Overflow(%d)", int(o))
+	}
+}
+
+// newQueue creates the queue for l, call start to start delivering
+func newQueue(l FeedListener, d Decoder, o QueueOptions, entry *log.Entry) *Queue {
+	if o.Size < 1 {
+		o.Size = 1
+	}
+	return &Queue{
+		listener: l,
+		decoder:  d,
+		options:  o,
+		log:      entry,
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+	}
+}
+
+// start starts delivering to the listener
+func (q *Queue) start() {
+	q.started.Do(func() { go q.run() })
+}
+
+// Listener returns the listener of the queue
+func (q *Queue) Listener() FeedListener { return q.listener }
+
+// Stats returns the queue metrics
+func (q *Queue) Stats() QueueStats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return QueueStats{
+		Depth:     len(q.items),
+		Size:      q.options.Size,
+		Overflow:  q.options.Overflow,
+		Delivered: q.delivered,
+		Dropped:   q.dropped,
+	}
+}
+
+// push queues the message, it returns false if the message was dropped because done was closed while blocking
+func (q *Queue) push(msg interface{}, done <-chan struct{}) bool {
+	for {
+		q.lock.Lock()
+		if q.messages < q.options.Size {
+			q.append(queueItem{msg: msg})
+			q.lock.Unlock()
+			return true
+		}
+		switch q.options.Overflow {
+		case OverflowDropOldest:
+			q.dropOldest()
+			q.append(queueItem{msg: msg})
+			q.lock.Unlock()
+			return true
+		case OverflowConflate:
+			q.dropMessages()
+			q.append(queueItem{msg: msg})
+			q.lock.Unlock()
+			return true
+		}
+		q.lock.Unlock()
+
+		select {
+		case <-q.notFull:
+		case <-done:
+			q.lock.Lock()
+			q.dropped++
+			q.lock.Unlock()
+			return false
+		}
+	}
+}
+
+// pushEvent queues a connection event, events don't count towards the size
+func (q *Queue) pushEvent(event func(FeedListener), last bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.append(queueItem{event: event, last: last})
+}
+
+// append must be called with the lock held
+func (q *Queue) append(item queueItem) {
+	q.items = append(q.items, item)
+	if item.event == nil && !item.last {
+		q.messages++
+	}
+	signal(q.notEmpty)
+}
+
+// dropOldest removes the oldest message, it must be called with the lock held
+func (q *Queue) dropOldest() {
+	for i, item := range q.items {
+		if item.event == nil && !item.last {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			q.messages--
+			q.dropped++
+			return
+		}
+	}
+}
+
+// dropMessages removes all queued messages and keeps the events, it must be called with the lock held
+func (q *Queue) dropMessages() {
+	items := q.items[:0]
+	for _, item := range q.items {
+		if item.event == nil && !item.last {
+			q.dropped++
+			continue
+		}
+		items = append(items, item)
+	}
+	q.items = items
+	q.messages = 0
+}
+
+// pop waits for the next item
+func (q *Queue) pop() queueItem {
+	for {
+		q.lock.Lock()
+		if len(q.items) > 0 {
+			item := q.items[0]
+			q.items[0] = queueItem{}
+			q.items = q.items[1:]
+			if item.event == nil && !item.last {
+				q.messages--
+			}
+			q.lock.Unlock()
+			signal(q.notFull)
+			return item
+		}
+		q.lock.Unlock()
+		<-q.notEmpty
+	}
+}
+
+// run delivers the queued items until the last item
+func (q *Queue) run() {
+	for {
+		item := q.pop()
+		if item.event != nil {
+			q.deliver(func() { item.event(q.listener) })
+		} else if !item.last {
+			q.deliver(func() { q.decoder.Deliver(item.msg, q.listener) })
+			q.lock.Lock()
+			q.delivered++
+			q.lock.Unlock()
+		}
+		if item.last {
+			return
+		}
+	}
+}
+
+// deliver calls the listener, a panicking listener is logged and doesn't stop the queue
+func (q *Queue) deliver(f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			q.log.Errorf("listener panic: %v", r)
+		}
+	}()
+	f()
+}
+
+// signal wakes up a waiting goroutine without blocking
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,158 @@
+package bl3pfeed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bl3pfeed/bl3pfeedtest"
+	"github.com/resc/rescbits/money"
+	log "github.com/sirupsen/logrus"
+)
+
+func testQueue(l *testListener, o QueueOptions) *Queue {
+	return newQueue(l, tradesDecoder{}, o, log.WithField("test", "queue"))
+}
+
+func tradePrices(trades []*Trade) []money.Price {
+	prices := make([]money.Price, len(trades))
+	for i, t := range trades {
+		prices[i] = t.Price
+	}
+	return prices
+}
+
+func TestQueue_DropOldest(t *testing.T) {
+	l := newTestListener()
+	q := testQueue(l, QueueOptions{Size: 3, Overflow: OverflowDropOldest})
+	done := make(chan struct{})
+
+	q.push(testTrade(1), done)
+	q.pushEvent(func(l FeedListener) { l.FeedDisconnected(ChannelTrades, nil) }, false)
+	for p := money.Price(2); p <= 5; p++ {
+		q.push(testTrade(p), done)
+	}
+	if stats := q.Stats(); stats.Depth != 4 || stats.Dropped != 2 || stats.Size != 3 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+
+	q.start()
+	l.waitReceived(t, 3)
+	if prices := tradePrices(l.Trades()); prices[0] != 3 || prices[2] != 5 {
+		t.Fatalf("Expected the latest 3 trades, got %v", prices)
+	}
+	if len(l.disconnected) != 1 {
+		t.Fatal("Expected the event to survive the overflow")
+	}
+	q.pushEvent(func(l FeedListener) { l.FeedClosed(ChannelTrades, nil) }, true)
+	l.waitClosed(t)
+	if stats := q.Stats(); stats.Depth != 0 || stats.Delivered != 3 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestQueue_Conflate(t *testing.T) {
+	l := newTestListener()
+	q := testQueue(l, QueueOptions{Size: 2, Overflow: OverflowConflate})
+	done := make(chan struct{})
+
+	for p := money.Price(1); p <= 5; p++ {
+		q.push(testTrade(p), done)
+	}
+	// 1 and 2 fill the queue, 3 replaces them, 4 is queued and 5 replaces 3 and 4
+	if stats := q.Stats(); stats.Depth != 1 || stats.Dropped != 4 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+	q.start()
+	l.waitReceived(t, 1)
+	if prices := tradePrices(l.Trades()); len(prices) != 1 || prices[0] != 5 {
+		t.Fatalf("Expected only the latest trade, got %v", prices)
+	}
+}
+
+func TestQueue_Block(t *testing.T) {
+	l := newTestListener()
+	q := testQueue(l, QueueOptions{Size: 1, Overflow: OverflowBlock})
+	done := make(chan struct{})
+
+	if !q.push(testTrade(1), done) {
+		t.Fatal("Expected the first push to succeed")
+	}
+	pushed := make(chan bool)
+	go func() { pushed <- q.push(testTrade(2), done) }()
+	select {
+	case <-pushed:
+		t.Fatal("Expected the push to block while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	q.start()
+	if !<-pushed {
+		t.Fatal("Expected the push to succeed once the listener caught up")
+	}
+	l.waitReceived(t, 2)
+
+	// a blocked push gives up when the feed is closed
+	l.setBlock()
+	q.push(testTrade(3), done)
+	q.push(testTrade(4), done)
+	go func() { pushed <- q.push(testTrade(5), done) }()
+	close(done)
+	if <-pushed {
+		t.Fatal("Expected the push to fail after closing")
+	}
+	if stats := q.Stats(); stats.Dropped != 1 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestChannelFeed_MultipleListeners(t *testing.T) {
+	server := bl3pfeedtest.NewServer()
+	defer server.Close()
+	slow := newTestListener()
+	block := slow.setBlock()
+	fast := newTestListener()
+
+	feed, err := NewChannelFeed(server.URL, "1", "BTCEUR", ChannelTrades, slow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed.SetQueueOptions(QueueOptions{Size: 5, Overflow: OverflowDropOldest})
+	if _, err := feed.AddListener(fast, DefaultQueue); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := feed.AddListener(OrderBookFunc(func(o *OrderBook) {}), DefaultQueue); err == nil {
+		t.Fatal("Expected an error for a listener the decoder doesn't accept")
+	}
+	if err := feed.Open(nil); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := server.Accept(testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the slow listener doesn't hold up the fast one
+	const n = 50
+	for i := 0; i < n; i++ {
+		conn.Send(testTrade(money.Price(i)))
+	}
+	fast.waitReceived(t, n)
+
+	stats := feed.Stats()
+	if len(stats) != 2 || stats[0].Dropped == 0 || stats[0].Depth > 5 || stats[1].Delivered != n || stats[1].Dropped != 0 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+
+	close(block)
+	if err := feed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	slow.waitClosed(t)
+	fast.waitClosed(t)
+	if last := slow.Trades()[len(slow.Trades())-1]; last.Price != n-1 {
+		t.Fatalf("Expected the slow listener to get the latest trade, got %d", last.Price)
+	}
+	if _, err := feed.AddListener(newTestListener(), DefaultQueue); err == nil {
+		t.Fatal("Expected an error when adding a listener to a closed feed")
+	}
+}
@@ -0,0 +1,195 @@
+package bl3pfeed
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Frame is a raw websocket message with the time it was received
+	Frame struct {
+		Time    time.Time
+		Market  string
+		Channel string
+		Data    []byte
+	}
+
+	// frameMessage is the recording format of a frame, one json object per line
+	frameMessage struct {
+		Time    int64  `json:"time"`
+		Market  string `json:"market"`
+		Channel string `json:"channel"`
+		Data    string `json:"data"`
+	}
+
+	// Recorder writes the raw frames of one or more feeds to a gzip compressed file, one json object per line.
+	// It's safe to share a recorder between feeds.
+	Recorder struct {
+		lock   sync.Mutex
+		file   io.Closer
+		gz     *gzip.Writer
+		enc    *json.Encoder
+		frames int
+		closed bool
+	}
+
+	// FrameReader reads the frames of a recording
+	FrameReader struct {
+		file    io.Closer
+		gz      *gzip.Reader
+		scanner *bufio.Scanner
+	}
+)
+
+// CreateRecording creates the file and returns a recorder for it
+func CreateRecording(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRecorder(f)
+	r.file = f
+	return r, nil
+}
+
+// NewRecorder returns a recorder that writes to w, closing the recorder doesn't close w
+func NewRecorder(w io.Writer) *Recorder {
+	gz := gzip.NewWriter(w)
+	return &Recorder{
+		gz:  gz,
+		enc: json.NewEncoder(gz),
+	}
+}
+
+// Record writes the frame
+func (r *Recorder) Record(f Frame) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return errors.New("Recorder closed")
+	}
+	err := r.enc.Encode(frameMessage{
+		Time:    f.Time.UnixNano(),
+		Market:  f.Market,
+		Channel: f.Channel,
+		Data:    string(f.Data),
+	})
+	if err != nil {
+		return err
+	}
+	r.frames++
+	return nil
+}
+
+// Frames returns the number of recorded frames
+func (r *Recorder) Frames() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.frames
+}
+
+// Flush writes the buffered frames to the underlying writer
+func (r *Recorder) Flush() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil
+	}
+	return r.gz.Flush()
+}
+
+// Close completes the recording and closes the file created by CreateRecording
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return errors.New("Already closed")
+	}
+	r.closed = true
+	err := r.gz.Close()
+	if r.file != nil {
+		if closeErr := r.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// record is called by the feeds for every received message, r can be nil
+func (r *Recorder) record(market, channel string, data []byte, l *log.Entry) {
+	if r == nil {
+		return
+	}
+	if err := r.Record(Frame{Time: time.Now(), Market: market, Channel: channel, Data: data}); err != nil {
+		l.Errorf("record: %v", err)
+	}
+}
+
+// OpenRecording opens a recording created by CreateRecording
+func OpenRecording(path string) (*FrameReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fr, err := NewFrameReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	fr.file = f
+	return fr, nil
+}
+
+// NewFrameReader reads the frames of a recording from r
+func NewFrameReader(r io.Reader) (*FrameReader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(gz)
+	// order books can be large
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return &FrameReader{
+		gz:      gz,
+		scanner: scanner,
+	}, nil
+}
+
+// Next returns the next frame, or io.EOF at the end of the recording
+func (fr *FrameReader) Next() (Frame, error) {
+	if !fr.scanner.Scan() {
+		if err := fr.scanner.Err(); err != nil {
+			return Frame{}, err
+		}
+		return Frame{}, io.EOF
+	}
+	m := frameMessage{}
+	if err := json.Unmarshal(fr.scanner.Bytes(), &m); err != nil {
+		return Frame{}, err
+	}
+	return Frame{
+		Time:    time.Unix(0, m.Time),
+		Market:  m.Market,
+		Channel: m.Channel,
+		Data:    []byte(m.Data),
+	}, nil
+}
+
+// Close closes the file opened by OpenRecording
+func (fr *FrameReader) Close() error {
+	err := fr.gz.Close()
+	if fr.file != nil {
+		if closeErr := fr.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
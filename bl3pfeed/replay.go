@@ -0,0 +1,194 @@
+package bl3pfeed
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AsFastAsPossible replays the frames without waiting
+const AsFastAsPossible = 0
+
+type (
+	// Replay is a Feed that plays a recording to the listener.
+	// Frames are decoded by the decoder of their channel if it accepts the listener.
+	Replay struct {
+		close sync.Once
+
+		path    string
+		market  string
+		channel string
+		speed   float64
+
+		listener FeedListener
+		done     chan struct{}
+
+		debug    bool
+		recorder *Recorder
+		log      *log.Entry
+	}
+)
+
+var _ Feed = (*Replay)(nil)
+
+// NewReplay creates a real time replay of the recording for the listener.
+// Only the frames of the market and channel are replayed, an empty market or channel matches all.
+func NewReplay(path, market, channel string, l FeedListener) (*Replay, error) {
+	if l == nil {
+		return nil, errors.New("l FeedListener is nil")
+	}
+	if channel != "" {
+		if _, err := decoderFor(channel, l); err != nil {
+			return nil, err
+		}
+	} else if !acceptsAny(l) {
+		return nil, errors.New("l isn't accepted by any decoder")
+	}
+	return &Replay{
+		path:     path,
+		market:   market,
+		channel:  channel,
+		speed:    1,
+		listener: l,
+		done:     make(chan struct{}),
+		log: log.WithFields(log.Fields{
+			"market":  market,
+			"channel": channel,
+			"replay":  path,
+		}),
+	}, nil
+}
+
+func (r *Replay) BaseUrl() string { return "file://" + r.path }
+func (r *Replay) Version() string { return "" }
+func (r *Replay) Market() string  { return r.market }
+func (r *Replay) Channel() string { return r.channel }
+
+func (r *Replay) SetDebug(b bool) { r.debug = b }
+
+// SetBackoff is ignored, a replay doesn't reconnect
+func (r *Replay) SetBackoff(b Backoff) {}
+
+// SetRecorder records the replayed frames with their original timestamps, set it before calling Open
+func (r *Replay) SetRecorder(rec *Recorder) { r.recorder = rec }
+
+// SetSpeed sets the replay speed, 1 is real time, 10 is ten times faster and AsFastAsPossible doesn't wait.
+// Set it before calling Open.
+func (r *Replay) SetSpeed(speed float64) {
+	if speed < 0 {
+		speed = AsFastAsPossible
+	}
+	r.speed = speed
+}
+
+// Open opens the recording and starts the replay, the header is ignored.
+// FeedClosed is called at the end of the recording.
+func (r *Replay) Open(h http.Header) error {
+	frames, err := OpenRecording(r.path)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-r.done:
+		frames.Close()
+		return errors.New("Already closed")
+	default:
+	}
+	go r.run(frames)
+	return nil
+}
+
+// Close stops the replay
+func (r *Replay) Close() error {
+	closed := false
+	r.close.Do(func() {
+		close(r.done)
+		closed = true
+	})
+	if !closed {
+		return errors.New("Already closed")
+	}
+	return nil
+}
+
+func (r *Replay) run(frames *FrameReader) {
+	defer frames.Close()
+
+	var first time.Time
+	started := time.Now()
+	for {
+		f, err := frames.Next()
+		if err == io.EOF {
+			r.log.Infof("replay finished")
+			r.listener.FeedClosed(r.channel, nil)
+			return
+		}
+		if err != nil {
+			r.log.Errorf("replay: %v", err)
+			r.listener.FeedClosed(r.channel, err)
+			return
+		}
+		if (r.market != "" && f.Market != r.market) || (r.channel != "" && f.Channel != r.channel) {
+			continue
+		}
+
+		if first.IsZero() {
+			first = f.Time
+		}
+		if !r.wait(started, f.Time.Sub(first)) {
+			r.listener.FeedClosed(r.channel, nil)
+			return
+		}
+
+		if r.recorder != nil {
+			if err := r.recorder.Record(f); err != nil {
+				r.log.Errorf("record: %v", err)
+			}
+		}
+		if r.debug {
+			r.log.Infof("%s %s: %s", f.Channel, f.Time, string(f.Data))
+		} else {
+			r.deliver(f)
+		}
+	}
+}
+
+// wait sleeps until the offset in the recording is reached at the replay speed, it returns false if the replay was closed
+func (r *Replay) wait(started time.Time, offset time.Duration) bool {
+	if r.speed > AsFastAsPossible {
+		due := started.Add(time.Duration(float64(offset) / r.speed))
+		if delay := time.Until(due); delay > 0 {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-r.done:
+				return false
+			case <-timer.C:
+				return true
+			}
+		}
+	}
+	select {
+	case <-r.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// deliver decodes the frame if the decoder of its channel accepts the listener
+func (r *Replay) deliver(f Frame) {
+	d, ok := DecoderFor(f.Channel)
+	if !ok || d.Accepts(r.listener) != nil {
+		return
+	}
+	if msg, err := d.Decode(f.Data); err != nil {
+		r.log.Errorf("replay: invalid %s message: %v", f.Channel, err)
+	} else {
+		d.Deliver(msg, r.listener)
+	}
+}
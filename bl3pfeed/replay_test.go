@@ -0,0 +1,193 @@
+package bl3pfeed
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/money"
+)
+
+func tradeFrame(t *testing.T, at time.Time, price money.Price) Frame {
+	data, err := json.Marshal(&Trade{Date: at.Unix(), Marketplace: "BTCEUR", Price: 800000000 + price, Type: "buy", Amount: 1e7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Frame{Time: at, Market: "BTCEUR", Channel: ChannelTrades, Data: data}
+}
+
+func writeRecording(t *testing.T, frames ...Frame) string {
+	dir, err := ioutil.TempDir("", "bl3pfeed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "session.jsonl.gz")
+	r, err := CreateRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range frames {
+		if err := r.Record(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRecorder_RoundTrip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	r := NewRecorder(buf)
+	start := time.Date(2018, 1, 1, 12, 0, 0, 123456789, time.UTC)
+	frames := []Frame{
+		tradeFrame(t, start, 1),
+		{Time: start.Add(time.Second), Market: "BTCEUR", Channel: ChannelOrderBook, Data: []byte(`{"marketplace":"BTCEUR","asks":[],"bids":[]}`)},
+		{Time: start.Add(2 * time.Second), Market: "BTCEUR", Channel: ChannelTrades, Data: []byte("not json \x00")},
+	}
+	for _, f := range frames {
+		if err := r.Record(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err == nil {
+		t.Error("Expected an error when closing twice")
+	}
+	if err := r.Record(frames[0]); err == nil {
+		t.Error("Expected an error when recording after close")
+	}
+
+	fr, err := NewFrameReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Close()
+	for i := range frames {
+		f, err := fr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !f.Time.Equal(frames[i].Time) || f.Market != frames[i].Market || f.Channel != frames[i].Channel || !bytes.Equal(f.Data, frames[i].Data) {
+			t.Errorf("Frame %d: expected %+v, got %+v", i, frames[i], f)
+		}
+	}
+	if _, err := fr.Next(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+}
+
+func TestReplay_AsFastAsPossible(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	path := writeRecording(t,
+		tradeFrame(t, start, 1),
+		Frame{Time: start.Add(time.Minute), Market: "BTCEUR", Channel: ChannelTrades, Data: []byte("{broken")},
+		Frame{Time: start.Add(2 * time.Minute), Market: "BTCEUR", Channel: ChannelOrderBook, Data: []byte(`{"marketplace":"BTCEUR","asks":[{"price_int":1,"amount_int":2}],"bids":[]}`)},
+		tradeFrame(t, start.Add(time.Hour), 2),
+		Frame{Time: start.Add(time.Hour), Market: "LTCEUR", Channel: ChannelTrades, Data: []byte(`{}`)},
+	)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	l := newTestListener()
+	replay, err := NewReplay(path, "BTCEUR", "", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay.SetSpeed(AsFastAsPossible)
+	if err := replay.Open(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.waitClosed(t); err != nil {
+		t.Fatalf("Expected a clean end of the replay, got %v", err)
+	}
+
+	if len(l.trades) != 2 || l.trades[0].Price != 800000001 || l.trades[1].Price != 800000002 {
+		t.Fatalf("Unexpected trades %+v", l.trades)
+	}
+	if len(l.orderBooks) != 1 || len(l.orderBooks[0].Asks) != 1 || l.orderBooks[0].Asks[0].Amount != 2 {
+		t.Fatalf("Unexpected order books %+v", l.orderBooks)
+	}
+}
+
+func TestReplay_Speed(t *testing.T) {
+	start := time.Now()
+	path := writeRecording(t,
+		tradeFrame(t, start, 1),
+		tradeFrame(t, start.Add(500*time.Millisecond), 2),
+	)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	l := newTestListener()
+	replay, err := NewReplay(path, "", ChannelTrades, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay.SetSpeed(10)
+	started := time.Now()
+	if err := replay.Open(nil); err != nil {
+		t.Fatal(err)
+	}
+	l.waitClosed(t)
+	if elapsed := time.Since(started); elapsed < 40*time.Millisecond || elapsed > 400*time.Millisecond {
+		t.Fatalf("Expected the replay to take about 50ms at 10x, took %v", elapsed)
+	}
+	if len(l.trades) != 2 {
+		t.Fatalf("Expected 2 trades, got %d", len(l.trades))
+	}
+}
+
+func TestReplay_Close(t *testing.T) {
+	start := time.Now()
+	path := writeRecording(t,
+		tradeFrame(t, start, 1),
+		tradeFrame(t, start.Add(time.Hour), 2),
+	)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	l := newTestListener()
+	replay, err := NewReplay(path, "", ChannelTrades, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replay.Open(nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := replay.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.waitClosed(t); err != nil {
+		t.Fatalf("Expected a clean close, got %v", err)
+	}
+	if err := replay.Close(); err == nil {
+		t.Error("Expected an error when closing twice")
+	}
+	if len(l.trades) != 1 {
+		t.Fatalf("Expected only the first trade, got %d", len(l.trades))
+	}
+}
+
+func TestNewReplay_Listener(t *testing.T) {
+	if _, err := NewReplay("x", "", ChannelTrades, nil); err == nil {
+		t.Error("Expected an error without a listener")
+	}
+	bookListener, _ := NewBookListener(&nopBookListener{})
+	if _, err := NewReplay("x", "", ChannelTrades, bookListener); err == nil {
+		t.Error("Expected an error for an order book listener on the trades channel")
+	}
+	if _, err := NewReplay("does-not-exist", "", ChannelOrderBook, bookListener); err != nil {
+		t.Error(err)
+	}
+}
+
+type nopBookListener struct{ testListener }
+
+func (l *nopBookListener) OnBookChanged(b *Book, diff *BookDiff) {}
@@ -0,0 +1,187 @@
+package bl3pfeed
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrStreamClosed is the final error of a stream that was closed with Close
+var ErrStreamClosed = errors.New("stream closed")
+
+type (
+	// stream ends a feed when the context is done or the stream is closed, and keeps the final error
+	stream struct {
+		feed Feed
+		end  sync.Once
+		done chan struct{}
+
+		lock sync.Mutex
+		err  error
+	}
+
+	// TradeStream streams the trades of a feed over a channel, see StreamTrades
+	TradeStream struct {
+		*stream
+		trades chan Trade
+	}
+
+	// OrderBookStream streams the order books of a feed over a channel, see StreamOrderBooks
+	OrderBookStream struct {
+		*stream
+		orderBooks chan OrderBook
+	}
+)
+
+var (
+	_ TradesFeedListener    = (*TradeStream)(nil)
+	_ OrderBookFeedListener = (*OrderBookStream)(nil)
+)
+
+// StreamTrades connects to the trades channel of the market and streams the trades until ctx is done or the stream is closed
+func StreamTrades(ctx context.Context, baseUrl, version, market string) (*TradeStream, error) {
+	s := &TradeStream{stream: newStream(), trades: make(chan Trade)}
+	feed, err := NewTrades(baseUrl, version, market, s)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.open(ctx, feed); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// StreamOrderBooks connects to the orderbook channel of the market and streams the order books until ctx is done or the stream is closed
+func StreamOrderBooks(ctx context.Context, baseUrl, version, market string) (*OrderBookStream, error) {
+	s := &OrderBookStream{stream: newStream(), orderBooks: make(chan OrderBook)}
+	feed, err := NewOrderBook(baseUrl, version, market, s)
+	if err != nil {
+		return nil, err
+	}
+	// a stream reader only needs the latest book
+	feed.SetQueueOptions(QueueOptions{Size: 1, Overflow: OverflowConflate})
+	if err := s.open(ctx, feed); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newStream() *stream {
+	return &stream{done: make(chan struct{})}
+}
+
+// open opens the feed and ends the stream when ctx is done
+func (s *stream) open(ctx context.Context, feed Feed) error {
+	s.feed = feed
+	if err := feed.Open(nil); err != nil {
+		return err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.stop(ctx.Err())
+		case <-s.done:
+		}
+	}()
+	return nil
+}
+
+// stop ends the stream with the final error and closes the feed, it returns false if the stream already ended
+func (s *stream) stop(err error) bool {
+	stopped := false
+	s.end.Do(func() {
+		s.lock.Lock()
+		s.err = err
+		s.lock.Unlock()
+		close(s.done)
+		stopped = true
+		s.feed.Close()
+	})
+	return stopped
+}
+
+// Feed returns the feed of the stream
+func (s *stream) Feed() Feed { return s.feed }
+
+// Err returns the final error of the stream, it's nil until the stream ends.
+// It's the context error, ErrStreamClosed or the error the feed closed with.
+func (s *stream) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+// Close ends the stream with ErrStreamClosed
+func (s *stream) Close() error {
+	if !s.stop(ErrStreamClosed) {
+		return errors.New("Already closed")
+	}
+	return nil
+}
+
+// closed ends the stream when the feed closes by itself
+func (s *stream) closed(err error) {
+	if err == nil {
+		err = ErrStreamClosed
+	}
+	s.stop(err)
+}
+
+func (s *stream) FeedDisconnected(channel string, err error)   {}
+func (s *stream) FeedReconnected(channel string, attempts int) {}
+
+// Trades returns the trades, the channel is closed when the stream ends
+func (s *TradeStream) Trades() <-chan Trade { return s.trades }
+
+// Next waits for the next trade, it returns the final error when the stream has ended or ctx.Err() when ctx is done first
+func (s *TradeStream) Next(ctx context.Context) (Trade, error) {
+	select {
+	case t, ok := <-s.trades:
+		if !ok {
+			return Trade{}, s.Err()
+		}
+		return t, nil
+	case <-ctx.Done():
+		return Trade{}, ctx.Err()
+	}
+}
+
+func (s *TradeStream) OnTrade(t *Trade) {
+	select {
+	case s.trades <- *t:
+	case <-s.done:
+	}
+}
+
+func (s *TradeStream) FeedClosed(channel string, err error) {
+	s.closed(err)
+	close(s.trades)
+}
+
+// OrderBooks returns the order books, the channel is closed when the stream ends
+func (s *OrderBookStream) OrderBooks() <-chan OrderBook { return s.orderBooks }
+
+// Next waits for the next order book, it returns the final error when the stream has ended or ctx.Err() when ctx is done first
+func (s *OrderBookStream) Next(ctx context.Context) (OrderBook, error) {
+	select {
+	case o, ok := <-s.orderBooks:
+		if !ok {
+			return OrderBook{}, s.Err()
+		}
+		return o, nil
+	case <-ctx.Done():
+		return OrderBook{}, ctx.Err()
+	}
+}
+
+func (s *OrderBookStream) OnOrderBookChanged(o *OrderBook) {
+	select {
+	case s.orderBooks <- *o:
+	case <-s.done:
+	}
+}
+
+func (s *OrderBookStream) FeedClosed(channel string, err error) {
+	s.closed(err)
+	close(s.orderBooks)
+}
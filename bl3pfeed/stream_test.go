@@ -0,0 +1,113 @@
+package bl3pfeed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bl3pfeed/bl3pfeedtest"
+	"github.com/resc/rescbits/money"
+)
+
+func TestTradeStream_Next(t *testing.T) {
+	server := bl3pfeedtest.NewServer()
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := StreamTrades(ctx, server.URL, "1", "BTCEUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := server.Accept(testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Send(testTrade(8000 * money.Euro))
+	conn.SendRaw([]byte("{"))
+	conn.Send(testTrade(8100 * money.Euro))
+
+	next, stop := context.WithTimeout(context.Background(), testTimeout)
+	defer stop()
+	for _, expected := range []money.Price{8000 * money.Euro, 8100 * money.Euro} {
+		trade, err := s.Next(next)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trade.Price != expected {
+			t.Fatalf("Expected %s, got %s", expected, trade.Price)
+		}
+	}
+
+	// a done context of Next doesn't end the stream
+	short, stopShort := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer stopShort()
+	if _, err := s.Next(short); err != context.DeadlineExceeded {
+		t.Fatalf("Expected a deadline error, got %v", err)
+	}
+	if s.Err() != nil {
+		t.Fatalf("Expected the stream to continue, got %v", s.Err())
+	}
+
+	cancel()
+	if _, err := s.Next(next); err != context.Canceled {
+		t.Fatalf("Expected the stream to end with context.Canceled, got %v", err)
+	}
+	if _, ok := <-s.Trades(); ok {
+		t.Fatal("Expected the trades channel to be closed")
+	}
+	if !conn.WaitDone(testTimeout) {
+		t.Fatal("Expected the connection to be closed")
+	}
+	if err := s.Close(); err == nil {
+		t.Fatal("Expected an error when closing an ended stream")
+	}
+}
+
+func TestOrderBookStream_Close(t *testing.T) {
+	server := bl3pfeedtest.NewServer()
+	defer server.Close()
+
+	s, err := StreamOrderBooks(context.Background(), server.URL, "1", "BTCEUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := server.Accept(testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Send(&OrderBook{Market: "BTCEUR", Asks: []*Order{{Price: 8000 * money.Euro, Amount: money.Bitcoin}}})
+
+	select {
+	case o := <-s.OrderBooks():
+		if o.Market != "BTCEUR" || len(o.Asks) != 1 {
+			t.Fatalf("Unexpected order book %+v", o)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timeout waiting for the order book")
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err == nil {
+		t.Fatal("Expected an error when closing twice")
+	}
+	for range s.OrderBooks() {
+	}
+	if s.Err() != ErrStreamClosed {
+		t.Fatalf("Expected ErrStreamClosed, got %v", s.Err())
+	}
+	if _, err := s.Next(context.Background()); err != ErrStreamClosed {
+		t.Fatalf("Expected Next to return ErrStreamClosed, got %v", err)
+	}
+}
+
+func TestStreamTrades_OpenError(t *testing.T) {
+	server := bl3pfeedtest.NewServer()
+	defer server.Close()
+	server.Reject(1)
+	if _, err := StreamTrades(context.Background(), server.URL, "1", "BTCEUR"); err == nil {
+		t.Fatal("Expected an error when the server rejects the connection")
+	}
+}
@@ -0,0 +1,186 @@
+package candles
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+)
+
+type (
+	// Builder aggregates a stream of trades or samples into candles.
+	//
+	// A candle stays open for late trades until a trade or Advance moves the clock past
+	// the end of the candle plus the lateness. Then it is passed to the callback, preceded by
+	// empty candles for intervals without trades. Trades for candles that are already closed are dropped.
+	// The callback is called outside the lock, add trades from a single goroutine to get the candles in order.
+	Builder struct {
+		interval time.Duration
+		lateness time.Duration
+		onCandle func(Candle)
+
+		lock      sync.Mutex
+		open      map[int64]*Candle
+		watermark time.Time
+		last      *Candle
+		late      int
+	}
+)
+
+// UntilFlush is the lateness for batches, candles are only closed by Flush
+const UntilFlush = time.Duration(1<<63 - 1)
+
+// NewBuilder creates a builder for candles of the given interval, onCandle is called for every closed candle
+func NewBuilder(interval time.Duration, lateness time.Duration, onCandle func(Candle)) (*Builder, error) {
+	if interval <= 0 {
+		return nil, errors.New("interval should be positive")
+	}
+	if lateness < 0 {
+		return nil, errors.New("lateness should not be negative")
+	}
+	if onCandle == nil {
+		return nil, errors.New("onCandle func is nil")
+	}
+	return &Builder{
+		interval: interval,
+		lateness: lateness,
+		onCandle: onCandle,
+		open:     make(map[int64]*Candle),
+	}, nil
+}
+
+// Interval returns the candle interval
+func (b *Builder) Interval() time.Duration {
+	return b.interval
+}
+
+// AddTrade adds a trade from the bl3p feed, it returns false if the trade was too late
+func (b *Builder) AddTrade(t *bl3pfeed.Trade) bool {
+	return b.Add(time.Unix(t.Date, 0), t.Price, t.Amount)
+}
+
+// AddSample adds a price sample without volume, it returns false if the sample was too late
+func (b *Builder) AddSample(timestamp time.Time, price money.Price) bool {
+	return b.Add(timestamp, price, 0)
+}
+
+// Add adds a trade or sample, it returns false if its candle was already closed
+func (b *Builder) Add(timestamp time.Time, price money.Price, volume money.Amount) bool {
+	closed, ok := func() ([]Candle, bool) {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+
+		start := Truncate(timestamp, b.interval)
+		if b.last != nil && !start.After(b.last.Start) {
+			b.late++
+			return nil, false
+		}
+
+		c, ok := b.open[start.UnixNano()]
+		if !ok {
+			c = &Candle{Start: start, Interval: b.interval}
+			b.open[start.UnixNano()] = c
+		}
+		c.add(timestamp, price, volume)
+
+		return b.advance(timestamp), true
+	}()
+	b.emit(closed)
+	return ok
+}
+
+// Advance moves the clock to now and closes the candles that can no longer receive trades
+func (b *Builder) Advance(now time.Time) {
+	b.lock.Lock()
+	closed := b.advance(now)
+	b.lock.Unlock()
+	b.emit(closed)
+}
+
+// Flush closes all open candles
+func (b *Builder) Flush() {
+	b.lock.Lock()
+	closed := b.closeWhere(func(c *Candle) bool { return true })
+	b.lock.Unlock()
+	b.emit(closed)
+}
+
+// Late returns the number of trades that were dropped because their candle was already closed
+func (b *Builder) Late() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.late
+}
+
+// Open returns a copy of the candles that are still open, oldest first
+func (b *Builder) Open() []Candle {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	cc := make([]Candle, 0, len(b.open))
+	for _, c := range b.open {
+		cc = append(cc, *c)
+	}
+	sortCandles(cc)
+	return cc
+}
+
+// advance moves the watermark and returns the closed candles, the caller must hold the lock
+func (b *Builder) advance(now time.Time) []Candle {
+	if now.After(b.watermark) {
+		b.watermark = now
+	}
+	if b.lateness == UntilFlush {
+		return nil
+	}
+	return b.closeWhere(func(c *Candle) bool {
+		return !c.End().Add(b.lateness).After(b.watermark)
+	})
+}
+
+// closeWhere closes the matching candles and returns them with the empty candles before them, oldest first.
+// The caller must hold the lock.
+func (b *Builder) closeWhere(match func(c *Candle) bool) []Candle {
+	cc := make([]Candle, 0)
+	for key, c := range b.open {
+		if match(c) {
+			cc = append(cc, *c)
+			delete(b.open, key)
+		}
+	}
+	if len(cc) == 0 {
+		return nil
+	}
+	sortCandles(cc)
+
+	if b.last != nil {
+		cc = append([]Candle{*b.last}, cc...)
+		cc = FillGaps(cc, b.interval)[1:]
+	} else {
+		cc = FillGaps(cc, b.interval)
+	}
+	last := cc[len(cc)-1]
+	b.last = &last
+	return cc
+}
+
+func (b *Builder) emit(cc []Candle) {
+	for i := range cc {
+		b.onCandle(cc[i])
+	}
+}
+
+// FromTrades aggregates the trades into candles, including empty candles for intervals without trades
+func FromTrades(trades []*bl3pfeed.Trade, interval time.Duration) ([]Candle, error) {
+	cc := make([]Candle, 0)
+	b, err := NewBuilder(interval, UntilFlush, func(c Candle) { cc = append(cc, c) })
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range trades {
+		b.AddTrade(t)
+	}
+	b.Flush()
+	return cc, nil
+}
@@ -0,0 +1,128 @@
+// Package candles aggregates trades and price samples into open/high/low/close/volume bars.
+package candles
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/resc/rescbits/money"
+)
+
+type (
+	// Candle is an OHLCV bar for the interval starting at Start
+	Candle struct {
+		Start    time.Time
+		Interval time.Duration
+		Open     money.Price
+		High     money.Price
+		Low      money.Price
+		Close    money.Price
+		Volume   money.Amount
+		// Count is the number of trades or samples in the candle, it's zero for empty intervals
+		Count int
+
+		// the timestamps of the open and close price, to handle trades that arrive out of order
+		openTime  time.Time
+		closeTime time.Time
+	}
+)
+
+var (
+	intervals = map[string]time.Duration{
+		"1m":  time.Minute,
+		"5m":  5 * time.Minute,
+		"15m": 15 * time.Minute,
+		"1h":  time.Hour,
+		"4h":  4 * time.Hour,
+		"1d":  24 * time.Hour,
+	}
+)
+
+// ParseInterval parses an interval like 1m, 5m, 15m, 1h, 4h or 1d
+func ParseInterval(s string) (time.Duration, error) {
+	if d, ok := intervals[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid interval '%s', expected one of 1m, 5m, 15m, 1h, 4h or 1d", s)
+}
+
+// FormatInterval formats an interval like 5m or 1d
+func FormatInterval(d time.Duration) string {
+	for name, interval := range intervals {
+		if interval == d {
+			return name
+		}
+	}
+	return d.String()
+}
+
+// Truncate returns the start of the interval that contains t, intervals are aligned to the unix epoch in UTC
+func Truncate(t time.Time, interval time.Duration) time.Time {
+	return t.UTC().Truncate(interval)
+}
+
+// End returns the end of the candle, exclusive
+func (c *Candle) End() time.Time {
+	return c.Start.Add(c.Interval)
+}
+
+// IsEmpty returns true if there were no trades or samples in the interval
+func (c *Candle) IsEmpty() bool {
+	return c.Count == 0
+}
+
+// add updates the candle with a trade or sample
+func (c *Candle) add(t time.Time, price money.Price, volume money.Amount) {
+	if c.Count == 0 {
+		c.Open, c.High, c.Low, c.Close = price, price, price, price
+		c.openTime, c.closeTime = t, t
+	} else {
+		if t.Before(c.openTime) {
+			c.Open, c.openTime = price, t
+		}
+		if !t.Before(c.closeTime) {
+			c.Close, c.closeTime = price, t
+		}
+		c.High = c.High.Max(price)
+		c.Low = c.Low.Min(price)
+	}
+	c.Volume += volume
+	c.Count++
+}
+
+// FillGaps returns the candles with empty candles inserted for intervals without data.
+// Empty candles have the close price of the previous candle for open, high, low and close.
+// The candles must be sorted by start time and have the same interval.
+func FillGaps(cc []Candle, interval time.Duration) []Candle {
+	if len(cc) == 0 {
+		return cc
+	}
+	result := make([]Candle, 0, len(cc))
+	for i := range cc {
+		if i > 0 {
+			previous := result[len(result)-1]
+			for start := previous.End(); start.Before(cc[i].Start); start = start.Add(interval) {
+				result = append(result, empty(start, interval, previous.Close))
+			}
+		}
+		result = append(result, cc[i])
+	}
+	return result
+}
+
+func empty(start time.Time, interval time.Duration, price money.Price) Candle {
+	return Candle{
+		Start:    start,
+		Interval: interval,
+		Open:     price,
+		High:     price,
+		Low:      price,
+		Close:    price,
+	}
+}
+
+func sortCandles(cc []Candle) {
+	sort.Slice(cc, func(i, j int) bool { return cc[i].Start.Before(cc[j].Start) })
+}
@@ -0,0 +1,103 @@
+package candles
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+)
+
+var t0 = time.Date(2018, 1, 28, 12, 0, 0, 0, time.UTC)
+
+func trade(offset time.Duration, price money.Price, amount money.Amount) *bl3pfeed.Trade {
+	return &bl3pfeed.Trade{
+		Date:   t0.Add(offset).Unix(),
+		Price:  price,
+		Amount: amount,
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	for s, expected := range map[string]time.Duration{"1m": time.Minute, "5m": 5 * time.Minute, "1H": time.Hour, "1d": 24 * time.Hour} {
+		if d, err := ParseInterval(s); err != nil || d != expected {
+			t.Fatalf("%s: expected %v, got %v (%v)", s, expected, d, err)
+		}
+	}
+	if _, err := ParseInterval("2w"); err == nil {
+		t.Fatal("expected an error for an unsupported interval")
+	}
+}
+
+func TestFromTrades(t *testing.T) {
+	trades := []*bl3pfeed.Trade{
+		trade(10*time.Second, 100, 1),
+		trade(20*time.Second, 120, 2),
+		trade(5*time.Second, 90, 3), // out of order, but the earliest trade opens the candle
+		trade(50*time.Second, 110, 4),
+		trade(3*time.Minute+time.Second, 130, 5),
+	}
+
+	cc, err := FromTrades(trades, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cc) != 4 {
+		t.Fatalf("expected 4 candles, got %d", len(cc))
+	}
+
+	c := cc[0]
+	if !c.Start.Equal(t0) || c.Open != 90 || c.High != 120 || c.Low != 90 || c.Close != 110 || c.Volume != 10 || c.Count != 4 {
+		t.Fatalf("unexpected first candle %+v", c)
+	}
+
+	for _, c := range cc[1:3] {
+		if !c.IsEmpty() || c.Open != 110 || c.Close != 110 || c.Volume != 0 {
+			t.Fatalf("expected an empty candle at the previous close, got %+v", c)
+		}
+	}
+
+	if c := cc[3]; !c.Start.Equal(t0.Add(3*time.Minute)) || c.Open != 130 || c.Count != 1 {
+		t.Fatalf("unexpected last candle %+v", c)
+	}
+}
+
+func TestBuilder_Lateness(t *testing.T) {
+	cc := make([]Candle, 0)
+	b, err := NewBuilder(time.Minute, 10*time.Second, func(c Candle) { cc = append(cc, c) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.AddTrade(trade(30*time.Second, 100, 1))
+	b.AddTrade(trade(65*time.Second, 101, 1))
+	if len(cc) != 0 {
+		t.Fatal("the first candle should still accept late trades")
+	}
+
+	// a late trade within the lateness still counts
+	if !b.AddTrade(trade(59*time.Second, 99, 1)) {
+		t.Fatal("expected the late trade to be accepted")
+	}
+
+	b.AddTrade(trade(71*time.Second, 102, 1))
+	if len(cc) != 1 || cc[0].Close != 99 || cc[0].Volume != 2 {
+		t.Fatalf("expected the first candle to be closed with the late trade, got %+v", cc)
+	}
+
+	// too late, the candle is closed
+	if b.AddTrade(trade(40*time.Second, 98, 1)) {
+		t.Fatal("expected the trade to be rejected")
+	}
+	if b.Late() != 1 {
+		t.Fatalf("expected 1 late trade, got %d", b.Late())
+	}
+
+	b.Advance(t0.Add(5 * time.Minute))
+	if len(cc) != 2 || cc[1].Volume != 2 || cc[1].Close != 102 {
+		t.Fatalf("expected the second candle to be closed by advancing the clock, got %+v", cc)
+	}
+	if len(b.Open()) != 0 {
+		t.Fatal("expected no open candles")
+	}
+}
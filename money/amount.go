@@ -0,0 +1,137 @@
+package money
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+// Amount is a fixed-point BTC amount with 8 decimals, like the BL3P amount_int.
+type Amount int64
+
+const (
+	// AmountDecimals is the number of decimals of an Amount
+	AmountDecimals = 8
+	// Bitcoin is one BTC
+	Bitcoin Amount = 1e8
+	// Satoshi is the smallest BTC unit
+	Satoshi Amount = 1
+)
+
+var (
+	_ sql.Scanner   = (*Amount)(nil)
+	_ driver.Valuer = Amount(0)
+)
+
+// ParseAmount parses a decimal BTC amount like 0.015, it fails if the amount has more than 8 decimals
+func ParseAmount(s string) (Amount, error) {
+	v, err := parseFixed(s, AmountDecimals, roundExact)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount '%s': %v", s, err)
+	}
+	return Amount(v), nil
+}
+
+// ParseAmountRounded parses a decimal BTC amount like 0.015, excess decimals are rounded with mode
+func ParseAmountRounded(s string, mode RoundingMode) (Amount, error) {
+	v, err := parseFixed(s, AmountDecimals, mode)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount '%s': %v", s, err)
+	}
+	return Amount(v), nil
+}
+
+// AmountFromFloat converts a float BTC amount, use this only at the edges for apis that use floats.
+// It fails for NaN, infinities and values out of range.
+func AmountFromFloat(f float64, mode RoundingMode) (Amount, error) {
+	v, err := floatToFixed(f, AmountDecimals, mode)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %g: %v", f, err)
+	}
+	return Amount(v), nil
+}
+
+func (a Amount) Add(b Amount) Amount { return a + b }
+func (a Amount) Sub(b Amount) Amount { return a - b }
+func (a Amount) Neg() Amount         { return -a }
+func (a Amount) Sign() int           { return sign(int64(a)) }
+func (a Amount) IsZero() bool        { return a == 0 }
+
+// Abs returns the absolute value
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// Mul multiplies the amount by n
+func (a Amount) Mul(n int64) Amount { return a * Amount(n) }
+
+// MulDiv returns a * num / den rounded with mode
+func (a Amount) MulDiv(num, den int64, mode RoundingMode) Amount {
+	return Amount(mulDiv(int64(a), num, den, mode))
+}
+
+// Min returns the smallest of a and b
+func (a Amount) Min(b Amount) Amount {
+	if b < a {
+		return b
+	}
+	return a
+}
+
+// Max returns the largest of a and b
+func (a Amount) Max(b Amount) Amount {
+	if b > a {
+		return b
+	}
+	return a
+}
+
+// Float64 returns the amount in BTC as a float, for display and statistics only
+func (a Amount) Float64() float64 {
+	return float64(a) / float64(Bitcoin)
+}
+
+// String formats the amount with all 8 decimals
+func (a Amount) String() string {
+	return formatFixed(int64(a), AmountDecimals)
+}
+
+// StringFixed formats the amount with the given number of decimals, rounding halves away from zero
+func (a Amount) StringFixed(decimals int) string {
+	return roundFixed(int64(a), AmountDecimals, decimals, RoundHalfUp)
+}
+
+// MarshalJSON writes the amount as a json number in BTC
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON reads a json number or string in BTC, excess decimals are rounded half to even
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	v, ok, err := unmarshalFixed(data, AmountDecimals)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s: %v", string(data), err)
+	}
+	if ok {
+		*a = Amount(v)
+	}
+	return nil
+}
+
+// Value stores the amount as an integer in 1e8 BTC
+func (a Amount) Value() (driver.Value, error) {
+	return int64(a), nil
+}
+
+// Scan reads an amount stored as an integer in 1e8 BTC
+func (a *Amount) Scan(src interface{}) error {
+	v, err := scanFixed(src)
+	if err != nil {
+		return fmt.Errorf("cannot scan amount: %v", err)
+	}
+	*a = Amount(v)
+	return nil
+}
@@ -0,0 +1,275 @@
+// Package money contains the fixed-point Price (EUR 1e5) and Amount (BTC 1e8) types
+// shared by the bl3p feed, the bitonic api and the datastore.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// RoundingMode determines how a value that can't be represented exactly is rounded
+type RoundingMode int
+
+const (
+	// RoundDown rounds towards zero
+	RoundDown RoundingMode = iota
+	// RoundUp rounds away from zero
+	RoundUp
+	// RoundFloor rounds towards negative infinity
+	RoundFloor
+	// RoundCeiling rounds towards positive infinity
+	RoundCeiling
+	// RoundHalfUp rounds to the nearest value, halves are rounded away from zero
+	RoundHalfUp
+	// RoundHalfEven rounds to the nearest value, halves are rounded to the even neighbour
+	RoundHalfEven
+
+	// roundExact is used internally for parsing, it fails instead of rounding
+	roundExact RoundingMode = -1
+)
+
+var (
+	// ErrPrecision is returned when a value has more decimals than the type can represent exactly
+	ErrPrecision = errors.New("too many decimals")
+	// ErrOverflow is returned when a value doesn't fit in the fixed-point type
+	ErrOverflow = errors.New("value out of range")
+)
+
+func (m RoundingMode) String() string {
+	switch m {
+	case RoundDown:
+		return "down"
+	case RoundUp:
+		return "up"
+	case RoundFloor:
+		return "floor"
+	case RoundCeiling:
+		return "ceiling"
+	case RoundHalfUp:
+		return "half-up"
+	case RoundHalfEven:
+		return "half-even"
+	default:
+		return "unknown"
+	}
+}
+
+// mulDiv returns a * b / c rounded with mode, without overflowing the intermediate product.
+// It panics when c is zero, like integer division.
+func mulDiv(a, b, c int64, mode RoundingMode) int64 {
+	if c == 0 {
+		panic("money: division by zero")
+	}
+	n := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+	d := big.NewInt(c)
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if r.Sign() != 0 {
+		// negative when the exact result is negative
+		sign := n.Sign() * d.Sign()
+		// compare 2*|r| with |d| to find out if we're below, at or above the half
+		twiceR := new(big.Int).Abs(r)
+		twiceR.Lsh(twiceR, 1)
+		half := twiceR.Cmp(new(big.Int).Abs(d))
+		if roundAway(mode, sign, half, q.Bit(0) == 1) {
+			q.Add(q, big.NewInt(int64(sign)))
+		}
+	}
+	if !q.IsInt64() {
+		panic(ErrOverflow)
+	}
+	return q.Int64()
+}
+
+// roundAway decides if a truncated result should be moved one unit away from zero.
+// sign is the sign of the exact result, half compares the discarded part with one half
+// and odd tells if the truncated result is odd.
+func roundAway(mode RoundingMode, sign int, half int, odd bool) bool {
+	switch mode {
+	case RoundDown:
+		return false
+	case RoundUp:
+		return true
+	case RoundFloor:
+		return sign < 0
+	case RoundCeiling:
+		return sign > 0
+	case RoundHalfUp:
+		return half >= 0
+	case RoundHalfEven:
+		return half > 0 || (half == 0 && odd)
+	default:
+		return false
+	}
+}
+
+// parseFixed parses a decimal number like -123.456 or 1.5e-3 into an integer with the given number of decimals.
+func parseFixed(s string, decimals int, mode RoundingMode) (int64, error) {
+	input := s
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("invalid number '%s'", input)
+	}
+
+	negative := false
+	if s[0] == '-' || s[0] == '+' {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	// split off the exponent
+	exponent := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return 0, fmt.Errorf("invalid number '%s'", input)
+		}
+		exponent = e
+		s = s[:i]
+	}
+
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if intPart == "" && fracPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, fmt.Errorf("invalid number '%s'", input)
+	}
+
+	digits := strings.TrimLeft(intPart+fracPart, "0")
+	if digits == "" {
+		return 0, nil
+	}
+
+	// larger exponents overflow and smaller ones leave less than one unit, which rounds the same for every
+	// smaller exponent, so limit the exponent before padding the digits with zeros
+	limit := len(intPart+fracPart) + decimals + 20
+	if exponent > limit {
+		return 0, ErrOverflow
+	}
+	if exponent < -limit {
+		exponent = -limit
+	}
+
+	// shift the decimal point so that digits[:point] is the scaled integer part
+	point := len(intPart) + exponent + decimals - (len(intPart+fracPart) - len(digits))
+	if point > 19 {
+		return 0, ErrOverflow
+	}
+	for point > len(digits) {
+		digits += "0"
+	}
+	if point < 0 {
+		digits = strings.Repeat("0", -point) + digits
+		point = 0
+	}
+
+	kept, discarded := digits[:point], strings.TrimRight(digits[point:], "0")
+	value := uint64(0)
+	if kept != "" {
+		v, err := strconv.ParseUint(kept, 10, 64)
+		if err != nil || v > math.MaxInt64 {
+			return 0, ErrOverflow
+		}
+		value = v
+	}
+
+	if discarded != "" {
+		if mode == roundExact {
+			return 0, ErrPrecision
+		}
+		half := -1
+		if discarded[0] > '5' || discarded[0] == '5' && len(discarded) > 1 {
+			half = 1
+		} else if discarded == "5" {
+			half = 0
+		}
+		sign := 1
+		if negative {
+			sign = -1
+		}
+		if roundAway(mode, sign, half, value%2 == 1) {
+			if value == math.MaxInt64 {
+				return 0, ErrOverflow
+			}
+			value++
+		}
+	}
+
+	if negative {
+		return -int64(value), nil
+	}
+	return int64(value), nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// formatFixed formats v as a decimal number with the given number of decimals
+func formatFixed(v int64, decimals int) string {
+	sign := ""
+	abs := uint64(v)
+	if v < 0 {
+		sign = "-"
+		abs = uint64(-v)
+	}
+	digits := strconv.FormatUint(abs, 10)
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	if decimals == 0 {
+		return sign + digits
+	}
+	point := len(digits) - decimals
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// roundFixed rounds v with the given number of decimals to at most places decimals and formats it
+func roundFixed(v int64, decimals int, places int, mode RoundingMode) string {
+	if places < 0 {
+		places = 0
+	}
+	if places >= decimals {
+		return formatFixed(v, decimals) + strings.Repeat("0", places-decimals)
+	}
+	unit := int64(math.Pow10(decimals - places))
+	return formatFixed(mulDiv(v, 1, unit, mode), places)
+}
+
+// unmarshalFixed parses a json number, a quoted decimal string or null
+func unmarshalFixed(data []byte, decimals int) (int64, bool, error) {
+	s := string(data)
+	if s == "null" {
+		return 0, false, nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	v, err := parseFixed(s, decimals, RoundHalfEven)
+	return v, true, err
+}
+
+// scanFixed converts a database value holding the integer representation
+func scanFixed(src interface{}) (int64, error) {
+	switch v := src.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return v, nil
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	default:
+		return 0, fmt.Errorf("unsupported type %T", src)
+	}
+}
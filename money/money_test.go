@@ -0,0 +1,175 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	cases := map[string]Price{
+		"0":            0,
+		"1":            Euro,
+		"1234.56":      123456000,
+		"-0.00001":     -1,
+		".5":           50000,
+		"5.":           500000,
+		"+7.25":        725000,
+		"1.5e3":        1500 * Euro,
+		"12345e-5":     12345,
+		" 0.10000 ":    10000,
+		"0e999999":     0,
+		"-0.0e-99":     0,
+		"0.0e99999999": 0,
+	}
+	for s, expected := range cases {
+		if p, err := ParsePrice(s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		} else if p != expected {
+			t.Fatalf("%s: expected %d, got %d", s, expected, p)
+		}
+	}
+
+	for _, s := range []string{"", ".", "-", "1,5", "abc", "1.2.3", "1.000001", "99999999999999999999", "1e999999", "1e-999999", "1e-999999999999999999999"} {
+		if _, err := ParsePrice(s); err == nil {
+			t.Fatalf("%s: expected an error", s)
+		}
+	}
+}
+
+func TestParseRounded(t *testing.T) {
+	cases := []struct {
+		s        string
+		mode     RoundingMode
+		expected Amount
+	}{
+		{"0.000000015", RoundDown, 1},
+		{"0.000000015", RoundUp, 2},
+		{"0.000000015", RoundHalfUp, 2},
+		{"0.000000015", RoundHalfEven, 2},
+		{"0.000000025", RoundHalfEven, 2},
+		{"0.0000000251", RoundHalfEven, 3},
+		{"-0.000000015", RoundFloor, -2},
+		{"-0.000000015", RoundCeiling, -1},
+		{"-0.000000015", RoundHalfUp, -2},
+		{"0.000000014", RoundHalfUp, 1},
+		{"1e-999999", RoundUp, 1},
+		{"-1e-999999", RoundFloor, -1},
+		{"1e-999999", RoundHalfUp, 0},
+	}
+	for _, c := range cases {
+		if a, err := ParseAmountRounded(c.s, c.mode); err != nil {
+			t.Fatalf("%s %v: %v", c.s, c.mode, err)
+		} else if a != c.expected {
+			t.Fatalf("%s %v: expected %d, got %d", c.s, c.mode, c.expected, a)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	if s := Price(123456000).String(); s != "1234.56000" {
+		t.Fatalf("expected 1234.56000, got %s", s)
+	}
+	if s := Price(-1).String(); s != "-0.00001" {
+		t.Fatalf("expected -0.00001, got %s", s)
+	}
+	if s := Price(123456789).StringFixed(2); s != "1234.57" {
+		t.Fatalf("expected 1234.57, got %s", s)
+	}
+	if s := Price(123456789).StringFixed(0); s != "1235" {
+		t.Fatalf("expected 1235, got %s", s)
+	}
+	if s := Amount(1).String(); s != "0.00000001" {
+		t.Fatalf("expected 0.00000001, got %s", s)
+	}
+	if s := Bitcoin.StringFixed(10); s != "1.0000000000" {
+		t.Fatalf("expected 1.0000000000, got %s", s)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	price := 8000 * Euro
+	if total := price.Total(Bitcoin/4, RoundHalfUp); total != 2000*Euro {
+		t.Fatalf("expected 2000 EUR, got %s", total)
+	}
+	if amount := price.Amount(100*Euro, RoundDown); amount != 1250000 {
+		t.Fatalf("expected 0.0125 BTC, got %s", amount)
+	}
+	if avg := AveragePrice(1505000, 15e7, RoundDown); avg != 1003333 {
+		t.Fatalf("expected 10.03333 EUR, got %s", avg)
+	}
+	// 100 BTC at 100000 EUR would overflow a naive int64 product
+	if total := (100000 * Euro).Total(100*Bitcoin, RoundDown); total != 10000000*Euro {
+		t.Fatalf("expected 10000000 EUR, got %s", total)
+	}
+	if p := Price(1001).MulDiv(1, 2, RoundHalfEven); p != 500 {
+		t.Fatalf("expected 500, got %d", p)
+	}
+	if p := Price(1003).MulDiv(1, 2, RoundHalfEven); p != 502 {
+		t.Fatalf("expected 502, got %d", p)
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	if p, err := PriceFromFloat(0.1+0.2, RoundHalfEven); err != nil || p != 30000 {
+		t.Fatalf("expected 0.30000, got %s (%v)", p, err)
+	}
+	if a, err := AmountFromFloat(1.23456789, RoundHalfEven); err != nil || a != 123456789 {
+		t.Fatalf("expected 1.23456789, got %s (%v)", a, err)
+	}
+	for _, f := range []float64{1e15, -1e15, math.NaN(), math.Inf(1)} {
+		if _, err := PriceFromFloat(f, RoundHalfEven); err == nil {
+			t.Fatalf("%g: expected an error", f)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	v := struct {
+		Price  Price  `json:"price"`
+		Amount Amount `json:"amount"`
+	}{}
+
+	if err := json.Unmarshal([]byte(`{"price": 8123.45, "amount": "0.5"}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Price != 812345000 || v.Amount != Bitcoin/2 {
+		t.Fatalf("unexpected values %+v", v)
+	}
+
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bytes) != `{"price":8123.45000,"amount":0.50000000}` {
+		t.Fatalf("unexpected json %s", string(bytes))
+	}
+
+	if err := json.Unmarshal([]byte(`{"price": "abc"}`), &v); err == nil {
+		t.Fatal("expected an error for an invalid price")
+	}
+
+	// huge exponents must not pad the digits with zeros
+	if err := json.Unmarshal([]byte(`{"price": 0e999999, "amount": 1e-999999}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Price != 0 || v.Amount != 0 {
+		t.Fatalf("unexpected values %+v", v)
+	}
+}
+
+func TestSql(t *testing.T) {
+	p := Price(0)
+	if err := p.Scan(int64(123)); err != nil || p != 123 {
+		t.Fatalf("expected 123, got %d (%v)", p, err)
+	}
+	if err := p.Scan([]byte("456")); err != nil || p != 456 {
+		t.Fatalf("expected 456, got %d (%v)", p, err)
+	}
+	if err := p.Scan(1.5); err == nil {
+		t.Fatal("expected an error when scanning a float")
+	}
+	if v, err := Amount(789).Value(); err != nil || v.(int64) != 789 {
+		t.Fatalf("expected 789, got %v (%v)", v, err)
+	}
+}
@@ -0,0 +1,176 @@
+package money
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+)
+
+// Price is a fixed-point EUR value with 5 decimals, like the BL3P price_int.
+// It's used for both prices in EUR / BTC and for EUR totals.
+type Price int64
+
+const (
+	// PriceDecimals is the number of decimals of a Price
+	PriceDecimals = 5
+	// Euro is one EUR
+	Euro Price = 1e5
+	// Cent is one euro cent
+	Cent Price = 1e3
+)
+
+var (
+	_ sql.Scanner   = (*Price)(nil)
+	_ driver.Valuer = Price(0)
+)
+
+// ParsePrice parses a decimal EUR value like 1234.56, it fails if the value has more than 5 decimals
+func ParsePrice(s string) (Price, error) {
+	v, err := parseFixed(s, PriceDecimals, roundExact)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price '%s': %v", s, err)
+	}
+	return Price(v), nil
+}
+
+// ParsePriceRounded parses a decimal EUR value like 1234.56, excess decimals are rounded with mode
+func ParsePriceRounded(s string, mode RoundingMode) (Price, error) {
+	v, err := parseFixed(s, PriceDecimals, mode)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price '%s': %v", s, err)
+	}
+	return Price(v), nil
+}
+
+// PriceFromFloat converts a float EUR value, use this only at the edges for apis that use floats.
+// It fails for NaN, infinities and values out of range.
+func PriceFromFloat(f float64, mode RoundingMode) (Price, error) {
+	v, err := floatToFixed(f, PriceDecimals, mode)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price %g: %v", f, err)
+	}
+	return Price(v), nil
+}
+
+func (p Price) Add(q Price) Price { return p + q }
+func (p Price) Sub(q Price) Price { return p - q }
+func (p Price) Neg() Price        { return -p }
+func (p Price) Sign() int         { return sign(int64(p)) }
+func (p Price) IsZero() bool      { return p == 0 }
+
+// Abs returns the absolute value
+func (p Price) Abs() Price {
+	if p < 0 {
+		return -p
+	}
+	return p
+}
+
+// Min returns the lowest of p and q
+func (p Price) Min(q Price) Price {
+	if q < p {
+		return q
+	}
+	return p
+}
+
+// Max returns the highest of p and q
+func (p Price) Max(q Price) Price {
+	if q > p {
+		return q
+	}
+	return p
+}
+
+// Mul multiplies the price by n
+func (p Price) Mul(n int64) Price { return p * Price(n) }
+
+// MulDiv returns p * num / den rounded with mode, e.g. p.MulDiv(3, 100, RoundHalfUp) for 3% of p
+func (p Price) MulDiv(num, den int64, mode RoundingMode) Price {
+	return Price(mulDiv(int64(p), num, den, mode))
+}
+
+// Total returns the EUR total of amount at price p
+func (p Price) Total(amount Amount, mode RoundingMode) Price {
+	return Price(mulDiv(int64(p), int64(amount), int64(Bitcoin), mode))
+}
+
+// Amount returns how much BTC the EUR total buys at price p
+func (p Price) Amount(total Price, mode RoundingMode) Amount {
+	return Amount(mulDiv(int64(total), int64(Bitcoin), int64(p), mode))
+}
+
+// AveragePrice returns the price per BTC of the EUR total for amount, it returns zero for a zero amount
+func AveragePrice(total Price, amount Amount, mode RoundingMode) Price {
+	if amount == 0 {
+		return 0
+	}
+	return Price(mulDiv(int64(total), int64(Bitcoin), int64(amount), mode))
+}
+
+// Float64 returns the price in EUR as a float, for display and statistics only
+func (p Price) Float64() float64 {
+	return float64(p) / float64(Euro)
+}
+
+// String formats the price with all 5 decimals
+func (p Price) String() string {
+	return formatFixed(int64(p), PriceDecimals)
+}
+
+// StringFixed formats the price with the given number of decimals, rounding halves away from zero
+func (p Price) StringFixed(decimals int) string {
+	return roundFixed(int64(p), PriceDecimals, decimals, RoundHalfUp)
+}
+
+// MarshalJSON writes the price as a json number in EUR
+func (p Price) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalJSON reads a json number or string in EUR, excess decimals are rounded half to even
+func (p *Price) UnmarshalJSON(data []byte) error {
+	v, ok, err := unmarshalFixed(data, PriceDecimals)
+	if err != nil {
+		return fmt.Errorf("invalid price %s: %v", string(data), err)
+	}
+	if ok {
+		*p = Price(v)
+	}
+	return nil
+}
+
+// Value stores the price as an integer in 1e5 EUR
+func (p Price) Value() (driver.Value, error) {
+	return int64(p), nil
+}
+
+// Scan reads a price stored as an integer in 1e5 EUR
+func (p *Price) Scan(src interface{}) error {
+	v, err := scanFixed(src)
+	if err != nil {
+		return fmt.Errorf("cannot scan price: %v", err)
+	}
+	*p = Price(v)
+	return nil
+}
+
+func sign(v int64) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func floatToFixed(f float64, decimals int, mode RoundingMode) (int64, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, ErrOverflow
+	}
+	// format the float with enough digits to round trip, then parse it exactly
+	return parseFixed(fmt.Sprintf("%.17g", f), decimals, mode)
+}
@@ -0,0 +1,639 @@
+// Package paper simulates the BL3P exchange for paper trading.
+// The Exchange implements bl3papi.Trader, so strategies can switch between paper and live trading,
+// and it fills the orders against the trades and order books of a live or replayed bl3pfeed.
+package paper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/resc/rescbits/bl3papi"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultMarket is used when the config has no market
+const DefaultMarket = "BTCEUR"
+
+type (
+	// Config configures the simulated exchange
+	Config struct {
+		// Market is the market the exchange trades, e.g. BTCEUR
+		Market string
+		// Eur is the starting EUR balance
+		Eur money.Price
+		// Btc is the starting BTC balance
+		Btc money.Amount
+		// MakerFee is the fee percentage for fills of orders that rest in the book, e.g. 0.25
+		MakerFee float64
+		// TakerFee is the fee percentage for fills against the order book
+		TakerFee float64
+		// Latency is the delay before a placed or cancelled order reaches the exchange
+		Latency time.Duration
+		// Clock returns the current time, replays and backtests set it to the time of the feed. nil means time.Now
+		Clock func() time.Time
+	}
+
+	// Exchange is a simulated exchange for a single market.
+	// Market orders and limit orders that cross the book fill against the last order book,
+	// resting limit orders fill at their limit price when a trade at that price or better goes through.
+	Exchange struct {
+		lock     sync.Mutex
+		market   string
+		base     string
+		quote    string
+		makerFee int64 // parts per million
+		takerFee int64 // parts per million
+		latency  time.Duration
+		now      func() time.Time
+
+		book      *bl3pfeed.Book
+		lastTrade money.Price
+
+		eur        money.Price
+		btc        money.Amount
+		lastId     int64
+		orders     map[int64]*order
+		open       []*order // the pending and open orders in order of placement
+		position   position
+		executions []Execution
+	}
+
+	order struct {
+		bl3papi.Order
+		feeCurrency string
+		isMarket    bool
+		activeAt    time.Time
+		cancelAt    time.Time
+		reservedEur money.Price
+		reservedBtc money.Amount
+	}
+)
+
+var (
+	_ bl3papi.Trader                 = (*Exchange)(nil)
+	_ bl3pfeed.TradesFeedListener    = (*Exchange)(nil)
+	_ bl3pfeed.OrderBookFeedListener = (*Exchange)(nil)
+)
+
+// NewExchange creates a simulated exchange with the starting balances of the config
+func NewExchange(c Config) (*Exchange, error) {
+	if c.Market == "" {
+		c.Market = DefaultMarket
+	}
+	if len(c.Market) != 6 {
+		return nil, fmt.Errorf("invalid market: %s", c.Market)
+	}
+	if c.MakerFee < 0 || c.MakerFee >= 100 || c.TakerFee < 0 || c.TakerFee >= 100 {
+		return nil, fmt.Errorf("invalid fees: maker %v%%, taker %v%%", c.MakerFee, c.TakerFee)
+	}
+	if c.Latency < 0 {
+		return nil, fmt.Errorf("invalid latency: %v", c.Latency)
+	}
+	if c.Eur < 0 || c.Btc < 0 {
+		return nil, errors.New("negative starting balance")
+	}
+	if c.Clock == nil {
+		c.Clock = time.Now
+	}
+	return &Exchange{
+		market:   c.Market,
+		base:     c.Market[:3],
+		quote:    c.Market[3:],
+		makerFee: int64(math.Round(c.MakerFee * 1e4)),
+		takerFee: int64(math.Round(c.TakerFee * 1e4)),
+		latency:  c.Latency,
+		now:      c.Clock,
+		book:     bl3pfeed.NewBook(),
+		eur:      c.Eur,
+		btc:      c.Btc,
+		orders:   make(map[int64]*order),
+	}, nil
+}
+
+// Market returns the market of the exchange
+func (e *Exchange) Market() string {
+	return e.market
+}
+
+// PlaceLimitOrder reserves the funds for the order and returns its id, it fails with an
+// *bl3papi.ApiError with code bl3papi.CodeInsufficientFunds if the funds aren't available
+func (e *Exchange) PlaceLimitOrder(ctx context.Context, lo bl3papi.LimitOrder) (int64, error) {
+	if err := e.checkOrder(ctx, lo.Validate(), lo.Market); err != nil {
+		return 0, err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	now := e.now()
+	e.process(now)
+	o := e.newOrder(lo.Type, lo.FeeCurrency, now)
+	o.Amount = lo.Amount
+	o.Price = lo.Price
+
+	// reserve enough for the highest fee, the unused part is released when the order is done
+	fee := e.makerFee
+	if e.takerFee > fee {
+		fee = e.takerFee
+	}
+	if o.Type == bl3papi.TypeBid {
+		o.reservedEur = lo.Price.Total(lo.Amount, money.RoundUp)
+		if o.feeCurrency == bl3papi.CurrencyEur {
+			o.reservedEur += feeEur(o.reservedEur, fee)
+		}
+		if o.reservedEur > e.availableEur() {
+			return 0, insufficientFunds()
+		}
+	} else {
+		o.reservedBtc = lo.Amount
+		if o.feeCurrency == bl3papi.CurrencyBtc {
+			o.reservedBtc += feeBtc(o.reservedBtc, fee)
+		}
+		if o.reservedBtc > e.availableBtc() {
+			return 0, insufficientFunds()
+		}
+	}
+	return e.place(o, now), nil
+}
+
+// PlaceMarketOrder returns the id of the order, it's filled against the order book after the latency.
+// The fill is limited to the available funds at that time.
+func (e *Exchange) PlaceMarketOrder(ctx context.Context, mo bl3papi.MarketOrder) (int64, error) {
+	if err := e.checkOrder(ctx, mo.Validate(), mo.Market); err != nil {
+		return 0, err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	now := e.now()
+	e.process(now)
+	o := e.newOrder(mo.Type, mo.FeeCurrency, now)
+	o.isMarket = true
+	o.Amount = mo.Amount
+	o.Funds = mo.Funds
+	if (o.Type == bl3papi.TypeBid && e.availableEur() <= 0) || (o.Type == bl3papi.TypeAsk && e.availableBtc() <= 0) {
+		return 0, insufficientFunds()
+	}
+	return e.place(o, now), nil
+}
+
+// CancelOrder cancels the order after the latency, it can still fill until then
+func (e *Exchange) CancelOrder(ctx context.Context, market string, id int64) error {
+	if err := e.checkOrder(ctx, nil, market); err != nil {
+		return err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	now := e.now()
+	e.process(now)
+	o, ok := e.orders[id]
+	if !ok {
+		return fmt.Errorf("unknown order: %d", id)
+	}
+	if o.IsDone() {
+		return fmt.Errorf("order %d is %s", id, o.Status)
+	}
+	if o.cancelAt.IsZero() {
+		o.cancelAt = now.Add(e.latency)
+	}
+	e.process(now)
+	return nil
+}
+
+// OpenOrders returns the pending and open orders
+func (e *Exchange) OpenOrders(ctx context.Context, market string) ([]bl3papi.Order, error) {
+	if err := e.checkOrder(ctx, nil, market); err != nil {
+		return nil, err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.process(e.now())
+	orders := make([]bl3papi.Order, 0, len(e.open))
+	for _, o := range e.open {
+		orders = append(orders, o.Order)
+	}
+	return orders, nil
+}
+
+// OrderStatus returns the state of the order
+func (e *Exchange) OrderStatus(ctx context.Context, market string, id int64) (bl3papi.Order, error) {
+	if err := e.checkOrder(ctx, nil, market); err != nil {
+		return bl3papi.Order{}, err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.process(e.now())
+	o, ok := e.orders[id]
+	if !ok {
+		return bl3papi.Order{}, fmt.Errorf("unknown order: %d", id)
+	}
+	return o.Order, nil
+}
+
+// Info returns the virtual balances, the trade fee is the taker fee
+func (e *Exchange) Info(ctx context.Context) (bl3papi.Info, error) {
+	if err := ctx.Err(); err != nil {
+		return bl3papi.Info{}, err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.process(e.now())
+	return bl3papi.Info{
+		TradeFee: float64(e.takerFee) / 1e4,
+		Wallets: []bl3papi.Wallet{
+			{
+				Currency:  e.base,
+				Balance:   bl3papi.Value{Int: int64(e.btc), Currency: e.base},
+				Available: bl3papi.Value{Int: int64(e.availableBtc()), Currency: e.base},
+			},
+			{
+				Currency:  e.quote,
+				Balance:   bl3papi.Value{Int: int64(e.eur), Currency: e.quote},
+				Available: bl3papi.Value{Int: int64(e.availableEur()), Currency: e.quote},
+			},
+		},
+	}, nil
+}
+
+// Position returns the position and its profit and loss at the current mark price
+func (e *Exchange) Position() Position {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	mark := e.mark()
+	return Position{
+		Market:      e.market,
+		Amount:      e.position.amount,
+		AverageCost: e.position.averageCost(),
+		Mark:        mark,
+		Realised:    e.position.realised,
+		Unrealised:  e.position.unrealised(mark),
+		Fees:        e.position.fees,
+	}
+}
+
+// Equity returns the EUR balance plus the BTC balance valued at the mark price
+func (e *Exchange) Equity() money.Price {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.eur + e.mark().Total(e.btc, money.RoundHalfUp)
+}
+
+// Executions returns the trade log, oldest first
+func (e *Exchange) Executions() []Execution {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	executions := make([]Execution, len(e.executions))
+	copy(executions, e.executions)
+	return executions
+}
+
+func (e *Exchange) FeedDisconnected(channel string, err error) {
+	log.Warnf("Paper exchange %s lost the %s feed: %v", e.market, channel, err)
+}
+
+func (e *Exchange) FeedReconnected(channel string, attempts int) {
+	log.Infof("Paper exchange %s has the %s feed again after %d attempts", e.market, channel, attempts)
+}
+
+func (e *Exchange) FeedClosed(channel string, err error) {
+	log.Infof("Paper exchange %s %s feed closed", e.market, channel)
+}
+
+// OnTrade fills the resting limit orders the trade went through
+func (e *Exchange) OnTrade(t *bl3pfeed.Trade) {
+	if t.Marketplace != "" && t.Marketplace != e.market {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	now := e.now()
+	e.process(now)
+	e.lastTrade = t.Price
+	e.matchTrade(t, now)
+}
+
+// OnOrderBookChanged updates the book the market orders fill against
+func (e *Exchange) OnOrderBookChanged(b *bl3pfeed.OrderBook) {
+	if b.Market != "" && b.Market != e.market {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.book.Update(b)
+	e.process(e.now())
+}
+
+func (e *Exchange) checkOrder(ctx context.Context, err error, market string) error {
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if market != e.market {
+		return fmt.Errorf("the paper exchange only trades %s, not %s", e.market, market)
+	}
+	return nil
+}
+
+func (e *Exchange) newOrder(typ, feeCurrency string, now time.Time) *order {
+	if feeCurrency == "" {
+		feeCurrency = bl3papi.CurrencyBtc
+	}
+	e.lastId++
+	return &order{
+		Order: bl3papi.Order{
+			Id:       e.lastId,
+			Market:   e.market,
+			Type:     typ,
+			Status:   bl3papi.StatusPending,
+			Date:     now,
+			TotalFee: bl3papi.Value{Currency: feeCurrency},
+		},
+		feeCurrency: feeCurrency,
+		activeAt:    now.Add(e.latency),
+	}
+}
+
+func (e *Exchange) place(o *order, now time.Time) int64 {
+	e.orders[o.Id] = o
+	e.open = append(e.open, o)
+	log.Debugf("Paper order %d placed: %s %s at %s", o.Id, o.Type, o.Amount, o.Price)
+	e.process(now)
+	return o.Id
+}
+
+// process cancels and activates the orders whose latency has passed
+func (e *Exchange) process(now time.Time) {
+	for _, o := range e.open {
+		if !o.cancelAt.IsZero() && !now.Before(o.cancelAt) {
+			e.finish(o, bl3papi.StatusCancelled)
+			continue
+		}
+		if o.Status != bl3papi.StatusPending || now.Before(o.activeAt) {
+			continue
+		}
+		if o.isMarket {
+			// market orders wait for the first order book
+			if !e.book.Updated().IsZero() {
+				e.fillMarket(o, now)
+			}
+		} else {
+			o.Status = bl3papi.StatusOpen
+			e.take(o, o.Amount, o.Price, now)
+			if o.TotalAmount == o.Amount {
+				e.finish(o, bl3papi.StatusClosed)
+			}
+		}
+	}
+	e.prune()
+}
+
+// fillMarket fills the market order against the book, limited by the available funds
+func (e *Exchange) fillMarket(o *order, now time.Time) {
+	o.Status = bl3papi.StatusOpen
+	var fill *bl3pfeed.Fill
+	if o.Type == bl3papi.TypeBid {
+		if o.Amount > 0 {
+			fill, _ = e.book.Simulate(bl3pfeed.ActionBuy, o.Amount)
+		} else {
+			fill, _ = e.book.SimulateEur(bl3pfeed.ActionBuy, o.Funds)
+		}
+		need := fill.Cost
+		if o.feeCurrency == bl3papi.CurrencyEur {
+			need += feeEur(need, e.takerFee)
+		}
+		if available := e.availableEur(); need > available {
+			affordable := available
+			if o.feeCurrency == bl3papi.CurrencyEur {
+				affordable = available.MulDiv(1e6, 1e6+e.takerFee, money.RoundDown)
+			}
+			// leave room for rounding the fee of every level up
+			affordable -= money.Price(fill.Levels)
+			fill, _ = e.book.SimulateEur(bl3pfeed.ActionBuy, affordable.Max(0))
+		}
+	} else {
+		if o.Amount > 0 {
+			fill, _ = e.book.Simulate(bl3pfeed.ActionSell, o.Amount)
+		} else {
+			fill, _ = e.book.SimulateEur(bl3pfeed.ActionSell, o.Funds)
+		}
+		need := fill.Amount
+		if o.feeCurrency == bl3papi.CurrencyBtc {
+			need += feeBtc(need, e.takerFee)
+		}
+		if available := e.availableBtc(); need > available {
+			sellable := available
+			if o.feeCurrency == bl3papi.CurrencyBtc {
+				sellable = available.MulDiv(1e6, 1e6+e.takerFee, money.RoundDown)
+			}
+			sellable -= money.Amount(fill.Levels)
+			fill, _ = e.book.Simulate(bl3pfeed.ActionSell, sellable.Max(0))
+		}
+	}
+	e.take(o, fill.Amount, 0, now)
+	e.finish(o, bl3papi.StatusClosed)
+}
+
+// take fills up to amount of the order against the book, limit is the worst price or zero for no limit
+func (e *Exchange) take(o *order, amount money.Amount, limit money.Price, now time.Time) {
+	var levels []bl3pfeed.Level
+	if o.Type == bl3papi.TypeBid {
+		levels = e.book.Asks()
+	} else {
+		levels = e.book.Bids()
+	}
+	remaining := amount - o.TotalAmount
+	if o.isMarket {
+		remaining = amount
+	}
+	for _, l := range levels {
+		if remaining <= 0 {
+			break
+		}
+		if limit > 0 && ((o.Type == bl3papi.TypeBid && l.Price > limit) || (o.Type == bl3papi.TypeAsk && l.Price < limit)) {
+			break
+		}
+		take := l.Amount.Min(remaining)
+		e.fill(o, take, l.Price, false, now)
+		remaining -= take
+	}
+}
+
+// matchTrade fills the open limit orders at their price when the trade price is at or through it, best prices first.
+// The bids and the asks can each fill up to the traded amount.
+func (e *Exchange) matchTrade(t *bl3pfeed.Trade, now time.Time) {
+	bids := make([]*order, 0)
+	asks := make([]*order, 0)
+	for _, o := range e.open {
+		if o.isMarket || o.Status != bl3papi.StatusOpen {
+			continue
+		}
+		if o.Type == bl3papi.TypeBid && o.Price >= t.Price {
+			bids = append(bids, o)
+		}
+		if o.Type == bl3papi.TypeAsk && o.Price <= t.Price {
+			asks = append(asks, o)
+		}
+	}
+	sort.SliceStable(bids, func(i, j int) bool { return bids[i].Price > bids[j].Price })
+	sort.SliceStable(asks, func(i, j int) bool { return asks[i].Price < asks[j].Price })
+
+	for _, orders := range [][]*order{bids, asks} {
+		remaining := t.Amount
+		for _, o := range orders {
+			if remaining <= 0 {
+				break
+			}
+			take := (o.Amount - o.TotalAmount).Min(remaining)
+			e.fill(o, take, o.Price, true, now)
+			remaining -= take
+			if o.TotalAmount == o.Amount {
+				e.finish(o, bl3papi.StatusClosed)
+			}
+		}
+	}
+	e.prune()
+}
+
+// fill books a fill of the order in the balances, the position and the trade log
+func (e *Exchange) fill(o *order, amount money.Amount, price money.Price, maker bool, now time.Time) {
+	fee := e.takerFee
+	if maker {
+		fee = e.makerFee
+	}
+	total := price.Total(amount, money.RoundDown)
+	paid := bl3papi.Value{Currency: o.feeCurrency}
+	var paidEur money.Price
+
+	if o.Type == bl3papi.TypeBid {
+		received := amount
+		cost := total
+		if o.feeCurrency == bl3papi.CurrencyBtc {
+			f := feeBtc(amount, fee)
+			received -= f
+			paid.Int, paidEur = int64(f), price.Total(f, money.RoundHalfUp)
+		} else {
+			f := feeEur(total, fee)
+			cost += f
+			paid.Int, paidEur = int64(f), f
+		}
+		e.eur -= cost
+		e.btc += received
+		o.reservedEur = (o.reservedEur - cost).Max(0)
+	} else {
+		sold := amount
+		proceeds := total
+		if o.feeCurrency == bl3papi.CurrencyBtc {
+			f := feeBtc(amount, fee)
+			sold += f
+			paid.Int, paidEur = int64(f), price.Total(f, money.RoundHalfUp)
+		} else {
+			f := feeEur(total, fee)
+			proceeds -= f
+			paid.Int, paidEur = int64(f), f
+		}
+		e.btc -= sold
+		e.eur += proceeds
+		o.reservedBtc = (o.reservedBtc - sold).Max(0)
+	}
+
+	o.TotalAmount += amount
+	o.TotalSpent += total
+	o.TotalFee.Int += paid.Int
+	o.AverageCost = money.AveragePrice(o.TotalSpent, o.TotalAmount, money.RoundHalfUp)
+
+	signed := amount
+	if o.Type == bl3papi.TypeAsk {
+		signed = -amount
+	}
+	realised := e.position.add(signed, price)
+	e.position.fees += paidEur
+
+	e.executions = append(e.executions, Execution{
+		Time:     now,
+		OrderId:  o.Id,
+		Market:   e.market,
+		Type:     o.Type,
+		Amount:   amount,
+		Price:    price,
+		Fee:      paid,
+		FeeEur:   paidEur,
+		Maker:    maker,
+		Realised: realised,
+	})
+	log.Debugf("Paper order %d filled: %s %s at %s, fee %s", o.Id, o.Type, amount, price, paid)
+}
+
+// finish releases the reserved funds of the order
+func (e *Exchange) finish(o *order, status string) {
+	o.Status = status
+	o.reservedEur = 0
+	o.reservedBtc = 0
+	log.Debugf("Paper order %d %s", o.Id, status)
+}
+
+// prune removes the done orders from the open orders
+func (e *Exchange) prune() {
+	open := e.open[:0]
+	for _, o := range e.open {
+		if !o.IsDone() {
+			open = append(open, o)
+		}
+	}
+	for i := len(open); i < len(e.open); i++ {
+		e.open[i] = nil
+	}
+	e.open = open
+}
+
+func (e *Exchange) availableEur() money.Price {
+	available := e.eur
+	for _, o := range e.open {
+		available -= o.reservedEur
+	}
+	return available
+}
+
+func (e *Exchange) availableBtc() money.Amount {
+	available := e.btc
+	for _, o := range e.open {
+		available -= o.reservedBtc
+	}
+	return available
+}
+
+// mark returns the last trade price, or the mid price before the first trade
+func (e *Exchange) mark() money.Price {
+	if e.lastTrade > 0 {
+		return e.lastTrade
+	}
+	mid, _ := e.book.MidPrice()
+	return mid
+}
+
+func feeEur(total money.Price, ppm int64) money.Price {
+	return total.MulDiv(ppm, 1e6, money.RoundUp)
+}
+
+func feeBtc(amount money.Amount, ppm int64) money.Amount {
+	return amount.MulDiv(ppm, 1e6, money.RoundUp)
+}
+
+func insufficientFunds() error {
+	return &bl3papi.ApiError{StatusCode: http.StatusOK, Code: bl3papi.CodeInsufficientFunds, Message: "Insufficient funds"}
+}
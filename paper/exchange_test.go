@@ -0,0 +1,303 @@
+package paper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bl3papi"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *testClock) Now() time.Time          { return c.now }
+func (c *testClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func bookOrder(price money.Price, amount money.Amount) *bl3pfeed.Order {
+	return &bl3pfeed.Order{Price: price, Amount: amount}
+}
+
+func newTestExchange(t *testing.T, c Config) (*Exchange, *testClock) {
+	clock := newTestClock()
+	c.Clock = clock.Now
+	e, err := NewExchange(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.OnOrderBookChanged(&bl3pfeed.OrderBook{
+		Market: "BTCEUR",
+		Asks:   []*bl3pfeed.Order{bookOrder(8000*money.Euro, money.Bitcoin), bookOrder(8100*money.Euro, money.Bitcoin)},
+		Bids:   []*bl3pfeed.Order{bookOrder(7900*money.Euro, money.Bitcoin), bookOrder(7800*money.Euro, money.Bitcoin)},
+	})
+	return e, clock
+}
+
+func balances(t *testing.T, e *Exchange) (eur bl3papi.Wallet, btc bl3papi.Wallet) {
+	info, err := e.Info(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	btc, _ = info.Wallet(bl3papi.CurrencyBtc)
+	eur, _ = info.Wallet(bl3papi.CurrencyEur)
+	return eur, btc
+}
+
+func status(t *testing.T, e *Exchange, id int64) bl3papi.Order {
+	o, err := e.OrderStatus(context.Background(), "BTCEUR", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestNewExchange(t *testing.T) {
+	for _, c := range []Config{
+		{Market: "BTC"},
+		{MakerFee: -1},
+		{TakerFee: 100},
+		{Latency: -time.Second},
+		{Eur: -money.Euro},
+	} {
+		if _, err := NewExchange(c); err == nil {
+			t.Errorf("Expected an error for %+v", c)
+		}
+	}
+	if e, err := NewExchange(Config{}); err != nil || e.Market() != DefaultMarket {
+		t.Fatalf("Unexpected exchange %v, %v", e, err)
+	}
+}
+
+func TestExchange_MarketOrder(t *testing.T) {
+	e, _ := newTestExchange(t, Config{Eur: 20000 * money.Euro, TakerFee: 0.25})
+	ctx := context.Background()
+
+	id, err := e.PlaceMarketOrder(ctx, bl3papi.MarketOrder{Market: "BTCEUR", Type: bl3papi.TypeBid, Amount: 3 * money.Bitcoin / 2, FeeCurrency: bl3papi.CurrencyEur})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := status(t, e, id)
+	if o.Status != bl3papi.StatusClosed || o.TotalAmount != 3*money.Bitcoin/2 || o.TotalSpent != 12050*money.Euro || o.AverageCost != 803333333 {
+		t.Fatalf("Unexpected order %+v", o)
+	}
+	if o.TotalFee.Price() != 3012500 || o.TotalFee.Currency != bl3papi.CurrencyEur {
+		t.Fatalf("Unexpected fee %+v", o.TotalFee)
+	}
+	eur, btc := balances(t, e)
+	if eur.Balance.Price() != 20000*money.Euro-12050*money.Euro-3012500 || btc.Balance.Amount() != 3*money.Bitcoin/2 {
+		t.Fatalf("Unexpected balances %s, %s", eur.Balance, btc.Balance)
+	}
+	executions := e.Executions()
+	if len(executions) != 2 || executions[0].Price != 8000*money.Euro || executions[1].Amount != money.Bitcoin/2 || executions[1].Maker {
+		t.Fatalf("Unexpected executions %+v", executions)
+	}
+
+	// sell for funds with the fee in BTC
+	id, err = e.PlaceMarketOrder(ctx, bl3papi.MarketOrder{Market: "BTCEUR", Type: bl3papi.TypeAsk, Funds: 3950 * money.Euro})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := status(t, e, id); o.TotalAmount != money.Bitcoin/2 || o.TotalSpent != 3950*money.Euro || o.TotalFee.Amount() != 125000 {
+		t.Fatalf("Unexpected order %+v", o)
+	}
+	if _, btc := balances(t, e); btc.Balance.Amount() != money.Bitcoin-125000 {
+		t.Fatalf("Unexpected BTC balance %s", btc.Balance)
+	}
+}
+
+func TestExchange_MarketOrderLimitedByFunds(t *testing.T) {
+	e, _ := newTestExchange(t, Config{Eur: 4000 * money.Euro, Btc: money.Bitcoin / 4})
+	ctx := context.Background()
+
+	id, err := e.PlaceMarketOrder(ctx, bl3papi.MarketOrder{Market: "BTCEUR", Type: bl3papi.TypeBid, Amount: money.Bitcoin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := status(t, e, id); o.Status != bl3papi.StatusClosed || o.TotalAmount != money.Bitcoin/2-1 {
+		t.Fatalf("Unexpected order %+v", o)
+	}
+	id, err = e.PlaceMarketOrder(ctx, bl3papi.MarketOrder{Market: "BTCEUR", Type: bl3papi.TypeAsk, Amount: 2 * money.Bitcoin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := status(t, e, id); o.TotalAmount != 3*money.Bitcoin/4-3 {
+		t.Fatalf("Unexpected order %+v", o)
+	}
+	if eur, btc := balances(t, e); eur.Balance.Price() < 0 || btc.Balance.Amount() < 0 {
+		t.Fatalf("Negative balances %s, %s", eur.Balance, btc.Balance)
+	}
+}
+
+func TestExchange_Latency(t *testing.T) {
+	e, clock := newTestExchange(t, Config{Eur: 10000 * money.Euro, Latency: time.Second})
+
+	id, err := e.PlaceMarketOrder(context.Background(), bl3papi.MarketOrder{Market: "BTCEUR", Type: bl3papi.TypeBid, Amount: money.Bitcoin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := status(t, e, id); o.Status != bl3papi.StatusPending {
+		t.Fatalf("Expected a pending order, got %+v", o)
+	}
+
+	// the book changes before the order arrives
+	clock.Advance(time.Second)
+	e.OnOrderBookChanged(&bl3pfeed.OrderBook{Market: "BTCEUR", Asks: []*bl3pfeed.Order{bookOrder(8200*money.Euro, money.Bitcoin)}})
+	if o := status(t, e, id); o.Status != bl3papi.StatusClosed || o.AverageCost != 8200*money.Euro {
+		t.Fatalf("Unexpected order %+v", o)
+	}
+	if executions := e.Executions(); len(executions) != 1 || !executions[0].Time.Equal(clock.Now()) {
+		t.Fatalf("Unexpected executions %+v", executions)
+	}
+}
+
+func TestExchange_LimitOrder(t *testing.T) {
+	e, _ := newTestExchange(t, Config{Eur: 10000 * money.Euro, MakerFee: 0.1, TakerFee: 0.25})
+	ctx := context.Background()
+
+	id, err := e.PlaceLimitOrder(ctx, bl3papi.LimitOrder{Market: "BTCEUR", Type: bl3papi.TypeBid, Amount: money.Bitcoin, Price: 7850 * money.Euro})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eur, _ := balances(t, e); eur.Available.Price() != 2150*money.Euro || eur.Balance.Price() != 10000*money.Euro {
+		t.Fatalf("Expected the funds to be reserved, got %+v", eur)
+	}
+	if _, err := e.PlaceLimitOrder(ctx, bl3papi.LimitOrder{Market: "BTCEUR", Type: bl3papi.TypeBid, Amount: money.Bitcoin, Price: 7000 * money.Euro}); !bl3papi.IsCode(err, bl3papi.CodeInsufficientFunds) {
+		t.Fatalf("Expected insufficient funds, got %v", err)
+	}
+
+	e.OnTrade(&bl3pfeed.Trade{Marketplace: "BTCEUR", Price: 7900 * money.Euro, Amount: money.Bitcoin})
+	if o := status(t, e, id); o.Status != bl3papi.StatusOpen || o.TotalAmount != 0 {
+		t.Fatalf("Unexpected fill %+v", o)
+	}
+	e.OnTrade(&bl3pfeed.Trade{Marketplace: "BTCEUR", Price: 7850 * money.Euro, Amount: 4 * money.Bitcoin / 10})
+	e.OnTrade(&bl3pfeed.Trade{Marketplace: "LTCEUR", Price: 100 * money.Euro, Amount: money.Bitcoin})
+	if o := status(t, e, id); o.Status != bl3papi.StatusOpen || o.TotalAmount != 4*money.Bitcoin/10 {
+		t.Fatalf("Unexpected fill %+v", o)
+	}
+	e.OnTrade(&bl3pfeed.Trade{Marketplace: "BTCEUR", Price: 7800 * money.Euro, Amount: money.Bitcoin})
+	o := status(t, e, id)
+	if o.Status != bl3papi.StatusClosed || o.TotalAmount != money.Bitcoin || o.AverageCost != 7850*money.Euro || o.TotalFee.Amount() != 100000 {
+		t.Fatalf("Unexpected order %+v", o)
+	}
+	eur, btc := balances(t, e)
+	if eur.Balance.Price() != 2150*money.Euro || eur.Available != eur.Balance || btc.Balance.Amount() != money.Bitcoin-100000 {
+		t.Fatalf("Unexpected balances %+v, %+v", eur, btc)
+	}
+	for _, x := range e.Executions() {
+		if !x.Maker {
+			t.Fatalf("Expected maker fills, got %+v", x)
+		}
+	}
+}
+
+func TestExchange_CrossingLimitOrder(t *testing.T) {
+	e, _ := newTestExchange(t, Config{Btc: 2 * money.Bitcoin})
+	ctx := context.Background()
+
+	id, err := e.PlaceLimitOrder(ctx, bl3papi.LimitOrder{Market: "BTCEUR", Type: bl3papi.TypeAsk, Amount: 3 * money.Bitcoin / 2, Price: 7850 * money.Euro})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := status(t, e, id)
+	if o.Status != bl3papi.StatusOpen || o.TotalAmount != money.Bitcoin || o.TotalSpent != 7900*money.Euro {
+		t.Fatalf("Expected the best bid to be taken, got %+v", o)
+	}
+	orders, err := e.OpenOrders(ctx, "BTCEUR")
+	if err != nil || len(orders) != 1 || orders[0].Id != id {
+		t.Fatalf("Unexpected open orders %+v, %v", orders, err)
+	}
+	if _, btc := balances(t, e); btc.Available.Amount() != money.Bitcoin/2 {
+		t.Fatalf("Unexpected BTC %+v", btc)
+	}
+}
+
+func TestExchange_Cancel(t *testing.T) {
+	e, clock := newTestExchange(t, Config{Eur: 10000 * money.Euro, Latency: time.Second})
+	ctx := context.Background()
+
+	id, err := e.PlaceLimitOrder(ctx, bl3papi.LimitOrder{Market: "BTCEUR", Type: bl3papi.TypeBid, Amount: money.Bitcoin, Price: 7000 * money.Euro})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Second)
+	if err := e.CancelOrder(ctx, "BTCEUR", id); err != nil {
+		t.Fatal(err)
+	}
+	// the order fills until the cancel arrives
+	e.OnTrade(&bl3pfeed.Trade{Price: 7000 * money.Euro, Amount: money.Bitcoin / 2})
+	clock.Advance(time.Second)
+	o := status(t, e, id)
+	if o.Status != bl3papi.StatusCancelled || o.TotalAmount != money.Bitcoin/2 {
+		t.Fatalf("Unexpected order %+v", o)
+	}
+	if eur, _ := balances(t, e); eur.Available != eur.Balance || eur.Balance.Price() != 6500*money.Euro {
+		t.Fatalf("Expected the reserved funds to be released, got %+v", eur)
+	}
+	if err := e.CancelOrder(ctx, "BTCEUR", id); err == nil {
+		t.Fatal("Expected an error cancelling a cancelled order")
+	}
+	if err := e.CancelOrder(ctx, "BTCEUR", 42); err == nil {
+		t.Fatal("Expected an error cancelling an unknown order")
+	}
+	if _, err := e.OpenOrders(ctx, "LTCEUR"); err == nil {
+		t.Fatal("Expected an error for another market")
+	}
+}
+
+func TestExchange_Position(t *testing.T) {
+	e, _ := newTestExchange(t, Config{Eur: 10000 * money.Euro, TakerFee: 0.25})
+	ctx := context.Background()
+
+	if _, err := e.PlaceMarketOrder(ctx, bl3papi.MarketOrder{Market: "BTCEUR", Type: bl3papi.TypeBid, Amount: money.Bitcoin, FeeCurrency: bl3papi.CurrencyEur}); err != nil {
+		t.Fatal(err)
+	}
+	e.OnOrderBookChanged(&bl3pfeed.OrderBook{Market: "BTCEUR", Bids: []*bl3pfeed.Order{bookOrder(9000*money.Euro, money.Bitcoin)}})
+	if _, err := e.PlaceMarketOrder(ctx, bl3papi.MarketOrder{Market: "BTCEUR", Type: bl3papi.TypeAsk, Amount: money.Bitcoin / 2, FeeCurrency: bl3papi.CurrencyEur}); err != nil {
+		t.Fatal(err)
+	}
+	e.OnTrade(&bl3pfeed.Trade{Price: 8500 * money.Euro, Amount: money.Bitcoin})
+
+	p := e.Position()
+	if p.Amount != money.Bitcoin/2 || p.AverageCost != 8000*money.Euro || p.Mark != 8500*money.Euro ||
+		p.Realised != 500*money.Euro || p.Unrealised != 250*money.Euro || p.Fees != 20*money.Euro+1125*money.Cent {
+		t.Fatalf("Unexpected position %+v", p)
+	}
+	if p.PnL() != 750*money.Euro-3125*money.Cent {
+		t.Fatalf("Unexpected pnl %s", p.PnL())
+	}
+	if equity := e.Equity(); equity != 10000*money.Euro+p.PnL() {
+		t.Fatalf("Unexpected equity %s", equity)
+	}
+	if executions := e.Executions(); len(executions) != 2 || executions[1].Realised != 500*money.Euro {
+		t.Fatalf("Unexpected executions %+v", executions)
+	}
+}
+
+func TestPosition_Add(t *testing.T) {
+	p := position{}
+	p.add(money.Bitcoin, 100*money.Euro)
+	p.add(money.Bitcoin, 200*money.Euro)
+	if p.averageCost() != 150*money.Euro {
+		t.Fatalf("Unexpected average cost %s", p.averageCost())
+	}
+	// sell 3, closing the long position and opening a short one
+	if realised := p.add(-3*money.Bitcoin, 170*money.Euro); realised != 40*money.Euro {
+		t.Fatalf("Unexpected realised %s", realised)
+	}
+	if p.amount != -money.Bitcoin || p.averageCost() != 170*money.Euro || p.unrealised(160*money.Euro) != 10*money.Euro {
+		t.Fatalf("Unexpected position %+v", p)
+	}
+	if realised := p.add(money.Bitcoin, 180*money.Euro); realised != -10*money.Euro || p.amount != 0 || p.cost != 0 {
+		t.Fatalf("Unexpected position %+v after realising %s", p, realised)
+	}
+	if p.realised != 30*money.Euro {
+		t.Fatalf("Unexpected total realised %s", p.realised)
+	}
+}
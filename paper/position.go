@@ -0,0 +1,117 @@
+package paper
+
+import (
+	"time"
+
+	"github.com/resc/rescbits/bl3papi"
+	"github.com/resc/rescbits/money"
+)
+
+type (
+	// Execution is a single fill of an order
+	Execution struct {
+		Time    time.Time
+		OrderId int64
+		Market  string
+		// Type is the order type, bid or ask
+		Type   string
+		Amount money.Amount
+		Price  money.Price
+		// Fee is the fee paid in the fee currency of the order
+		Fee bl3papi.Value
+		// FeeEur is the fee valued in EUR at the fill price
+		FeeEur money.Price
+		// Maker is true if the order was resting in the book, false if it took liquidity
+		Maker bool
+		// Realised is the profit or loss of the part of the position this fill closed, fees excluded
+		Realised money.Price
+	}
+
+	// Position is the BTC bought minus the BTC sold by the paper trades, valued with the average cost method
+	Position struct {
+		Market string
+		// Amount is positive when long and negative when short
+		Amount money.Amount
+		// AverageCost is the average price of the open position
+		AverageCost money.Price
+		// Mark is the price the position is valued at, the last trade or the mid price
+		Mark money.Price
+		// Realised is the profit or loss of the closed trades, fees excluded
+		Realised money.Price
+		// Unrealised is the profit or loss of the open position at the mark price
+		Unrealised money.Price
+		// Fees are the total fees paid, valued in EUR
+		Fees money.Price
+	}
+
+	// position tracks the cost basis of the open position
+	position struct {
+		amount   money.Amount
+		cost     money.Price // the cost of the open position, always positive
+		realised money.Price
+		fees     money.Price
+	}
+)
+
+// PnL returns the realised plus unrealised profit or loss minus the fees
+func (p Position) PnL() money.Price {
+	return p.Realised + p.Unrealised - p.Fees
+}
+
+// add books a buy (positive amount) or sell (negative amount) at price and returns the realised profit or loss
+func (p *position) add(amount money.Amount, price money.Price) money.Price {
+	if amount == 0 {
+		return 0
+	}
+	if p.amount == 0 || amount.Sign() == p.amount.Sign() {
+		p.amount += amount
+		p.cost += price.Total(amount.Abs(), money.RoundHalfUp)
+		return 0
+	}
+
+	// the trade closes (a part of) the position
+	closed := amount.Abs().Min(p.amount.Abs())
+	basis := p.cost.MulDiv(int64(closed), int64(p.amount.Abs()), money.RoundHalfUp)
+	proceeds := price.Total(closed, money.RoundHalfUp)
+	realised := proceeds - basis
+	if p.amount < 0 {
+		realised = basis - proceeds
+	}
+	p.realised += realised
+	p.cost -= basis
+	if p.amount > 0 {
+		p.amount -= closed
+	} else {
+		p.amount += closed
+	}
+
+	// the rest opens a position on the other side
+	if rest := amount.Abs() - closed; rest > 0 {
+		p.amount = rest
+		if amount < 0 {
+			p.amount = -rest
+		}
+		p.cost = price.Total(rest, money.RoundHalfUp)
+	}
+	if p.amount == 0 {
+		p.cost = 0
+	}
+	return realised
+}
+
+// unrealised returns the profit or loss of the open position at the mark price
+func (p *position) unrealised(mark money.Price) money.Price {
+	if p.amount == 0 || mark == 0 {
+		return 0
+	}
+	value := mark.Total(p.amount.Abs(), money.RoundHalfUp)
+	if p.amount > 0 {
+		return value - p.cost
+	}
+	return p.cost - value
+}
+
+// averageCost returns the average price of the open position
+func (p *position) averageCost() money.Price {
+	return money.AveragePrice(p.cost, p.amount.Abs(), money.RoundHalfUp)
+}
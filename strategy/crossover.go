@@ -0,0 +1,119 @@
+package strategy
+
+import (
+	"errors"
+	"time"
+
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/candles"
+	"github.com/resc/rescbits/money"
+)
+
+type (
+	// Crossover is a long only moving average crossover strategy on the candle closes.
+	// It buys the amount at the market when the fast average crosses above the slow average,
+	// and sells the position when it crosses below.
+	Crossover struct {
+		fast    int
+		slow    int
+		amount  money.Amount
+		builder *candles.Builder
+
+		closes []money.Price // the last slow closes, oldest first
+		closed int           // the number of candles closed by the last update
+		above  int           // 1 when the fast average is above the slow average, -1 when below, 0 at the start
+	}
+)
+
+var _ Strategy = (*Crossover)(nil)
+
+// NewCrossover creates a crossover strategy on candles of the interval, with fast and slow the number of candles of the averages
+func NewCrossover(interval time.Duration, fast, slow int, amount money.Amount) (*Crossover, error) {
+	if fast <= 0 || slow <= fast {
+		return nil, errors.New("the averages need 0 < fast < slow candles")
+	}
+	if amount <= 0 {
+		return nil, errors.New("the amount should be positive")
+	}
+	c := &Crossover{fast: fast, slow: slow, amount: amount}
+	builder, err := candles.NewBuilder(interval, 0, c.onCandle)
+	if err != nil {
+		return nil, err
+	}
+	c.builder = builder
+	return c, nil
+}
+
+func (c *Crossover) Name() string {
+	return "crossover"
+}
+
+func (c *Crossover) OnTrade(a *Account, t *bl3pfeed.Trade) []Intent {
+	c.builder.AddTrade(t)
+	return c.signal(a)
+}
+
+func (c *Crossover) OnOrderBook(a *Account, b *bl3pfeed.Book) []Intent {
+	return nil
+}
+
+func (c *Crossover) OnTimer(a *Account) []Intent {
+	c.builder.Advance(a.Now)
+	return c.signal(a)
+}
+
+// Averages returns the fast and slow moving averages, ok is false until there are enough candles
+func (c *Crossover) Averages() (fast, slow money.Price, ok bool) {
+	if len(c.closes) < c.slow {
+		return 0, 0, false
+	}
+	return average(c.closes[len(c.closes)-c.fast:]), average(c.closes), true
+}
+
+func (c *Crossover) onCandle(candle candles.Candle) {
+	if candle.Close == 0 {
+		// an empty candle before the first trade
+		return
+	}
+	c.closes = append(c.closes, candle.Close)
+	if len(c.closes) > c.slow {
+		c.closes = c.closes[1:]
+	}
+	c.closed++
+}
+
+// signal returns the intents for the crossings of the candles closed since the last call
+func (c *Crossover) signal(a *Account) []Intent {
+	if c.closed == 0 {
+		return nil
+	}
+	c.closed = 0
+	fast, slow, ok := c.Averages()
+	if !ok || fast == slow {
+		return nil
+	}
+	above := 1
+	if fast < slow {
+		above = -1
+	}
+	crossed := c.above != 0 && above != c.above
+	c.above = above
+	if !crossed || len(a.Orders) > 0 {
+		return nil
+	}
+	if above > 0 && a.Position < c.amount {
+		return []Intent{Buy(c.amount-a.Position, 0, "fast average crossed above the slow average")}
+	}
+	if above < 0 && a.Position > 0 {
+		return []Intent{Sell(a.Position, 0, "fast average crossed below the slow average")}
+	}
+	return nil
+}
+
+func average(prices []money.Price) money.Price {
+	sum := money.Price(0)
+	for _, p := range prices {
+		sum += p
+	}
+	return sum.MulDiv(1, int64(len(prices)), money.RoundHalfUp)
+}
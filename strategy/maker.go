@@ -0,0 +1,98 @@
+package strategy
+
+import (
+	"errors"
+
+	"github.com/resc/rescbits/bl3papi"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+)
+
+type (
+	// SpreadMaker captures the spread by quoting a bid just above the best bid and an ask just below the best ask.
+	// It only quotes while the spread between its quotes is at least the min spread,
+	// and stops quoting the side that would take the inventory beyond the max inventory.
+	// The account needs both EUR and BTC to quote both sides.
+	SpreadMaker struct {
+		amount       money.Amount
+		minSpread    money.Price
+		tick         money.Price
+		maxInventory money.Amount
+	}
+)
+
+var _ Strategy = (*SpreadMaker)(nil)
+
+// NewSpreadMaker creates a maker that quotes amount on both sides, improving the best prices by tick.
+// A zero max inventory means no limit.
+func NewSpreadMaker(amount money.Amount, minSpread, tick money.Price, maxInventory money.Amount) (*SpreadMaker, error) {
+	if amount <= 0 {
+		return nil, errors.New("the amount should be positive")
+	}
+	if minSpread < 0 || tick <= 0 || maxInventory < 0 {
+		return nil, errors.New("invalid spread, tick or inventory")
+	}
+	return &SpreadMaker{amount: amount, minSpread: minSpread, tick: tick, maxInventory: maxInventory}, nil
+}
+
+func (m *SpreadMaker) Name() string {
+	return "spread-maker"
+}
+
+func (m *SpreadMaker) OnTrade(a *Account, t *bl3pfeed.Trade) []Intent {
+	return nil
+}
+
+func (m *SpreadMaker) OnTimer(a *Account) []Intent {
+	return nil
+}
+
+func (m *SpreadMaker) OnOrderBook(a *Account, b *bl3pfeed.Book) []Intent {
+	bids := a.OrdersOf(bl3papi.TypeBid)
+	asks := a.OrdersOf(bl3papi.TypeAsk)
+	bestAsk, bestBid, ok := b.Best()
+	if !ok {
+		intents := m.quote(bids, false, 0, Buy)
+		return append(intents, m.quote(asks, false, 0, Sell)...)
+	}
+
+	// keep our quote when it's the best price, otherwise improve the best price
+	bid := bestBid.Price + m.tick
+	if owns(bids, bestBid.Price) {
+		bid = bestBid.Price
+	}
+	ask := bestAsk.Price - m.tick
+	if owns(asks, bestAsk.Price) {
+		ask = bestAsk.Price
+	}
+	worthIt := ask-bid >= m.minSpread && ask > bid
+
+	intents := m.quote(bids, worthIt && (m.maxInventory == 0 || a.Position+m.amount <= m.maxInventory), bid, Buy)
+	return append(intents, m.quote(asks, worthIt && (m.maxInventory == 0 || a.Position-m.amount >= -m.maxInventory), ask, Sell)...)
+}
+
+// quote keeps one order at the price and cancels the others, it places a new order if there's none at the price
+func (m *SpreadMaker) quote(orders []bl3papi.Order, wanted bool, price money.Price, place func(money.Amount, money.Price, string) Intent) []Intent {
+	intents := make([]Intent, 0)
+	kept := false
+	for _, o := range orders {
+		if wanted && !kept && o.Price == price {
+			kept = true
+			continue
+		}
+		intents = append(intents, Cancel(o.Id, "requote"))
+	}
+	if wanted && !kept {
+		intents = append(intents, place(m.amount, price, "quote"))
+	}
+	return intents
+}
+
+func owns(orders []bl3papi.Order, price money.Price) bool {
+	for _, o := range orders {
+		if o.Price == price {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,400 @@
+package strategy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/resc/rescbits/bl3papi"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultInterval is the default time between timer ticks
+	DefaultInterval = 5 * time.Second
+	// shutdownTimeout is the time the runner takes to cancel its orders when it stops
+	shutdownTimeout = 10 * time.Second
+)
+
+type (
+	// Runner feeds a strategy and executes its intents on one market.
+	// Subscribe it to the trades and orderbook channels of the market with TradesQueue and OrderBookQueue and call Run,
+	// or call the Handle methods from a single goroutine to drive it with a simulated clock.
+	Runner struct {
+		strategy Strategy
+		trader   bl3papi.Trader
+		market   string
+		base     string // the currency bought and sold, e.g. BTC
+		quote    string // the currency of the prices, e.g. EUR
+		limits   Limits
+		interval time.Duration
+		now      func() time.Time
+
+		events  chan event
+		stopped chan struct{}
+
+		book      *bl3pfeed.Book
+		lastTrade money.Price
+		position  money.Amount
+		orders    []*trackedOrder // in order of placement
+		day       string
+		dayEquity money.Price
+		halted    bool
+	}
+
+	trackedOrder struct {
+		bl3papi.Order
+		cancelling bool
+	}
+
+	// event is a feed message for the Run loop
+	event struct {
+		trade  *bl3pfeed.Trade
+		book   *bl3pfeed.OrderBook
+		closed bool
+		err    error
+	}
+)
+
+var (
+	// TradesQueue and OrderBookQueue are the queue options for the subscriptions of a runner.
+	// The runner calls the api while it handles the messages, so a slow call drops the oldest trades
+	// and all but the latest order book instead of blocking the feed for its other listeners.
+	TradesQueue    = bl3pfeed.QueueOptions{Size: 1000, Overflow: bl3pfeed.OverflowDropOldest}
+	OrderBookQueue = bl3pfeed.QueueOptions{Size: 1, Overflow: bl3pfeed.OverflowConflate}
+)
+
+var (
+	_ bl3pfeed.TradesFeedListener    = (*Runner)(nil)
+	_ bl3pfeed.OrderBookFeedListener = (*Runner)(nil)
+)
+
+// NewRunner creates a runner for the strategy on the market, the orders are placed with trader
+func NewRunner(s Strategy, trader bl3papi.Trader, market string, limits Limits) (*Runner, error) {
+	if s == nil {
+		return nil, errors.New("s Strategy is nil")
+	}
+	if trader == nil {
+		return nil, errors.New("trader bl3papi.Trader is nil")
+	}
+	if len(market) != 6 {
+		return nil, fmt.Errorf("invalid market: %s", market)
+	}
+	if err := limits.validate(); err != nil {
+		return nil, err
+	}
+	return &Runner{
+		strategy: s,
+		trader:   trader,
+		market:   market,
+		base:     market[:3],
+		quote:    market[3:],
+		limits:   limits,
+		interval: DefaultInterval,
+		now:      time.Now,
+		events:   make(chan event),
+		stopped:  make(chan struct{}),
+		book:     bl3pfeed.NewBook(),
+	}, nil
+}
+
+// SetInterval sets the time between timer ticks, the orders are refreshed on every tick
+func (r *Runner) SetInterval(interval time.Duration) {
+	r.interval = interval
+}
+
+// SetClock sets the clock for the Account and the daily loss limit, the default is time.Now
+func (r *Runner) SetClock(now func() time.Time) {
+	r.now = now
+}
+
+// Position returns the BTC bought minus the BTC sold since the runner started, as of the last refresh
+func (r *Runner) Position() money.Amount {
+	return r.position
+}
+
+// Run feeds the strategy until ctx is done or the feed is closed, then it cancels the open orders.
+// It returns nil when ctx is done and the feed's error when the feed is closed.
+func (r *Runner) Run(ctx context.Context) error {
+	defer close(r.stopped)
+	log.Infof("Running strategy %s on %s", r.strategy.Name(), r.market)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := r.CancelAll(shutdownCtx); err != nil {
+			log.Errorf("Strategy %s could not cancel all orders: %v", r.strategy.Name(), err)
+		}
+		log.Infof("Strategy %s stopped with position %s BTC", r.strategy.Name(), r.position)
+	}()
+
+	r.HandleTimer(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-r.events:
+			switch {
+			case e.closed:
+				return e.err
+			case e.trade != nil:
+				r.HandleTrade(ctx, e.trade)
+			case e.book != nil:
+				r.HandleOrderBook(ctx, e.book)
+			}
+		case <-ticker.C:
+			r.HandleTimer(ctx)
+		}
+	}
+}
+
+// HandleTrade passes the trade to the strategy and executes its intents
+func (r *Runner) HandleTrade(ctx context.Context, t *bl3pfeed.Trade) {
+	r.lastTrade = t.Price
+	r.execute(ctx, r.strategy.OnTrade(r.account(), t))
+}
+
+// HandleOrderBook updates the book, passes it to the strategy and executes its intents
+func (r *Runner) HandleOrderBook(ctx context.Context, o *bl3pfeed.OrderBook) {
+	r.book.Update(o)
+	r.execute(ctx, r.strategy.OnOrderBook(r.account(), r.book))
+}
+
+// HandleTimer refreshes the orders, checks the daily loss limit and executes the intents of the strategy's timer
+func (r *Runner) HandleTimer(ctx context.Context) {
+	if err := r.refresh(ctx); err != nil {
+		log.Warnf("Strategy %s could not refresh its orders: %v", r.strategy.Name(), err)
+	}
+	r.execute(ctx, r.strategy.OnTimer(r.account()))
+}
+
+// CancelAll cancels the open orders and refreshes them to book the last fills
+func (r *Runner) CancelAll(ctx context.Context) error {
+	var err error
+	for _, o := range r.orders {
+		if o.cancelling {
+			continue
+		}
+		if e := r.trader.CancelOrder(ctx, r.market, o.Id); e != nil && err == nil {
+			err = e
+		}
+		o.cancelling = true
+	}
+	if e := r.refresh(ctx); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+func (r *Runner) FeedDisconnected(channel string, err error) {
+	log.Warnf("Strategy %s lost the %s feed: %v", r.strategy.Name(), channel, err)
+}
+
+func (r *Runner) FeedReconnected(channel string, attempts int) {
+	log.Infof("Strategy %s has the %s feed again after %d attempts", r.strategy.Name(), channel, attempts)
+}
+
+func (r *Runner) FeedClosed(channel string, err error) {
+	r.send(event{closed: true, err: err})
+}
+
+func (r *Runner) OnTrade(t *bl3pfeed.Trade) {
+	r.send(event{trade: t})
+}
+
+func (r *Runner) OnOrderBookChanged(o *bl3pfeed.OrderBook) {
+	r.send(event{book: o})
+}
+
+// send passes the event to the Run loop, it drops the event when the runner has stopped
+func (r *Runner) send(e event) {
+	select {
+	case r.events <- e:
+	case <-r.stopped:
+	}
+}
+
+func (r *Runner) account() *Account {
+	a := &Account{
+		Now:      r.now(),
+		Market:   r.market,
+		Position: r.position,
+		Orders:   make([]bl3papi.Order, 0, len(r.orders)),
+		Halted:   r.halted,
+	}
+	for _, o := range r.orders {
+		if !o.cancelling {
+			a.Orders = append(a.Orders, o.Order)
+		}
+	}
+	return a
+}
+
+// execute checks and executes the intents, the rejected and failed intents are logged
+func (r *Runner) execute(ctx context.Context, intents []Intent) {
+	for _, i := range intents {
+		if i.IsCancel() {
+			r.cancel(ctx, i)
+			continue
+		}
+		if err := r.check(i); err != nil {
+			log.Warnf("Strategy %s: rejected %s: %v", r.strategy.Name(), i, err)
+			continue
+		}
+		var id int64
+		var err error
+		if i.Price == 0 {
+			id, err = r.trader.PlaceMarketOrder(ctx, bl3papi.MarketOrder{Market: r.market, Type: i.Type, Amount: i.Amount})
+		} else {
+			id, err = r.trader.PlaceLimitOrder(ctx, bl3papi.LimitOrder{Market: r.market, Type: i.Type, Amount: i.Amount, Price: i.Price})
+		}
+		if err != nil {
+			log.Errorf("Strategy %s: could not %s: %v", r.strategy.Name(), i, err)
+			continue
+		}
+		log.Infof("Strategy %s: order %d: %s", r.strategy.Name(), id, i)
+		r.orders = append(r.orders, &trackedOrder{Order: bl3papi.Order{
+			Id:     id,
+			Market: r.market,
+			Type:   i.Type,
+			Status: bl3papi.StatusPending,
+			Date:   r.now(),
+			Amount: i.Amount,
+			Price:  i.Price,
+		}})
+	}
+}
+
+func (r *Runner) cancel(ctx context.Context, i Intent) {
+	for _, o := range r.orders {
+		if o.Id != i.OrderId {
+			continue
+		}
+		if o.cancelling {
+			return
+		}
+		if err := r.trader.CancelOrder(ctx, r.market, o.Id); err != nil {
+			log.Errorf("Strategy %s: could not %s: %v", r.strategy.Name(), i, err)
+			return
+		}
+		log.Infof("Strategy %s: %s", r.strategy.Name(), i)
+		o.cancelling = true
+		return
+	}
+	log.Warnf("Strategy %s: rejected %s: not an open order", r.strategy.Name(), i)
+}
+
+// check returns an error if the intent breaks a risk limit
+func (r *Runner) check(i Intent) error {
+	if i.Type != bl3papi.TypeBid && i.Type != bl3papi.TypeAsk {
+		return fmt.Errorf("invalid order type: %s", i.Type)
+	}
+	if i.Amount <= 0 || i.Price < 0 {
+		return errors.New("invalid amount or price")
+	}
+	if r.halted {
+		return errors.New("trading halted after hitting the daily loss limit")
+	}
+	if r.limits.MaxOrder > 0 && i.Amount > r.limits.MaxOrder {
+		return fmt.Errorf("the amount is above the max order size of %s", r.limits.MaxOrder)
+	}
+	if r.limits.MaxPosition > 0 {
+		bids, asks := money.Amount(0), money.Amount(0)
+		for _, o := range r.orders {
+			remaining := o.Amount - o.TotalAmount
+			if o.Type == bl3papi.TypeBid {
+				bids += remaining
+			} else {
+				asks += remaining
+			}
+		}
+		if i.Type == bl3papi.TypeBid && r.position+bids+i.Amount > r.limits.MaxPosition {
+			return fmt.Errorf("the position could go above the max position of %s", r.limits.MaxPosition)
+		}
+		if i.Type == bl3papi.TypeAsk && r.position-asks-i.Amount < -r.limits.MaxPosition {
+			return fmt.Errorf("the position could go below the max short position of %s", r.limits.MaxPosition)
+		}
+	}
+	return nil
+}
+
+// refresh books the fills of the orders since the last refresh and checks the daily loss limit
+func (r *Runner) refresh(ctx context.Context) error {
+	orders := r.orders[:0]
+	var err error
+	for _, o := range r.orders {
+		status, e := r.trader.OrderStatus(ctx, r.market, o.Id)
+		if e != nil {
+			if err == nil {
+				err = e
+			}
+			orders = append(orders, o)
+			continue
+		}
+		filled := status.TotalAmount - o.TotalAmount
+		if o.Type == bl3papi.TypeBid {
+			r.position += filled
+		} else {
+			r.position -= filled
+		}
+		if filled > 0 {
+			log.Infof("Strategy %s: order %d filled %s BTC at %s EUR, position %s BTC", r.strategy.Name(), o.Id, filled, status.AverageCost, r.position)
+		}
+		o.Order = status
+		if !status.IsDone() {
+			orders = append(orders, o)
+		}
+	}
+	for i := len(orders); i < len(r.orders); i++ {
+		r.orders[i] = nil
+	}
+	r.orders = orders
+	if err != nil {
+		return err
+	}
+	return r.checkDailyLoss(ctx)
+}
+
+// checkDailyLoss halts trading and cancels the orders when the equity dropped more than the daily loss limit
+func (r *Runner) checkDailyLoss(ctx context.Context) error {
+	if r.limits.MaxDailyLoss == 0 {
+		return nil
+	}
+	mark := r.lastTrade
+	if mark == 0 {
+		mark, _ = r.book.MidPrice()
+	}
+	if mark == 0 {
+		return nil
+	}
+	info, err := r.trader.Info(ctx)
+	if err != nil {
+		return err
+	}
+	base, _ := info.Wallet(r.base)
+	quote, _ := info.Wallet(r.quote)
+	equity := quote.Balance.Price() + mark.Total(base.Balance.Amount(), money.RoundHalfUp)
+
+	if day := r.now().UTC().Format("2006-01-02"); day != r.day {
+		if r.halted {
+			log.Infof("Strategy %s: trading resumes on %s", r.strategy.Name(), day)
+		}
+		r.day, r.dayEquity, r.halted = day, equity, false
+	}
+	if loss := r.dayEquity - equity; !r.halted && loss > r.limits.MaxDailyLoss {
+		log.Errorf("Strategy %s: lost %s EUR today, halting until tomorrow", r.strategy.Name(), loss)
+		r.halted = true
+		for _, o := range r.orders {
+			if !o.cancelling {
+				r.cancel(ctx, Cancel(o.Id, "daily loss limit"))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package strategy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bl3papi"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+	"github.com/resc/rescbits/paper"
+)
+
+type (
+	// scriptedStrategy returns the queued intents on the next call and records what it saw
+	scriptedStrategy struct {
+		intents  []Intent
+		accounts []*Account
+		trades   chan *bl3pfeed.Trade
+	}
+)
+
+func newScriptedStrategy() *scriptedStrategy {
+	return &scriptedStrategy{trades: make(chan *bl3pfeed.Trade, 10)}
+}
+
+func (s *scriptedStrategy) Name() string { return "scripted" }
+
+func (s *scriptedStrategy) OnTrade(a *Account, t *bl3pfeed.Trade) []Intent {
+	s.trades <- t
+	return s.next(a)
+}
+
+func (s *scriptedStrategy) OnOrderBook(a *Account, b *bl3pfeed.Book) []Intent { return s.next(a) }
+func (s *scriptedStrategy) OnTimer(a *Account) []Intent                       { return s.next(a) }
+
+func (s *scriptedStrategy) next(a *Account) []Intent {
+	s.accounts = append(s.accounts, a)
+	intents := s.intents
+	s.intents = nil
+	return intents
+}
+
+func (s *scriptedStrategy) last() *Account {
+	return s.accounts[len(s.accounts)-1]
+}
+
+func testBook() *bl3pfeed.OrderBook {
+	return &bl3pfeed.OrderBook{
+		Market: "BTCEUR",
+		Asks:   []*bl3pfeed.Order{{Price: 8000 * money.Euro, Amount: 2 * money.Bitcoin}},
+		Bids:   []*bl3pfeed.Order{{Price: 7990 * money.Euro, Amount: 2 * money.Bitcoin}},
+	}
+}
+
+// newTestRunner creates a runner that trades on a paper exchange with 10000 EUR and the test book
+func newTestRunner(t *testing.T, limits Limits) (*Runner, *scriptedStrategy, *paper.Exchange) {
+	exchange, err := paper.NewExchange(paper.Config{Market: "BTCEUR", Eur: 10000 * money.Euro})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newScriptedStrategy()
+	r, err := NewRunner(s, exchange, "BTCEUR", limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchange.OnOrderBookChanged(testBook())
+	r.HandleOrderBook(context.Background(), testBook())
+	return r, s, exchange
+}
+
+func openOrders(t *testing.T, exchange *paper.Exchange) []bl3papi.Order {
+	orders, err := exchange.OpenOrders(context.Background(), "BTCEUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return orders
+}
+
+func TestNewRunner(t *testing.T) {
+	exchange, _ := paper.NewExchange(paper.Config{})
+	if _, err := NewRunner(nil, exchange, "BTCEUR", Limits{}); err == nil {
+		t.Error("Expected an error without a strategy")
+	}
+	if _, err := NewRunner(newScriptedStrategy(), nil, "BTCEUR", Limits{}); err == nil {
+		t.Error("Expected an error without a trader")
+	}
+	if _, err := NewRunner(newScriptedStrategy(), exchange, "BTCEUR", Limits{MaxOrder: -1}); err == nil {
+		t.Error("Expected an error for negative limits")
+	}
+	for _, market := range []string{"", "BT", "BTCEURO"} {
+		if _, err := NewRunner(newScriptedStrategy(), exchange, market, Limits{}); err == nil {
+			t.Errorf("Expected an error for market %q", market)
+		}
+	}
+}
+
+func TestRunner_Limits(t *testing.T) {
+	r, s, exchange := newTestRunner(t, Limits{MaxOrder: money.Bitcoin / 2, MaxPosition: money.Bitcoin})
+	ctx := context.Background()
+
+	s.intents = []Intent{
+		Buy(money.Bitcoin, 7000*money.Euro, "too large"),
+		Buy(money.Bitcoin/2, 7000*money.Euro, "first"),
+		Buy(money.Bitcoin/2, 7100*money.Euro, "second"),
+		Buy(money.Bitcoin/2, 7200*money.Euro, "beyond the max position"),
+		Sell(money.Bitcoin/2, 9000*money.Euro, "no BTC"),
+		Intent{Type: "buy", Amount: money.Bitcoin / 2, Reason: "invalid type"},
+	}
+	r.HandleTimer(ctx)
+	if orders := openOrders(t, exchange); len(orders) != 2 || orders[0].Price != 7000*money.Euro || orders[1].Price != 7100*money.Euro {
+		t.Fatalf("Unexpected orders %+v", orders)
+	}
+
+	// the account shows the orders, without the ones being cancelled
+	r.HandleTimer(ctx)
+	if a := s.last(); len(a.Orders) != 2 || a.Position != 0 || a.Market != "BTCEUR" {
+		t.Fatalf("Unexpected account %+v", a)
+	}
+	s.intents = []Intent{Cancel(s.last().Orders[0].Id, "test"), Cancel(42, "unknown")}
+	r.HandleTimer(ctx)
+	r.HandleTimer(ctx)
+	if a := s.last(); len(a.Orders) != 1 || a.Orders[0].Price != 7100*money.Euro {
+		t.Fatalf("Unexpected account %+v", a)
+	}
+
+	// fills count towards the position
+	trade := &bl3pfeed.Trade{Price: 7100 * money.Euro, Amount: money.Bitcoin}
+	exchange.OnTrade(trade)
+	r.HandleTrade(ctx, trade)
+	r.HandleTimer(ctx)
+	if r.Position() != money.Bitcoin/2 || len(s.last().Orders) != 0 {
+		t.Fatalf("Unexpected position %s with %+v", r.Position(), s.last())
+	}
+	s.intents = []Intent{Buy(money.Bitcoin/2, 7000*money.Euro, "up to the max position"), Buy(money.Satoshi, 7000*money.Euro, "beyond")}
+	r.HandleTimer(ctx)
+	if orders := openOrders(t, exchange); len(orders) != 1 {
+		t.Fatalf("Unexpected orders %+v", orders)
+	}
+}
+
+func TestRunner_DailyLoss(t *testing.T) {
+	r, s, exchange := newTestRunner(t, Limits{MaxDailyLoss: 100 * money.Euro})
+	ctx := context.Background()
+
+	s.intents = []Intent{Buy(money.Bitcoin, 0, "buy"), Sell(money.Bitcoin/2, 9000*money.Euro, "take profit")}
+	r.HandleTimer(ctx)
+	r.HandleTimer(ctx)
+	if r.Position() != money.Bitcoin || s.last().Halted {
+		t.Fatalf("Unexpected position %s, %+v", r.Position(), s.last())
+	}
+
+	// a loss of 200 EUR
+	trade := &bl3pfeed.Trade{Price: 7800 * money.Euro, Amount: money.Bitcoin}
+	exchange.OnTrade(trade)
+	r.HandleTrade(ctx, trade)
+	s.intents = []Intent{Buy(money.Bitcoin/10, 7000*money.Euro, "rejected")}
+	r.HandleTimer(ctx)
+	if !s.last().Halted || len(s.last().Orders) != 0 {
+		t.Fatalf("Expected a halted account without orders, got %+v", s.last())
+	}
+	if orders := openOrders(t, exchange); len(orders) != 0 {
+		t.Fatalf("Expected the orders to be cancelled, got %+v", orders)
+	}
+}
+
+func TestRunner_Run(t *testing.T) {
+	r, s, exchange := newTestRunner(t, Limits{})
+	r.SetInterval(10 * time.Millisecond)
+	s.intents = []Intent{Buy(money.Bitcoin, 7000*money.Euro, "resting")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Run(ctx) }()
+
+	r.OnTrade(&bl3pfeed.Trade{Price: 7995 * money.Euro, Amount: money.Bitcoin})
+	select {
+	case trade := <-s.trades:
+		if trade.Price != 7995*money.Euro {
+			t.Fatalf("Unexpected trade %+v", trade)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the trade")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the runner to stop")
+	}
+	if orders := openOrders(t, exchange); len(orders) != 0 {
+		t.Fatalf("Expected the orders to be cancelled on shutdown, got %+v", orders)
+	}
+	// events after the runner stopped are dropped
+	r.OnTrade(&bl3pfeed.Trade{})
+}
+
+func TestRunner_FeedClosed(t *testing.T) {
+	r, _, _ := newTestRunner(t, Limits{})
+	done := make(chan error)
+	go func() { done <- r.Run(context.Background()) }()
+
+	closed := errors.New("closed")
+	r.FeedClosed(bl3pfeed.ChannelTrades, closed)
+	select {
+	case err := <-done:
+		if err != closed {
+			t.Fatalf("Expected the feed error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the runner to stop")
+	}
+}
@@ -0,0 +1,116 @@
+package strategy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bl3papi"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+)
+
+func TestNewCrossover(t *testing.T) {
+	if _, err := NewCrossover(time.Minute, 3, 3, money.Bitcoin); err == nil {
+		t.Error("Expected an error when fast isn't faster than slow")
+	}
+	if _, err := NewCrossover(time.Minute, 2, 3, 0); err == nil {
+		t.Error("Expected an error without an amount")
+	}
+	if _, err := NewCrossover(0, 2, 3, money.Bitcoin); err == nil {
+		t.Error("Expected an error without an interval")
+	}
+}
+
+func TestCrossover(t *testing.T) {
+	c, err := NewCrossover(time.Minute, 2, 3, money.Bitcoin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := &Account{Market: "BTCEUR"}
+
+	// a trade per minute, every trade closes the candle of the previous one
+	trade := func(minute int, price money.Price) []Intent {
+		return c.OnTrade(a, &bl3pfeed.Trade{Date: start.Add(time.Duration(minute) * time.Minute).Unix(), Price: price * money.Euro, Amount: money.Bitcoin})
+	}
+	for i, price := range []money.Price{100, 100, 90, 80, 120} {
+		if intents := trade(i, price); len(intents) != 0 {
+			t.Fatalf("Unexpected intents %v at minute %d", intents, i)
+		}
+	}
+	if fast, slow, ok := c.Averages(); !ok || fast != 85*money.Euro || slow != 90*money.Euro {
+		t.Fatalf("Unexpected averages %s, %s", fast, slow)
+	}
+
+	// the close of 120 crosses the averages
+	intents := trade(5, 130)
+	if len(intents) != 1 || intents[0].Type != bl3papi.TypeBid || intents[0].Amount != money.Bitcoin || intents[0].Price != 0 {
+		t.Fatalf("Expected a market buy, got %v", intents)
+	}
+
+	a.Position = money.Bitcoin
+	if intents := trade(6, 50); len(intents) != 0 {
+		t.Fatalf("Unexpected intents %v", intents)
+	}
+	// the close of 50 crosses back, the timer closes the candle without a trade
+	a.Now = start.Add(8 * time.Minute)
+	intents = c.OnTimer(a)
+	if len(intents) != 1 || intents[0].Type != bl3papi.TypeAsk || intents[0].Amount != money.Bitcoin {
+		t.Fatalf("Expected a market sell, got %v", intents)
+	}
+}
+
+func testMakerBook(bids, asks []money.Price) *bl3pfeed.Book {
+	o := &bl3pfeed.OrderBook{Market: "BTCEUR"}
+	for _, p := range bids {
+		o.Bids = append(o.Bids, &bl3pfeed.Order{Price: p * money.Euro, Amount: money.Bitcoin})
+	}
+	for _, p := range asks {
+		o.Asks = append(o.Asks, &bl3pfeed.Order{Price: p * money.Euro, Amount: money.Bitcoin})
+	}
+	b := bl3pfeed.NewBook()
+	b.Update(o)
+	return b
+}
+
+func TestSpreadMaker(t *testing.T) {
+	m, err := NewSpreadMaker(money.Bitcoin/10, 5*money.Euro, money.Euro, money.Bitcoin/10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Account{Market: "BTCEUR"}
+
+	intents := m.OnOrderBook(a, testMakerBook([]money.Price{7990}, []money.Price{8010}))
+	if len(intents) != 2 || intents[0] != Buy(money.Bitcoin/10, 7991*money.Euro, "quote") || intents[1] != Sell(money.Bitcoin/10, 8009*money.Euro, "quote") {
+		t.Fatalf("Unexpected quotes %v", intents)
+	}
+
+	// our quotes are the best prices
+	a.Orders = []bl3papi.Order{
+		{Id: 1, Type: bl3papi.TypeBid, Amount: money.Bitcoin / 10, Price: 7991 * money.Euro},
+		{Id: 2, Type: bl3papi.TypeAsk, Amount: money.Bitcoin / 10, Price: 8009 * money.Euro},
+	}
+	if intents := m.OnOrderBook(a, testMakerBook([]money.Price{7991, 7990}, []money.Price{8009, 8010})); len(intents) != 0 {
+		t.Fatalf("Expected the quotes to be kept, got %v", intents)
+	}
+
+	// outbid
+	intents = m.OnOrderBook(a, testMakerBook([]money.Price{7995, 7991}, []money.Price{8009}))
+	if len(intents) != 2 || intents[0] != Cancel(1, "requote") || intents[1].Price != 7996*money.Euro {
+		t.Fatalf("Expected a requote, got %v", intents)
+	}
+
+	// the spread is too small
+	intents = m.OnOrderBook(a, testMakerBook([]money.Price{8000, 7991}, []money.Price{8004, 8009}))
+	if len(intents) != 2 || !intents[0].IsCancel() || !intents[1].IsCancel() {
+		t.Fatalf("Expected the quotes to be cancelled, got %v", intents)
+	}
+
+	// the inventory is full
+	a.Orders = nil
+	a.Position = money.Bitcoin / 10
+	intents = m.OnOrderBook(a, testMakerBook([]money.Price{7990}, []money.Price{8010}))
+	if len(intents) != 1 || intents[0].Type != bl3papi.TypeAsk {
+		t.Fatalf("Expected only an ask, got %v", intents)
+	}
+}
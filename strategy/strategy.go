@@ -0,0 +1,107 @@
+// Package strategy runs trading strategies on the BL3P feeds.
+// A Strategy reacts to trades, order book updates and timer ticks with order intents,
+// the Runner checks the intents against the risk limits and executes them with a bl3papi.Trader,
+// which is the live api client or a paper.Exchange.
+package strategy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/resc/rescbits/bl3papi"
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+)
+
+type (
+	// Strategy decides what to trade, the runner calls it from a single goroutine
+	Strategy interface {
+		Name() string
+		OnTrade(a *Account, t *bl3pfeed.Trade) []Intent
+		OnOrderBook(a *Account, b *bl3pfeed.Book) []Intent
+		OnTimer(a *Account) []Intent
+	}
+
+	// Account is the state of the strategy's orders when it's called
+	Account struct {
+		Now    time.Time
+		Market string
+		// Position is the BTC bought minus the BTC sold since the runner started
+		Position money.Amount
+		// Orders are the pending and open orders of the runner, without the orders it's cancelling
+		Orders []bl3papi.Order
+		// Halted is true when the daily loss limit was hit, new orders are rejected until the next day
+		Halted bool
+	}
+
+	// Intent is an order the strategy wants to place or cancel
+	Intent struct {
+		// OrderId is the order to cancel, zero for new orders
+		OrderId int64
+		// Type is bl3papi.TypeBid or bl3papi.TypeAsk
+		Type   string
+		Amount money.Amount
+		// Price is the limit price, zero for a market order
+		Price money.Price
+		// Reason is logged with the order
+		Reason string
+	}
+
+	// Limits are the risk limits the runner checks before placing an order, zero means no limit
+	Limits struct {
+		// MaxPosition is the largest long or short position the open orders may lead to
+		MaxPosition money.Amount
+		// MaxOrder is the largest amount of a single order
+		MaxOrder money.Amount
+		// MaxDailyLoss halts trading for the rest of the day when the equity drops this much below the start of the day
+		MaxDailyLoss money.Price
+	}
+)
+
+// Buy returns the intent to buy amount at the limit price, or at the market if price is zero
+func Buy(amount money.Amount, price money.Price, reason string) Intent {
+	return Intent{Type: bl3papi.TypeBid, Amount: amount, Price: price, Reason: reason}
+}
+
+// Sell returns the intent to sell amount at the limit price, or at the market if price is zero
+func Sell(amount money.Amount, price money.Price, reason string) Intent {
+	return Intent{Type: bl3papi.TypeAsk, Amount: amount, Price: price, Reason: reason}
+}
+
+// Cancel returns the intent to cancel the order
+func Cancel(id int64, reason string) Intent {
+	return Intent{OrderId: id, Reason: reason}
+}
+
+// IsCancel returns true if the intent cancels an order
+func (i Intent) IsCancel() bool {
+	return i.OrderId != 0
+}
+
+func (i Intent) String() string {
+	if i.IsCancel() {
+		return fmt.Sprintf("cancel order %d (%s)", i.OrderId, i.Reason)
+	}
+	if i.Price == 0 {
+		return fmt.Sprintf("%s %s BTC at the market (%s)", i.Type, i.Amount, i.Reason)
+	}
+	return fmt.Sprintf("%s %s BTC at %s EUR (%s)", i.Type, i.Amount, i.Price, i.Reason)
+}
+
+// OrdersOf returns the account's orders of the type, bl3papi.TypeBid or bl3papi.TypeAsk
+func (a *Account) OrdersOf(typ string) []bl3papi.Order {
+	orders := make([]bl3papi.Order, 0)
+	for _, o := range a.Orders {
+		if o.Type == typ {
+			orders = append(orders, o)
+		}
+	}
+	return orders
+}
+
+func (l Limits) validate() error {
+	if l.MaxPosition < 0 || l.MaxOrder < 0 || l.MaxDailyLoss < 0 {
+		return fmt.Errorf("negative risk limits: %+v", l)
+	}
+	return nil
+}
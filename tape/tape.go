@@ -0,0 +1,174 @@
+// Package tape computes rolling statistics of the trades of a market, like the VWAP and the buy/sell imbalance.
+package tape
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+)
+
+// DefaultLargest is the default number of largest trades of the statistics
+const DefaultLargest = 3
+
+type (
+	// Stats are the statistics of the trades in a window that ends at End
+	Stats struct {
+		Window time.Duration
+		End    time.Time
+		Count  int
+		Volume money.Amount
+		// Turnover is the EUR value of the volume
+		Turnover money.Price
+		// VWAP is the volume weighted average price, zero without volume
+		VWAP money.Price
+		// BuyVolume and SellVolume are the volumes of the trades where the buyer or the seller was the aggressor
+		BuyVolume  money.Amount
+		SellVolume money.Amount
+		// Largest are the largest trades, largest first
+		Largest []bl3pfeed.Trade
+	}
+
+	// Tape keeps the trades of the longest window and computes the statistics of every window, it's safe for concurrent use.
+	// It is a TradesFeedListener, so it can be subscribed to the trades feed.
+	Tape struct {
+		windows []time.Duration
+		largest int
+
+		lock   sync.RWMutex
+		trades []bl3pfeed.Trade // oldest first
+	}
+)
+
+var _ bl3pfeed.TradesFeedListener = (*Tape)(nil)
+
+// New creates a tape for the windows that keeps the given number of largest trades
+func New(largest int, windows ...time.Duration) (*Tape, error) {
+	if len(windows) == 0 {
+		return nil, errors.New("a tape needs at least one window")
+	}
+	if largest < 0 {
+		return nil, errors.New("largest should not be negative")
+	}
+	sorted := make([]time.Duration, len(windows))
+	copy(sorted, windows)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for _, w := range sorted {
+		if w < time.Second {
+			return nil, fmt.Errorf("window %s is shorter than the one second resolution of the trades", w)
+		}
+	}
+	return &Tape{windows: sorted, largest: largest}, nil
+}
+
+// Windows returns the windows, shortest first
+func (t *Tape) Windows() []time.Duration {
+	windows := make([]time.Duration, len(t.windows))
+	copy(windows, t.windows)
+	return windows
+}
+
+// AddTrade adds the trade and forgets the trades that are older than the longest window before the newest trade
+func (t *Tape) AddTrade(trade *bl3pfeed.Trade) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// trades mostly arrive in order, so search for the position from the end
+	i := len(t.trades)
+	for i > 0 && t.trades[i-1].Date > trade.Date {
+		i--
+	}
+	t.trades = append(t.trades, bl3pfeed.Trade{})
+	copy(t.trades[i+1:], t.trades[i:])
+	t.trades[i] = *trade
+
+	oldest := t.trades[len(t.trades)-1].Date - int64(t.windows[len(t.windows)-1]/time.Second)
+	n := 0
+	for n < len(t.trades) && t.trades[n].Date <= oldest {
+		n++
+	}
+	if n > 0 {
+		t.trades = append(t.trades[:0], t.trades[n:]...)
+	}
+}
+
+// Stats returns the statistics of every window ending at now, shortest window first
+func (t *Tape) Stats(now time.Time) []Stats {
+	stats := make([]Stats, 0, len(t.windows))
+	for _, w := range t.windows {
+		stats = append(stats, t.Window(now, w))
+	}
+	return stats
+}
+
+// Window returns the statistics of the trades after now minus the window up to and including now.
+// Windows longer than the longest window of the tape only have the trades of the longest window.
+func (t *Tape) Window(now time.Time, window time.Duration) Stats {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	s := Stats{Window: window, End: now}
+	from, to := now.Add(-window).Unix(), now.Unix()
+	for i := range t.trades {
+		trade := &t.trades[i]
+		if trade.Date <= from || trade.Date > to {
+			continue
+		}
+		s.add(trade, t.largest)
+	}
+	if s.Volume > 0 {
+		s.VWAP = money.AveragePrice(s.Turnover, s.Volume, money.RoundHalfUp)
+	}
+	return s
+}
+
+func (t *Tape) OnTrade(trade *bl3pfeed.Trade)                { t.AddTrade(trade) }
+func (t *Tape) FeedDisconnected(channel string, err error)   {}
+func (t *Tape) FeedReconnected(channel string, attempts int) {}
+func (t *Tape) FeedClosed(channel string, err error)         {}
+
+// Imbalance returns the buy volume minus the sell volume divided by the total volume,
+// 1 means only aggressive buyers and -1 only aggressive sellers
+func (s *Stats) Imbalance() float64 {
+	total := s.BuyVolume + s.SellVolume
+	if total == 0 {
+		return 0
+	}
+	return (s.BuyVolume - s.SellVolume).Float64() / total.Float64()
+}
+
+func (s *Stats) String() string {
+	return fmt.Sprintf("%s: %d trades, volume %s BTC (%s EUR), vwap %s EUR, buy %s BTC, sell %s BTC, imbalance %+.2f",
+		s.Window, s.Count, s.Volume.StringFixed(5), s.Turnover.StringFixed(2), s.VWAP.StringFixed(2),
+		s.BuyVolume.StringFixed(5), s.SellVolume.StringFixed(5), s.Imbalance())
+}
+
+func (s *Stats) add(trade *bl3pfeed.Trade, largest int) {
+	s.Count++
+	s.Volume += trade.Amount
+	s.Turnover += trade.Price.Total(trade.Amount, money.RoundHalfUp)
+	switch trade.Type {
+	case bl3pfeed.ActionBuy:
+		s.BuyVolume += trade.Amount
+	case bl3pfeed.ActionSell:
+		s.SellVolume += trade.Amount
+	}
+
+	// insert the trade in the largest trades, older trades stay ahead of equally large newer ones
+	i := len(s.Largest)
+	for i > 0 && s.Largest[i-1].Amount < trade.Amount {
+		i--
+	}
+	if i >= largest {
+		return
+	}
+	if len(s.Largest) < largest {
+		s.Largest = append(s.Largest, bl3pfeed.Trade{})
+	}
+	copy(s.Largest[i+1:], s.Largest[i:])
+	s.Largest[i] = *trade
+}
@@ -0,0 +1,89 @@
+package tape
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resc/rescbits/bl3pfeed"
+	"github.com/resc/rescbits/money"
+)
+
+var start = time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func trade(offset time.Duration, typ string, price money.Price, amount money.Amount) *bl3pfeed.Trade {
+	return &bl3pfeed.Trade{
+		Date:        start.Add(offset).Unix(),
+		Marketplace: "BTCEUR",
+		Price:       price,
+		Type:        typ,
+		Amount:      amount,
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(DefaultLargest); err == nil {
+		t.Error("expected an error without windows")
+	}
+	if _, err := New(-1, time.Minute); err == nil {
+		t.Error("expected an error for a negative number of largest trades")
+	}
+	if _, err := New(DefaultLargest, time.Millisecond); err == nil {
+		t.Error("expected an error for a window shorter than a second")
+	}
+	tape, err := New(DefaultLargest, time.Hour, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := tape.Windows(); len(w) != 2 || w[0] != time.Minute || w[1] != time.Hour {
+		t.Errorf("expected the windows shortest first, got %v", w)
+	}
+}
+
+func TestTape_Stats(t *testing.T) {
+	tape, _ := New(2, time.Minute, 5*time.Minute)
+	tape.AddTrade(trade(0, "buy", 8000*money.Euro, money.Bitcoin))
+	tape.AddTrade(trade(3*time.Minute, "sell", 7900*money.Euro, 2*money.Bitcoin))
+	tape.AddTrade(trade(4*time.Minute+30*time.Second, "buy", 8100*money.Euro, money.Bitcoin))
+	// out of order
+	tape.AddTrade(trade(4*time.Minute+10*time.Second, "sell", 8050*money.Euro, money.Bitcoin/2))
+
+	stats := tape.Stats(start.Add(5 * time.Minute))
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 windows, got %d", len(stats))
+	}
+	minute, five := stats[0], stats[1]
+
+	if minute.Window != time.Minute || minute.Count != 2 || minute.Volume != 3*money.Bitcoin/2 {
+		t.Errorf("unexpected 1m stats %s", &minute)
+	}
+	if minute.VWAP != 808333333 || minute.Turnover != 12125*money.Euro {
+		t.Errorf("unexpected 1m vwap %s turnover %s", minute.VWAP, minute.Turnover)
+	}
+	if imbalance := minute.Imbalance(); imbalance < 0.333 || imbalance > 0.334 {
+		t.Errorf("expected a 1m imbalance of 1/3, got %f", imbalance)
+	}
+
+	// the first trade is exactly 5 minutes old, so it's outside the window
+	if five.Count != 3 || five.Volume != 7*money.Bitcoin/2 || five.BuyVolume != money.Bitcoin || five.SellVolume != 5*money.Bitcoin/2 {
+		t.Errorf("unexpected 5m stats %s", &five)
+	}
+	if imbalance := five.Imbalance(); imbalance < -0.429 || imbalance > -0.428 {
+		t.Errorf("expected a 5m imbalance of -3/7, got %f", imbalance)
+	}
+	if len(five.Largest) != 2 || five.Largest[0].Amount != 2*money.Bitcoin || five.Largest[1].Price != 8100*money.Euro {
+		t.Errorf("unexpected largest trades %+v", five.Largest)
+	}
+}
+
+func TestTape_Prune(t *testing.T) {
+	tape, _ := New(DefaultLargest, time.Minute)
+	tape.AddTrade(trade(0, "buy", 8000*money.Euro, money.Bitcoin))
+	tape.AddTrade(trade(30*time.Second, "buy", 8000*money.Euro, money.Bitcoin))
+	tape.AddTrade(trade(90*time.Second, "buy", 8000*money.Euro, money.Bitcoin))
+	if len(tape.trades) != 1 {
+		t.Errorf("expected the trades older than the longest window to be forgotten, got %d trades", len(tape.trades))
+	}
+	if s := tape.Window(start.Add(10*time.Minute), time.Minute); s.Count != 0 || s.VWAP != 0 || s.Imbalance() != 0 {
+		t.Errorf("expected an empty window, got %s", &s)
+	}
+}